@@ -13,76 +13,245 @@ extern "C" {
 #define LOAD_LIBRARY(name) LoadLibrary(name)
 #define GET_FUNCTION GetProcAddress
 #define CLOSE_LIBRARY FreeLibrary
+#define LIBRARY_ERROR() "LoadLibrary or GetProcAddress failed"
 #else
 #include <dlfcn.h>
 #define LIBRARY_HANDLE void*
 #define LOAD_LIBRARY(name) dlopen(name, RTLD_LAZY)
 #define GET_FUNCTION dlsym
 #define CLOSE_LIBRARY dlclose
+#define LIBRARY_ERROR() dlerror()
 #endif
 
+
 typedef struct _DYLIB_HANDLE_ {
     LIBRARY_HANDLE handle;
+    int32_t abi_version; // 插件ABI版本, 加载时由plugin_info或abi_version确定, 默认为1
+
+    // 插件导出函数表, 加载时由resolve_library一次性解析, 未导出的函数为NULL
+    // 写入函数的返回值类型由abi_version决定, 所以这里统一保存为void*, 调用时再转换
+    void *login;
+    void *logout;
+    void *flush;
+    void *last_error;
+    void *write_rt_analog;
+    void *write_rt_digital;
+    void *write_rt_analog_list;
+    void *write_rt_digital_list;
+    void *write_his_analog;
+    void *write_his_digital;
+    void *write_static_analog;
+    void *write_static_digital;
+    void *read_rt_analog;
+    void *read_rt_digital;
+    void *read_his_analog;
+    void *read_his_digital;
+    void *write_rt_analog_async;
+    void *write_rt_digital_async;
+    void *write_his_analog_async;
+    void *write_his_digital_async;
 } DYLIB_HANDLE;
 
 DYLIB_HANDLE load_library(char *name) {
-    DYLIB_HANDLE handle = {LOAD_LIBRARY(name)};
+    DYLIB_HANDLE handle = {LOAD_LIBRARY(name), 1};
     return handle;
 }
 
-int close_library(DYLIB_HANDLE  handle) {
-    return CLOSE_LIBRARY(handle.handle);
+// 解析插件导出函数, 保存到函数表中, 之后的每次调用都不再查找函数
+void resolve_library(DYLIB_HANDLE *handle) {
+    handle->login = (void *) GET_FUNCTION(handle->handle, "login");
+    handle->logout = (void *) GET_FUNCTION(handle->handle, "logout");
+    handle->flush = (void *) GET_FUNCTION(handle->handle, "flush");
+    handle->last_error = (void *) GET_FUNCTION(handle->handle, "last_error");
+    handle->write_rt_analog = (void *) GET_FUNCTION(handle->handle, "write_rt_analog");
+    handle->write_rt_digital = (void *) GET_FUNCTION(handle->handle, "write_rt_digital");
+    handle->write_rt_analog_list = (void *) GET_FUNCTION(handle->handle, "write_rt_analog_list");
+    handle->write_rt_digital_list = (void *) GET_FUNCTION(handle->handle, "write_rt_digital_list");
+    handle->write_his_analog = (void *) GET_FUNCTION(handle->handle, "write_his_analog");
+    handle->write_his_digital = (void *) GET_FUNCTION(handle->handle, "write_his_digital");
+    handle->write_static_analog = (void *) GET_FUNCTION(handle->handle, "write_static_analog");
+    handle->write_static_digital = (void *) GET_FUNCTION(handle->handle, "write_static_digital");
+    handle->read_rt_analog = (void *) GET_FUNCTION(handle->handle, "read_rt_analog");
+    handle->read_rt_digital = (void *) GET_FUNCTION(handle->handle, "read_rt_digital");
+    handle->read_his_analog = (void *) GET_FUNCTION(handle->handle, "read_his_analog");
+    handle->read_his_digital = (void *) GET_FUNCTION(handle->handle, "read_his_digital");
+    handle->write_rt_analog_async = (void *) GET_FUNCTION(handle->handle, "write_rt_analog_async");
+    handle->write_rt_digital_async = (void *) GET_FUNCTION(handle->handle, "write_rt_digital_async");
+    handle->write_his_analog_async = (void *) GET_FUNCTION(handle->handle, "write_his_analog_async");
+    handle->write_his_digital_async = (void *) GET_FUNCTION(handle->handle, "write_his_digital_async");
+}
+
+// 获取最近一次加载动态库或查找函数失败的原因, 没有错误时返回NULL
+const char *library_error() {
+    return LIBRARY_ERROR();
+}
+
+// 查找插件导出的函数, 未导出时返回NULL
+void *dy_symbol(DYLIB_HANDLE *handle, char *name) {
+    return (void *) GET_FUNCTION(handle->handle, name);
+}
+
+// 获取插件信息, 优先调用plugin_info, 其次调用abi_version
+// 返回值: 2表示插件导出了plugin_info, 1表示只导出了abi_version, 0表示都未导出
+int dy_plugin_info(DYLIB_HANDLE *handle, PluginInfo *info) {
+    void (*plugin_info)(PluginInfo*) = (void (*)(PluginInfo*)) GET_FUNCTION(handle->handle, "plugin_info");
+    if (plugin_info != NULL) {
+        plugin_info(info);
+        info->vendor[sizeof(info->vendor) - 1] = '\0';
+        info->version[sizeof(info->version) - 1] = '\0';
+        return 2;
+    }
+    int32_t (*abi_version)() = (int32_t (*)()) GET_FUNCTION(handle->handle, "abi_version");
+    if (abi_version != NULL) {
+        info->abi_version = abi_version();
+        return 1;
+    }
+    info->abi_version = 1;
+    return 0;
+}
+
+int close_library(DYLIB_HANDLE *handle) {
+    return CLOSE_LIBRARY(handle->handle);
+}
+
+int dy_login(DYLIB_HANDLE *handle, char* param) {
+    return ((int (*)(char*)) handle->login)(param);
+}
+
+void dy_logout(DYLIB_HANDLE *handle) {
+    ((void (*)()) handle->logout)();
+}
+
+// 刷新插件缓存, 插件未导出flush时直接返回0
+int dy_flush(DYLIB_HANDLE *handle) {
+    if (handle->flush == NULL) {
+        return 0;
+    }
+    return ((int (*)()) handle->flush)();
+}
+
+// 获取插件最近一次写入失败的错误信息, 插件未导出last_error时返回0
+int dy_last_error(DYLIB_HANDLE *handle, char *buf, size_t len) {
+    if (handle->last_error == NULL || len == 0) {
+        return 0;
+    }
+    buf[0] = '\0';
+    ((void (*)(char*, size_t)) handle->last_error)(buf, len);
+    buf[len - 1] = '\0';
+    return 1;
 }
 
-int dy_login(DYLIB_HANDLE handle, char* param) {
-    int (*login)(char*) = (int (*)(char*)) GET_FUNCTION(handle.handle, "login");
-    return login(param);
+int dy_write_rt_analog(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int64_t time, Analog *analog, int64_t count, bool is_fast) {
+    if (handle->abi_version >= 2) {
+        return ((int (*)(int32_t, int64_t, int64_t, Analog*, int64_t, bool)) handle->write_rt_analog)(magic, unit_id, time, analog, count, is_fast);
+    }
+    ((void (*)(int32_t, int64_t, int64_t, Analog*, int64_t, bool)) handle->write_rt_analog)(magic, unit_id, time, analog, count, is_fast);
+    return 0;
 }
 
-void dy_logout(DYLIB_HANDLE handle) {
-    void (*logout)() = (void (*)()) GET_FUNCTION(handle.handle, "logout");
-    logout();
+int dy_write_rt_digital(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int64_t time, Digital *digital, int64_t count, bool is_fast) {
+    if (handle->abi_version >= 2) {
+        return ((int (*)(int32_t, int64_t, int64_t, Digital*, int64_t, bool)) handle->write_rt_digital)(magic, unit_id, time, digital, count, is_fast);
+    }
+    ((void (*)(int32_t, int64_t, int64_t, Digital*, int64_t, bool)) handle->write_rt_digital)(magic, unit_id, time, digital, count, is_fast);
+    return 0;
 }
 
-void dy_write_rt_analog(DYLIB_HANDLE handle, int32_t magic, int64_t unit_id, int64_t time, Analog *analog, int64_t count, bool is_fast) {
-    void (*write_rt_analog)(int32_t, int64_t, int64_t, Analog*, int64_t, bool) = (void (*)(int32_t, int64_t, int64_t, Analog*, int64_t, bool)) GET_FUNCTION(handle.handle, "write_rt_analog");
-    write_rt_analog(magic, unit_id, time, analog, count, is_fast);
+int dy_write_rt_analog_list(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int64_t *time, Analog **analog_array_array_ptr, int64_t *array_count, int64_t count) {
+    if (handle->abi_version >= 2) {
+        return ((int (*)(int32_t, int64_t, int64_t*, Analog**, int64_t*, int64_t)) handle->write_rt_analog_list)(magic, unit_id, time, analog_array_array_ptr, array_count, count);
+    }
+    ((void (*)(int32_t, int64_t, int64_t*, Analog**, int64_t*, int64_t)) handle->write_rt_analog_list)(magic, unit_id, time, analog_array_array_ptr, array_count, count);
+    return 0;
 }
 
-void dy_write_rt_digital(DYLIB_HANDLE handle, int32_t magic, int64_t unit_id, int64_t time, Digital *digital, int64_t count, bool is_fast) {
-    void (*write_rt_digital)(int64_t, int64_t, int64_t, Digital*, int64_t, bool) = (void (*)(int64_t, int64_t, int64_t, Digital*, int64_t, bool)) GET_FUNCTION(handle.handle, "write_rt_digital");
-    write_rt_digital(magic, unit_id, time, digital, count, is_fast);
+int dy_write_rt_digital_list(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int64_t *time, Digital **digital_array_array_ptr, int64_t *array_count, int64_t count) {
+    if (handle->abi_version >= 2) {
+        return ((int (*)(int32_t, int64_t, int64_t*, Digital**, int64_t*, int64_t)) handle->write_rt_digital_list)(magic, unit_id, time, digital_array_array_ptr, array_count, count);
+    }
+    ((void (*)(int32_t, int64_t, int64_t*, Digital**, int64_t*, int64_t)) handle->write_rt_digital_list)(magic, unit_id, time, digital_array_array_ptr, array_count, count);
+    return 0;
 }
 
-void dy_write_rt_analog_list(DYLIB_HANDLE handle, int32_t magic, int64_t unit_id, int64_t *time, Analog **analog_array_array_ptr, int64_t *array_count, int64_t count) {
-    void (*write_rt_analog_list)(int32_t, int64_t, int64_t*, Analog**, int64_t*, int64_t) = (void (*)(int32_t, int64_t, int64_t*, Analog**, int64_t*, int64_t)) GET_FUNCTION(handle.handle, "write_rt_analog_list");
-    write_rt_analog_list(magic, unit_id, time, analog_array_array_ptr, array_count, count);
+int dy_write_his_analog(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int64_t time, Analog *analog, int64_t count) {
+    if (handle->abi_version >= 2) {
+        return ((int (*)(int32_t, int64_t, int64_t, Analog*, int64_t)) handle->write_his_analog)(magic, unit_id, time, analog, count);
+    }
+    ((void (*)(int32_t, int64_t, int64_t, Analog*, int64_t)) handle->write_his_analog)(magic, unit_id, time, analog, count);
+    return 0;
 }
 
-void dy_write_rt_digital_list(DYLIB_HANDLE handle, int32_t magic, int64_t unit_id, int64_t *time, Digital **digital_array_array_ptr, int64_t *array_count, int64_t count) {
-    void (*write_rt_digital_list)(int32_t, int64_t, int64_t*, Digital**, int64_t*, int64_t) = (void (*)(int32_t, int64_t, int64_t*, Digital**, int64_t*, int64_t)) GET_FUNCTION(handle.handle, "write_rt_digital_list");
-    write_rt_digital_list(magic, unit_id, time, digital_array_array_ptr, array_count, count);
+int dy_write_his_digital(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int64_t time, Digital *digital, int64_t count) {
+    if (handle->abi_version >= 2) {
+        return ((int (*)(int32_t, int64_t, int64_t, Digital*, int64_t)) handle->write_his_digital)(magic, unit_id, time, digital, count);
+    }
+    ((void (*)(int32_t, int64_t, int64_t, Digital*, int64_t)) handle->write_his_digital)(magic, unit_id, time, digital, count);
+    return 0;
 }
 
+int dy_write_static_analog(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, StaticAnalog *static_analog, int64_t count, int64_t type) {
+    if (handle->abi_version >= 2) {
+        return ((int (*)(int32_t, int64_t, StaticAnalog*, int64_t, int64_t)) handle->write_static_analog)(magic, unit_id, static_analog, count, type);
+    }
+    ((void (*)(int32_t, int64_t, StaticAnalog*, int64_t, int64_t)) handle->write_static_analog)(magic, unit_id, static_analog, count, type);
+    return 0;
+}
+
+int dy_write_static_digital(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, StaticDigital *static_digital, int64_t count, int64_t type) {
+    if (handle->abi_version >= 2) {
+        return ((int (*)(int32_t, int64_t, StaticDigital*, int64_t, int64_t)) handle->write_static_digital)(magic, unit_id, static_digital, count, type);
+    }
+    ((void (*)(int32_t, int64_t, StaticDigital*, int64_t, int64_t)) handle->write_static_digital)(magic, unit_id, static_digital, count, type);
+    return 0;
+}
+
+// 读取历史值的回调函数, 由写数程序(Go)导出
+extern void goReadAnalogCallback(uintptr_t ctx, int64_t time, Analog *analog);
+extern void goReadDigitalCallback(uintptr_t ctx, int64_t time, Digital *digital);
+
+int dy_read_rt_analog(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int32_t *p_num_array, int64_t count, bool is_fast, int64_t *time_out, Analog *out) {
+    return ((int (*)(int32_t, int64_t, int32_t*, int64_t, bool, int64_t*, Analog*)) handle->read_rt_analog)(magic, unit_id, p_num_array, count, is_fast, time_out, out);
+}
+
+int dy_read_rt_digital(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int32_t *p_num_array, int64_t count, bool is_fast, int64_t *time_out, Digital *out) {
+    return ((int (*)(int32_t, int64_t, int32_t*, int64_t, bool, int64_t*, Digital*)) handle->read_rt_digital)(magic, unit_id, p_num_array, count, is_fast, time_out, out);
+}
+
+int dy_read_his_analog(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int32_t p_num, int64_t start, int64_t end, uintptr_t ctx) {
+    return ((int (*)(int32_t, int64_t, int32_t, int64_t, int64_t, ReadAnalogCallback, uintptr_t)) handle->read_his_analog)(magic, unit_id, p_num, start, end, goReadAnalogCallback, ctx);
+}
+
+int dy_read_his_digital(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int32_t p_num, int64_t start, int64_t end, uintptr_t ctx) {
+    return ((int (*)(int32_t, int64_t, int32_t, int64_t, int64_t, ReadDigitalCallback, uintptr_t)) handle->read_his_digital)(magic, unit_id, p_num, start, end, goReadDigitalCallback, ctx);
+}
+
+// 异步写入完成的回调函数, 由写数程序(Go)导出
+extern void goWriteCallback(uintptr_t ctx, int64_t request_id, int status);
+
+int dy_write_rt_analog_async(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int64_t time, Analog *analog, int64_t count, bool is_fast, int64_t request_id, uintptr_t ctx) {
+    return ((int (*)(int32_t, int64_t, int64_t, Analog*, int64_t, bool, int64_t, WriteCallback, uintptr_t)) handle->write_rt_analog_async)(magic, unit_id, time, analog, count, is_fast, request_id, goWriteCallback, ctx);
+}
+
+int dy_write_rt_digital_async(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int64_t time, Digital *digital, int64_t count, bool is_fast, int64_t request_id, uintptr_t ctx) {
+    return ((int (*)(int32_t, int64_t, int64_t, Digital*, int64_t, bool, int64_t, WriteCallback, uintptr_t)) handle->write_rt_digital_async)(magic, unit_id, time, digital, count, is_fast, request_id, goWriteCallback, ctx);
+}
 
-void dy_write_his_analog(DYLIB_HANDLE handle, int32_t magic, int64_t unit_id, int64_t time, Analog *analog, int64_t count) {
-    void (*write_his_analog)(int32_t, int64_t, int64_t, Analog*, int64_t) = (void (*)(int32_t, int64_t, int64_t, Analog*, int64_t)) GET_FUNCTION(handle.handle, "write_his_analog");
-    write_his_analog(magic, unit_id, time, analog, count);
+int dy_write_his_analog_async(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int64_t time, Analog *analog, int64_t count, int64_t request_id, uintptr_t ctx) {
+    return ((int (*)(int32_t, int64_t, int64_t, Analog*, int64_t, int64_t, WriteCallback, uintptr_t)) handle->write_his_analog_async)(magic, unit_id, time, analog, count, request_id, goWriteCallback, ctx);
 }
 
-void dy_write_his_digital(DYLIB_HANDLE handle, int32_t magic, int64_t unit_id, int64_t time, Digital *digital, int64_t count) {
-    void (*write_his_digital)(int32_t, int64_t, int64_t, Digital*, int64_t) = (void (*)(int32_t, int64_t, int64_t, Digital*, int64_t)) GET_FUNCTION(handle.handle, "write_his_digital");
-    write_his_digital(magic, unit_id, time, digital, count);
+int dy_write_his_digital_async(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int64_t time, Digital *digital, int64_t count, int64_t request_id, uintptr_t ctx) {
+    return ((int (*)(int32_t, int64_t, int64_t, Digital*, int64_t, int64_t, WriteCallback, uintptr_t)) handle->write_his_digital_async)(magic, unit_id, time, digital, count, request_id, goWriteCallback, ctx);
 }
 
-void dy_write_static_analog(DYLIB_HANDLE handle, int32_t magic, int64_t unit_id, StaticAnalog *static_analog, int64_t count, int64_t type) {
-    void (*write_static_analog)(int32_t, int64_t, StaticAnalog*, int64_t, int64_t) = (void (*)(int32_t, int64_t, StaticAnalog*, int64_t, int64_t)) GET_FUNCTION(handle.handle, "write_static_analog");
-    write_static_analog(magic, unit_id, static_analog, count, type);
+// 空调用, 参数与dy_write_rt_analog相同, 但不调用插件, 用于测量写数程序调用插件的额外开销
+int dy_nop_write_rt_analog(DYLIB_HANDLE *handle, int32_t magic, int64_t unit_id, int64_t time, Analog *analog, int64_t count, bool is_fast) {
+    return 0;
 }
 
-void dy_write_static_digital(DYLIB_HANDLE handle, int32_t magic, int64_t unit_id, StaticDigital *static_digital, int64_t count, int64_t type) {
-    void (*write_static_digital)(int32_t, int64_t, StaticDigital*, int64_t, int64_t) = (void (*)(int32_t, int64_t, StaticDigital*, int64_t, int64_t)) GET_FUNCTION(handle.handle, "write_static_digital");
-    write_static_digital(magic, unit_id, static_digital, count, type);
+// 按函数名查找write_rt_analog, 用于测量每次调用都查找函数的开销
+int dy_lookup_write_rt_analog(DYLIB_HANDLE *handle) {
+    return GET_FUNCTION(handle->handle, "write_rt_analog") == NULL;
 }
 
 
@@ -90,4 +259,4 @@ void dy_write_static_digital(DYLIB_HANDLE handle, int32_t magic, int64_t unit_id
 }
 #endif
 
-#endif // _C_PLUGIN_H_
\ No newline at end of file
+#endif // _C_PLUGIN_H_
@@ -3,6 +3,23 @@
 
 #include <stdint.h>
 #include <stdbool.h>
+#include <stddef.h>
+
+// 插件ABI版本
+// * 1: 写入函数没有返回值, 写数程序无法感知写入失败
+// * 2: 写入函数返回int状态码, 0表示成功, 非0表示失败, 并且可以导出last_error获取错误信息
+// 备注: 写数程序优先通过plugin_info, 其次通过abi_version函数判断插件的ABI版本, 两者都未导出的插件按版本1处理
+#define WRITE_PLUGIN_ABI_VERSION 2
+
+// 插件能力位, 插件通过plugin_info声明自己支持的能力
+// 写数程序加载插件时会校验声明的能力对应的函数是否全部导出, 并且拒绝执行插件不支持的命令
+#define PLUGIN_CAP_REALTIME   (1 << 0) // 写实时值: write_rt_analog, write_rt_digital
+#define PLUGIN_CAP_LIST_WRITE (1 << 1) // 批量写实时值: write_rt_analog_list, write_rt_digital_list
+#define PLUGIN_CAP_HISTORY    (1 << 2) // 写历史值: write_his_analog, write_his_digital
+#define PLUGIN_CAP_STATIC     (1 << 3) // 写静态值: write_static_analog, write_static_digital
+#define PLUGIN_CAP_READ       (1 << 4) // 读取数据: read_rt_analog, read_rt_digital, read_his_analog, read_his_digital
+#define PLUGIN_CAP_FLUSH      (1 << 5) // 刷新缓存: flush
+#define PLUGIN_CAP_ASYNC      (1 << 6) // 异步写入: write_rt_analog_async, write_rt_digital_async, write_his_analog_async, write_his_digital_async
 
 //
 // global_id是一个全局唯一的ID, 格式如下:
@@ -86,6 +103,30 @@ typedef struct _StaticDigital_ {
     char unit[32];      // UNIT, 32Byte
 } StaticDigital;
 
+// 插件ABI版本, v2及以上的插件必须导出此函数, 并返回 WRITE_PLUGIN_ABI_VERSION
+int32_t abi_version();
+
+// 插件信息结构
+typedef struct _PluginInfo_ {
+    int32_t abi_version;   // 插件ABI版本, 填写 WRITE_PLUGIN_ABI_VERSION
+    char vendor[64];       // 厂商名称
+    char version[32];      // 插件版本
+    uint64_t capabilities; // 能力位, PLUGIN_CAP_* 按位或
+} PluginInfo;
+
+// 获取插件信息(可选)
+// info: 由写数程序分配并清零, 插件填写各个字段
+// 备注: 未导出此函数的插件, 写数程序会根据插件导出的函数推断能力位
+void plugin_info(PluginInfo *info);
+
+// 获取最近一次写入失败的错误信息(可选)
+// buf: 错误信息缓冲区, 由写数程序分配
+// len: 缓冲区长度, 插件写入的错误信息(包含结尾的'\0')不能超过此长度
+// 备注: 只有写入函数返回非0时, 写数程序才会调用此接口
+// 备注: 多个机组的写入会在不同线程上并发调用写入函数, 写数程序在调用写入函数的同一个线程上调用此接口,
+//       插件应按线程保存错误信息(例如C11的_Thread_local或C++的thread_local), 保存在全局变量中会取到其他线程的错误
+void last_error(char *buf, size_t len);
+
 // 登陆数据库
 // param是命令行向login传递的参数, 如果参数为空则param为NULL
 int login(char *param);
@@ -93,6 +134,12 @@ int login(char *param);
 // 登出数据库
 void logout();
 
+// 刷新插件缓存的数据(可选), 把插件内部缓存的数据全部写入数据库
+// 写数程序在每个写入阶段结束时(logout之前)调用, 也可以通过--flush_every每写入N个断面调用一次
+// flush的耗时单独统计, 不计入写入函数的耗时
+// 返回值: 0表示刷新成功, 非0表示刷新失败
+int flush();
+
 // 写实时模拟量
 // magic: 魔数, 用于标记测试数据集
 // unit_id: 机组ID
@@ -100,7 +147,8 @@ void logout();
 // analog_array_ptr: 指向模拟量数组的指针
 // count: 数组长度
 // is_fast: 当为true时表示写快采点, 当为false时表示写普通点
-void write_rt_analog(int32_t magic, int64_t unit_id, int64_t time, Analog *analog_array_ptr, int64_t count, bool is_fast);
+// 返回值: 0表示写入成功, 非0表示写入失败
+int write_rt_analog(int32_t magic, int64_t unit_id, int64_t time, Analog *analog_array_ptr, int64_t count, bool is_fast);
 
 // 写实时数字量
 // magic: 魔数, 用于标记测试数据集
@@ -109,7 +157,8 @@ void write_rt_analog(int32_t magic, int64_t unit_id, int64_t time, Analog *analo
 // digital_array_ptr: 指向数字量数组的指针
 // count: 数组长度
 // is_fast: 当为true时表示写快采点, 当为false时表示写普通点
-void write_rt_digital(int32_t magic, int64_t unit_id, int64_t time, Digital *digital_array_ptr, int64_t count, bool is_fast);
+// 返回值: 0表示写入成功, 非0表示写入失败
+int write_rt_digital(int32_t magic, int64_t unit_id, int64_t time, Digital *digital_array_ptr, int64_t count, bool is_fast);
 
 // 批量写实时模拟量
 // magic: 魔数, 用于标记测试数据集
@@ -118,8 +167,9 @@ void write_rt_digital(int32_t magic, int64_t unit_id, int64_t time, Digital *dig
 // time: 时间列表, 包含count个时间
 // analog_array_array_ptr: 模拟量断面数组, 包含count个断面的模拟量
 // array_count: 每个断面中包含值的数量
+// 返回值: 0表示写入成功, 非0表示写入失败
 // 备注: 只有写快采点的时候会调用此接口
-void write_rt_analog_list(int32_t magic, int64_t unit_id, int64_t *time, Analog **analog_array_array_ptr, int64_t *array_count, int64_t count);
+int write_rt_analog_list(int32_t magic, int64_t unit_id, int64_t *time, Analog **analog_array_array_ptr, int64_t *array_count, int64_t count);
 
 // 批量写实时数字量
 // magic: 魔数, 用于标记测试数据集
@@ -128,8 +178,9 @@ void write_rt_analog_list(int32_t magic, int64_t unit_id, int64_t *time, Analog
 // time: 时间列表, 包含count个时间
 // analog_array_array_ptr: 数字量断面数组, 包含count个断面的数字量
 // array_count: 每个断面中包含值的数量
+// 返回值: 0表示写入成功, 非0表示写入失败
 // 备注: 只有写快采点的时候会调用此接口
-void write_rt_digital_list(int32_t magic, int64_t unit_id, int64_t *time, Digital **digital_array_array_ptr, int64_t *array_count, int64_t count);
+int write_rt_digital_list(int32_t magic, int64_t unit_id, int64_t *time, Digital **digital_array_array_ptr, int64_t *array_count, int64_t count);
 
 // 写历史模拟量
 // magic: 魔数, 用于标记测试数据集
@@ -137,7 +188,8 @@ void write_rt_digital_list(int32_t magic, int64_t unit_id, int64_t *time, Digita
 // time: 断面时间戳
 // analog_array_ptr: 指向模拟量数组的指针
 // count: 数组长度
-void write_his_analog(int32_t magic, int64_t unit_id, int64_t time, Analog *analog_array_ptr, int64_t count);
+// 返回值: 0表示写入成功, 非0表示写入失败
+int write_his_analog(int32_t magic, int64_t unit_id, int64_t time, Analog *analog_array_ptr, int64_t count);
 
 // 写历史数字量
 // magic: 魔数, 用于标记测试数据集
@@ -145,7 +197,8 @@ void write_his_analog(int32_t magic, int64_t unit_id, int64_t time, Analog *anal
 // time: 断面时间戳
 // digital_array_ptr: 指向数字量数组的指针
 // count: 数组长度
-void write_his_digital(int32_t magic, int64_t unit_id, int64_t time, Digital *digital_array_ptr, int64_t count);
+// 返回值: 0表示写入成功, 非0表示写入失败
+int write_his_digital(int32_t magic, int64_t unit_id, int64_t time, Digital *digital_array_ptr, int64_t count);
 
 // 写静态模拟量
 // magic: 魔数, 用于标记测试数据集
@@ -153,7 +206,8 @@ void write_his_digital(int32_t magic, int64_t unit_id, int64_t time, Digital *di
 // static_analog_array_ptr: 指向静态模拟量数组的指针
 // count: 数组长度
 // type: 数据类型, 通过命令行传递, 0代表实时快采集点, 1代表实时普通点, 2代表历史普通点
-void write_static_analog(int32_t magic, int64_t unit_id, StaticAnalog *static_analog_array_ptr, int64_t count, int64_t type);
+// 返回值: 0表示写入成功, 非0表示写入失败
+int write_static_analog(int32_t magic, int64_t unit_id, StaticAnalog *static_analog_array_ptr, int64_t count, int64_t type);
 
 // 写静态数字量
 // magic: 魔数, 用于标记测试数据集
@@ -161,7 +215,78 @@ void write_static_analog(int32_t magic, int64_t unit_id, StaticAnalog *static_an
 // static_digital_array_ptr: 指向静态数字量数组的指针
 // count: 数组长度
 // type: 数据类型, 通过命令行传递, 0代表实时快采集点, 1代表实时普通点, 2代表历史普通点
-void write_static_digital(int32_t magic, int64_t unit_id, StaticDigital *static_digital_array_ptr, int64_t count, int64_t type);
+// 返回值: 0表示写入成功, 非0表示写入失败
+int write_static_digital(int32_t magic, int64_t unit_id, StaticDigital *static_digital_array_ptr, int64_t count, int64_t type);
+
+// 读取历史模拟量的回调函数, 每读取到一个值调用一次
+// ctx: 写数程序传递给read_his_analog的上下文, 插件原样传回
+// time: 值的时间戳
+// analog: 读取到的值, 只在回调期间有效
+typedef void (*ReadAnalogCallback)(uintptr_t ctx, int64_t time, Analog *analog);
+
+// 读取历史数字量的回调函数, 每读取到一个值调用一次
+// ctx: 写数程序传递给read_his_digital的上下文, 插件原样传回
+// time: 值的时间戳
+// digital: 读取到的值, 只在回调期间有效
+typedef void (*ReadDigitalCallback)(uintptr_t ctx, int64_t time, Digital *digital);
+
+// 读实时模拟量快照(可选, PLUGIN_CAP_READ)
+// magic: 魔数, 用于标记测试数据集
+// unit_id: 机组ID
+// p_num_array: 需要读取的P_NUM数组
+// count: 数组长度
+// is_fast: 当为true时表示读快采点, 当为false时表示读普通点
+// time_out: 由写数程序分配的长度为count的数组, 初始值为-1, 插件按p_num_array的顺序填写值的时间戳, 没有值时保持-1
+// out: 由写数程序分配的长度为count的数组, 插件按p_num_array的顺序填写读取到的值
+// 返回值: 0表示读取成功, 非0表示读取失败
+int read_rt_analog(int32_t magic, int64_t unit_id, int32_t *p_num_array, int64_t count, bool is_fast, int64_t *time_out, Analog *out);
+
+// 读实时数字量快照(可选, PLUGIN_CAP_READ)
+// 参数含义同read_rt_analog
+int read_rt_digital(int32_t magic, int64_t unit_id, int32_t *p_num_array, int64_t count, bool is_fast, int64_t *time_out, Digital *out);
+
+// 读历史模拟量(可选, PLUGIN_CAP_READ)
+// magic: 魔数, 用于标记测试数据集
+// unit_id: 机组ID
+// p_num: 需要读取的P_NUM
+// start: 开始时间(包含)
+// end: 结束时间(包含)
+// callback: 按时间顺序对每个值调用一次
+// ctx: 回调函数的上下文, 原样传递给callback
+// 返回值: 0表示读取成功, 非0表示读取失败
+int read_his_analog(int32_t magic, int64_t unit_id, int32_t p_num, int64_t start, int64_t end, ReadAnalogCallback callback, uintptr_t ctx);
+
+// 读历史数字量(可选, PLUGIN_CAP_READ)
+// 参数含义同read_his_analog
+int read_his_digital(int32_t magic, int64_t unit_id, int32_t p_num, int64_t start, int64_t end, ReadDigitalCallback callback, uintptr_t ctx);
+
+// 异步写入完成的回调函数, 数据库确认写入(或写入失败)后由插件调用, 每个请求只能调用一次
+// ctx: 写数程序传递给异步写入函数的上下文, 插件原样传回
+// request_id: 写数程序传递给异步写入函数的请求ID
+// status: 0表示写入成功, 非0表示写入失败
+// 备注: 可以在任意线程中调用
+typedef void (*WriteCallback)(uintptr_t ctx, int64_t request_id, int status);
+
+// 异步写实时模拟量(可选, PLUGIN_CAP_ASYNC), 写数程序通过--async开启
+// 参数含义同write_rt_analog
+// request_id: 请求ID, 调用callback时原样传回
+// callback: 数据库确认写入后调用
+// ctx: 回调函数的上下文, 原样传递给callback
+// 返回值: 0表示提交成功, 非0表示提交失败(提交失败时不能再调用callback)
+// 备注: analog_array_ptr只在函数返回前有效, 插件需要在返回前复制数据
+int write_rt_analog_async(int32_t magic, int64_t unit_id, int64_t time, Analog *analog_array_ptr, int64_t count, bool is_fast, int64_t request_id, WriteCallback callback, uintptr_t ctx);
+
+// 异步写实时数字量(可选, PLUGIN_CAP_ASYNC)
+// 参数含义同write_rt_analog_async
+int write_rt_digital_async(int32_t magic, int64_t unit_id, int64_t time, Digital *digital_array_ptr, int64_t count, bool is_fast, int64_t request_id, WriteCallback callback, uintptr_t ctx);
+
+// 异步写历史模拟量(可选, PLUGIN_CAP_ASYNC)
+// 参数含义同write_rt_analog_async
+int write_his_analog_async(int32_t magic, int64_t unit_id, int64_t time, Analog *analog_array_ptr, int64_t count, int64_t request_id, WriteCallback callback, uintptr_t ctx);
+
+// 异步写历史数字量(可选, PLUGIN_CAP_ASYNC)
+// 参数含义同write_rt_analog_async
+int write_his_digital_async(int32_t magic, int64_t unit_id, int64_t time, Digital *digital_array_ptr, int64_t count, int64_t request_id, WriteCallback callback, uintptr_t ctx);
 
 #ifdef __cplusplus
 }
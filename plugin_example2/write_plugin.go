@@ -107,6 +107,19 @@ func login(param *C.char) C.int {
 //export logout
 func logout() {
 	//fmt.Println("等待数据库退出......")
+	flush()
+	// 等待线程池执行完毕
+	wg.Wait()
+	threadPool.Release()
+	sessionPool.Close()
+	//endTime = time.Now().UnixMilli()
+	//fmt.Println("登出数据库，结束程序，耗时" + fmt.Sprint(endTime-startTime) + "ms")
+}
+
+//export flush
+func flush() C.int {
+	// 等待线程池中已经提交的写入完成, flush返回时之前写入的数据都已经落库
+	wg.Wait()
 	if tabletHisAnalog[1] != nil {
 		// 插入剩下的历史模拟量数据
 		if tabletHisAnalog[1].RowSize > 0 {
@@ -177,12 +190,7 @@ func logout() {
 			rtFastDigitalCount = 0
 		}
 	}
-	// 等待线程池执行完毕
-	wg.Wait()
-	threadPool.Release()
-	sessionPool.Close()
-	//endTime = time.Now().UnixMilli()
-	//fmt.Println("登出数据库，结束程序，耗时" + fmt.Sprint(endTime-startTime) + "ms")
+	return 0
 }
 
 type Analog struct {
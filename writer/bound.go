@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 有界写入(--duration, --max_sections, --start_time, --end_time)
+// 写入默认在输入文件读完(EOF)或收到中断信号时结束, 有界写入在读取和调度流水线中提前结束输入, 与EOF走同一条平滑退出路径, 统计结果完整:
+// * --start_time/--end_time 只写入断面时间(输入文件中的TIME, 不含 --time_base 和循环回放的偏移)在窗口内的断面, 超过 end_time 后结束本轮读取
+// * --max_sections 每个读取协程最多发送的断面数量(快采点、普通点分别计数, 循环回放时累计各轮), 达到后停止读取
+// * --duration 从开始写入时计时, 到期后读取协程停止读取, 调度器不再调度新的断面(开环模式下发布协程停止发布, 已发布的断面写完后结束)
+// static_write 写入的静态数据没有断面时间, 整个文件一次写入, 不支持有界写入
+
+// BoundCollector 有界写入的配置, 以及提前结束的原因
+type BoundCollector struct {
+	Duration    time.Duration // 写入时长, 为0时不限制
+	MaxSections int64         // 每个读取协程最多发送的断面数量, 为0时不限制
+	Start       int64         // 断面时间窗口的开始时间(毫秒, 包含)
+	End         int64         // 断面时间窗口的结束时间(毫秒, 包含)
+
+	once     sync.Once
+	deadline time.Time
+	expired  chan struct{}
+	mu       sync.Mutex
+	reached  []string
+}
+
+var GlobalBound = &BoundCollector{Start: math.MinInt64, End: math.MaxInt64, expired: make(chan struct{})}
+
+// ParseSectionTime 解析 --start_time/--end_time, 毫秒时间戳或RFC3339格式的时间
+func ParseSectionTime(name string, value string) (int64, error) {
+	if t, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("--%v 应为毫秒时间戳或 RFC3339 格式的时间(例如 2024-07-20T08:00:00+08:00): %v", name, value)
+	}
+	return t.UnixMilli(), nil
+}
+
+// Set 设置并检查有界写入的参数, startTime/endTime 为空时不限制
+func (bc *BoundCollector) Set(duration time.Duration, maxSections int64, startTime string, endTime string) error {
+	if duration < 0 {
+		return fmt.Errorf("--duration 不能小于0: %v", duration)
+	}
+	if maxSections < 0 {
+		return fmt.Errorf("--max_sections 不能小于0: %v", maxSections)
+	}
+	bc.Duration = duration
+	bc.MaxSections = maxSections
+	if startTime != "" {
+		start, err := ParseSectionTime("start_time", startTime)
+		if err != nil {
+			return err
+		}
+		bc.Start = start
+	}
+	if endTime != "" {
+		end, err := ParseSectionTime("end_time", endTime)
+		if err != nil {
+			return err
+		}
+		bc.End = end
+	}
+	if bc.Start > bc.End {
+		return fmt.Errorf("--start_time(%v) 不能晚于 --end_time(%v)", bc.Start, bc.End)
+	}
+	return nil
+}
+
+// Enabled 是否有界写入
+func (bc *BoundCollector) Enabled() bool {
+	return bc.Duration > 0 || bc.MaxSections > 0 || bc.Start != math.MinInt64 || bc.End != math.MaxInt64
+}
+
+// Begin 开始写入, 第一次调用时开始计时, 每个写入协程开始写入前调用
+func (bc *BoundCollector) Begin() {
+	bc.once.Do(func() {
+		if bc.Duration <= 0 {
+			return
+		}
+		bc.deadline = time.Now().Add(bc.Duration)
+		time.AfterFunc(bc.Duration, func() {
+			bc.Reach(fmt.Sprintf("达到写入时长 --duration=%v", bc.Duration))
+			close(bc.expired)
+		})
+	})
+}
+
+// Done 返回一个在写入时长到期时关闭的通道
+func (bc *BoundCollector) Done() chan struct{} {
+	return bc.expired
+}
+
+// Expired 写入时长是否已经到期, 按到期时间判断, 计划时间等于到期时间的断面不再写入
+func (bc *BoundCollector) Expired() bool {
+	return !bc.deadline.IsZero() && !time.Now().Before(bc.deadline)
+}
+
+// Reach 记录提前结束的原因, 统计结果中输出, 相同的原因(例如循环回放的每一轮)只记录一次
+func (bc *BoundCollector) Reach(reason string) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	for _, r := range bc.reached {
+		if r == reason {
+			return
+		}
+	}
+	log.Println("有界写入: ", reason)
+	bc.reached = append(bc.reached, reason)
+}
+
+// Print 输出有界写入的配置和提前结束的原因, 不是有界写入时不输出
+func (bc *BoundCollector) Print() {
+	if !bc.Enabled() {
+		return
+	}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	duration, maxSections, start, end := "不限制", "不限制", "不限制", "不限制"
+	if bc.Duration > 0 {
+		duration = bc.Duration.String()
+	}
+	if bc.MaxSections > 0 {
+		maxSections = strconv.FormatInt(bc.MaxSections, 10)
+	}
+	if bc.Start != math.MinInt64 {
+		start = strconv.FormatInt(bc.Start, 10)
+	}
+	if bc.End != math.MaxInt64 {
+		end = strconv.FormatInt(bc.End, 10)
+	}
+	reached := "没有达到限制"
+	if len(bc.reached) != 0 {
+		reached = strings.Join(bc.reached, ", ")
+	}
+	log.Printf("有界写入 - 写入时长: %v, 最多断面数量: %v, 断面时间窗口: [%v, %v], 结束原因: %v\n", duration, maxSections, start, end, reached)
+}
+
+// DrainSections 丢弃缓存队列中剩余的断面直到队列关闭, 读取协程收到停止信号后关闭队列
+func DrainSections(ch chan Section) {
+	for range ch {
+	}
+}
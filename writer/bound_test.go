@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseSectionTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "0", want: 0},
+		{value: "1721454092945", want: 1721454092945},
+		{value: "-1000", want: -1000},
+		{value: "2024-07-20T08:00:00+08:00", want: 1721433600000},
+		{value: "2024-07-20T00:00:00.5Z", want: 1721433600500},
+		{value: "2024-07-20", wantErr: true},
+		{value: "now", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSectionTime("start_time", tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseSectionTime(%q) = %v, %v, want %v, error: %v", tt.value, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBoundCollectorSet(t *testing.T) {
+	tests := []struct {
+		name        string
+		duration    time.Duration
+		maxSections int64
+		start, end  string
+		wantErr     bool
+		enabled     bool
+		wantStart   int64
+		wantEnd     int64
+	}{
+		{name: "unbounded", wantStart: math.MinInt64, wantEnd: math.MaxInt64},
+		{name: "duration", duration: time.Minute, enabled: true, wantStart: math.MinInt64, wantEnd: math.MaxInt64},
+		{name: "max sections", maxSections: 10, enabled: true, wantStart: math.MinInt64, wantEnd: math.MaxInt64},
+		{name: "window", start: "1000", end: "2024-07-20T08:00:00+08:00", enabled: true, wantStart: 1000, wantEnd: 1721433600000},
+		{name: "start only", start: "1000", enabled: true, wantStart: 1000, wantEnd: math.MaxInt64},
+		{name: "start equals end", start: "1000", end: "1000", enabled: true, wantStart: 1000, wantEnd: 1000},
+		{name: "start after end", start: "2000", end: "1000", wantErr: true},
+		{name: "negative duration", duration: -time.Second, wantErr: true},
+		{name: "negative max sections", maxSections: -1, wantErr: true},
+		{name: "bad end time", end: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := &BoundCollector{Start: math.MinInt64, End: math.MaxInt64, expired: make(chan struct{})}
+			err := bc.Set(tt.duration, tt.maxSections, tt.start, tt.end)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set = %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if bc.Enabled() != tt.enabled || bc.Start != tt.wantStart || bc.End != tt.wantEnd {
+				t.Errorf("enabled, start, end = %v, %v, %v, want %v, %v, %v", bc.Enabled(), bc.Start, bc.End, tt.enabled, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestBoundCollectorDuration(t *testing.T) {
+	bc := &BoundCollector{Start: math.MinInt64, End: math.MaxInt64, expired: make(chan struct{})}
+	if err := bc.Set(20*time.Millisecond, 0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if bc.Expired() {
+		t.Fatal("expired before Begin")
+	}
+	bc.Begin()
+	bc.Begin()
+	select {
+	case <-bc.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done was not closed after the duration")
+	}
+	if !bc.Expired() {
+		t.Error("not expired after Done was closed")
+	}
+	if len(bc.reached) != 1 {
+		t.Errorf("reached = %v, want one reason", bc.reached)
+	}
+}
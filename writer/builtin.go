@@ -0,0 +1,170 @@
+package main
+
+// #include "write_plugin.h"
+import "C"
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 内置插件, 用于测量写数程序自身的开销(CSV解析、GlobalID初始化、协程分发等)
+// --plugin=builtin:null   所有写入直接返回, 不做任何工作
+// --plugin=builtin:memcpy 把每次写入的数据复制一份并逐字节读取, 模拟插件最少需要的数据拷贝
+// 统计结果可以作为各个命令和模式的基准值, 与数据库插件的结果对比
+
+// BuiltinPluginPrefix 内置插件路径前缀
+const BuiltinPluginPrefix = "builtin:"
+
+// BuiltinCaps 内置插件支持的能力
+const BuiltinCaps = PluginCapRealtime | PluginCapListWrite | PluginCapHistory | PluginCapStatic | PluginCapFlush | PluginCapAsync
+
+// BuiltinWriter 内置插件
+type BuiltinWriter struct {
+	name  string
+	touch bool          // 为true时复制并逐字节读取写入的数据
+	sink  atomic.Uint64 // 逐字节读取的结果, 避免读取被编译器优化掉
+	bufs  sync.Pool     // 复制数据的缓冲区(*[]byte), 多个机组并发写入时各自取一个, 写入后放回复用
+}
+
+var _ Writer = (*BuiltinWriter)(nil)
+var _ AsyncWriter = (*BuiltinWriter)(nil)
+var _ NopWriter = (*BuiltinWriter)(nil)
+
+// IsBuiltinPlugin 判断插件路径是否为内置插件
+func IsBuiltinPlugin(path string) bool {
+	return strings.HasPrefix(path, BuiltinPluginPrefix)
+}
+
+// NewBuiltinWriter 根据插件路径创建内置插件, 例如 builtin:null
+func NewBuiltinWriter(path string) (*BuiltinWriter, error) {
+	name := strings.TrimPrefix(path, BuiltinPluginPrefix)
+	switch name {
+	case "null":
+		return &BuiltinWriter{name: name}, nil
+	case "memcpy":
+		return &BuiltinWriter{name: name, touch: true}, nil
+	default:
+		return nil, fmt.Errorf("未知的内置插件: %v, 支持的内置插件: builtin:null, builtin:memcpy", path)
+	}
+}
+
+// touchBytes 复制数据并逐字节读取, 复制到复用的缓冲区, 不在每次写入时分配内存
+func touchBytes[T any](bw *BuiltinWriter, data []T) {
+	if !bw.touch {
+		return
+	}
+	src := rawBytes(data)
+	bp, _ := bw.bufs.Get().(*[]byte)
+	if bp == nil {
+		bp = new([]byte)
+	}
+	if cap(*bp) < len(src) {
+		*bp = make([]byte, len(src))
+	}
+	buf := (*bp)[:len(src)]
+	copy(buf, src)
+	sum := uint64(0)
+	for _, b := range buf {
+		sum += uint64(b)
+	}
+	bw.sink.Add(sum)
+	bw.bufs.Put(bp)
+}
+
+// NopWriteRtAnalog 只做GlobalID初始化, 不复制数据
+func (bw *BuiltinWriter) NopWriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool) error {
+	InitAnalogGlobalID(magic, unitId, isFast, true, section)
+	return nil
+}
+
+func (bw *BuiltinWriter) Info() PluginInfo {
+	return PluginInfo{
+		ABIVersion:   int32(C.WRITE_PLUGIN_ABI_VERSION),
+		Vendor:       "builtin",
+		Version:      bw.name,
+		Capabilities: BuiltinCaps,
+		Declared:     true,
+	}
+}
+
+func (bw *BuiltinWriter) Login(param string) int {
+	return 0
+}
+
+func (bw *BuiltinWriter) Logout() {}
+
+func (bw *BuiltinWriter) Flush() error {
+	return nil
+}
+
+func (bw *BuiltinWriter) WriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool) error {
+	touchBytes(bw, section.Data)
+	return nil
+}
+
+func (bw *BuiltinWriter) WriteRtDigital(magic int32, unitId int64, section DigitalSection, isFast bool) error {
+	touchBytes(bw, section.Data)
+	return nil
+}
+
+func (bw *BuiltinWriter) WriteRtAnalogList(magic int32, unitId int64, sections []AnalogSection) error {
+	for i := range sections {
+		touchBytes(bw, sections[i].Data)
+	}
+	return nil
+}
+
+func (bw *BuiltinWriter) WriteRtDigitalList(magic int32, unitId int64, sections []DigitalSection) error {
+	for i := range sections {
+		touchBytes(bw, sections[i].Data)
+	}
+	return nil
+}
+
+func (bw *BuiltinWriter) WriteHisAnalog(magic int32, unitId int64, section AnalogSection) error {
+	touchBytes(bw, section.Data)
+	return nil
+}
+
+func (bw *BuiltinWriter) WriteHisDigital(magic int32, unitId int64, section DigitalSection) error {
+	touchBytes(bw, section.Data)
+	return nil
+}
+
+func (bw *BuiltinWriter) WriteStaticAnalog(magic int32, unitId int64, section StaticAnalogSection, typ int64) error {
+	touchBytes(bw, section.Data)
+	return nil
+}
+
+func (bw *BuiltinWriter) WriteStaticDigital(magic int32, unitId int64, section StaticDigitalSection, typ int64) error {
+	touchBytes(bw, section.Data)
+	return nil
+}
+
+// 异步写入在提交时立即确认, 确认耗时只包含写数程序的开销
+
+func (bw *BuiltinWriter) WriteRtAnalogAsync(magic int32, unitId int64, section AnalogSection, isFast bool, requestId int64) error {
+	touchBytes(bw, section.Data)
+	GlobalAcks.Ack(requestId, 0)
+	return nil
+}
+
+func (bw *BuiltinWriter) WriteRtDigitalAsync(magic int32, unitId int64, section DigitalSection, isFast bool, requestId int64) error {
+	touchBytes(bw, section.Data)
+	GlobalAcks.Ack(requestId, 0)
+	return nil
+}
+
+func (bw *BuiltinWriter) WriteHisAnalogAsync(magic int32, unitId int64, section AnalogSection, requestId int64) error {
+	touchBytes(bw, section.Data)
+	GlobalAcks.Ack(requestId, 0)
+	return nil
+}
+
+func (bw *BuiltinWriter) WriteHisDigitalAsync(magic int32, unitId int64, section DigitalSection, requestId int64) error {
+	touchBytes(bw, section.Data)
+	GlobalAcks.Ack(requestId, 0)
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+// #include "write_plugin.h"
+import "C"
+import "runtime/cgo"
+
+// 备注: 导出给C调用的函数不能和 dylib.h 放在同一个文件中(dylib.h 中包含函数定义), 所以单独放在此文件
+
+// goReadAnalogCallback 插件读取历史模拟量时的回调, ctx 是指向 func(int64, C.Analog) 的 cgo.Handle
+//
+//export goReadAnalogCallback
+func goReadAnalogCallback(ctx C.uintptr_t, time C.int64_t, analog *C.Analog) {
+	fn := cgo.Handle(ctx).Value().(func(int64, C.Analog))
+	fn(int64(time), *analog)
+}
+
+// goReadDigitalCallback 插件读取历史数字量时的回调, ctx 是指向 func(int64, C.Digital) 的 cgo.Handle
+//
+//export goReadDigitalCallback
+func goReadDigitalCallback(ctx C.uintptr_t, time C.int64_t, digital *C.Digital) {
+	fn := cgo.Handle(ctx).Value().(func(int64, C.Digital))
+	fn(int64(time), *digital)
+}
+
+// goWriteCallback 插件异步写入完成时的回调, 可能在插件的任意线程中调用
+//
+//export goWriteCallback
+func goWriteCallback(ctx C.uintptr_t, requestId C.int64_t, status C.int) {
+	GlobalAcks.Ack(int64(requestId), int(status))
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// 饱和搜索(capacity)
+// 逐步增加机组数量、每个断面的PNUM数量或断面速率, 找出数据库能够持续写入的最大PNUM速率:
+// * 写入前把输入文件的所有断面读入内存, 每一步按开环的固定速率(与 --open_loop 相同)循环写入这些断面, 持续 Hold 时间
+// * 循环写入时每一轮的断面时间加上数据集的时长(与 --loop 相同), 步骤之间时间继续递增
+// * 每一步结束时判断是否饱和: 错过截止时间的比例、结束时积压的断面数量、写入失败的比例超过阈值, 出现饱和时停止
+// * 超过 Hold 时间后留出按目标速率写完 MaxBacklog 个断面的时间, 之后仍在积压的断面不再写入, 计入未写入断面数量
+// * 输出每一步的统计表, 以及没有饱和的步骤中最大的PNUM速率
+
+const (
+	CapacityRampUnit   = "unit"   // 增加机组数量
+	CapacityRampPoints = "points" // 增加每个断面的PNUM数量
+	CapacityRampRate   = "rate"   // 增加每秒写入的断面数量
+)
+
+// CapacityConfig 饱和搜索的参数
+type CapacityConfig struct {
+	Type          int64 // 0代表实时快采集点, 1代表实时普通点, 2代表历史普通点
+	AnalogPath    string
+	DigitalPath   string
+	Magic         int32
+	RandomAv      bool
+	Ramp          string        // unit, points, rate
+	UnitNumber    int64         // 第一步的机组数量
+	Points        int           // 第一步每个断面的模拟量和数字量各自最多写入的PNUM数量, 为0时写入文件中的全部PNUM
+	Rate          float64       // 第一步每秒写入的断面数量
+	Step          float64       // 每一步增加的机组数量、PNUM数量或断面速率
+	Steps         int           // 最多的步骤数量
+	Hold          time.Duration // 每一步的持续时间
+	MaxMissRatio  float64       // 错过截止时间的断面比例超过该值时认为饱和
+	MaxBacklog    int           // 结束时积压的断面数量超过该值时认为饱和
+	MaxErrorRatio float64       // 写入失败的调用比例超过该值时认为饱和
+}
+
+// Validate 检查参数
+func (cfg *CapacityConfig) Validate() error {
+	if cfg.Type < 0 || cfg.Type > 2 {
+		return fmt.Errorf("type必须为0、1或2: %v", cfg.Type)
+	}
+	if cfg.AnalogPath == "" || cfg.DigitalPath == "" {
+		return fmt.Errorf("analog和digital都不能为空")
+	}
+	switch cfg.Ramp {
+	case CapacityRampUnit, CapacityRampPoints, CapacityRampRate:
+	default:
+		return fmt.Errorf("未知的ramp: %v, 支持: unit, points, rate", cfg.Ramp)
+	}
+	if cfg.UnitNumber < 1 {
+		return fmt.Errorf("unit_number必须大于0: %v", cfg.UnitNumber)
+	}
+	if cfg.Points < 0 || (cfg.Ramp == CapacityRampPoints && cfg.Points == 0) {
+		return fmt.Errorf("points不能小于0, ramp为points时必须大于0: %v", cfg.Points)
+	}
+	if cfg.Rate <= 0 {
+		return fmt.Errorf("rate必须大于0: %v", cfg.Rate)
+	}
+	if cfg.Step <= 0 || cfg.Steps < 1 {
+		return fmt.Errorf("step必须大于0, steps必须大于0")
+	}
+	if cfg.Hold <= 0 {
+		return fmt.Errorf("hold必须大于0: %v", cfg.Hold)
+	}
+	if cfg.MaxMissRatio < 0 || cfg.MaxMissRatio > 1 || cfg.MaxErrorRatio < 0 || cfg.MaxErrorRatio > 1 {
+		return fmt.Errorf("max_miss_ratio和max_error_ratio必须在[0,1]之间")
+	}
+	if cfg.MaxBacklog < 0 {
+		return fmt.Errorf("max_backlog不能小于0: %v", cfg.MaxBacklog)
+	}
+	return nil
+}
+
+// CapacityStep 一步的参数和结果
+type CapacityStep struct {
+	UnitNumber int64
+	Points     int     // 每个断面的模拟量和数字量各自最多写入的PNUM数量, 为0时不限制
+	Rate       float64 // 每秒写入的断面数量
+
+	Released    int64         // 发布的断面数量
+	Written     int64         // 写入的断面数量
+	Unwritten   int64         // 超过持续时间仍在积压, 没有写入的断面数量
+	Missed      int64         // 错过截止时间的断面数量
+	Calls       int64         // 插件调用次数(每个机组调用一次)
+	Failed      int64         // 写入失败的调用次数
+	PNumCount   int64         // 写入的PNUM数量(按机组累计)
+	MaxBacklog  int           // 最大积压断面数量
+	LastBacklog int           // 最后一次发布时的积压断面数量
+	P99         time.Duration // 开环延迟(写入完成时间 - 计划发布时间)的P99
+	Elapsed     time.Duration
+	Saturated   string // 饱和的原因, 为空时没有饱和
+	Interrupted bool   // 被中断, 没有写满持续时间
+}
+
+// TargetRate 目标PNUM速率
+func (step *CapacityStep) TargetRate(pNumPerSection float64) float64 {
+	return step.Rate * pNumPerSection * float64(step.UnitNumber)
+}
+
+// Result 每一步的结论, 被中断的步骤不参与比较
+func (step *CapacityStep) Result() string {
+	switch {
+	case step.Saturated != "":
+		return "饱和: " + step.Saturated
+	case step.Interrupted:
+		return "被中断"
+	default:
+		return "稳定"
+	}
+}
+
+// PNumRate 实际写入的PNUM速率
+func (step *CapacityStep) PNumRate() float64 {
+	if step.Elapsed <= 0 {
+		return 0
+	}
+	return float64(step.PNumCount) / step.Elapsed.Seconds()
+}
+
+// capacitySource 循环提供内存中的断面, 每一轮的断面时间加上数据集的时长
+type capacitySource struct {
+	sections []Section
+	span     int64
+	next     int64
+}
+
+func (cs *capacitySource) Next(points int) Section {
+	i := cs.next % int64(len(cs.sections))
+	shift := cs.next / int64(len(cs.sections)) * cs.span
+	cs.next++
+	section := cs.sections[i]
+	section.analog.Time += shift
+	section.digital.Time += shift
+	if points > 0 && len(section.analog.Data) > points {
+		section.analog.Data = section.analog.Data[:points]
+	}
+	if points > 0 && len(section.digital.Data) > points {
+		section.digital.Data = section.digital.Data[:points]
+	}
+	return section
+}
+
+// loadCapacitySections 把输入文件的所有断面读入内存
+func loadCapacitySections(analogPath string, digitalPath string) *capacitySource {
+	ch := make(chan Section, GlobalPeriodic.CacheSize)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go ReadCsv(wg, analogPath, digitalPath, ch, make(chan bool, 1))
+	cs := &capacitySource{sections: make([]Section, 0)}
+	for section := range ch {
+		cs.sections = append(cs.sections, section)
+	}
+	wg.Wait()
+	if len(cs.sections) != 0 {
+		cs.span = LoopSpan(cs.sections[0].Time(), cs.sections[len(cs.sections)-1].Time(), int64(len(cs.sections)))
+	}
+	return cs
+}
+
+// RunCapacity 饱和搜索, 插件需要已经登入
+func RunCapacity(cfg *CapacityConfig) {
+	t := time.Now()
+	source := loadCapacitySections(cfg.AnalogPath, cfg.DigitalPath)
+	if len(source.sections) == 0 {
+		log.Println("饱和搜索: 输入文件中没有断面")
+		return
+	}
+	maxPoints := 0
+	for _, section := range source.sections {
+		if len(section.analog.Data) > maxPoints {
+			maxPoints = len(section.analog.Data)
+		}
+		if len(section.digital.Data) > maxPoints {
+			maxPoints = len(section.digital.Data)
+		}
+	}
+	log.Printf("饱和搜索 - 断面数量: %v, 每个断面最多的PNUM数量: %v, 读取耗时: %v\n", len(source.sections), maxPoints, time.Since(t))
+
+	// 中断信号或中止写入时结束当前步骤, 不再继续
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	interrupted := make(chan struct{})
+	go func() {
+		WaitExit(sigs)
+		close(interrupted)
+	}()
+
+	steps := make([]*CapacityStep, 0)
+	for i := 0; i < cfg.Steps; i++ {
+		step := &CapacityStep{UnitNumber: cfg.UnitNumber, Points: cfg.Points, Rate: cfg.Rate}
+		switch cfg.Ramp {
+		case CapacityRampUnit:
+			step.UnitNumber += int64(math.Round(cfg.Step * float64(i)))
+		case CapacityRampPoints:
+			step.Points += int(math.Round(cfg.Step * float64(i)))
+		case CapacityRampRate:
+			step.Rate += cfg.Step * float64(i)
+		}
+		if cfg.Ramp == CapacityRampPoints && i != 0 && step.Points > maxPoints {
+			log.Printf("饱和搜索: 输入文件中每个断面最多只有%v个PNUM, 无法增加到%v\n", maxPoints, step.Points)
+			break
+		}
+		ok := runCapacityStep(cfg, fmt.Sprintf("第%v步", i+1), step, source, interrupted)
+		steps = append(steps, step)
+		printCapacityStep(len(steps), step, pNumPerSection(source, step.Points))
+		if !ok || step.Saturated != "" {
+			break
+		}
+	}
+	PrintCapacitySummary(source, steps)
+}
+
+// pNumPerSection 每个断面平均写入的PNUM数量(模拟量+数字量, 单个机组)
+func pNumPerSection(source *capacitySource, points int) float64 {
+	sum := 0
+	for _, section := range source.sections {
+		a, d := len(section.analog.Data), len(section.digital.Data)
+		if points > 0 && a > points {
+			a = points
+		}
+		if points > 0 && d > points {
+			d = points
+		}
+		sum += a + d
+	}
+	return float64(sum) / float64(len(source.sections))
+}
+
+// runCapacityStep 按开环的固定速率写入 Hold 时间, 被中断时返回false
+func runCapacityStep(cfg *CapacityConfig, name string, step *CapacityStep, source *capacitySource, interrupted chan struct{}) bool {
+	period := time.Duration(float64(time.Second) / step.Rate)
+	count := int64(cfg.Hold / period)
+	if count < 1 {
+		count = 1
+	}
+
+	// 发布 count 个断面, 超过 Hold 时间后再按目标速率留出写完 MaxBacklog 个积压断面的时间, 剩余的断面不再写入
+	in := make(chan Section, GlobalPeriodic.CacheSize)
+	stop := make(chan struct{})
+	go func() {
+		defer close(in)
+		for i := int64(0); i < count; i++ {
+			select {
+			case in <- source.Next(step.Points):
+			case <-stop:
+				return
+			}
+		}
+	}()
+	start := time.Now()
+	end := start.Add(cfg.Hold + period*time.Duration(cfg.MaxBacklog+1))
+	out := GlobalOpenLoop.Release(name, in, &PeriodicSchedule{Regular: period}, stop)
+
+	// 被中断时停止发布
+	stepDone := make(chan struct{})
+	defer close(stepDone)
+	go func() {
+		select {
+		case <-interrupted:
+			close(stop)
+		case <-stepDone:
+		}
+	}()
+
+	latency := DurationHistogram{}
+	lastFinished := start
+	for section := range out {
+		select {
+		case <-stop:
+			step.Unwritten++
+			continue
+		default:
+		}
+		if time.Now().After(end) {
+			step.Unwritten++
+			continue
+		}
+
+		var aStatus, dStatus WriteStatus
+		if section.analogOk {
+			if cfg.Type == 2 {
+				aStatus = GlobalPlugin.WriteHisAnalog(cfg.Magic, step.UnitNumber, section.analog, cfg.RandomAv)
+			} else {
+				aStatus = GlobalPlugin.WriteRtAnalog(cfg.Magic, step.UnitNumber, section.analog, cfg.Type == 0, cfg.RandomAv)
+			}
+			step.Calls += step.UnitNumber
+			step.PNumCount += int64(len(section.analog.Data)) * step.UnitNumber
+		}
+		if section.digitalOk {
+			if cfg.Type == 2 {
+				dStatus = GlobalPlugin.WriteHisDigital(cfg.Magic, step.UnitNumber, section.digital)
+			} else {
+				dStatus = GlobalPlugin.WriteRtDigital(cfg.Magic, step.UnitNumber, section.digital, cfg.Type == 0)
+			}
+			step.Calls += step.UnitNumber
+			step.PNumCount += int64(len(section.digital.Data)) * step.UnitNumber
+		}
+		finished := time.Now()
+
+		step.Written++
+		step.Failed += aStatus.FailedCount + dStatus.FailedCount
+		if finished.After(section.deadline) {
+			step.Missed++
+		}
+		latency.Add(finished.Sub(section.release))
+		lastFinished = finished
+	}
+	// 写入跟得上时按计划时长计算速率, 避免最后一个断面的周期没有计入
+	step.Elapsed = lastFinished.Sub(start)
+	if planned := period * time.Duration(step.Written); step.Elapsed < planned {
+		step.Elapsed = planned
+	}
+	GlobalFlush.Flush()
+	ok := true
+	select {
+	case <-stop:
+		ok = false
+	default:
+	}
+
+	backlog, _ := GlobalOpenLoop.Backlog(name)
+	step.Released = backlog.Released
+	step.MaxBacklog = backlog.Max
+	step.LastBacklog = backlog.Last
+	step.P99 = latency.Quantile(0.99)
+
+	// 判断是否饱和
+	reasons := make([]string, 0)
+	if step.Released != 0 && float64(step.Missed)/float64(step.Released) > cfg.MaxMissRatio {
+		reasons = append(reasons, fmt.Sprintf("错过截止时间的比例%.2f%%", float64(step.Missed)/float64(step.Released)*100))
+	}
+	if step.LastBacklog > cfg.MaxBacklog {
+		reasons = append(reasons, fmt.Sprintf("结束时积压%v个断面", step.LastBacklog))
+	}
+	if step.Unwritten != 0 {
+		reasons = append(reasons, fmt.Sprintf("%v个断面没有在持续时间内写入", step.Unwritten))
+	}
+	if step.Calls != 0 && float64(step.Failed)/float64(step.Calls) > cfg.MaxErrorRatio {
+		reasons = append(reasons, fmt.Sprintf("写入失败的比例%.2f%%", float64(step.Failed)/float64(step.Calls)*100))
+	}
+	if step.Written == 0 {
+		reasons = append(reasons, "没有写入断面")
+	}
+	step.Saturated = strings.Join(reasons, ", ")
+	step.Interrupted = !ok
+	return ok
+}
+
+func printCapacityStep(i int, step *CapacityStep, pNum float64) {
+	log.Printf("第%v步 - 机组数量: %v, 每个断面PNUM数量: %.0f, 断面速率: %.2f/s, 目标速率: %.2f PNUM/s, 实际写入速率: %.2f PNUM/s, \n\t\t发布断面数量: %v, 写入断面数量: %v, 未写入断面数量: %v, 错过截止时间的次数: %v, 最大积压断面数量: %v, 结束时积压断面数量: %v, 失败调用次数: %v/%v, P99延迟: %v, 结论: %v\n",
+		i, step.UnitNumber, pNum, step.Rate, step.TargetRate(pNum), step.PNumRate(),
+		step.Released, step.Written, step.Unwritten, step.Missed, step.MaxBacklog, step.LastBacklog, step.Failed, step.Calls, step.P99, step.Result(),
+	)
+}
+
+// PrintCapacitySummary 输出每一步的统计表和最大可持续写入速率
+func PrintCapacitySummary(source *capacitySource, steps []*CapacityStep) {
+	builder := &strings.Builder{}
+	w := tabwriter.NewWriter(builder, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "步骤\t机组数量\t断面PNUM数量\t断面速率(/s)\t目标速率(PNUM/s)\t实际速率(PNUM/s)\t错过截止时间\t结束时积压\t失败调用\tP99延迟\t结论")
+	best := -1
+	for i, step := range steps {
+		pNum := pNumPerSection(source, step.Points)
+		if step.Saturated == "" && !step.Interrupted && (best == -1 || step.PNumRate() > steps[best].PNumRate()) {
+			best = i
+		}
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%.0f\t%.2f\t%.2f\t%.2f\t%v/%v\t%v\t%v/%v\t%v\t%v\n",
+			i+1, step.UnitNumber, pNum, step.Rate, step.TargetRate(pNum), step.PNumRate(),
+			step.Missed, step.Released, step.LastBacklog, step.Failed, step.Calls, step.P99, step.Result(),
+		)
+	}
+	_ = w.Flush()
+	log.Printf("饱和搜索结果:\n%v", builder.String())
+	if best == -1 {
+		log.Println("最大可持续写入速率: 没有稳定的步骤, 需要降低第一步的机组数量、PNUM数量或断面速率")
+		return
+	}
+	step := steps[best]
+	log.Printf("最大可持续写入速率: %.2f PNUM/s (第%v步, 机组数量: %v, 每个断面PNUM数量: %.0f, 断面速率: %.2f/s)\n",
+		step.PNumRate(), best+1, step.UnitNumber, pNumPerSection(source, step.Points), step.Rate)
+	if best == len(steps)-1 {
+		log.Println("所有步骤都没有饱和, 可以增加 --steps 或 --step 继续搜索")
+	}
+}
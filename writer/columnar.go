@@ -0,0 +1,565 @@
+package main
+
+// #include "write_plugin.h"
+import "C"
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/apache/arrow/go/v17/parquet/file"
+	"github.com/apache/arrow/go/v17/parquet/pqarrow"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Parquet / Arrow IPC 输入
+// 列名与CSV相同(不区分大小写, 列的顺序任意), 与CSV一样支持列名映射文件和可选列的默认值(见 columnmap.go):
+// 模拟量 TIME,P_NUM,AV,AVR,Q,BF,FQ,FAI,MS,TEW,CST
+// 数字量 TIME,P_NUM,DV,DVR,Q,BF,FQ,FAI,MS,TEW,CST
+// 数值列直接转换, 不经过字符串, 浮点数不会丢失精度; 布尔列也可以使用整数列(非0为true)
+// TEW 可以是长度为1的字符串列, 也可以是整数列
+// Parquet 通过 pqarrow 按批次(每批 ParquetBatchRows 行)转换成 Arrow 记录批次, 与 Arrow IPC 使用同一套列读取, 不逐个值装箱
+// 按记录批次(record batch)流式读取, 连续的相同TIME的行组成一个断面
+
+// 列式文件格式
+const (
+	ColumnarNone    = ""
+	ColumnarParquet = "parquet"
+	ColumnarArrow   = "arrow"        // Arrow IPC 文件格式(Feather V2)
+	ColumnarStream  = "arrow_stream" // Arrow IPC 流格式
+)
+
+// ColumnarFormats 列式文件格式的扩展名和魔数, 流格式没有魔数, 只能通过扩展名识别
+var ColumnarFormats = []struct {
+	Name  string
+	Exts  []string
+	Magic []byte
+}{
+	{ColumnarParquet, []string{".parquet", ".pq"}, []byte("PAR1")},
+	{ColumnarArrow, []string{".arrow", ".feather"}, []byte("ARROW1")},
+	{ColumnarStream, []string{".arrows", ".ipc"}, nil},
+}
+
+// DetectColumnar 识别列式文件格式, 优先检查文件头的魔数, 魔数无法识别时使用扩展名
+func DetectColumnar(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ColumnarNone
+	}
+	defer func() { _ = file.Close() }()
+	header := make([]byte, 8)
+	n, _ := io.ReadFull(file, header)
+	for _, f := range ColumnarFormats {
+		if f.Magic != nil && bytes.HasPrefix(header[:n], f.Magic) {
+			return f.Name
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range ColumnarFormats {
+		for _, e := range f.Exts {
+			if ext == e {
+				return f.Name
+			}
+		}
+	}
+	return ColumnarNone
+}
+
+// ColumnValues 一个批次中的一列
+type ColumnValues interface {
+	Int(i int) (int64, error)
+	Float(i int) (float64, error)
+	Bool(i int) (bool, error)
+	Char(i int) (byte, error)
+}
+
+// ColumnarBatch 一个批次(记录批次), 列按照 AnalogColumns/DigitalColumns 的顺序排列
+type ColumnarBatch struct {
+	Rows    int
+	Columns []ColumnValues
+}
+
+// ColumnarSource 按批次读取列式文件, 读取结束时返回 io.EOF
+type ColumnarSource interface {
+	Next() (ColumnarBatch, error)
+	Close() error
+}
+
+// OpenColumnar 打开列式文件, kind 为数据类型(DatasetAnalog/DatasetDigital), 按列名映射需要读取的列
+func OpenColumnar(path string, format string, kind uint32) (ColumnarSource, error) {
+	switch format {
+	case ColumnarParquet:
+		return OpenParquetSource(path, kind)
+	case ColumnarArrow, ColumnarStream:
+		return OpenArrowSource(path, format == ColumnarStream, kind)
+	default:
+		return nil, fmt.Errorf("unknown columnar format: %v", format)
+	}
+}
+
+// mapColumns 按列名映射组成批次的列, column 返回文件中的第j列, 缺少的列使用默认值
+func mapColumns(m *ColumnMap, column func(j int) (ColumnValues, error)) ([]ColumnValues, error) {
+	columns := make([]ColumnValues, len(m.Index))
+	for i, j := range m.Index {
+		if j < 0 {
+			continue
+		}
+		c, err := column(j)
+		if err != nil {
+			return nil, err
+		}
+		columns[i] = c
+	}
+	for i, j := range m.Index {
+		switch {
+		case j >= 0:
+		case m.Copies[i] >= 0:
+			columns[i] = columns[m.Copies[i]]
+		default:
+			columns[i] = DefaultColumn(m.Defaults[i])
+		}
+	}
+	return columns, nil
+}
+
+// ParseAnalogRow 把批次中的一行转换成 C.Analog
+func ParseAnalogRow(batch ColumnarBatch, i int) (int64, C.Analog, error) {
+	analog := C.Analog{}
+	c := batch.Columns
+	ts, err := c[0].Int(i)
+	if err != nil {
+		return -1, analog, fmt.Errorf("parse time error: %v", err)
+	}
+	pNum, err := c[1].Int(i)
+	if err != nil {
+		return -1, analog, fmt.Errorf("parse pNum error: %v", err)
+	}
+	av, err := c[2].Float(i)
+	if err != nil {
+		return -1, analog, fmt.Errorf("parse av error: %v", err)
+	}
+	avr, err := c[3].Float(i)
+	if err != nil {
+		return -1, analog, fmt.Errorf("parse avr error: %v", err)
+	}
+	q, err := c[4].Bool(i)
+	if err != nil {
+		return -1, analog, fmt.Errorf("parse q error: %v", err)
+	}
+	bf, err := c[5].Bool(i)
+	if err != nil {
+		return -1, analog, fmt.Errorf("parse bf error: %v", err)
+	}
+	qf, err := c[6].Bool(i)
+	if err != nil {
+		return -1, analog, fmt.Errorf("parse qf error: %v", err)
+	}
+	fai, err := c[7].Float(i)
+	if err != nil {
+		return -1, analog, fmt.Errorf("parse fai error: %v", err)
+	}
+	ms, err := c[8].Bool(i)
+	if err != nil {
+		return -1, analog, fmt.Errorf("parse ms error: %v", err)
+	}
+	tew, err := c[9].Char(i)
+	if err != nil {
+		return -1, analog, fmt.Errorf("parse tew error: %v", err)
+	}
+	cst, err := c[10].Int(i)
+	if err != nil {
+		return -1, analog, fmt.Errorf("parse cst error: %v", err)
+	}
+
+	analog.p_num = C.int32_t(pNum)
+	analog.av = C.float(av)
+	analog.avr = C.float(avr)
+	analog.q = C.bool(q)
+	analog.bf = C.bool(bf)
+	analog.qf = C.bool(qf)
+	analog.fai = C.float(fai)
+	analog.ms = C.bool(ms)
+	analog.tew = C.char(tew)
+	analog.cst = C.uint16_t(cst)
+
+	return ts, analog, nil
+}
+
+// ParseDigitalRow 把批次中的一行转换成 C.Digital
+func ParseDigitalRow(batch ColumnarBatch, i int) (int64, C.Digital, error) {
+	digital := C.Digital{}
+	c := batch.Columns
+	ts, err := c[0].Int(i)
+	if err != nil {
+		return -1, digital, fmt.Errorf("parse time error: %v", err)
+	}
+	pNum, err := c[1].Int(i)
+	if err != nil {
+		return -1, digital, fmt.Errorf("parse pNum error: %v", err)
+	}
+	dv, err := c[2].Bool(i)
+	if err != nil {
+		return -1, digital, fmt.Errorf("parse dv error: %v", err)
+	}
+	dvr, err := c[3].Bool(i)
+	if err != nil {
+		return -1, digital, fmt.Errorf("parse dvr error: %v", err)
+	}
+	q, err := c[4].Bool(i)
+	if err != nil {
+		return -1, digital, fmt.Errorf("parse q error: %v", err)
+	}
+	bf, err := c[5].Bool(i)
+	if err != nil {
+		return -1, digital, fmt.Errorf("parse bf error: %v", err)
+	}
+	bq, err := c[6].Bool(i)
+	if err != nil {
+		return -1, digital, fmt.Errorf("parse bq error: %v", err)
+	}
+	fai, err := c[7].Bool(i)
+	if err != nil {
+		return -1, digital, fmt.Errorf("parse fai error: %v", err)
+	}
+	ms, err := c[8].Bool(i)
+	if err != nil {
+		return -1, digital, fmt.Errorf("parse ms error: %v", err)
+	}
+	tew, err := c[9].Char(i)
+	if err != nil {
+		return -1, digital, fmt.Errorf("parse tew error: %v", err)
+	}
+	cst, err := c[10].Int(i)
+	if err != nil {
+		return -1, digital, fmt.Errorf("parse cst error: %v", err)
+	}
+
+	digital.p_num = C.int32_t(pNum)
+	digital.dv = C.bool(dv)
+	digital.dvr = C.bool(dvr)
+	digital.q = C.bool(q)
+	digital.bf = C.bool(bf)
+	digital.bq = C.bool(bq)
+	digital.fai = C.bool(fai)
+	digital.ms = C.bool(ms)
+	digital.tew = C.char(tew)
+	digital.cst = C.uint16_t(cst)
+
+	return ts, digital, nil
+}
+
+// readColumnarSections 按批次读取列式文件, 把连续的相同TIME的行组成断面发送到缓存队列
+// 一个断面可以跨越多个批次
+func readColumnarSections[T any, S any](path string, format string, kind uint32,
+	parse func(ColumnarBatch, int) (int64, T, error), section func(int64, []T) S,
+	ch chan S, exitCh chan bool) {
+	defer close(ch)
+	src, err := OpenColumnar(path, format, kind)
+	if err != nil {
+		panic("can not open file: " + path + ", " + err.Error())
+	}
+	defer func() { _ = src.Close() }()
+
+	dataList := make([]T, 0)
+	tsFlag := int64(-1)
+	for {
+		batch, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic("read " + format + " file failed: " + path + ", " + err.Error())
+		}
+		for i := 0; i < batch.Rows; i++ {
+			ts, data, err := parse(batch, i)
+			if err != nil {
+				log.Printf("Error parsing row: %s", err)
+				continue
+			}
+
+			// time 初始化
+			if tsFlag == -1 {
+				tsFlag = ts
+			}
+
+			// 如果出现的时间戳, 则更新timeFlag, 发送数据, 并且清空dataList
+			if tsFlag != ts {
+				select {
+				case <-exitCh:
+					log.Println("信号中断列式文件读取协程:", path)
+					return
+				case ch <- section(tsFlag, dataList):
+				}
+				tsFlag = ts
+				dataList = make([]T, 0)
+			}
+			dataList = append(dataList, data)
+		}
+	}
+	if len(dataList) != 0 {
+		select {
+		case <-exitCh:
+			log.Println("信号中断列式文件读取协程:", path)
+		case ch <- section(tsFlag, dataList):
+		}
+	}
+}
+
+// ReadAnalogColumnar 读取 Parquet / Arrow IPC 文件, 将其转换成 C.Analog 结构后发送到缓存队列
+func ReadAnalogColumnar(path string, format string, ch chan AnalogSection, exitCh chan bool) {
+	readColumnarSections(path, format, DatasetAnalog, ParseAnalogRow,
+		func(t int64, data []C.Analog) AnalogSection { return AnalogSection{Time: t, Data: data} }, ch, exitCh)
+}
+
+// ReadDigitalColumnar 读取 Parquet / Arrow IPC 文件, 将其转换成 C.Digital 结构后发送到缓存队列
+func ReadDigitalColumnar(path string, format string, ch chan DigitalSection, exitCh chan bool) {
+	readColumnarSections(path, format, DatasetDigital, ParseDigitalRow,
+		func(t int64, data []C.Digital) DigitalSection { return DigitalSection{Time: t, Data: data} }, ch, exitCh)
+}
+
+// DefaultColumn 文件中缺少的列, 每一行都是同一个默认值, 按CSV的格式解析
+type DefaultColumn string
+
+func (dc DefaultColumn) Int(i int) (int64, error) {
+	return strconv.ParseInt(string(dc), 10, 64)
+}
+
+func (dc DefaultColumn) Float(i int) (float64, error) {
+	return strconv.ParseFloat(string(dc), 64)
+}
+
+func (dc DefaultColumn) Bool(i int) (bool, error) {
+	return strconv.ParseBool(string(dc))
+}
+
+func (dc DefaultColumn) Char(i int) (byte, error) {
+	if len(dc) != 1 {
+		return 0, fmt.Errorf("expect 1 char, got %q", string(dc))
+	}
+	return dc[0], nil
+}
+
+// ---------------------------------------- Arrow IPC ----------------------------------------
+
+// arrowRecordReader ipc.FileReader, ipc.Reader 和 pqarrow.RecordReader 的公共部分
+type arrowRecordReader interface {
+	Read() (arrow.Record, error)
+	Schema() *arrow.Schema
+}
+
+// ArrowSource 按记录批次读取 Arrow IPC 文件, Parquet 文件经 pqarrow 转换后也使用它读取
+type ArrowSource struct {
+	file    io.Closer
+	reader  arrowRecordReader
+	m       *ColumnMap
+	columns []int // 文件中第j列在记录批次中的位置, 为空时与文件中的列相同
+	current arrow.Record
+}
+
+func OpenArrowSource(path string, stream bool, kind uint32) (*ArrowSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	as := &ArrowSource{file: f}
+	if stream {
+		r, err := ipc.NewReader(bufio.NewReader(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		as.reader = r
+	} else {
+		r, err := ipc.NewFileReader(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		as.reader = r
+	}
+
+	names := make([]string, 0)
+	for _, field := range as.reader.Schema().Fields() {
+		names = append(names, field.Name)
+	}
+	if as.m, err = NewColumnMap(kind, names); err != nil {
+		_ = as.Close()
+		return nil, err
+	}
+	return as, nil
+}
+
+// ParquetBatchRows Parquet 每个记录批次的行数
+const ParquetBatchRows = 64 * 1024
+
+// OpenParquetSource 打开 Parquet 文件, 只读取列名映射用到的顶层列
+func OpenParquetSource(path string, kind uint32) (*ArrowSource, error) {
+	pf, err := file.OpenParquetFile(path, false)
+	if err != nil {
+		return nil, err
+	}
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: ParquetBatchRows}, memory.DefaultAllocator)
+	if err != nil {
+		_ = pf.Close()
+		return nil, err
+	}
+
+	// 只支持顶层的列
+	names := make([]string, 0)
+	leaves := make([]int, 0)
+	for _, field := range fr.Manifest.Fields {
+		if !field.IsLeaf() {
+			continue
+		}
+		names = append(names, field.Field.Name)
+		leaves = append(leaves, field.ColIndex)
+	}
+	m, err := NewColumnMap(kind, names)
+	if err != nil {
+		_ = pf.Close()
+		return nil, err
+	}
+
+	// 记录批次中的列按 colIndices 的顺序排列
+	columns := make([]int, len(names))
+	colIndices := make([]int, 0)
+	for j := range names {
+		columns[j] = -1
+	}
+	for _, j := range m.Index {
+		if j >= 0 && columns[j] < 0 {
+			columns[j] = len(colIndices)
+			colIndices = append(colIndices, leaves[j])
+		}
+	}
+	rr, err := fr.GetRecordReader(context.Background(), colIndices, nil)
+	if err != nil {
+		_ = pf.Close()
+		return nil, err
+	}
+	return &ArrowSource{file: pf, reader: rr, m: m, columns: columns}, nil
+}
+
+func (as *ArrowSource) Next() (ColumnarBatch, error) {
+	// 上一个批次的数据已经转换完成
+	if as.current != nil {
+		as.current.Release()
+		as.current = nil
+	}
+	record, err := as.reader.Read()
+	if err != nil {
+		return ColumnarBatch{}, err
+	}
+	record.Retain()
+	as.current = record
+
+	batch := ColumnarBatch{Rows: int(record.NumRows())}
+	batch.Columns, err = mapColumns(as.m, func(j int) (ColumnValues, error) {
+		if as.columns != nil {
+			j = as.columns[j]
+		}
+		return ArrowColumn{record.Column(j)}, nil
+	})
+	return batch, err
+}
+
+func (as *ArrowSource) Close() error {
+	if as.current != nil {
+		as.current.Release()
+		as.current = nil
+	}
+	if r, ok := as.reader.(interface{ Release() }); ok {
+		r.Release()
+	}
+	return as.file.Close()
+}
+
+// ArrowColumn Arrow 的一列
+type ArrowColumn struct {
+	arrow.Array
+}
+
+func (ac ArrowColumn) Int(i int) (int64, error) {
+	if ac.IsNull(i) {
+		return 0, fmt.Errorf("null value at row %v", i)
+	}
+	switch a := ac.Array.(type) {
+	case *array.Int8:
+		return int64(a.Value(i)), nil
+	case *array.Int16:
+		return int64(a.Value(i)), nil
+	case *array.Int32:
+		return int64(a.Value(i)), nil
+	case *array.Int64:
+		return a.Value(i), nil
+	case *array.Uint8:
+		return int64(a.Value(i)), nil
+	case *array.Uint16:
+		return int64(a.Value(i)), nil
+	case *array.Uint32:
+		return int64(a.Value(i)), nil
+	case *array.Uint64:
+		return int64(a.Value(i)), nil
+	case *array.Timestamp:
+		return int64(a.Value(i)), nil
+	case *array.Boolean:
+		if a.Value(i) {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unsupported type %v", ac.DataType())
+	}
+}
+
+func (ac ArrowColumn) Float(i int) (float64, error) {
+	if ac.IsNull(i) {
+		return 0, fmt.Errorf("null value at row %v", i)
+	}
+	switch a := ac.Array.(type) {
+	case *array.Float32:
+		return float64(a.Value(i)), nil
+	case *array.Float64:
+		return a.Value(i), nil
+	default:
+		v, err := ac.Int(i)
+		return float64(v), err
+	}
+}
+
+func (ac ArrowColumn) Bool(i int) (bool, error) {
+	v, err := ac.Int(i)
+	return v != 0, err
+}
+
+// Char 字符串列和二进制列(没有UTF8注解的 Parquet BYTE_ARRAY)取唯一的字符, 其他类型按整数转换
+func (ac ArrowColumn) Char(i int) (byte, error) {
+	var v string
+	switch a := ac.Array.(type) {
+	case *array.String:
+		v = a.Value(i)
+	case *array.LargeString:
+		v = a.Value(i)
+	case *array.Binary:
+		v = a.ValueString(i)
+	default:
+		n, err := ac.Int(i)
+		return byte(n), err
+	}
+	if ac.IsNull(i) {
+		return 0, fmt.Errorf("null value at row %v", i)
+	}
+	if len(v) != 1 {
+		return 0, fmt.Errorf("expect 1 char, got %q", v)
+	}
+	return v[0], nil
+}
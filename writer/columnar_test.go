@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/apache/arrow/go/v17/parquet"
+	"github.com/apache/arrow/go/v17/parquet/pqarrow"
+)
+
+// columnarTypes 测试文件中每一列的 Arrow 类型
+var columnarTypes = map[uint32]map[string]arrow.DataType{
+	DatasetAnalog: {
+		"TIME": arrow.PrimitiveTypes.Int64, "P_NUM": arrow.PrimitiveTypes.Int32,
+		"AV": arrow.PrimitiveTypes.Float32, "AVR": arrow.PrimitiveTypes.Float32,
+		"Q": arrow.FixedWidthTypes.Boolean, "BF": arrow.FixedWidthTypes.Boolean, "FQ": arrow.FixedWidthTypes.Boolean,
+		"FAI": arrow.PrimitiveTypes.Float32, "MS": arrow.FixedWidthTypes.Boolean,
+		"TEW": arrow.BinaryTypes.String, "CST": arrow.PrimitiveTypes.Uint16,
+	},
+	DatasetDigital: {
+		"TIME": arrow.PrimitiveTypes.Int64, "P_NUM": arrow.PrimitiveTypes.Int32,
+		"DV": arrow.FixedWidthTypes.Boolean, "DVR": arrow.FixedWidthTypes.Boolean,
+		"Q": arrow.FixedWidthTypes.Boolean, "BF": arrow.FixedWidthTypes.Boolean, "FQ": arrow.FixedWidthTypes.Boolean,
+		"FAI": arrow.FixedWidthTypes.Boolean, "MS": arrow.FixedWidthTypes.Boolean,
+		"TEW": arrow.BinaryTypes.String, "CST": arrow.PrimitiveTypes.Uint16,
+	},
+}
+
+// columnarRows 3个断面, 每个断面3个点, 每一行的各列取值不同, 列的顺序错误时结果不同
+func columnarRows(kind uint32) [][]string {
+	rows := make([][]string, 0)
+	k := 0
+	for ts := int64(1000); ts < 1003; ts++ {
+		for pNum := 1; pNum <= 3; pNum++ {
+			row := []string{strconv.FormatInt(ts, 10), strconv.Itoa(pNum)}
+			if kind == DatasetAnalog {
+				row = append(row, fmt.Sprintf("%v.5", pNum), fmt.Sprint(float64(k)*0.25))
+			} else {
+				row = append(row, strconv.FormatBool(k%2 == 0), strconv.FormatBool(k%3 == 0))
+			}
+			row = append(row, strconv.FormatBool(k%2 == 1), strconv.FormatBool(k%3 == 1), strconv.FormatBool(k%4 == 1))
+			if kind == DatasetAnalog {
+				row = append(row, fmt.Sprint(float64(k)*0.5))
+			} else {
+				row = append(row, strconv.FormatBool(k%4 == 2))
+			}
+			row = append(row, strconv.FormatBool(k%5 == 0), string(rune('A'+k%3)), strconv.Itoa(k*100))
+			rows = append(rows, row)
+			k++
+		}
+	}
+	return rows
+}
+
+// selectColumns 按列名取出每一行中的列, 列名不区分大小写
+func selectColumns(kind uint32, columns []string, rows [][]string) [][]string {
+	index := make([]int, len(columns))
+	for i, column := range columns {
+		for j, name := range KindColumns(kind) {
+			if strings.ToUpper(column) == name {
+				index[i] = j
+			}
+		}
+	}
+	selected := make([][]string, 0)
+	for _, row := range rows {
+		r := make([]string, len(columns))
+		for i, j := range index {
+			r[i] = row[j]
+		}
+		selected = append(selected, r)
+	}
+	return selected
+}
+
+// buildRecord 把CSV格式的行转换成 Arrow 记录批次
+func buildRecord(t *testing.T, schema *arrow.Schema, rows [][]string) arrow.Record {
+	t.Helper()
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	for j := range schema.Fields() {
+		for _, row := range rows {
+			var err error
+			switch fb := b.Field(j).(type) {
+			case *array.Int64Builder:
+				var v int64
+				v, err = strconv.ParseInt(row[j], 10, 64)
+				fb.Append(v)
+			case *array.Int32Builder:
+				var v int64
+				v, err = strconv.ParseInt(row[j], 10, 32)
+				fb.Append(int32(v))
+			case *array.Uint16Builder:
+				var v uint64
+				v, err = strconv.ParseUint(row[j], 10, 16)
+				fb.Append(uint16(v))
+			case *array.Float32Builder:
+				var v float64
+				v, err = strconv.ParseFloat(row[j], 32)
+				fb.Append(float32(v))
+			case *array.BooleanBuilder:
+				var v bool
+				v, err = strconv.ParseBool(row[j])
+				fb.Append(v)
+			case *array.StringBuilder:
+				fb.Append(row[j])
+			default:
+				t.Fatalf("unsupported builder %T", fb)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return b.NewRecord()
+}
+
+// writeColumnar 在临时目录中写入列式文件, 行分成两个记录批次, 第二个断面跨越两个批次
+func writeColumnar(t *testing.T, format string, kind uint32, columns []string, rows [][]string) string {
+	t.Helper()
+	fields := make([]arrow.Field, 0)
+	for _, column := range columns {
+		fields = append(fields, arrow.Field{Name: column, Type: columnarTypes[kind][strings.ToUpper(column)]})
+	}
+	schema := arrow.NewSchema(fields, nil)
+	records := []arrow.Record{buildRecord(t, schema, rows[:4]), buildRecord(t, schema, rows[4:])}
+	defer func() {
+		for _, record := range records {
+			record.Release()
+		}
+	}()
+
+	ext := map[string]string{ColumnarParquet: ".parquet", ColumnarArrow: ".arrow", ColumnarStream: ".arrows"}[format]
+	path := filepath.Join(t.TempDir(), "c"+ext)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	var w interface {
+		Write(arrow.Record) error
+		Close() error
+	}
+	switch format {
+	case ColumnarParquet:
+		w, err = pqarrow.NewFileWriter(schema, f, parquet.NewWriterProperties(), pqarrow.DefaultWriterProps())
+	case ColumnarArrow:
+		w, err = ipc.NewFileWriter(f, ipc.WithSchema(schema))
+	case ColumnarStream:
+		w = ipc.NewWriter(f, ipc.WithSchema(schema))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// collectSections 读取协程关闭队列前收到的所有断面, 超时说明读取没有结束
+func collectSections[S any](t *testing.T, ch chan S, key func(S) string) []string {
+	t.Helper()
+	keys := make([]string, 0)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case section, ok := <-ch:
+			if !ok {
+				return keys
+			}
+			keys = append(keys, key(section))
+		case <-timeout:
+			t.Fatal("reading did not finish")
+		}
+	}
+}
+
+// readKindSections 读取CSV文件(format为空)或列式文件, 每个断面表示为时间和C结构体的字节
+func readKindSections(t *testing.T, kind uint32, path string, format string) []string {
+	t.Helper()
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	exitCh := make(chan bool)
+	if kind == DatasetAnalog {
+		ch := make(chan AnalogSection, 16)
+		if format == ColumnarNone {
+			go ReadAnalogCsv(wg, path, ch, exitCh)
+		} else {
+			go func() { defer wg.Done(); ReadAnalogColumnar(path, format, ch, exitCh) }()
+		}
+		defer wg.Wait()
+		return collectSections(t, ch, func(s AnalogSection) string { return fmt.Sprintf("%v:%x", s.Time, rawBytes(s.Data)) })
+	}
+	ch := make(chan DigitalSection, 16)
+	if format == ColumnarNone {
+		go ReadDigitalCsv(wg, path, ch, exitCh)
+	} else {
+		go func() { defer wg.Done(); ReadDigitalColumnar(path, format, ch, exitCh) }()
+	}
+	defer wg.Wait()
+	return collectSections(t, ch, func(s DigitalSection) string { return fmt.Sprintf("%v:%x", s.Time, rawBytes(s.Data)) })
+}
+
+func TestReadColumnar(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    uint32
+		columns []string
+	}{
+		{"analog", DatasetAnalog, AnalogColumns},
+		{"digital", DatasetDigital, DigitalColumns},
+		{"analog reordered", DatasetAnalog, []string{"cst", "tew", "ms", "fai", "fq", "bf", "q", "avr", "av", "p_num", "time"}},
+		{"digital reordered", DatasetDigital, []string{"P_NUM", "DV", "TIME", "Q", "TEW", "BF", "DVR", "FQ", "CST", "MS", "FAI"}},
+		// 缺少的 AVR/DVR 与 AV/DV 相同, 缺少的 CST 为0
+		{"analog missing optional", DatasetAnalog, []string{"TIME", "P_NUM", "AV", "Q", "BF", "FQ", "FAI", "MS", "TEW"}},
+		{"digital missing optional reordered", DatasetDigital, []string{"TEW", "MS", "FAI", "FQ", "BF", "Q", "DV", "P_NUM", "TIME"}},
+	}
+	for _, tt := range tests {
+		rows := selectColumns(tt.kind, tt.columns, columnarRows(tt.kind))
+		for _, format := range []string{ColumnarParquet, ColumnarArrow, ColumnarStream} {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				// 同样的列和数据从CSV读取的结果作为期望值
+				want := readKindSections(t, tt.kind, writeCsv(t, "c.csv", tt.columns, rows...), ColumnarNone)
+				if len(want) != 3 {
+					t.Fatalf("csv sections = %v, want 3", len(want))
+				}
+				path := writeColumnar(t, format, tt.kind, tt.columns, rows)
+				if got := DetectColumnar(path); got != format {
+					t.Fatalf("DetectColumnar = %q, want %q", got, format)
+				}
+				got := readKindSections(t, tt.kind, path, format)
+				if len(got) != len(want) {
+					t.Fatalf("sections = %v, want %v", len(got), len(want))
+				}
+				for i := range want {
+					if got[i] != want[i] {
+						t.Errorf("section %v = %v, want %v", i, got[i], want[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestReadColumnarMissingDefaults(t *testing.T) {
+	// 缺少可选列的文件与补上默认值的完整文件结果相同
+	full := columnarRows(DatasetAnalog)
+	for _, row := range full {
+		row[3], row[10] = row[2], "0"
+	}
+	columns := []string{"TIME", "P_NUM", "AV", "Q", "BF", "FQ", "FAI", "MS", "TEW"}
+	want := readKindSections(t, DatasetAnalog, writeCsv(t, "full.csv", AnalogColumns, full...), ColumnarNone)
+	for _, format := range []string{ColumnarParquet, ColumnarArrow} {
+		path := writeColumnar(t, format, DatasetAnalog, columns, selectColumns(DatasetAnalog, columns, full))
+		if got := readKindSections(t, DatasetAnalog, path, format); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%v sections = %v, want %v", format, got, want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 按表头的列名映射列
+// 解析函数(ParseAnalogRecord 等)按固定的列顺序解析, 读取时先把文件中的一行按表头映射为固定的列顺序:
+// * 列的顺序任意, 多余的列被忽略, 列名不区分大小写
+// * 通过 --column_map 指定映射文件, 把厂商自定义的列名映射为逻辑列名, 也可以为缺少的列指定默认值
+// * 可选列缺少时使用默认值(例如 AVR 默认与 AV 相同, CST 默认为0), 必需的列缺少时无法读取
+// * 没有表头的文件按固定的列顺序读取, 与之前相同
+
+// AnalogColumns 模拟量的列名, 与CSV的列顺序相同
+var AnalogColumns = []string{"TIME", "P_NUM", "AV", "AVR", "Q", "BF", "FQ", "FAI", "MS", "TEW", "CST"}
+
+// DigitalColumns 数字量的列名, 与CSV的列顺序相同
+var DigitalColumns = []string{"TIME", "P_NUM", "DV", "DVR", "Q", "BF", "FQ", "FAI", "MS", "TEW", "CST"}
+
+// StaticAnalogColumns 静态模拟量的列名
+var StaticAnalogColumns = []string{"P_NUM", "TAGT", "FACK", "L4AR", "L3AR", "L2AR", "L1AR", "H4AR", "H3AR", "H2AR", "H1AR", "CHN", "PN", "DESC", "UNIT", "MU", "MD"}
+
+// StaticDigitalColumns 静态数字量的列名
+var StaticDigitalColumns = []string{"P_NUM", "FACK", "CHN", "PN", "DESC", "UNIT"}
+
+// KindColumns 数据类型对应的列名
+func KindColumns(kind uint32) []string {
+	switch kind {
+	case DatasetAnalog:
+		return AnalogColumns
+	case DatasetDigital:
+		return DigitalColumns
+	case DatasetStaticAnalog:
+		return StaticAnalogColumns
+	case DatasetStaticDigital:
+		return StaticDigitalColumns
+	}
+	return nil
+}
+
+// ColumnDefaults 可选列的默认值, 以$开头表示与另一列的值相同
+var ColumnDefaults = map[uint32]map[string]string{
+	DatasetAnalog:  {"AVR": "$AV", "CST": "0"},
+	DatasetDigital: {"DVR": "$DV", "CST": "0"},
+	DatasetStaticAnalog: {"TAGT": "0", "FACK": "0",
+		"L4AR": "False", "L3AR": "False", "L2AR": "False", "L1AR": "False",
+		"H4AR": "False", "H3AR": "False", "H2AR": "False", "H1AR": "False",
+		"CHN": "", "PN": "", "DESC": "", "UNIT": "", "MU": "0", "MD": "0"},
+	DatasetStaticDigital: {"FACK": "0", "CHN": "", "PN": "", "DESC": "", "UNIT": ""},
+}
+
+// ColumnMapping 列名映射文件的内容
+type ColumnMapping struct {
+	Names    map[string]string // 逻辑列名 -> 文件中的列名
+	Defaults map[string]string // 逻辑列名 -> 缺少该列时的默认值
+}
+
+var GlobalColumnMapping = &ColumnMapping{Names: map[string]string{}, Defaults: map[string]string{}}
+
+// LoadColumnMapping 加载列名映射文件, 路径为空时不做任何事
+// 文件格式: 每行一个映射, #开头的行为注释
+//
+//	AV = analog_value        逻辑列AV对应文件中的analog_value列
+//	default.TEW = A          缺少TEW列时使用默认值A
+//	default.FAI = $AV        缺少FAI列时与AV列的值相同
+func LoadColumnMapping(path string) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	mapping := &ColumnMapping{Names: map[string]string{}, Defaults: map[string]string{}}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return fmt.Errorf("%v:%v: 格式错误, 应为 逻辑列名=文件中的列名 或 default.逻辑列名=默认值", path, line)
+		}
+		key, value = strings.ToUpper(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if strings.HasPrefix(key, "DEFAULT.") {
+			mapping.Defaults[strings.TrimPrefix(key, "DEFAULT.")] = value
+		} else {
+			mapping.Names[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	GlobalColumnMapping = mapping
+	return nil
+}
+
+// FileName 逻辑列在文件中的列名
+func (cm *ColumnMapping) FileName(column string) string {
+	if name, ok := cm.Names[column]; ok {
+		return name
+	}
+	return column
+}
+
+// Default 逻辑列的默认值, 映射文件中的默认值优先
+func (cm *ColumnMapping) Default(kind uint32, column string) (string, bool) {
+	if value, ok := cm.Defaults[column]; ok {
+		return value, true
+	}
+	value, ok := ColumnDefaults[kind][column]
+	return value, ok
+}
+
+// findColumn 在表头中查找列名(不区分大小写, 忽略首尾空格和UTF-8 BOM), 找不到时返回-1
+func findColumn(header []string, name string) int {
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ColumnMap 把文件中的一行映射为解析函数的列顺序
+type ColumnMap struct {
+	columns  []string // 逻辑列, 与解析函数的列顺序相同
+	Index    []int    // 逻辑列在文件中的位置, -1 表示缺少该列
+	Copies   []int    // 缺少的列与哪个逻辑列的值相同, -1 表示使用 Defaults
+	Defaults []string // 缺少的列的默认值
+	identity bool     // 文件的列顺序与解析函数相同, 不需要映射
+	width    int      // 文件中每行至少需要的列数
+	buf      []string
+}
+
+// NewColumnMap 根据表头建立映射, header 为nil时按固定的列顺序读取
+func NewColumnMap(kind uint32, header []string) (*ColumnMap, error) {
+	columns := KindColumns(kind)
+	m := &ColumnMap{columns: columns, Index: make([]int, len(columns)), Copies: make([]int, len(columns)),
+		Defaults: make([]string, len(columns)), buf: make([]string, len(columns))}
+	if header == nil {
+		m.identity = true
+		for i := range columns {
+			m.Index[i], m.Copies[i] = i, -1
+		}
+		return m, nil
+	}
+
+	m.identity = len(header) == len(columns)
+	missing := make([]string, 0)
+	for i, column := range columns {
+		m.Index[i], m.Copies[i] = findColumn(header, GlobalColumnMapping.FileName(column)), -1
+		m.identity = m.identity && m.Index[i] == i
+		if m.Index[i] >= m.width {
+			m.width = m.Index[i] + 1
+		}
+		if m.Index[i] >= 0 {
+			continue
+		}
+		value, ok := GlobalColumnMapping.Default(kind, column)
+		if !ok {
+			missing = append(missing, column)
+			continue
+		}
+		m.Defaults[i] = value
+	}
+	if len(missing) != 0 {
+		return nil, fmt.Errorf("缺少列: %v, 表头: %v", strings.Join(missing, ","), strings.Join(header, ","))
+	}
+
+	// 默认值引用的列, 只能引用文件中存在的列
+	for i := range columns {
+		if m.Index[i] >= 0 || !strings.HasPrefix(m.Defaults[i], "$") {
+			continue
+		}
+		ref := strings.TrimPrefix(m.Defaults[i], "$")
+		m.Copies[i] = -1
+		for j, column := range columns {
+			if column == strings.ToUpper(ref) && m.Index[j] >= 0 {
+				m.Copies[i] = j
+			}
+		}
+		if m.Copies[i] == -1 {
+			return nil, fmt.Errorf("列 %v 的默认值引用的列 %v 不存在", columns[i], ref)
+		}
+	}
+	return m, nil
+}
+
+// Apply 把文件中的一行映射为解析函数的列顺序, 返回的切片在下一次调用时被覆盖
+func (m *ColumnMap) Apply(record []string) ([]string, error) {
+	if m.identity {
+		return record, nil
+	}
+	if len(record) < m.width {
+		return nil, fmt.Errorf("列数不足: %v, 至少需要 %v 列", len(record), m.width)
+	}
+	for i := range m.columns {
+		switch {
+		case m.Index[i] >= 0:
+			m.buf[i] = record[m.Index[i]]
+		case m.Copies[i] >= 0:
+			m.buf[i] = record[m.Index[m.Copies[i]]]
+		default:
+			m.buf[i] = m.Defaults[i]
+		}
+	}
+	return m.buf, nil
+}
+
+// ErrColumnHeader 表头无法建立映射(缺少必需的列等), 文件无法读取
+var ErrColumnHeader = errors.New("表头错误")
+
+// CsvRecordMapper 读取CSV时使用, 第一行为表头时按表头建立映射, 否则按固定的列顺序读取
+type CsvRecordMapper struct {
+	kind uint32
+	m    *ColumnMap
+}
+
+func NewCsvRecordMapper(kind uint32) *CsvRecordMapper {
+	return &CsvRecordMapper{kind: kind}
+}
+
+// IsHeader 判断一行是否为表头(包含第一个逻辑列 TIME/P_NUM 的列名)
+func (rm *CsvRecordMapper) IsHeader(record []string) bool {
+	return findColumn(record, GlobalColumnMapping.FileName(KindColumns(rm.kind)[0])) >= 0
+}
+
+// Map 映射一行, 表头映射为逻辑列名(解析函数把它当作表头跳过); 表头缺少必需的列时返回 ErrColumnHeader
+func (rm *CsvRecordMapper) Map(record []string) ([]string, error) {
+	if rm.IsHeader(record) {
+		if rm.m == nil {
+			m, err := NewColumnMap(rm.kind, record)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrColumnHeader, err)
+			}
+			rm.m = m
+		}
+		return KindColumns(rm.kind), nil
+	}
+	if rm.m == nil {
+		rm.m, _ = NewColumnMap(rm.kind, nil)
+	}
+	return rm.m.Apply(record)
+}
+
+// CheckCsvHeader 开始读取前检查CSV文件的第一行, 第一行为表头且缺少必需的列时返回 ErrColumnHeader
+// 空文件和格式错误的行在读取时处理, 这里不返回错误
+func CheckCsvHeader(path string, kind uint32) error {
+	file, err := OpenCsvFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	record, err := csv.NewReader(NewCRFilterReader(bufio.NewReader(file))).Read()
+	if err != nil {
+		return nil
+	}
+	if _, err := NewCsvRecordMapper(kind).Map(record); errors.Is(err, ErrColumnHeader) {
+		return err
+	}
+	return nil
+}
+
+// Identity 文件的列顺序与解析函数相同
+func (rm *CsvRecordMapper) Identity() bool {
+	return rm.m == nil || rm.m.identity
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestColumnMapApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     uint32
+		names    map[string]string
+		defaults map[string]string
+		header   string
+		record   string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "standard header", kind: DatasetAnalog,
+			header: "TIME,P_NUM,AV,AVR,Q,BF,FQ,FAI,MS,TEW,CST",
+			record: "1000,1,2.5,2.5,true,false,false,0,false,A,0",
+			want:   "1000,1,2.5,2.5,true,false,false,0,false,A,0",
+		},
+		{
+			name: "reordered, case and BOM", kind: DatasetAnalog,
+			header: "\ufeffp_num, time ,CST,TEW,MS,FAI,FQ,BF,Q,AVR,AV",
+			record: "1,1000,0,A,false,0,false,false,true,2.0,2.5",
+			want:   "1000,1,2.5,2.0,true,false,false,0,false,A,0",
+		},
+		{
+			name: "optional columns use defaults", kind: DatasetDigital,
+			header: "TIME,P_NUM,DV,Q,BF,FQ,FAI,MS,TEW",
+			record: "1000,7,1,true,false,false,0,false,A",
+			want:   "1000,7,1,1,true,false,false,0,false,A,0",
+		},
+		{
+			name: "mapping file renames and defaults", kind: DatasetAnalog,
+			names:    map[string]string{"AV": "value", "TIME": "ts"},
+			defaults: map[string]string{"Q": "false", "BF": "false", "FQ": "false", "FAI": "0", "MS": "false", "TEW": "B"},
+			header:   "ts,P_NUM,value",
+			record:   "1000,3,4.5",
+			want:     "1000,3,4.5,4.5,false,false,false,0,false,B,0",
+		},
+		{
+			name: "static digital", kind: DatasetStaticDigital,
+			header: "P_NUM,DESC",
+			record: "9,pump",
+			want:   "9,0,,,pump,",
+		},
+		{
+			name: "missing required column", kind: DatasetAnalog,
+			header:  "TIME,AV,AVR,Q,BF,FQ,FAI,MS,TEW,CST",
+			wantErr: true,
+		},
+		{
+			name: "default refers to a missing column", kind: DatasetAnalog,
+			defaults: map[string]string{"AV": "0"},
+			header:   "TIME,P_NUM,Q,BF,FQ,FAI,MS,TEW",
+			wantErr:  true,
+		},
+		{
+			name: "record shorter than header", kind: DatasetAnalog,
+			header:  "P_NUM,TIME,AV,AVR,Q,BF,FQ,FAI,MS,TEW,CST",
+			record:  "1,1000,2.5",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			GlobalColumnMapping = &ColumnMapping{Names: map[string]string{}, Defaults: map[string]string{}}
+			for k, v := range tt.names {
+				GlobalColumnMapping.Names[k] = v
+			}
+			for k, v := range tt.defaults {
+				GlobalColumnMapping.Defaults[k] = v
+			}
+			defer func() {
+				GlobalColumnMapping = &ColumnMapping{Names: map[string]string{}, Defaults: map[string]string{}}
+			}()
+
+			m, err := NewColumnMap(tt.kind, strings.Split(tt.header, ","))
+			if err == nil && tt.record != "" {
+				var got []string
+				got, err = m.Apply(strings.Split(tt.record, ","))
+				if err == nil && strings.Join(got, ",") != tt.want {
+					t.Errorf("Apply = %v, want %v", strings.Join(got, ","), tt.want)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestColumnMapIdentity(t *testing.T) {
+	m, err := NewColumnMap(DatasetAnalog, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := []string{"1000", "1", "2.5"}
+	got, err := m.Apply(record)
+	if err != nil || &got[0] != &record[0] {
+		t.Errorf("Apply without header should return the record unchanged, got %v, %v", got, err)
+	}
+}
+
+func TestReadCsvHeaderError(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      uint32
+		header    []string
+		row       []string
+		wantAbort bool
+	}{
+		{name: "analog header", kind: DatasetAnalog, header: AnalogColumns, row: analogRow(1000, 1)},
+		{name: "analog without header", kind: DatasetAnalog, row: analogRow(1000, 1)},
+		{name: "analog missing P_NUM", kind: DatasetAnalog, header: []string{"TIME", "AV", "Q", "BF", "FQ", "FAI", "MS", "TEW"}, row: analogRow(1000, 1), wantAbort: true},
+		{name: "digital header", kind: DatasetDigital, header: DigitalColumns, row: digitalRow(1000, 1)},
+		{name: "digital missing DV", kind: DatasetDigital, header: []string{"TIME", "P_NUM", "Q", "BF", "FQ", "FAI", "MS", "TEW"}, row: digitalRow(1000, 1), wantAbort: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AbortCh, abortOnce = make(chan struct{}), sync.Once{}
+			defer func() { AbortCh, abortOnce = make(chan struct{}), sync.Once{} }()
+
+			path := writeCsv(t, "a.csv", tt.header, tt.row)
+			if tt.header == nil {
+				path = writeCsv(t, "a.csv", tt.row)
+			}
+			// 表头错误时读取协程中止写入并关闭缓存队列, 不发送断面
+			sections := 0
+			wg := new(sync.WaitGroup)
+			wg.Add(1)
+			if tt.kind == DatasetAnalog {
+				ch := make(chan AnalogSection, 4)
+				go ReadAnalogCsv(wg, path, ch, make(chan bool))
+				for range ch {
+					sections++
+				}
+			} else {
+				ch := make(chan DigitalSection, 4)
+				go ReadDigitalCsv(wg, path, ch, make(chan bool))
+				for range ch {
+					sections++
+				}
+			}
+			wg.Wait()
+
+			aborted := false
+			select {
+			case <-AbortCh:
+				aborted = true
+			default:
+			}
+			if aborted != tt.wantAbort || (sections == 0) != tt.wantAbort {
+				t.Errorf("aborted = %v, sections = %v, want abort: %v", aborted, sections, tt.wantAbort)
+			}
+		})
+	}
+}
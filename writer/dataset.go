@@ -0,0 +1,413 @@
+package main
+
+// #include "write_plugin.h"
+import "C"
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// 预编译数据集
+// prepare 命令把CSV文件转换为二进制数据集, 断面数据按 C.Analog/C.Digital 等结构体数组的内存布局存放, 文件末尾是断面索引
+// 写入命令读取数据集时通过mmap(只读)映射文件, 发送到缓存队列的断面直接引用映射的内存, 不需要解析CSV
+// 备注: 写入时随机浮动和GlobalID初始化仍然会为每个机组复制一份断面数据, 插件收到的不是映射的内存
+//
+// 文件格式(小端):
+// 文件头(DatasetHeaderSize字节): 8字节魔数 DatasetMagic + uint32版本 + uint32数据类型 + uint32结构体大小 + uint32保留
+//                               + uint64断面数量 + uint64索引偏移
+// 断面数据: 每个断面一个结构体数组, 从文件头之后依次存放
+// 断面索引: 每个断面 int64时间 + uint64数据偏移 + uint64结构体数量
+
+// DatasetMagic 数据集文件魔数
+const DatasetMagic = "RTDBDSET"
+
+// DatasetVersion 数据集文件版本
+const DatasetVersion = 1
+
+// DatasetHeaderSize 文件头大小, 保证断面数据按结构体对齐
+const DatasetHeaderSize = 64
+
+// datasetIndexSize 每个断面索引的大小
+const datasetIndexSize = 24
+
+// 数据集类型
+const (
+	DatasetAnalog        = 1
+	DatasetDigital       = 2
+	DatasetStaticAnalog  = 3
+	DatasetStaticDigital = 4
+)
+
+// DatasetKinds 数据集类型名称和结构体大小
+var DatasetKinds = map[uint32]struct {
+	Name string
+	Size uintptr
+}{
+	DatasetAnalog:        {"analog", unsafe.Sizeof(C.Analog{})},
+	DatasetDigital:       {"digital", unsafe.Sizeof(C.Digital{})},
+	DatasetStaticAnalog:  {"static_analog", unsafe.Sizeof(C.StaticAnalog{})},
+	DatasetStaticDigital: {"static_digital", unsafe.Sizeof(C.StaticDigital{})},
+}
+
+// DatasetKindByName 根据名称查找数据集类型
+func DatasetKindByName(name string) (uint32, error) {
+	for kind, k := range DatasetKinds {
+		if k.Name == name {
+			return kind, nil
+		}
+	}
+	return 0, fmt.Errorf("未知的数据集类型: %v, 支持的类型: analog, digital, static_analog, static_digital", name)
+}
+
+// DatasetIndex 断面索引
+type DatasetIndex struct {
+	Time   int64
+	Offset uint64
+	Count  uint64
+}
+
+// Dataset 通过mmap映射的数据集
+// 写入命令读取的数据集通过 GlobalDatasets 映射, 在程序退出前不释放(写入中的断面直接引用映射的内存); 其他用途使用后调用Close
+type Dataset struct {
+	Path  string
+	Kind  uint32
+	data  []byte
+	Index []DatasetIndex
+}
+
+// IsDatasetFile 根据文件头的魔数判断是否为数据集文件
+func IsDatasetFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = file.Close() }()
+	magic := make([]byte, len(DatasetMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return string(magic) == DatasetMagic
+}
+
+// OpenDataset 映射数据集文件, 并且校验数据类型、结构体大小和索引
+func OpenDataset(path string, kind uint32) (*Dataset, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() < DatasetHeaderSize {
+		return nil, errors.New("数据集文件不完整")
+	}
+	// 只读映射, 断面数据在写入前都会复制, 不会修改映射的内存
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("mmap: %v", err)
+	}
+
+	ds := &Dataset{Path: path, data: data}
+	if err := ds.parse(kind); err != nil {
+		_ = syscall.Munmap(data)
+		return nil, err
+	}
+	return ds, nil
+}
+
+// Close 释放映射, 之后不能再使用数据集中的断面
+func (ds *Dataset) Close() error {
+	if ds.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(ds.data)
+	ds.data = nil
+	return err
+}
+
+// DatasetCache 写入命令读取的数据集, 每个文件只映射一次, 循环回放的每一轮和多次读取复用同一个映射
+type DatasetCache struct {
+	mu       sync.Mutex
+	datasets map[string]*Dataset
+}
+
+var GlobalDatasets = &DatasetCache{}
+
+// Open 返回已经映射的数据集, 第一次读取时映射文件
+func (dc *DatasetCache) Open(path string, kind uint32) (*Dataset, error) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if ds, ok := dc.datasets[path]; ok {
+		if ds.Kind != kind {
+			return nil, fmt.Errorf("数据集类型错误: %v, 需要的类型: %v", DatasetKinds[ds.Kind].Name, DatasetKinds[kind].Name)
+		}
+		return ds, nil
+	}
+	ds, err := OpenDataset(path, kind)
+	if err != nil {
+		return nil, err
+	}
+	if dc.datasets == nil {
+		dc.datasets = make(map[string]*Dataset)
+	}
+	dc.datasets[path] = ds
+	return ds, nil
+}
+
+// parse 解析文件头和断面索引
+func (ds *Dataset) parse(kind uint32) error {
+	if string(ds.data[:len(DatasetMagic)]) != DatasetMagic {
+		return errors.New("不是数据集文件")
+	}
+	d := &HostDecoder{buf: ds.data[len(DatasetMagic):DatasetHeaderSize]}
+	version := d.Int32()
+	ds.Kind = uint32(d.Int32())
+	size := uintptr(d.Int32())
+	_ = d.Int32()
+	count := uint64(d.Int64())
+	indexOffset := uint64(d.Int64())
+	if version != DatasetVersion {
+		return fmt.Errorf("数据集版本不支持: %v", version)
+	}
+	if ds.Kind != kind {
+		return fmt.Errorf("数据集类型错误: %v, 需要的类型: %v", DatasetKinds[ds.Kind].Name, DatasetKinds[kind].Name)
+	}
+	if size != DatasetKinds[kind].Size {
+		return fmt.Errorf("数据集的结构体大小与写数程序不一致, 数据集: %v, 写数程序: %v", size, DatasetKinds[kind].Size)
+	}
+	if indexOffset > uint64(len(ds.data)) || (uint64(len(ds.data))-indexOffset)/datasetIndexSize < count {
+		return errors.New("数据集索引不完整")
+	}
+
+	ds.Index = make([]DatasetIndex, count)
+	d = &HostDecoder{buf: ds.data[indexOffset:]}
+	for i := range ds.Index {
+		ds.Index[i] = DatasetIndex{Time: d.Int64(), Offset: uint64(d.Int64()), Count: uint64(d.Int64())}
+		end := ds.Index[i].Offset + ds.Index[i].Count*uint64(size)
+		if ds.Index[i].Offset < DatasetHeaderSize || end > indexOffset || end < ds.Index[i].Offset {
+			return fmt.Errorf("第%v个断面的索引错误", i+1)
+		}
+	}
+	return nil
+}
+
+// datasetSlice 直接引用映射内存中的结构体数组
+func datasetSlice[T any](ds *Dataset, index DatasetIndex) []T {
+	if index.Count == 0 {
+		return []T{}
+	}
+	return unsafe.Slice((*T)(unsafe.Pointer(&ds.data[index.Offset])), index.Count)
+}
+
+func (ds *Dataset) AnalogSection(i int) AnalogSection {
+	return AnalogSection{Time: ds.Index[i].Time, Data: datasetSlice[C.Analog](ds, ds.Index[i])}
+}
+
+func (ds *Dataset) DigitalSection(i int) DigitalSection {
+	return DigitalSection{Time: ds.Index[i].Time, Data: datasetSlice[C.Digital](ds, ds.Index[i])}
+}
+
+func (ds *Dataset) StaticAnalogSection() StaticAnalogSection {
+	data := make([]C.StaticAnalog, 0)
+	for _, index := range ds.Index {
+		data = append(data, datasetSlice[C.StaticAnalog](ds, index)...)
+	}
+	return StaticAnalogSection{Data: data}
+}
+
+func (ds *Dataset) StaticDigitalSection() StaticDigitalSection {
+	data := make([]C.StaticDigital, 0)
+	for _, index := range ds.Index {
+		data = append(data, datasetSlice[C.StaticDigital](ds, index)...)
+	}
+	return StaticDigitalSection{Data: data}
+}
+
+// ReadAnalogDataset 按顺序把数据集中的断面发送到缓存队列, 与 ReadAnalogCsv 相同
+func ReadAnalogDataset(filepath string, ch chan AnalogSection, exitCh chan bool) {
+	defer close(ch)
+	ds, err := GlobalDatasets.Open(filepath, DatasetAnalog)
+	if err != nil {
+		panic("can not open dataset: " + filepath + ", " + err.Error())
+	}
+	for i := range ds.Index {
+		select {
+		case <-exitCh:
+			log.Println("信号中断数据集读取协程:", filepath)
+			return
+		case ch <- ds.AnalogSection(i):
+		}
+	}
+}
+
+// ReadDigitalDataset 按顺序把数据集中的断面发送到缓存队列, 与 ReadDigitalCsv 相同
+func ReadDigitalDataset(filepath string, ch chan DigitalSection, exitCh chan bool) {
+	defer close(ch)
+	ds, err := GlobalDatasets.Open(filepath, DatasetDigital)
+	if err != nil {
+		panic("can not open dataset: " + filepath + ", " + err.Error())
+	}
+	for i := range ds.Index {
+		select {
+		case <-exitCh:
+			log.Println("信号中断数据集读取协程:", filepath)
+			return
+		case ch <- ds.DigitalSection(i):
+		}
+	}
+}
+
+// DatasetWriter 写入数据集文件, 断面数据依次写入, Close 时写入索引和文件头
+type DatasetWriter struct {
+	file   *os.File
+	w      *bufio.Writer
+	kind   uint32
+	offset uint64
+	index  []DatasetIndex
+	pNum   uint64
+}
+
+func NewDatasetWriter(path string, kind uint32) (*DatasetWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	dw := &DatasetWriter{file: file, w: bufio.NewWriterSize(file, 1<<20), kind: kind, offset: DatasetHeaderSize}
+	// 文件头在 Close 时写入
+	if _, err := dw.w.Write(make([]byte, DatasetHeaderSize)); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return dw, nil
+}
+
+// writeSection 写入一个断面的结构体数组
+func writeSection[T any](dw *DatasetWriter, t int64, data []T) error {
+	raw := rawBytes(data)
+	if _, err := dw.w.Write(raw); err != nil {
+		return err
+	}
+	dw.index = append(dw.index, DatasetIndex{Time: t, Offset: dw.offset, Count: uint64(len(data))})
+	dw.offset += uint64(len(raw))
+	dw.pNum += uint64(len(data))
+	return nil
+}
+
+// Close 写入索引和文件头
+func (dw *DatasetWriter) Close() error {
+	defer func() { _ = dw.file.Close() }()
+	e := &HostEncoder{}
+	for _, index := range dw.index {
+		e.Int64(index.Time).Int64(int64(index.Offset)).Int64(int64(index.Count))
+	}
+	if _, err := dw.w.Write(e.buf); err != nil {
+		return err
+	}
+	if err := dw.w.Flush(); err != nil {
+		return err
+	}
+
+	header := &HostEncoder{buf: []byte(DatasetMagic)}
+	header.Int32(DatasetVersion).Int32(int32(dw.kind)).Int32(int32(DatasetKinds[dw.kind].Size)).Int32(0)
+	header.Int64(int64(len(dw.index))).Int64(int64(dw.offset))
+	if _, err := dw.file.WriteAt(header.buf, 0); err != nil {
+		return err
+	}
+	return dw.file.Close()
+}
+
+// DetectCsvKind 根据CSV文件的表头(或列式文件的列名)判断数据集类型
+func DetectCsvKind(path string) (uint32, error) {
+	// Parquet / Arrow IPC 文件根据列名判断
+	if format := DetectColumnar(path); format != ColumnarNone {
+		for _, kind := range []uint32{DatasetAnalog, DatasetDigital} {
+			if src, err := OpenColumnar(path, format, kind); err == nil {
+				_ = src.Close()
+				return kind, nil
+			}
+		}
+		return 0, fmt.Errorf("%v 文件缺少模拟量或数字量的列", format)
+	}
+	file, err := OpenCsvFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+	header, err := csv.NewReader(NewCRFilterReader(bufio.NewReader(file))).Read()
+	if err != nil {
+		return 0, fmt.Errorf("读取表头失败: %v", err)
+	}
+	// 列名经过 --column_map 映射, 不区分大小写
+	has := func(column string) bool {
+		return findColumn(header, GlobalColumnMapping.FileName(column)) >= 0
+	}
+	switch {
+	case has("TIME") && has("AV"):
+		return DatasetAnalog, nil
+	case has("TIME") && has("DV"):
+		return DatasetDigital, nil
+	case has("TAGT"):
+		return DatasetStaticAnalog, nil
+	case has("FACK"):
+		return DatasetStaticDigital, nil
+	}
+	return 0, fmt.Errorf("无法根据表头判断数据集类型: %v", header)
+}
+
+// PrepareDataset 把CSV文件转换为数据集, 解析过程与写入命令读取CSV完全相同
+func PrepareDataset(input string, output string, kind uint32) error {
+	dw, err := NewDatasetWriter(output, kind)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	never := make(chan bool)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	switch kind {
+	case DatasetAnalog:
+		ch := make(chan AnalogSection, GlobalPeriodic.CacheSize)
+		go ReadAnalogCsv(wg, input, ch, never)
+		for section := range ch {
+			if err == nil {
+				err = writeSection(dw, section.Time, section.Data)
+			}
+		}
+	case DatasetDigital:
+		ch := make(chan DigitalSection, GlobalPeriodic.CacheSize)
+		go ReadDigitalCsv(wg, input, ch, never)
+		for section := range ch {
+			if err == nil {
+				err = writeSection(dw, section.Time, section.Data)
+			}
+		}
+	case DatasetStaticAnalog:
+		wg.Done()
+		err = writeSection(dw, -1, ReadStaticAnalogCsv(input).Data)
+	case DatasetStaticDigital:
+		wg.Done()
+		err = writeSection(dw, -1, ReadStaticDigitalCsv(input).Data)
+	}
+	wg.Wait()
+	if err != nil {
+		_ = dw.file.Close()
+		return err
+	}
+	if err := dw.Close(); err != nil {
+		return err
+	}
+	log.Printf("prepare完成 - 输入: %v, 输出: %v, 类型: %v, 断面数量: %v, PNUM数量: %v, 文件大小: %.2f MB, 耗时: %v\n",
+		input, output, DatasetKinds[kind].Name, len(dw.index), dw.pNum, float64(dw.offset+uint64(len(dw.index))*datasetIndexSize)/1024/1024, time.Since(start))
+	return nil
+}
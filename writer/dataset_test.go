@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDatasetWriterRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	analog := []AnalogSection{testAnalogSection(t, 1000, 1, 2, 3), testAnalogSection(t, 2000), testAnalogSection(t, 3000, 4)}
+	digital := []DigitalSection{testDigitalSection(t, 1000, 1), testDigitalSection(t, 2000, 2, 3)}
+
+	analogPath := filepath.Join(dir, "analog.ds")
+	dw, err := NewDatasetWriter(analogPath, DatasetAnalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range analog {
+		if err := writeSection(dw, section.Time, section.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	digitalPath := filepath.Join(dir, "digital.ds")
+	dw, err = NewDatasetWriter(digitalPath, DatasetDigital)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range digital {
+		if err := writeSection(dw, section.Time, section.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsDatasetFile(analogPath) {
+		t.Fatalf("%v is not a dataset file", analogPath)
+	}
+	ds, err := OpenDataset(analogPath, DatasetAnalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ds.Close() }()
+	if len(ds.Index) != len(analog) {
+		t.Fatalf("sections = %v, want %v", len(ds.Index), len(analog))
+	}
+	for i, want := range analog {
+		got := ds.AnalogSection(i)
+		if got.Time != want.Time || string(rawBytes(got.Data)) != string(rawBytes(want.Data)) {
+			t.Errorf("section %v = %v(%v), want %v(%v)", i, got.Time, len(got.Data), want.Time, len(want.Data))
+		}
+	}
+
+	ds2, err := OpenDataset(digitalPath, DatasetDigital)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ds2.Close() }()
+	for i, want := range digital {
+		got := ds2.DigitalSection(i)
+		if got.Time != want.Time || string(rawBytes(got.Data)) != string(rawBytes(want.Data)) {
+			t.Errorf("section %v = %v(%v), want %v(%v)", i, got.Time, len(got.Data), want.Time, len(want.Data))
+		}
+	}
+}
+
+func TestPrepareDatasetMatchesCsv(t *testing.T) {
+	csvPath := writeCsv(t, "a.csv", AnalogColumns, analogRow(1000, 1), analogRow(1000, 2), analogRow(2000, 1), analogRow(3000, 3))
+	dsPath := filepath.Join(t.TempDir(), "a.ds")
+	if err := PrepareDataset(csvPath, dsPath, DatasetAnalog); err != nil {
+		t.Fatal(err)
+	}
+
+	// 数据集中的断面与直接读取CSV相同
+	want := make([]AnalogSection, 0)
+	ch := make(chan AnalogSection, 16)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go ReadAnalogCsv(wg, csvPath, ch, make(chan bool))
+	for section := range ch {
+		want = append(want, section)
+	}
+	wg.Wait()
+
+	ds, err := OpenDataset(dsPath, DatasetAnalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ds.Close() }()
+	if len(ds.Index) != len(want) || len(want) != 3 {
+		t.Fatalf("sections = %v, csv sections = %v, want 3", len(ds.Index), len(want))
+	}
+	for i := range want {
+		got := ds.AnalogSection(i)
+		if got.Time != want[i].Time || string(rawBytes(got.Data)) != string(rawBytes(want[i].Data)) {
+			t.Errorf("section %v = %v(%v), want %v(%v)", i, got.Time, len(got.Data), want[i].Time, len(want[i].Data))
+		}
+	}
+}
+
+func TestOpenDatasetErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "analog.ds")
+	dw, err := NewDatasetWriter(path, DatasetAnalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSection(dw, 1000, testAnalogSection(t, 1000, 1, 2).Data); err != nil {
+		t.Fatal(err)
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	badMagic := append([]byte(nil), data...)
+	badMagic[0] ^= 0xff
+
+	tests := []struct {
+		name    string
+		content []byte
+		kind    uint32
+		wantErr bool
+	}{
+		{name: "valid", content: data, kind: DatasetAnalog},
+		{name: "wrong kind", content: data, kind: DatasetDigital, wantErr: true},
+		{name: "shorter than header", content: data[:DatasetHeaderSize-1], kind: DatasetAnalog, wantErr: true},
+		{name: "truncated index", content: data[:len(data)-1], kind: DatasetAnalog, wantErr: true},
+		{name: "bad magic", content: badMagic, kind: DatasetAnalog, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			ds, err := OpenDataset(path, tt.kind)
+			if err == nil {
+				_ = ds.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+// #include "write_plugin.h"
+import "C"
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// 生成测试数据集(generate命令)
+// 每个数据集(实时快采集点、实时普通点、历史普通点)生成模拟量、数字量和对应的静态数据, 文件名与CSV目录中的文件相同
+// 每个文件使用 seed 和文件名派生的随机数生成器, 参数相同时生成的文件完全相同, 与选择了哪些数据集无关
+
+// 模拟量的值模型
+const (
+	ValueModelConstant   = "constant"    // 每个点的值固定不变
+	ValueModelRandomWalk = "random_walk" // 每个断面在上一个值的基础上加一个正态分布的步长
+	ValueModelSine       = "sine"        // 正弦波, 每个点的相位随机
+	ValueModelStep       = "step"        // 阶跃, 每个周期重新随机一个值
+)
+
+// 生成的文件格式
+const (
+	GenerateFormatCsv     = "csv"
+	GenerateFormatDataset = "dataset"
+)
+
+// GenerateSets 数据集名称和文件名前缀
+var GenerateSets = []struct {
+	Name   string
+	Prefix string
+}{
+	{"rt_fast", "REALTIME_FAST"},
+	{"rt_normal", "REALTIME_NORMAL"},
+	{"his", "HISTORY_NORMAL"},
+}
+
+// GenerateConfig generate命令的参数
+type GenerateConfig struct {
+	OutputDir    string
+	Prefix       string   // 文件名前缀, 例如 1721454092945_
+	Sets         []string // rt_fast, rt_normal, his
+	Format       string   // csv, dataset
+	Static       bool     // 是否生成静态数据
+	AnalogCount  int      // 每个断面的模拟量PNUM数量
+	DigitalCount int      // 每个断面的数字量PNUM数量
+	StartTime    int64    // 第一个断面的时间(毫秒)
+	Interval     int64    // 断面间隔(毫秒)
+	Duration     int64    // 持续时间(毫秒), 断面数量为 Duration/Interval
+	Model        string
+	Base         float64 // 模拟量的基准值
+	Amplitude    float64 // 模拟量的幅度, 每个点的基准值在[Base, Base+Amplitude)之间随机
+	Period       int64   // sine/step 的周期(毫秒)
+	WalkStep     float64 // random_walk 的步长标准差
+	QProb        float64 // Q 为true的概率
+	BfProb       float64 // BF 为true的概率
+	FqProb       float64 // FQ 为true的概率
+	MsProb       float64 // MS 为true的概率
+	FaiProb      float64 // 数字量 FAI 为true的概率
+	DvToggleProb float64 // 数字量 DV 每个断面翻转的概率
+	Seed         int64
+}
+
+// Validate 检查参数
+func (cfg *GenerateConfig) Validate() error {
+	if len(cfg.Sets) == 0 {
+		return fmt.Errorf("sets不能为空")
+	}
+	for _, name := range cfg.Sets {
+		found := false
+		for _, set := range GenerateSets {
+			found = found || set.Name == name
+		}
+		if !found {
+			return fmt.Errorf("未知的数据集: %v, 支持的数据集: rt_fast, rt_normal, his", name)
+		}
+	}
+	if cfg.Format != GenerateFormatCsv && cfg.Format != GenerateFormatDataset {
+		return fmt.Errorf("未知的格式: %v, 支持的格式: csv, dataset", cfg.Format)
+	}
+	switch cfg.Model {
+	case ValueModelConstant, ValueModelRandomWalk, ValueModelSine, ValueModelStep:
+	default:
+		return fmt.Errorf("未知的值模型: %v, 支持的值模型: constant, random_walk, sine, step", cfg.Model)
+	}
+	if cfg.AnalogCount < 0 || cfg.DigitalCount < 0 || cfg.AnalogCount+cfg.DigitalCount == 0 {
+		return fmt.Errorf("analog_count和digital_count不能小于0, 且不能同时为0")
+	}
+	if cfg.Interval <= 0 || cfg.Duration < cfg.Interval {
+		return fmt.Errorf("interval必须不小于1ms, duration不能小于interval")
+	}
+	if cfg.Period <= 0 {
+		return fmt.Errorf("period必须不小于1ms")
+	}
+	for name, p := range map[string]float64{"q_prob": cfg.QProb, "bf_prob": cfg.BfProb, "fq_prob": cfg.FqProb,
+		"ms_prob": cfg.MsProb, "fai_prob": cfg.FaiProb, "dv_toggle_prob": cfg.DvToggleProb} {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("%v必须在[0,1]之间: %v", name, p)
+		}
+	}
+	return nil
+}
+
+// Sections 断面数量
+func (cfg *GenerateConfig) Sections() int64 {
+	return cfg.Duration / cfg.Interval
+}
+
+// Path 生成文件的路径
+func (cfg *GenerateConfig) Path(name string) string {
+	ext := ".csv"
+	if cfg.Format == GenerateFormatDataset {
+		ext = ".rtds"
+	}
+	return filepath.Join(cfg.OutputDir, cfg.Prefix+name+ext)
+}
+
+// Rand 根据 seed 和文件名派生随机数生成器
+func (cfg *GenerateConfig) Rand(name string) *rand.Rand {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return rand.New(rand.NewSource(cfg.Seed ^ int64(h.Sum64())))
+}
+
+// GenerateSink 生成的断面写入CSV文件或数据集
+type GenerateSink struct {
+	path string
+	file *os.File
+	buf  *bufio.Writer
+	csv  *csv.Writer
+	ds   *DatasetWriter
+	rows int64
+}
+
+func NewGenerateSink(cfg *GenerateConfig, name string, kind uint32, header []string) (*GenerateSink, error) {
+	path := cfg.Path(name)
+	if cfg.Format == GenerateFormatDataset {
+		ds, err := NewDatasetWriter(path, kind)
+		if err != nil {
+			return nil, err
+		}
+		return &GenerateSink{path: path, ds: ds}, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriterSize(file, 1<<20)
+	sink := &GenerateSink{path: path, file: file, buf: buf, csv: csv.NewWriter(buf)}
+	if err := sink.csv.Write(header); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return sink, nil
+}
+
+// writeGenerated 写入一个断面, CSV文件通过 format 转换为CSV行
+func writeGenerated[T any](sink *GenerateSink, t int64, data []T, format func(int64, T) []string) error {
+	sink.rows += int64(len(data))
+	if sink.ds != nil {
+		return writeSection(sink.ds, t, data)
+	}
+	for i := range data {
+		if err := sink.csv.Write(format(t, data[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *GenerateSink) Close() error {
+	if sink.ds != nil {
+		return sink.ds.Close()
+	}
+	sink.csv.Flush()
+	if err := sink.csv.Error(); err != nil {
+		_ = sink.file.Close()
+		return err
+	}
+	if err := sink.buf.Flush(); err != nil {
+		_ = sink.file.Close()
+		return err
+	}
+	return sink.file.Close()
+}
+
+// chance 以概率p返回true
+func chance(r *rand.Rand, p float64) bool {
+	return r.Float64() < p
+}
+
+// randomLetters 随机小写字母字符串, 写入C结构体的char数组时 n 需要比数组长度小1, 给结尾的'\0'留出一个字节
+func randomLetters(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('a' + r.Intn(26))
+	}
+	return string(b)
+}
+
+// AnalogModel 按值模型计算每个点的模拟量
+type AnalogModel struct {
+	cfg    *GenerateConfig
+	r      *rand.Rand
+	base   []float64 // 每个点的基准值
+	phase  []float64 // sine 的相位
+	value  []float64 // random_walk 和 step 的当前值
+	period int64     // step 当前所在的周期
+}
+
+func NewAnalogModel(cfg *GenerateConfig, r *rand.Rand, count int) *AnalogModel {
+	m := &AnalogModel{cfg: cfg, r: r, base: make([]float64, count), phase: make([]float64, count), value: make([]float64, count), period: -1}
+	for i := 0; i < count; i++ {
+		m.base[i] = cfg.Base + r.Float64()*cfg.Amplitude
+		m.phase[i] = r.Float64() * 2 * math.Pi
+		m.value[i] = m.base[i]
+	}
+	return m
+}
+
+// Value 第i个点在时间t的值, 按断面顺序调用
+func (m *AnalogModel) Value(i int, t int64) float64 {
+	cfg := m.cfg
+	switch cfg.Model {
+	case ValueModelRandomWalk:
+		m.value[i] += m.r.NormFloat64() * cfg.WalkStep
+		return m.value[i]
+	case ValueModelSine:
+		return m.base[i] + cfg.Amplitude*math.Sin(2*math.Pi*float64(t-cfg.StartTime)/float64(cfg.Period)+m.phase[i])
+	case ValueModelStep:
+		return m.value[i]
+	default:
+		return m.base[i]
+	}
+}
+
+// NextSection 进入下一个断面, step 在每个周期开始时重新随机所有点的值
+func (m *AnalogModel) NextSection(t int64) {
+	if m.cfg.Model != ValueModelStep {
+		return
+	}
+	period := (t - m.cfg.StartTime) / m.cfg.Period
+	if period != m.period {
+		m.period = period
+		for i := range m.value {
+			m.value[i] = m.cfg.Base + m.r.Float64()*m.cfg.Amplitude
+		}
+	}
+}
+
+// generateAnalog 生成模拟量文件
+func generateAnalog(cfg *GenerateConfig, name string) (*GenerateSink, error) {
+	sink, err := NewGenerateSink(cfg, name, DatasetAnalog, AnalogColumns)
+	if err != nil {
+		return nil, err
+	}
+	r := cfg.Rand(name)
+	model := NewAnalogModel(cfg, r, cfg.AnalogCount)
+	data := make([]C.Analog, cfg.AnalogCount)
+	for s := int64(0); s < cfg.Sections(); s++ {
+		t := cfg.StartTime + s*cfg.Interval
+		model.NextSection(t)
+		for i := range data {
+			av := model.Value(i, t)
+			data[i] = C.Analog{
+				p_num: C.int32_t(i + 1),
+				av:    C.float(av),
+				avr:   C.float(av),
+				q:     C.bool(chance(r, cfg.QProb)),
+				bf:    C.bool(chance(r, cfg.BfProb)),
+				qf:    C.bool(chance(r, cfg.FqProb)),
+				fai:   C.float(av),
+				ms:    C.bool(chance(r, cfg.MsProb)),
+				tew:   C.char('a' + r.Intn(26)),
+				cst:   C.uint16_t(r.Intn(65536)),
+			}
+		}
+		if err := writeGenerated(sink, t, data, FormatAnalogRecord); err != nil {
+			_ = sink.Close()
+			return nil, err
+		}
+	}
+	return sink, sink.Close()
+}
+
+// generateDigital 生成数字量文件
+func generateDigital(cfg *GenerateConfig, name string) (*GenerateSink, error) {
+	sink, err := NewGenerateSink(cfg, name, DatasetDigital, DigitalColumns)
+	if err != nil {
+		return nil, err
+	}
+	r := cfg.Rand(name)
+	dv := make([]bool, cfg.DigitalCount)
+	for i := range dv {
+		dv[i] = r.Intn(2) == 1
+	}
+	data := make([]C.Digital, cfg.DigitalCount)
+	for s := int64(0); s < cfg.Sections(); s++ {
+		t := cfg.StartTime + s*cfg.Interval
+		for i := range data {
+			if s > 0 && chance(r, cfg.DvToggleProb) {
+				dv[i] = !dv[i]
+			}
+			data[i] = C.Digital{
+				p_num: C.int32_t(i + 1),
+				dv:    C.bool(dv[i]),
+				dvr:   C.bool(dv[i]),
+				q:     C.bool(chance(r, cfg.QProb)),
+				bf:    C.bool(chance(r, cfg.BfProb)),
+				bq:    C.bool(chance(r, cfg.FqProb)),
+				fai:   C.bool(chance(r, cfg.FaiProb)),
+				ms:    C.bool(chance(r, cfg.MsProb)),
+				tew:   C.char('a' + r.Intn(26)),
+				cst:   C.uint16_t(r.Intn(65536)),
+			}
+		}
+		if err := writeGenerated(sink, t, data, FormatDigitalRecord); err != nil {
+			_ = sink.Close()
+			return nil, err
+		}
+	}
+	return sink, sink.Close()
+}
+
+// generateStaticAnalog 生成静态模拟量文件, 格式与CSV目录中的 *_STATIC_ANALOG.csv 相同
+func generateStaticAnalog(cfg *GenerateConfig, name string) (*GenerateSink, error) {
+	sink, err := NewGenerateSink(cfg, name, DatasetStaticAnalog, StaticAnalogColumns)
+	if err != nil {
+		return nil, err
+	}
+	r := cfg.Rand(name)
+	records := make([][]string, 0, cfg.AnalogCount)
+	for i := 0; i < cfg.AnalogCount; i++ {
+		record := []string{strconv.Itoa(i + 1), strconv.Itoa(r.Intn(65536)), strconv.Itoa(r.Intn(65536))}
+		for j := 0; j < 8; j++ {
+			record = append(record, "False")
+		}
+		record = append(record, randomLetters(r, 31), randomLetters(r, 31), randomLetters(r, 127), randomLetters(r, 31), "999", "0")
+		records = append(records, record)
+	}
+	if sink.ds != nil {
+		section := StaticAnalogSection{}
+		for _, record := range records {
+			staticAnalog, _ := ParseStaticAnalogRecord(record)
+			section.Data = append(section.Data, staticAnalog)
+		}
+		err = writeGenerated(sink, -1, section.Data, nil)
+	} else {
+		err = writeGenerated(sink, -1, records, func(_ int64, record []string) []string { return record })
+	}
+	if err != nil {
+		_ = sink.Close()
+		return nil, err
+	}
+	return sink, sink.Close()
+}
+
+// generateStaticDigital 生成静态数字量文件, 格式与CSV目录中的 *_STATIC_DIGITAL.csv 相同
+func generateStaticDigital(cfg *GenerateConfig, name string) (*GenerateSink, error) {
+	sink, err := NewGenerateSink(cfg, name, DatasetStaticDigital, StaticDigitalColumns)
+	if err != nil {
+		return nil, err
+	}
+	r := cfg.Rand(name)
+	records := make([][]string, 0, cfg.DigitalCount)
+	for i := 0; i < cfg.DigitalCount; i++ {
+		records = append(records, []string{strconv.Itoa(i + 1), strconv.Itoa(r.Intn(65536)),
+			randomLetters(r, 31), randomLetters(r, 31), randomLetters(r, 127), randomLetters(r, 31)})
+	}
+	if sink.ds != nil {
+		section := StaticDigitalSection{}
+		for _, record := range records {
+			staticDigital, _ := ParseStaticDigitalRecord(record)
+			section.Data = append(section.Data, staticDigital)
+		}
+		err = writeGenerated(sink, -1, section.Data, nil)
+	} else {
+		err = writeGenerated(sink, -1, records, func(_ int64, record []string) []string { return record })
+	}
+	if err != nil {
+		_ = sink.Close()
+		return nil, err
+	}
+	return sink, sink.Close()
+}
+
+// GenerateDataset 按参数生成所有文件
+func GenerateDataset(cfg *GenerateConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return err
+	}
+	start := time.Now()
+	files := 0
+	rows := int64(0)
+	for _, set := range GenerateSets {
+		selected := false
+		for _, name := range cfg.Sets {
+			selected = selected || name == set.Name
+		}
+		if !selected {
+			continue
+		}
+		type generator struct {
+			name  string
+			count int
+			fn    func(*GenerateConfig, string) (*GenerateSink, error)
+		}
+		generators := []generator{
+			{set.Prefix + "_ANALOG", cfg.AnalogCount, generateAnalog},
+			{set.Prefix + "_DIGITAL", cfg.DigitalCount, generateDigital},
+		}
+		if cfg.Static {
+			generators = append(generators,
+				generator{set.Prefix + "_STATIC_ANALOG", cfg.AnalogCount, generateStaticAnalog},
+				generator{set.Prefix + "_STATIC_DIGITAL", cfg.DigitalCount, generateStaticDigital})
+		}
+		for _, g := range generators {
+			if g.count == 0 {
+				continue
+			}
+			sink, err := g.fn(cfg, g.name)
+			if err != nil {
+				return fmt.Errorf("%v: %v", cfg.Path(g.name), err)
+			}
+			log.Printf("生成文件: %v, PNUM数量: %v\n", sink.path, sink.rows)
+			files++
+			rows += sink.rows
+		}
+	}
+	log.Printf("generate完成 - 输出目录: %v, 格式: %v, 值模型: %v, 断面数量: %v, 断面间隔: %vms, 文件数量: %v, PNUM数量: %v, seed: %v, 耗时: %v\n",
+		cfg.OutputDir, cfg.Format, cfg.Model, cfg.Sections(), cfg.Interval, files, rows, cfg.Seed, time.Since(start))
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 压缩格式, 根据扩展名或者文件头的魔数识别
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+	CompressionXz   = "xz"
+)
+
+// CompressionFormats 压缩格式的扩展名和魔数
+var CompressionFormats = []struct {
+	Name  string
+	Ext   string
+	Magic []byte
+}{
+	{CompressionGzip, ".gz", []byte{0x1f, 0x8b}},
+	{CompressionZstd, ".zst", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CompressionXz, ".xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+// DetectCompression 识别压缩格式, 优先使用扩展名, 扩展名无法识别时检查文件头的魔数
+func DetectCompression(path string, header []byte) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range CompressionFormats {
+		if ext == f.Ext {
+			return f.Name
+		}
+	}
+	for _, f := range CompressionFormats {
+		if bytes.HasPrefix(header, f.Magic) {
+			return f.Name
+		}
+	}
+	return CompressionNone
+}
+
+// DecompressCollector 统计解压耗时, 解压在读取协程中进行, 不计入写入耗时
+type DecompressCollector struct {
+	files    atomic.Int64
+	bytes    atomic.Int64
+	duration atomic.Int64
+}
+
+func (dc *DecompressCollector) Print() {
+	if dc.files.Load() == 0 {
+		return
+	}
+	log.Printf("解压耗时(不计入写入耗时): %v, 压缩文件数量: %v, 解压后数据量: %.2f MB\n",
+		time.Duration(dc.duration.Load()), dc.files.Load(), float64(dc.bytes.Load())/1024/1024)
+}
+
+var GlobalDecompress = &DecompressCollector{}
+
+// DecompressReader 解压读取器, 统计解压耗时(包含读取压缩文件的耗时)
+type DecompressReader struct {
+	reader io.Reader
+	file   *os.File
+	closer io.Closer // 解压器需要关闭时不为nil
+}
+
+func (r *DecompressReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.reader.Read(p)
+	GlobalDecompress.duration.Add(int64(time.Since(start)))
+	GlobalDecompress.bytes.Add(int64(n))
+	return n, err
+}
+
+func (r *DecompressReader) Close() error {
+	if r.closer != nil {
+		_ = r.closer.Close()
+	}
+	return r.file.Close()
+}
+
+// OpenCsvFile 打开CSV文件, .gz/.zst/.xz 压缩文件在读取时透明解压
+// 返回值交给 bufio.Reader 和 CrFilterReader 继续处理
+func OpenCsvFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReader(file)
+	header, _ := buffered.Peek(8)
+
+	r := &DecompressReader{file: file}
+	switch DetectCompression(path, header) {
+	case CompressionGzip:
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("gzip: %v", err)
+		}
+		r.reader, r.closer = gz, gz
+	case CompressionZstd:
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("zstd: %v", err)
+		}
+		r.reader, r.closer = zr, zr.IOReadCloser()
+	case CompressionXz:
+		xr, err := xz.NewReader(buffered)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("xz: %v", err)
+		}
+		r.reader = xr
+	default:
+		return struct {
+			io.Reader
+			io.Closer
+		}{buffered, file}, nil
+	}
+	GlobalDecompress.files.Add(1)
+	return r, nil
+}
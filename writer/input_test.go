@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestDetectCompression(t *testing.T) {
+	tests := []struct {
+		path   string
+		header []byte
+		want   string
+	}{
+		{"a.csv.gz", nil, CompressionGzip},
+		{"A.CSV.GZ", nil, CompressionGzip},
+		{"a.csv.zst", nil, CompressionZstd},
+		{"a.csv.xz", nil, CompressionXz},
+		{"a.csv", []byte{0x1f, 0x8b, 0x08, 0x00}, CompressionGzip},
+		{"a.csv", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x04}, CompressionZstd},
+		{"a.csv", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, CompressionXz},
+		{"a", []byte{0xfd, '7', 'z', 'X', 'Z'}, CompressionNone},
+		{"a.csv", []byte("TIME,P_NUM"), CompressionNone},
+		{"a.csv", nil, CompressionNone},
+		// 扩展名优先于魔数
+		{"a.gz", []byte{0x28, 0xb5, 0x2f, 0xfd}, CompressionGzip},
+	}
+	for _, tt := range tests {
+		if got := DetectCompression(tt.path, tt.header); got != tt.want {
+			t.Errorf("DetectCompression(%v, % x) = %q, want %q", tt.path, tt.header, got, tt.want)
+		}
+	}
+}
+
+// compress 按 format 压缩数据
+func compress(t *testing.T, format string, data []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	var err error
+	switch format {
+	case CompressionGzip:
+		w := gzip.NewWriter(buf)
+		if _, err = w.Write(data); err == nil {
+			err = w.Close()
+		}
+	case CompressionZstd:
+		var w *zstd.Encoder
+		if w, err = zstd.NewWriter(buf); err == nil {
+			if _, err = w.Write(data); err == nil {
+				err = w.Close()
+			}
+		}
+	case CompressionXz:
+		var w *xz.Writer
+		if w, err = xz.NewWriter(buf); err == nil {
+			if _, err = w.Write(data); err == nil {
+				err = w.Close()
+			}
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readAnalogSections 通过 ReadAnalogCsv 读取文件, 超时说明读取没有结束
+func readAnalogSections(t *testing.T, path string) []AnalogSection {
+	t.Helper()
+	ch := make(chan AnalogSection, 16)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go ReadAnalogCsv(wg, path, ch, make(chan bool))
+	sections := make([]AnalogSection, 0)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case section, ok := <-ch:
+			if !ok {
+				wg.Wait()
+				return sections
+			}
+			sections = append(sections, section)
+		case <-timeout:
+			t.Fatalf("%v: reading did not finish", path)
+		}
+	}
+}
+
+func TestReadAnalogCsvCompressed(t *testing.T) {
+	rows := make([][]string, 0)
+	for ts := int64(1000); ts < 1200; ts++ {
+		rows = append(rows, analogRow(ts, 1), analogRow(ts, 2))
+	}
+	plainPath := writeCsv(t, "a.csv", AnalogColumns, rows...)
+	plain, err := os.ReadFile(plainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := readAnalogSections(t, plainPath)
+	if len(want) != 200 {
+		t.Fatalf("plain sections = %v, want 200", len(want))
+	}
+
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name   string
+		format string
+	}{
+		{"a.csv.gz", CompressionGzip},
+		{"a.csv.zst", CompressionZstd},
+		{"a.csv.xz", CompressionXz},
+		// 没有压缩扩展名时按魔数识别
+		{"gzip.csv", CompressionGzip},
+		{"zstd.csv", CompressionZstd},
+		{"xz.csv", CompressionXz},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, compress(t, tt.format, plain), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got := readAnalogSections(t, path)
+			if len(got) != len(want) {
+				t.Fatalf("sections = %v, want %v", len(got), len(want))
+			}
+			for i := range want {
+				if got[i].Time != want[i].Time || string(rawBytes(got[i].Data)) != string(rawBytes(want[i].Data)) {
+					t.Fatalf("section %v = %v, want %v", i, got[i].Time, want[i].Time)
+				}
+			}
+		})
+	}
+}
+
+func TestReadAnalogCsvTruncated(t *testing.T) {
+	rows := make([][]string, 0)
+	for ts := int64(1000); ts < 2000; ts++ {
+		rows = append(rows, analogRow(ts, 1))
+	}
+	plain, err := os.ReadFile(writeCsv(t, "a.csv", AnalogColumns, rows...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, format := range []string{CompressionGzip, CompressionZstd, CompressionXz} {
+		t.Run(format, func(t *testing.T) {
+			AbortCh, abortOnce = make(chan struct{}), sync.Once{}
+			defer func() { AbortCh, abortOnce = make(chan struct{}), sync.Once{} }()
+
+			// 压缩文件被截断时每次读取都返回同一个错误, 读取协程应当中止写入并结束, 而不是反复重试
+			data := compress(t, format, plain)
+			path := filepath.Join(dir, "truncated_"+format+".csv")
+			if err := os.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+				t.Fatal(err)
+			}
+			got := readAnalogSections(t, path)
+			if len(got) >= len(rows) {
+				t.Errorf("sections = %v, want fewer than %v", len(got), len(rows))
+			}
+			select {
+			case <-AbortCh:
+			default:
+				t.Errorf("truncated %v file did not abort the write", format)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// 循环回放(--loop, --loop_until)
+// 数据集通常只覆盖几分钟, 长时间的稳定性测试需要反复回放同一个数据集:
+// * 每一轮重新读取输入文件, 断面时间加上 轮数*数据集时长, 保证时间戳单调递增
+// * 数据集时长 = 最后一个断面时间 - 第一个断面时间 + 平均断面间隔, 由第一轮读取的断面计算
+// * 写入的每个断面记录所在的轮数, 写入统计按轮累加(见 stats.go), 统计结果中按轮输出
+
+// LoopCollector 循环回放的配置
+type LoopCollector struct {
+	Count int64         // 回放轮数, 为0时不限制轮数(由Until限制)
+	Until time.Duration // 从开始读取起超过该时长后不再开始新的一轮, 为0时不限制
+
+	once  sync.Once
+	start time.Time
+}
+
+var GlobalLoop = &LoopCollector{Count: 1}
+
+// Enabled 是否循环回放
+func (lc *LoopCollector) Enabled() bool {
+	return lc.Count != 1 || lc.Until > 0
+}
+
+// Validate 检查循环回放的参数
+func (lc *LoopCollector) Validate() error {
+	if lc.Count < 0 {
+		return fmt.Errorf("--loop 不能小于0: %v", lc.Count)
+	}
+	if lc.Until < 0 {
+		return fmt.Errorf("--loop_until 不能小于0: %v", lc.Until)
+	}
+	if lc.Count == 0 && lc.Until == 0 {
+		return fmt.Errorf("--loop=0 表示不限制轮数, 需要通过 --loop_until 指定回放时长")
+	}
+	return nil
+}
+
+// Next 是否开始第 loop 轮(从0开始)
+func (lc *LoopCollector) Next(loop int64) bool {
+	lc.once.Do(func() { lc.start = time.Now() })
+	if loop == 0 {
+		return true
+	}
+	if !lc.Enabled() {
+		return false
+	}
+	if lc.Count > 0 && loop >= lc.Count {
+		return false
+	}
+	return lc.Until <= 0 || time.Since(lc.start) < lc.Until
+}
+
+// LoopSpan 数据集时长, 下一轮的时间偏移, first/last 为第一轮第一个和最后一个断面的时间
+func LoopSpan(first int64, last int64, count int64) int64 {
+	step := int64(1)
+	if count > 1 && last > first {
+		step = (last - first) / (count - 1)
+	}
+	return last - first + step
+}
+
+// MaxLoopSummaries 最多输出多少轮的统计, 超过时只输出前后各一半
+const MaxLoopSummaries = 100
+
+// PrintLoopSummary 按轮输出写入统计, 不循环回放时不输出
+func PrintLoopSummary(prefix string, stats *WriteStats) {
+	if !GlobalLoop.Enabled() {
+		return
+	}
+	loops, loopStats := stats.Loops()
+	log.Printf("%v循环回放 - 轮数: %v\n", prefix, len(loops))
+	for i, loop := range loops {
+		if len(loops) > MaxLoopSummaries && i >= MaxLoopSummaries/2 && i < len(loops)-MaxLoopSummaries/2 {
+			if i == MaxLoopSummaries/2 {
+				log.Printf("%v... 省略 %v 轮\n", prefix, len(loops)-MaxLoopSummaries)
+			}
+			continue
+		}
+		ls := loopStats[i]
+		all, count, avg, max, _, p99, _, _, pNum := ls.Summary()
+		log.Printf("%v第%v轮 - 断面时间: [%v, %v], 断面数量: %v, PNUM数量: %v, 写入耗时: %v, 平均耗时: %v, P99耗时: %v, 最长耗时: %v, 失败断面数量: %v\n",
+			prefix, loop+1, ls.FirstTime, ls.LastTime, count, pNum, all, avg, p99, max, ls.FailedSections,
+		)
+	}
+}
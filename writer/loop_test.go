@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoopSpan(t *testing.T) {
+	tests := []struct {
+		name               string
+		first, last, count int64
+		want               int64
+	}{
+		{"evenly spaced", 1000, 5000, 5, 5000},
+		{"uneven spacing uses average", 0, 1000, 3, 1500},
+		{"single section", 1000, 1000, 1, 1},
+		{"same time", 1000, 1000, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LoopSpan(tt.first, tt.last, tt.count); got != tt.want {
+				t.Errorf("LoopSpan(%v, %v, %v) = %v, want %v", tt.first, tt.last, tt.count, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoopCollector(t *testing.T) {
+	tests := []struct {
+		name    string
+		count   int64
+		until   time.Duration
+		wantErr bool
+		enabled bool
+		wait    time.Duration // 第0轮开始后等待的时间
+		next    []bool        // 从第0轮开始依次是否开始
+	}{
+		{name: "default", count: 1, next: []bool{true, false}},
+		{name: "3 loops", count: 3, enabled: true, next: []bool{true, true, true, false}},
+		{name: "until", count: 0, until: time.Hour, enabled: true, next: []bool{true, true, true, true}},
+		{name: "until expired", count: 5, until: time.Millisecond, wait: 2 * time.Millisecond, enabled: true, next: []bool{true, false}},
+		{name: "unbounded", count: 0, wantErr: true},
+		{name: "negative count", count: -1, wantErr: true},
+		{name: "negative until", count: 1, until: -time.Second, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lc := &LoopCollector{Count: tt.count, Until: tt.until}
+			if err := lc.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate = %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if lc.Enabled() != tt.enabled {
+				t.Errorf("Enabled = %v, want %v", lc.Enabled(), tt.enabled)
+			}
+			for loop, want := range tt.next {
+				if got := lc.Next(int64(loop)); got != want {
+					t.Errorf("Next(%v) = %v, want %v", loop, got, want)
+				}
+				if loop == 0 {
+					time.Sleep(tt.wait)
+				}
+			}
+		})
+	}
+}
@@ -16,10 +16,13 @@ import (
 	"math/rand"
 	"os"
 	"os/signal"
+	"runtime"
+	"runtime/cgo"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
@@ -40,21 +43,388 @@ const FastRegularWritePeriodic = 1
 // NormalRegularWritePeriodic 普通点写入周期, 400毫秒
 const NormalRegularWritePeriodic = 400
 
-// WriteSectionInfo  每次写入断面, 记录基本信息
+// FastCacheBatchSize 开启快采点缓存时每次批量写入的断面数量
+const FastCacheBatchSize = 100
+
+// MaxWriteErrorMessages 统计结果中最多输出的写入错误信息数量
+const MaxWriteErrorMessages = 10
+
+// WriteSectionInfo  每次写入断面, 记录基本信息, 模拟量和数字量各一条, 由 WriteStats.Add 累加到统计中, 不保留
 type WriteSectionInfo struct {
-	UnitNumber   int64         // 机组数量
-	Time         int64         // 断面时间
-	Duration     time.Duration // 写入断面消耗的时间
-	SectionCount int64         // 断面数量
-	PNumCount    int64         // PNum数量
+	UnitNumber      int64         // 机组数量
+	Time            int64         // 断面时间
+	Duration        time.Duration // 写入断面消耗的时间
+	SectionCount    int64         // 断面数量
+	PNumCount       int64         // PNum数量
+	FailedCount     int64         // 写入失败的调用次数(每个机组调用一次插件)
+	FailedPNumCount int64         // 写入失败的PNum数量(按机组累计)
+	Ack             *AckGroup     // 异步写入请求, 同步写入时为nil
+	Loop            int64         // 循环回放的轮数, 从0开始
+	Scheduled       time.Time     // 周期性写入时计划开始写入的时间, 其他写入方式为零值
+	Started         time.Time     // 周期性写入时实际开始写入的时间
+	Missed          bool          // 周期性写入时没有在下一个周期开始前写完, 即错过截止时间
+}
+
+// WriteStatus 一次写入(包含所有机组)的结果
+type WriteStatus struct {
+	FailedCount     int64     // 写入失败的调用次数
+	FailedPNumCount int64     // 写入失败的PNum数量(按机组累计)
+	Ack             *AckGroup // 异步写入请求, 同步写入时为nil
+}
+
+// Record 记录一次插件调用的结果, 可以被多个机组协程并发调用
+func (ws *WriteStatus) Record(err error, pNumCount int) {
+	if err == nil {
+		return
+	}
+	atomic.AddInt64(&ws.FailedCount, 1)
+	atomic.AddInt64(&ws.FailedPNumCount, int64(pNumCount))
+	GlobalWriteErrors.Add(err)
+}
+
+// WriteErrorCollector 收集写入错误, 只保留前 MaxWriteErrorMessages 条错误信息
+type WriteErrorCollector struct {
+	mu       sync.Mutex
+	count    int64
+	messages []string
+}
+
+func (c *WriteErrorCollector) Add(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count++
+	if len(c.messages) < MaxWriteErrorMessages {
+		c.messages = append(c.messages, err.Error())
+	}
+}
+
+// Print 输出错误数量和前 MaxWriteErrorMessages 条错误信息
+func (c *WriteErrorCollector) Print() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.count == 0 {
+		return
+	}
+	log.Printf("写入错误数量: %v, 前%v条错误信息:\n", c.count, len(c.messages))
+	for i, msg := range c.messages {
+		log.Printf("\t%v: %v\n", i+1, msg)
+	}
+}
+
+var GlobalWriteErrors = &WriteErrorCollector{}
+
+// AlignCollector 统计模拟量和数字量断面按时间戳对齐的结果, 只保留前 MaxWriteErrorMessages 条不对齐的断面
+type AlignCollector struct {
+	Strict      bool // 为true时出现第一个不对齐的断面就中止写入
+	mu          sync.Mutex
+	matched     int64
+	analogOnly  int64
+	digitalOnly int64
+	messages    []string
+}
+
+// Match 模拟量和数字量时间戳一致
+func (ac *AlignCollector) Match() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.matched++
+}
+
+// Gap 只有一侧存在的断面, isAnalog 表示存在的一侧, path 为缺少断面的CSV文件
+func (ac *AlignCollector) Gap(isAnalog bool, t int64, path string) {
+	ac.mu.Lock()
+	msg := ""
+	if isAnalog {
+		ac.analogOnly++
+		msg = fmt.Sprintf("time: %v, 只有模拟量, 数字量文件缺少此断面: %v", t, path)
+	} else {
+		ac.digitalOnly++
+		msg = fmt.Sprintf("time: %v, 只有数字量, 模拟量文件缺少此断面: %v", t, path)
+	}
+	if len(ac.messages) < MaxWriteErrorMessages {
+		ac.messages = append(ac.messages, msg)
+	}
+	ac.mu.Unlock()
+
+	if ac.Strict {
+		Abort("断面时间戳不对齐, " + msg)
+	}
+}
+
+// Print 输出对齐结果
+func (ac *AlignCollector) Print() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.matched == 0 && ac.analogOnly == 0 && ac.digitalOnly == 0 {
+		return
+	}
+	log.Printf("断面对齐 - 对齐断面数量: %v, 只有模拟量的断面数量: %v, 只有数字量的断面数量: %v\n", ac.matched, ac.analogOnly, ac.digitalOnly)
+	if len(ac.messages) == 0 {
+		return
+	}
+	log.Printf("前%v条不对齐的断面:\n", len(ac.messages))
+	for i, msg := range ac.messages {
+		log.Printf("\t%v: %v\n", i+1, msg)
+	}
+}
+
+var GlobalAlign = &AlignCollector{}
+
+// FlushCollector 调用插件的flush并统计flush的次数和耗时
+// 快采点和普通点的写入协程并发写入, flush与写入互斥: 写入期间持有读锁, flush等正在进行的写入返回后再调用插件的flush
+type FlushCollector struct {
+	Every int64 // 每写入Every个断面调用一次flush, 为0时只在写入结束时调用
+
+	writing      sync.RWMutex
+	mu           sync.Mutex
+	sectionCount int64
+	count        int64
+	failedCount  int64
+	duration     time.Duration
+}
+
+// Flush 调用一次插件的flush, 返回flush耗时, 插件不支持flush时直接返回0
+func (fc *FlushCollector) Flush() time.Duration {
+	if GlobalPlugin == nil || GlobalPlugin.Info().Capabilities&PluginCapFlush == 0 {
+		return 0
+	}
+	fc.writing.Lock()
+	t := time.Now()
+	err := GlobalPlugin.Flush()
+	d := time.Since(t)
+	fc.writing.Unlock()
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.count++
+	fc.duration += d
+	if err != nil {
+		fc.failedCount++
+		GlobalWriteErrors.Add(err)
+	}
+	return d
+}
+
+// AfterSections 累计已写入的断面数量, 每满Every个断面调用一次flush, 返回flush耗时
+func (fc *FlushCollector) AfterSections(n int64) time.Duration {
+	if fc.Every <= 0 || n <= 0 {
+		return 0
+	}
+	fc.mu.Lock()
+	before := fc.sectionCount
+	fc.sectionCount += n
+	need := fc.sectionCount/fc.Every != before/fc.Every
+	fc.mu.Unlock()
+	if !need {
+		return 0
+	}
+	return fc.Flush()
+}
+
+// Writing 开始一次写入, 返回写入结束时调用的函数, 写入期间不会调用flush
+// 异步写入只保证flush时已经提交的请求不在提交过程中, 不等待插件确认
+func (fc *FlushCollector) Writing() func() {
+	fc.writing.RLock()
+	return fc.writing.RUnlock
+}
+
+// Duration flush总耗时
+func (fc *FlushCollector) Duration() time.Duration {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.duration
+}
+
+// Print 输出flush次数和耗时, 插件不支持flush时不输出
+func (fc *FlushCollector) Print() {
+	if GlobalPlugin == nil || GlobalPlugin.Info().Capabilities&PluginCapFlush == 0 {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	log.Printf("flush time: %v, flush次数: %v, flush失败次数: %v\n", fc.duration, fc.count, fc.failedCount)
+}
+
+var GlobalFlush = &FlushCollector{}
+
+// AckGroup 一次异步写入(包含所有机组)提交的请求, 所有请求都被插件确认后才算确认
+type AckGroup struct {
+	Name   string    // 插件函数名
+	Submit time.Time // 提交时间
+
+	mu              sync.Mutex
+	pending         int64 // 未确认的请求数量, 初始为1, 所有机组提交完成后调用Seal减1
+	acked           time.Time
+	done            bool
+	failedCount     int64
+	failedPNumCount int64
+	onDone          []func()
+}
+
+func NewAckGroup(name string) *AckGroup {
+	return &AckGroup{Name: name, Submit: time.Now(), pending: 1}
+}
+
+func (g *AckGroup) add() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pending++
+}
+
+func (g *AckGroup) finish(failed bool, pNumCount int) {
+	g.mu.Lock()
+	if failed {
+		g.failedCount++
+		g.failedPNumCount += int64(pNumCount)
+	}
+	g.pending--
+	if g.pending != 0 {
+		g.mu.Unlock()
+		return
+	}
+	g.acked = time.Now()
+	g.done = true
+	onDone := g.onDone
+	g.onDone = nil
+	g.mu.Unlock()
+	for _, f := range onDone {
+		f()
+	}
+}
+
+// OnDone 所有请求都被确认后调用f, 已经确认时立即调用
+func (g *AckGroup) OnDone(f func()) {
+	g.mu.Lock()
+	if !g.done {
+		g.onDone = append(g.onDone, f)
+		g.mu.Unlock()
+		return
+	}
+	g.mu.Unlock()
+	f()
+}
+
+// Seal 所有机组提交完成, 之后最后一个请求被确认时记录确认时间
+func (g *AckGroup) Seal() {
+	if g == nil {
+		return
+	}
+	g.finish(false, 0)
+}
+
+// Latency 提交到确认的耗时, 还有请求未确认时返回false
+func (g *AckGroup) Latency() (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.acked.Sub(g.Submit), g.done
+}
+
+// Failed 插件确认写入失败的请求数量和PNum数量(按机组累计)
+func (g *AckGroup) Failed() (int64, int64) {
+	if g == nil {
+		return 0, 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.failedCount, g.failedPNumCount
+}
+
+type ackRequest struct {
+	group     *AckGroup
+	pNumCount int
+}
+
+// AckTracker 跟踪所有未确认的异步写入请求, 请求ID全局唯一
+type AckTracker struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	nextId   int64
+	requests map[int64]ackRequest
+}
+
+// Submit 提交前登记请求, 返回请求ID
+func (t *AckTracker) Submit(group *AckGroup, pNumCount int) int64 {
+	group.add()
+	t.wg.Add(1)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.requests == nil {
+		t.requests = make(map[int64]ackRequest)
+	}
+	t.nextId++
+	t.requests[t.nextId] = ackRequest{group: group, pNumCount: pNumCount}
+	return t.nextId
+}
+
+func (t *AckTracker) remove(requestId int64) (ackRequest, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	req, ok := t.requests[requestId]
+	if ok {
+		delete(t.requests, requestId)
+	}
+	return req, ok
+}
+
+// Cancel 提交失败, 插件不会再确认此请求
+func (t *AckTracker) Cancel(requestId int64) {
+	if req, ok := t.remove(requestId); ok {
+		req.group.finish(false, 0)
+		t.wg.Done()
+	}
+}
+
+// Ack 插件确认请求, 可以被插件的任意线程调用
+func (t *AckTracker) Ack(requestId int64, status int) {
+	req, ok := t.remove(requestId)
+	if !ok {
+		GlobalWriteErrors.Add(fmt.Errorf("unknown request_id: %v, status: %v", requestId, status))
+		return
+	}
+	if status != 0 {
+		GlobalWriteErrors.Add(fmt.Errorf("%v failed, request_id: %v, status: %v", req.group.Name, requestId, status))
+	}
+	req.group.finish(status != 0, req.pNumCount)
+	t.wg.Done()
+}
+
+// Pending 未确认的请求数量
+func (t *AckTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.requests)
+}
+
+// Wait 等待所有请求被确认, 超时返回false
+func (t *AckTracker) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
 
-var FastAnalogWriteSectionInfoList = make([]WriteSectionInfo, 0)
-var FastDigitalWriteSectionInfoList = make([]WriteSectionInfo, 0)
-var NormalAnalogWriteSectionInfoList = make([]WriteSectionInfo, 0)
-var NormalDigitalWriteSectionInfoList = make([]WriteSectionInfo, 0)
-var FastSleepDurationList = make([]time.Duration, 0)
-var NormalSleepDurationList = make([]time.Duration, 0)
+var GlobalAcks = &AckTracker{}
+
+// AckWaitTimeout 写入结束后等待异步写入确认的最长时间
+const AckWaitTimeout = 60 * time.Second
+
+// WaitAcks 写入结束后等待所有异步写入请求被确认, 同步写入时直接返回
+func WaitAcks() {
+	if GlobalPlugin == nil || !GlobalPlugin.Async() {
+		return
+	}
+	t := time.Now()
+	if !GlobalAcks.Wait(AckWaitTimeout) {
+		log.Printf("等待异步写入确认超时(%v), 未确认请求数量: %v\n", AckWaitTimeout, GlobalAcks.Pending())
+	}
+	log.Println("ack wait time: ", time.Since(t))
+}
 
 func DurationListToFloatList(durationList []time.Duration) []float64 {
 	rtn := make([]float64, 0)
@@ -64,171 +434,237 @@ func DurationListToFloatList(durationList []time.Duration) []float64 {
 	return rtn
 }
 
-func Summary(analogList []WriteSectionInfo, digitalList []WriteSectionInfo) (time.Duration, int, time.Duration, time.Duration, time.Duration, time.Duration, time.Duration, time.Duration, int) {
-	infoLen := len(analogList)
-	if len(digitalList) > infoLen {
-		infoLen = len(digitalList)
-	}
-	infoList := make([]WriteSectionInfo, infoLen)
-	for i, info := range analogList {
-		infoList[i] = WriteSectionInfo{
-			Duration:     info.Duration,
-			SectionCount: info.SectionCount,
-			PNumCount:    info.PNumCount,
-			Time:         info.Time,
-			UnitNumber:   info.UnitNumber,
-		}
-	}
+// Summary 统计写入耗时, 模拟量和数字量的一次写入合并计算
+// 返回值: 总耗时, 断面数量, 平均耗时, 最长耗时, 最短耗时, P99耗时, P95耗时, 中位数耗时, PNum数量
+func Summary(stats *WriteStats) (time.Duration, int, time.Duration, time.Duration, time.Duration, time.Duration, time.Duration, time.Duration, int) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	return stats.total.Summary()
+}
+
+// FailSummary 统计写入失败信息, 模拟量和数字量任意一个写入失败则认为断面写入失败
+// 返回值: 失败断面数量, 失败调用次数, 失败PNum数量
+func FailSummary(stats *WriteStats) (int, int, int) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	return int(stats.total.FailedSections), int(stats.total.FailedCount), int(stats.total.FailedPNumCount)
+}
+
+// PrintFailSummary 输出写入失败信息
+func PrintFailSummary(prefix string, stats *WriteStats) {
+	failedSection, failedCount, failedPNum := FailSummary(stats)
+	log.Printf("%v失败断面数量: %v, 失败调用次数: %v, 失败PNUM数量(按机组累计): %v\n", prefix, failedSection, failedCount, failedPNum)
+}
+
+// AckSummary 统计异步写入提交到确认的耗时, 模拟量和数字量合并, 从最先提交到最后确认
+// 返回值: 是否为异步写入, 已确认断面数量, 平均耗时, 最长耗时, P99耗时, P95耗时, 中位数耗时, 未确认断面数量
+func AckSummary(stats *WriteStats) (bool, int, time.Duration, time.Duration, time.Duration, time.Duration, time.Duration, int) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	h := &stats.acks
+	return stats.async, int(h.Count), h.Avg(), h.Max, h.Quantile(0.99), h.Quantile(0.95), h.Quantile(0.50), int(stats.unacked)
+}
 
-	for i, info := range digitalList {
-		infoList[i].Duration += info.Duration
-		infoList[i].PNumCount += info.PNumCount
+// PrintAckSummary 输出异步写入提交到确认的耗时, 同步写入时不输出
+func PrintAckSummary(prefix string, stats *WriteStats) {
+	isAsync, count, dAvg, dMax, dP99, dP95, dP50, unacked := AckSummary(stats)
+	if !isAsync {
+		return
 	}
+	log.Printf("%v确认耗时(提交到数据库确认) - 已确认断面数量: %v, 未确认断面数量: %v, 平均耗时: %v, \n\t\t最长耗时: %v, P99耗时: %v, P95耗时: %v, 中位数耗时: %v\n",
+		prefix, count, unacked, dAvg, dMax, dP99, dP95, dP50,
+	)
+}
 
-	allDuration := time.Duration(0)
-	sectionCount := 0
-	durationList := make([]time.Duration, 0)
-	pnumCount := 0
-	for _, info := range infoList {
-		durationList = append(durationList, info.Duration)
-		allDuration += info.Duration
-		sectionCount += int(info.SectionCount)
-		pnumCount += int(info.PNumCount)
+// LatenessSummary 统计周期性写入的调度延迟(实际开始写入时间 - 计划时间)
+// 返回值: 是否为周期性写入, 写入次数(开启快采点缓存时每批断面为一次), 错过截止时间的次数, 平均延迟, 最大延迟, P99延迟, P95延迟, 中位数延迟, 最后一个断面的延迟
+func LatenessSummary(stats *WriteStats) (bool, int, int, time.Duration, time.Duration, time.Duration, time.Duration, time.Duration, time.Duration) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	h := &stats.lateness
+	if h.Count == 0 {
+		return false, 0, 0, 0, 0, 0, 0, 0, 0
 	}
+	return true, int(h.Count), int(stats.missed), h.Avg(), h.Max, h.Quantile(0.99), h.Quantile(0.95), h.Quantile(0.50), stats.lastLateness
+}
 
-	sort.Slice(durationList, func(i, j int) bool {
-		return durationList[i] < durationList[j]
-	})
-	dAvg := allDuration / time.Duration(sectionCount)
-	dMax := time.Duration(stat.Quantile(1.00, stat.Empirical, DurationListToFloatList(durationList), nil))
-	dMin := time.Duration(stat.Quantile(0.00, stat.Empirical, DurationListToFloatList(durationList), nil))
-	dP99 := time.Duration(stat.Quantile(0.99, stat.Empirical, DurationListToFloatList(durationList), nil))
-	dP95 := time.Duration(stat.Quantile(0.95, stat.Empirical, DurationListToFloatList(durationList), nil))
-	dP50 := time.Duration(stat.Quantile(0.50, stat.Empirical, DurationListToFloatList(durationList), nil))
+// PrintLatenessSummary 输出周期性写入的调度延迟和错过截止时间的次数, 不是周期性写入时不输出
+func PrintLatenessSummary(prefix string, stats *WriteStats) {
+	ok, count, missed, dAvg, dMax, dP99, dP95, dP50, last := LatenessSummary(stats)
+	if !ok {
+		return
+	}
+	log.Printf("%v调度延迟(实际开始写入时间 - 计划时间) - 写入次数: %v, 错过截止时间的次数: %v, 平均延迟: %v, \n\t\t最大延迟: %v, P99延迟: %v, P95延迟: %v, 中位数延迟: %v, 最后一个断面的延迟: %v\n",
+		prefix, count, missed, dAvg, dMax, dP99, dP95, dP50, last,
+	)
+}
 
-	return allDuration, sectionCount, dAvg, dMax, dMin, dP99, dP95, dP50, pnumCount
+// EffectiveRate 有效写入速率, 即每秒写入的PNUM数量(按机组累计), duration需要包含flush耗时
+func EffectiveRate(duration time.Duration, stats ...*WriteStats) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	pNumCount := int64(0)
+	for _, s := range stats {
+		s.mu.Lock()
+		pNumCount += s.total.UnitPNumCount
+		s.mu.Unlock()
+	}
+	return float64(pNumCount) / duration.Seconds()
 }
 
-func StaticSummary(magic int32, name string, start time.Time, end time.Time, analog []WriteSectionInfo, digital []WriteSectionInfo, logoutDuration time.Duration) {
+func StaticSummary(magic int32, name string, start time.Time, end time.Time, stats *WriteStats, flushDuration time.Duration, logoutDuration time.Duration) {
+	all, _, _, _, _, _, _, _, pNum := Summary(stats)
 	log.Printf("MAGIC: %v, %v - 开始时间: %v, 结束时间: %v\n", magic, name, start.Format(time.RFC3339), end.Format(time.RFC3339))
-	log.Printf("总耗时: %v, 机组数量: %v, 写入pnum数量: %v\n", analog[0].Duration+digital[0].Duration+logoutDuration, analog[0].UnitNumber, analog[0].PNumCount+digital[0].PNumCount)
+	log.Printf("总耗时: %v, 机组数量: %v, 写入pnum数量: %v\n", all+flushDuration+logoutDuration, stats.unitNumber, pNum)
+	PrintFailSummary("", stats)
+	GlobalWriteErrors.Print()
 }
 
 func HisFastWriteSummary(
 	magic int32, name string, start time.Time, end time.Time,
-	normalAnalog []WriteSectionInfo, normalDigital []WriteSectionInfo,
-	logoutDuration time.Duration,
+	normal *WriteStats,
+	flushDuration time.Duration, logoutDuration time.Duration,
 ) {
 	log.Printf("MAGIC: %v, %v - 开始时间: %v, 结束时间: %v\n", magic, name, start.Format(time.RFC3339), end.Format(time.RFC3339))
-	if len(normalAnalog) != 0 && len(normalDigital) != 0 {
-		nAll, nCount, nAvg, nMax, nMin, nP99, nP95, nP50, nPNum := Summary(normalAnalog, normalDigital)
+	if normal.Written() {
+		nAll, nCount, nAvg, nMax, nMin, nP99, nP95, nP50, nPNum := Summary(normal)
 		log.Printf("总耗时: %v, 断面数量: %v, PNUM数量: %v, 平均耗时: %v,\n\t\t最长耗时: %v, 最短耗时: %v, P99耗时: %v, P95耗时: %v, 中位数耗时: %v\n",
-			nAll+logoutDuration, nCount, nPNum, nAvg, nMax, nMin, nP99, nP95, nP50,
+			nAll+flushDuration+logoutDuration, nCount, nPNum, nAvg, nMax, nMin, nP99, nP95, nP50,
 		)
+		log.Printf("flush耗时: %v, 有效写入速率(含flush耗时): %.2f PNUM/s\n", flushDuration, EffectiveRate(nAll+flushDuration, normal))
+		PrintFailSummary("", normal)
+		PrintAckSummary("", normal)
 	}
+	GlobalWriteErrors.Print()
 }
 
 func ParallelRtFastWriteSummary(
 	magic int32, name string, start time.Time, end time.Time,
-	fastAnalog []WriteSectionInfo, fastDigital []WriteSectionInfo,
-	normalAnalog []WriteSectionInfo, normalDigital []WriteSectionInfo,
-	logoutDuration time.Duration,
+	fast *WriteStats, normal *WriteStats,
+	flushDuration time.Duration, logoutDuration time.Duration,
 ) {
 	log.Printf("MAGIC: %v, %v - 开始时间: %v, 结束时间: %v\n", magic, name, start.Format(time.RFC3339), end.Format(time.RFC3339))
 	allTime := time.Duration(0)
-	if len(fastAnalog) != 0 && len(fastDigital) != 0 {
-		fAll, fCount, fAvg, fMax, fMin, fP99, fP95, fP50, fPNum := Summary(fastAnalog, fastDigital)
+	if fast.Written() {
+		fAll, fCount, fAvg, fMax, fMin, fP99, fP95, fP50, fPNum := Summary(fast)
 		if allTime < fAll {
 			allTime = fAll
 		}
 		log.Printf("快采点 - 总耗时: %v, 断面数量: %v, PNUM数量: %v, 平均耗时: %v, \n\t\t最长耗时: %v, 最短耗时: %v, P99耗时: %v, P95耗时: %v, 中位数耗时: %v\n",
 			fAll, fCount, fPNum, fAvg, fMax, fMin, fP99, fP95, fP50,
 		)
+		PrintFailSummary("快采点 - ", fast)
+		PrintAckSummary("快采点 - ", fast)
 	}
-	if len(normalAnalog) != 0 && len(normalDigital) != 0 {
-		nAll, nCount, nAvg, nMax, nMin, nP99, nP95, nP50, nPNum := Summary(normalAnalog, normalDigital)
+	if normal.Written() {
+		nAll, nCount, nAvg, nMax, nMin, nP99, nP95, nP50, nPNum := Summary(normal)
 		if allTime < nAll {
 			allTime = nAll
 		}
 		log.Printf("普通点 - 总耗时: %v, 断面数量: %v, PNUM数量: %v, 平均耗时: %v, \n\t\t最长耗时: %v, 最短耗时: %v, P99耗时: %v, P95耗时: %v, 中位数耗时: %v\n",
 			nAll, nCount, nPNum, nAvg, nMax, nMin, nP99, nP95, nP50,
 		)
+		PrintFailSummary("普通点 - ", normal)
+		PrintAckSummary("普通点 - ", normal)
 	}
-	log.Printf("统计总耗时(刨除掉等待CSV读取时间): %v\n", allTime+logoutDuration)
+	log.Printf("flush耗时: %v, 有效写入速率(含flush耗时): %.2f PNUM/s\n", flushDuration,
+		EffectiveRate(allTime+flushDuration, fast, normal))
+	log.Printf("统计总耗时(刨除掉等待CSV读取时间): %v\n", allTime+flushDuration+logoutDuration)
 	log.Printf("实际总耗时(会算上等待CSV读取时间): %v\n", end.Sub(start)+logoutDuration)
+	GlobalWriteErrors.Print()
 }
 
 func RtFastWriteSummary(
 	magic int32, name string, start time.Time, end time.Time,
-	fastAnalog []WriteSectionInfo, fastDigital []WriteSectionInfo,
-	normalAnalog []WriteSectionInfo, normalDigital []WriteSectionInfo,
-	logoutDuration time.Duration,
+	fast *WriteStats, normal *WriteStats,
+	flushDuration time.Duration, logoutDuration time.Duration,
 ) {
 	log.Printf("MAGIC: %v, %v - 开始时间: %v, 结束时间: %v\n", magic, name, start.Format(time.RFC3339), end.Format(time.RFC3339))
 	all := time.Duration(0)
-	if len(fastAnalog) != 0 && len(fastDigital) != 0 {
-		fAll, fCount, fAvg, fMax, fMin, fP99, fP95, fP50, fPNum := Summary(fastAnalog, fastDigital)
+	if fast.Written() {
+		fAll, fCount, fAvg, fMax, fMin, fP99, fP95, fP50, fPNum := Summary(fast)
 		log.Printf("快采点 - 总耗时: %v, 断面数量: %v, PNUM数量: %v, 平均耗时: %v, \n\t\t最长耗时: %v, 最短耗时: %v, P99耗时: %v, P95耗时: %v, 中位数耗时: %v\n",
 			fAll, fCount, fPNum, fAvg, fMax, fMin, fP99, fP95, fP50,
 		)
+		PrintFailSummary("快采点 - ", fast)
+		PrintAckSummary("快采点 - ", fast)
 		all += fAll
 	}
-	if len(normalAnalog) != 0 && len(normalDigital) != 0 {
-		nAll, nCount, nAvg, nMax, nMin, nP99, nP95, nP50, nPNum := Summary(normalAnalog, normalDigital)
+	if normal.Written() {
+		nAll, nCount, nAvg, nMax, nMin, nP99, nP95, nP50, nPNum := Summary(normal)
 		log.Printf("普通点 - 总耗时: %v, 断面数量: %v, PNUM数量: %v, 平均耗时: %v, \n\t\t最长耗时: %v, 最短耗时: %v, P99耗时: %v, P95耗时: %v, 中位数耗时: %v\n",
 			nAll, nCount, nPNum, nAvg, nMax, nMin, nP99, nP95, nP50,
 		)
+		PrintFailSummary("普通点 - ", normal)
+		PrintAckSummary("普通点 - ", normal)
 		all += nAll
 	}
-	log.Printf("写入总耗时: %v\n", all+logoutDuration)
+	log.Printf("flush耗时: %v, 有效写入速率(含flush耗时): %.2f PNUM/s\n", flushDuration,
+		EffectiveRate(all+flushDuration, fast, normal))
+	log.Printf("写入总耗时: %v\n", all+flushDuration+logoutDuration)
+	GlobalWriteErrors.Print()
 }
 
 func PeriodicWriteHisSummary(
 	magic int32, name string, start time.Time, end time.Time,
-	normalAnalog []WriteSectionInfo, normalDigital []WriteSectionInfo, normalSleepList []time.Duration, logoutDuration time.Duration,
+	normal *WriteStats,
+	flushDuration time.Duration, logoutDuration time.Duration,
 ) {
 	log.Printf("MAGIC: %v, %v - 开始时间: %v, 结束时间: %v\n", magic, name, start.Format(time.RFC3339), end.Format(time.RFC3339))
-	if len(normalAnalog) != 0 && len(normalDigital) != 0 {
-		nSleepSum := time.Duration(0)
-		for _, d := range normalSleepList {
-			nSleepSum += d
-		}
-		nAll, nCount, nAvg, nMax, nMin, nP99, nP95, nP50, nPNum := Summary(normalAnalog, normalDigital)
+	GlobalPeriodic.Print(false)
+	if normal.Written() {
+		nAll, nCount, nAvg, nMax, nMin, nP99, nP95, nP50, nPNum := Summary(normal)
 		log.Printf("总耗时: %v, 睡眠耗时: %v, 断面数量: %v, PNUM数量: %v, 平均耗时: %v, \n\t\t最长耗时: %v, 最短耗时: %v, P99耗时: %v, P95耗时: %v, 中位数耗时: %v\n",
-			nAll+logoutDuration, nSleepSum, nCount, nPNum, nAvg, nMax, nMin, nP99, nP95, nP50,
+			nAll+flushDuration+logoutDuration, normal.Sleep(), nCount, nPNum, nAvg, nMax, nMin, nP99, nP95, nP50,
 		)
+		log.Printf("flush耗时: %v, 有效写入速率(含flush耗时): %.2f PNUM/s\n", flushDuration, EffectiveRate(nAll+flushDuration, normal))
+		PrintFailSummary("", normal)
+		PrintAckSummary("", normal)
+		PrintLatenessSummary("", normal)
+		PrintOpenLoopSummary("", "普通点", normal)
+		PrintLoopSummary("", normal)
 	}
+	GlobalWriteErrors.Print()
 }
 
 func PeriodicWriteRtSummary(
 	magic int32, name string, start time.Time, end time.Time,
-	fastAnalog []WriteSectionInfo, fastDigital []WriteSectionInfo, fastSleepList []time.Duration,
-	normalAnalog []WriteSectionInfo, normalDigital []WriteSectionInfo, normalSleepList []time.Duration,
-	logoutDuration time.Duration,
+	fast *WriteStats, normal *WriteStats,
+	flushDuration time.Duration, logoutDuration time.Duration,
 ) {
 	log.Printf("MAGIC: %v, %v - 开始时间: %v, 结束时间: %v\n", magic, name, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	GlobalPeriodic.Print(true)
+	all := time.Duration(0)
 
-	if len(fastAnalog) != 0 && len(fastDigital) != 0 {
-		fAll, fCount, fAvg, fMax, fMin, fP99, fP95, fP50, fPNum := Summary(fastAnalog, fastDigital)
-		fSleepSum := time.Duration(0)
-		for _, d := range fastSleepList {
-			fSleepSum += d
-		}
+	if fast.Written() {
+		fAll, fCount, fAvg, fMax, fMin, fP99, fP95, fP50, fPNum := Summary(fast)
 		log.Printf("快采点 - 总耗时: %v, 睡眠耗时: %v, 断面数量: %v, PNUM数量: %v, \n\t\t平均耗时: %v ,最长耗时: %v, 最短耗时: %v, P99耗时: %v, P95耗时: %v, 中位数耗时: %v\n",
-			fAll+logoutDuration, fSleepSum, fCount, fPNum, fAvg, fMax, fMin, fP99, fP95, fP50,
+			fAll+logoutDuration, fast.Sleep(), fCount, fPNum, fAvg, fMax, fMin, fP99, fP95, fP50,
 		)
+		PrintFailSummary("快采点 - ", fast)
+		PrintAckSummary("快采点 - ", fast)
+		PrintLatenessSummary("快采点 - ", fast)
+		PrintOpenLoopSummary("快采点 - ", "快采点", fast)
+		PrintLoopSummary("快采点 - ", fast)
+		all += fAll
 	}
 
-	if len(normalAnalog) != 0 && len(normalDigital) != 0 {
-		nSleepSum := time.Duration(0)
-		for _, d := range normalSleepList {
-			nSleepSum += d
-		}
-		nAll, nCount, nAvg, nMax, nMin, nP99, nP95, nP50, nPNum := Summary(normalAnalog, normalDigital)
+	if normal.Written() {
+		nAll, nCount, nAvg, nMax, nMin, nP99, nP95, nP50, nPNum := Summary(normal)
 		log.Printf("普通点 - 总耗时: %v, 睡眠耗时: %v, 断面数量: %v, PNUM数量: %v, \n\t\t平均耗时: %v ,最长耗时: %v, 最短耗时: %v, P99耗时: %v, P95耗时: %v, 中位数耗时: %v\n",
-			nAll+logoutDuration, nSleepSum, nCount, nPNum, nAvg, nMax, nMin, nP99, nP95, nP50,
+			nAll+logoutDuration, normal.Sleep(), nCount, nPNum, nAvg, nMax, nMin, nP99, nP95, nP50,
 		)
+		PrintFailSummary("普通点 - ", normal)
+		PrintAckSummary("普通点 - ", normal)
+		PrintLatenessSummary("普通点 - ", normal)
+		PrintOpenLoopSummary("普通点 - ", "普通点", normal)
+		PrintLoopSummary("普通点 - ", normal)
+		all += nAll
 	}
+	log.Printf("flush耗时: %v, 有效写入速率(含flush耗时): %.2f PNUM/s\n", flushDuration,
+		EffectiveRate(all+flushDuration, fast, normal))
+	GlobalWriteErrors.Print()
 }
 
 type Section struct {
@@ -236,6 +672,17 @@ type Section struct {
 	analog    AnalogSection
 	digitalOk bool
 	digital   DigitalSection
+	loop      int64     // 循环回放的轮数, 从0开始
+	release   time.Time // 开环写入时断面的计划发布时间
+	deadline  time.Time // 开环写入时断面的截止时间, 即下一个断面的计划发布时间
+}
+
+// Time 断面时间, 只有一侧存在时取存在的一侧
+func (s Section) Time() int64 {
+	if s.analogOk {
+		return s.analog.Time
+	}
+	return s.digital.Time
 }
 
 type AnalogSection struct {
@@ -571,62 +1018,283 @@ func ParseStaticDigitalRecord(record []string) (C.StaticDigital, error) {
 	return staticDigital, nil
 }
 
+// FormatAnalogRecord 将 C.Analog 转换为CSV行, 列顺序与 ParseAnalogRecord 相同
+func FormatAnalogRecord(ts int64, analog C.Analog) []string {
+	return []string{
+		strconv.FormatInt(ts, 10),
+		strconv.FormatInt(int64(analog.p_num), 10),
+		strconv.FormatFloat(float64(analog.av), 'f', -1, 32),
+		strconv.FormatFloat(float64(analog.avr), 'f', -1, 32),
+		strconv.FormatBool(bool(analog.q)),
+		strconv.FormatBool(bool(analog.bf)),
+		strconv.FormatBool(bool(analog.qf)),
+		strconv.FormatFloat(float64(analog.fai), 'f', -1, 32),
+		strconv.FormatBool(bool(analog.ms)),
+		string([]byte{byte(analog.tew)}),
+		strconv.FormatInt(int64(analog.cst), 10),
+	}
+}
+
+// FormatDigitalRecord 将 C.Digital 转换为CSV行, 列顺序与 ParseDigitalRecord 相同
+func FormatDigitalRecord(ts int64, digital C.Digital) []string {
+	return []string{
+		strconv.FormatInt(ts, 10),
+		strconv.FormatInt(int64(digital.p_num), 10),
+		strconv.FormatBool(bool(digital.dv)),
+		strconv.FormatBool(bool(digital.dvr)),
+		strconv.FormatBool(bool(digital.q)),
+		strconv.FormatBool(bool(digital.bf)),
+		strconv.FormatBool(bool(digital.bq)),
+		strconv.FormatBool(bool(digital.fai)),
+		strconv.FormatBool(bool(digital.ms)),
+		string([]byte{byte(digital.tew)}),
+		strconv.FormatInt(int64(digital.cst), 10),
+	}
+}
+
+// ParsePNumList 解析P_NUM列表, 格式: 1,2,5-10
+func ParsePNumList(s string) ([]int32, error) {
+	pNumList := make([]int32, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		first, err := strconv.ParseInt(bounds[0], 10, 32)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintln("parse pNum error", item))
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.ParseInt(bounds[1], 10, 32)
+			if err != nil || last < first {
+				return nil, errors.New(fmt.Sprintln("parse pNum error", item))
+			}
+		}
+		for pNum := first; pNum <= last; pNum++ {
+			pNumList = append(pNumList, int32(pNum))
+		}
+	}
+	return pNumList, nil
+}
+
 func ReadCsv(wg2 *sync.WaitGroup, analogFilePath string, digitalFilePath string, sectionCh chan Section, exitCh chan bool) {
 	defer wg2.Done()
 
+	stop := make(chan struct{})
+	readDone := make(chan struct{})
+	defer close(readDone)
+	expired := GlobalBound.Done()
+	go func() {
+		select {
+		case <-exitCh:
+			log.Println("ReadCsv 收到平滑退出信号")
+		case <-expired:
+			log.Println("ReadCsv 写入时长到期, 停止读取")
+		case <-readDone:
+			return
+		}
+		close(stop)
+	}()
+
+	// 循环回放时每一轮重新读取文件, 断面时间加上前几轮的时长, 保证时间戳单调递增
+	span := int64(0)
+	sent := int64(0)
+passes:
+	for loop := int64(0); GlobalLoop.Next(loop); loop++ {
+		if loop > 0 {
+			log.Printf("循环回放 - %v, %v: 第%v轮, 时间偏移: %v\n", analogFilePath, digitalFilePath, loop+1, loop*span)
+		}
+		limit := int64(0)
+		if GlobalBound.MaxSections > 0 {
+			limit = GlobalBound.MaxSections - sent
+		}
+		count, first, last := readCsvPass(analogFilePath, digitalFilePath, sectionCh, stop, loop, loop*span, limit)
+		sent += count
+		if loop == 0 {
+			if count == 0 {
+				break
+			}
+			span = LoopSpan(first, last, count)
+		}
+		// 达到 --max_sections, 与读取结束相同
+		if GlobalBound.MaxSections > 0 && sent >= GlobalBound.MaxSections {
+			GlobalBound.Reach(fmt.Sprintf("%v, %v: 达到最多断面数量 --max_sections=%v", analogFilePath, digitalFilePath, GlobalBound.MaxSections))
+			break
+		}
+		// 收到平滑退出信号, 不再开始新的一轮
+		select {
+		case <-stop:
+			break passes
+		default:
+		}
+	}
+	log.Println("ReadCsv 平滑退出成功")
+	close(sectionCh)
+}
+
+// readCsvPass 读取一轮模拟量和数字量文件, 按时间戳合并成断面后发送, 断面时间加上 shift(循环回放的偏移, --time_base 的偏移在提交给插件时加上)
+// 只发送断面时间窗口(--start_time, --end_time)内的断面, 超过窗口或发送了 limit 个断面(为0时不限制)后结束本轮
+// 返回值: 断面数量, 第一个断面的时间, 最后一个断面的时间(都不含偏移)
+func readCsvPass(analogFilePath string, digitalFilePath string, sectionCh chan Section, stop chan struct{}, loop int64, shift int64, limit int64) (int64, int64, int64) {
 	rd1 := make(chan bool, 1)
 	rd2 := make(chan bool, 1)
+	passDone := make(chan struct{})
+	bounded := make(chan struct{})
+	defer close(passDone)
 	go func() {
-		<-exitCh
-		rd1 <- true
-		rd2 <- true
-		log.Println("ReadCsv 收到平滑退出信号")
+		select {
+		case <-stop:
+			rd1 <- true
+			rd2 <- true
+		case <-bounded:
+			rd1 <- true
+			rd2 <- true
+		case <-passDone:
+		}
 	}()
 
-	analogCh := make(chan AnalogSection, CacheSize)
-	digitalCh := make(chan DigitalSection, CacheSize)
+	analogCh := make(chan AnalogSection, GlobalPeriodic.CacheSize)
+	digitalCh := make(chan DigitalSection, GlobalPeriodic.CacheSize)
 	wg := new(sync.WaitGroup)
 	wg.Add(2)
 	go ReadAnalogCsv(wg, analogFilePath, analogCh, rd1)
 	go ReadDigitalCsv(wg, digitalFilePath, digitalCh, rd2)
 
-	for {
-		analogSection, ok1 := <-analogCh
-		digitalSection, ok2 := <-digitalCh
+	count, first, last := int64(0), int64(0), int64(0)
+	finished := false
+	// accept 断面时间是否在窗口内, 超过窗口时结束本轮
+	accept := func(section Section) bool {
+		if section.Time() < GlobalBound.Start {
+			return false
+		}
+		if section.Time() > GlobalBound.End {
+			GlobalBound.Reach(fmt.Sprintf("断面时间超过 --end_time=%v", GlobalBound.End))
+			finished = true
+			return false
+		}
+		return true
+	}
+	send := func(section Section) {
+		if count == 0 {
+			first = section.Time()
+		}
+		last = section.Time()
+		count++
+		section.loop = loop
+		section.analog.Time += shift
+		section.digital.Time += shift
+		sectionCh <- section
+		finished = limit > 0 && count >= limit
+	}
+	// gap 只有一侧存在的断面, 严格对齐时不发送并结束本轮, 不对齐的断面不会写入
+	gap := func(section Section, isAnalog bool, t int64, path string) {
+		GlobalAlign.Gap(isAnalog, t, path)
+		if GlobalAlign.Strict {
+			finished = true
+			return
+		}
+		send(section)
+	}
 
-		if !ok1 && !ok2 {
-			break
+	// 按时间戳合并模拟量和数字量断面(两个文件都按时间戳升序排列), 只有一侧存在的断面单独发送
+	// 断面时间窗口外的断面不发送, 也不统计对齐
+	analogSection, ok1 := <-analogCh
+	digitalSection, ok2 := <-digitalCh
+	for (ok1 || ok2) && !finished {
+		switch {
+		case ok1 && ok2 && analogSection.Time == digitalSection.Time:
+			section := Section{
+				analogOk:  true,
+				analog:    analogSection,
+				digitalOk: true,
+				digital:   digitalSection,
+			}
+			if accept(section) {
+				GlobalAlign.Match()
+				send(section)
+			}
+			analogSection, ok1 = <-analogCh
+			digitalSection, ok2 = <-digitalCh
+		case ok1 && (!ok2 || analogSection.Time < digitalSection.Time):
+			section := Section{
+				analogOk: true,
+				analog:   analogSection,
+			}
+			if accept(section) {
+				gap(section, true, analogSection.Time, digitalFilePath)
+			}
+			analogSection, ok1 = <-analogCh
+		default:
+			section := Section{
+				digitalOk: true,
+				digital:   digitalSection,
+			}
+			if accept(section) {
+				gap(section, false, digitalSection.Time, analogFilePath)
+			}
+			digitalSection, ok2 = <-digitalCh
 		}
+	}
 
-		sectionCh <- Section{
-			analogOk:  ok1,
-			analog:    analogSection,
-			digitalOk: ok2,
-			digital:   digitalSection,
+	// 提前结束本轮时通知读取协程停止, 丢弃剩余的断面直到读取协程退出, 与读取结束相同
+	if finished {
+		close(bounded)
+		for range analogCh {
+		}
+		for range digitalCh {
 		}
 	}
 	wg.Wait()
-	log.Println("ReadCsv 平滑退出成功")
-	close(sectionCh)
+	return count, first, last
+}
+
+// LogSkippedRows 输出CSV文件中被跳过的行数, 被跳过的行不会写入
+func LogSkippedRows(filepath string, skipped int) {
+	if skipped > 0 {
+		log.Printf("%v: 跳过了 %v 行无法解析的数据, 可以通过validate命令查看每一行的问题\n", filepath, skipped)
+	}
 }
 
 // ReadAnalogCsv 读取CSV文件, 将其转换成 C.Analog 结构后发送到缓存队列
 func ReadAnalogCsv(wg *sync.WaitGroup, filepath string, ch chan AnalogSection, exitCh chan bool) {
 	defer wg.Done()
 
-	// 打开文件
-	file, err := os.Open(filepath)
+	// 预编译的数据集不需要解析
+	if IsDatasetFile(filepath) {
+		ReadAnalogDataset(filepath, ch, exitCh)
+		return
+	}
+
+	// Parquet / Arrow IPC 文件按列读取
+	if format := DetectColumnar(filepath); format != ColumnarNone {
+		ReadAnalogColumnar(filepath, format, ch, exitCh)
+		return
+	}
+
+	// 打开文件, 压缩文件透明解压
+	file, err := OpenCsvFile(filepath)
 	if err != nil {
-		panic("can not open file: " + filepath)
+		panic("can not open file: " + filepath + ", " + err.Error())
 	}
 	defer func() { _ = file.Close() }()
 
+	// 表头缺少必需的列时文件无法读取, 开始读取前检查, 与读取失败相同中止写入
+	if err := CheckCsvHeader(filepath, DatasetAnalog); err != nil {
+		Abort(fmt.Sprintf("读取文件失败: %v, %v", filepath, err))
+		close(ch)
+		return
+	}
+
 	// CSV读取器
 	reader := csv.NewReader(NewCRFilterReader(bufio.NewReader(file)))
 
 	// 按行读取
 	dataList := make([]C.Analog, 0)
 	tsFlag := int64(-1)
+	skipped := 0 // 无法解析的行数
+	mapper := NewCsvRecordMapper(DatasetAnalog)
 	for {
 		select {
 		case <-exitCh:
@@ -638,13 +1306,37 @@ func ReadAnalogCsv(wg *sync.WaitGroup, filepath string, ch chan AnalogSection, e
 			record, err := reader.Read()
 			if err != nil {
 				if err.Error() == "EOF" {
+					LogSkippedRows(filepath, skipped)
 					if len(dataList) != 0 {
 						ch <- AnalogSection{Time: tsFlag, Data: dataList}
 					}
 					close(ch)
 					return
 				}
+				// 只跳过格式错误的行, 其他错误(例如压缩文件被截断)每次读取都会返回, 中止写入
+				var parseErr *csv.ParseError
+				if !errors.As(err, &parseErr) {
+					LogSkippedRows(filepath, skipped)
+					Abort(fmt.Sprintf("读取文件失败: %v, %v", filepath, err))
+					close(ch)
+					return
+				}
 				log.Printf("Error reading record: %s", err)
+				skipped++
+				continue
+			}
+
+			// 按表头映射为固定的列顺序, 表头缺少必需的列时无法读取
+			record, err = mapper.Map(record)
+			if err != nil {
+				if errors.Is(err, ErrColumnHeader) {
+					LogSkippedRows(filepath, skipped)
+					Abort(fmt.Sprintf("读取文件失败: %v, %v", filepath, err))
+					close(ch)
+					return
+				}
+				log.Printf("Error mapping record: %s", err)
+				skipped++
 				continue
 			}
 
@@ -652,6 +1344,7 @@ func ReadAnalogCsv(wg *sync.WaitGroup, filepath string, ch chan AnalogSection, e
 			if err != nil {
 				if !strings.Contains(err.Error(), "continue HEAD") {
 					log.Printf("Error parsing record: %s", err)
+					skipped++
 				}
 				continue
 			}
@@ -678,19 +1371,40 @@ func ReadAnalogCsv(wg *sync.WaitGroup, filepath string, ch chan AnalogSection, e
 func ReadDigitalCsv(wg *sync.WaitGroup, filepath string, ch chan DigitalSection, exitCh chan bool) {
 	defer wg.Done()
 
-	// 打开文件
-	file, err := os.Open(filepath)
+	// 预编译的数据集不需要解析
+	if IsDatasetFile(filepath) {
+		ReadDigitalDataset(filepath, ch, exitCh)
+		return
+	}
+
+	// Parquet / Arrow IPC 文件按列读取
+	if format := DetectColumnar(filepath); format != ColumnarNone {
+		ReadDigitalColumnar(filepath, format, ch, exitCh)
+		return
+	}
+
+	// 打开文件, 压缩文件透明解压
+	file, err := OpenCsvFile(filepath)
 	if err != nil {
-		panic("can not open file: " + filepath)
+		panic("can not open file: " + filepath + ", " + err.Error())
 	}
 	defer func() { _ = file.Close() }()
 
+	// 表头缺少必需的列时文件无法读取, 开始读取前检查, 与读取失败相同中止写入
+	if err := CheckCsvHeader(filepath, DatasetDigital); err != nil {
+		Abort(fmt.Sprintf("读取文件失败: %v, %v", filepath, err))
+		close(ch)
+		return
+	}
+
 	// CSV读取器
 	reader := csv.NewReader(NewCRFilterReader(bufio.NewReader(file)))
 
 	// 按行读取
 	dataList := make([]C.Digital, 0)
 	tsFlag := int64(-1)
+	skipped := 0 // 无法解析的行数
+	mapper := NewCsvRecordMapper(DatasetDigital)
 	for {
 		select {
 		case <-exitCh:
@@ -702,13 +1416,37 @@ func ReadDigitalCsv(wg *sync.WaitGroup, filepath string, ch chan DigitalSection,
 			record, err := reader.Read()
 			if err != nil {
 				if err.Error() == "EOF" {
+					LogSkippedRows(filepath, skipped)
 					if len(dataList) != 0 {
 						ch <- DigitalSection{Time: tsFlag, Data: dataList}
 					}
 					close(ch)
 					return
 				}
+				// 只跳过格式错误的行, 其他错误(例如压缩文件被截断)每次读取都会返回, 中止写入
+				var parseErr *csv.ParseError
+				if !errors.As(err, &parseErr) {
+					LogSkippedRows(filepath, skipped)
+					Abort(fmt.Sprintf("读取文件失败: %v, %v", filepath, err))
+					close(ch)
+					return
+				}
 				log.Printf("Error reading record: %s", err)
+				skipped++
+				continue
+			}
+
+			// 按表头映射为固定的列顺序, 表头缺少必需的列时无法读取
+			record, err = mapper.Map(record)
+			if err != nil {
+				if errors.Is(err, ErrColumnHeader) {
+					LogSkippedRows(filepath, skipped)
+					Abort(fmt.Sprintf("读取文件失败: %v, %v", filepath, err))
+					close(ch)
+					return
+				}
+				log.Printf("Error mapping record: %s", err)
+				skipped++
 				continue
 			}
 
@@ -716,6 +1454,7 @@ func ReadDigitalCsv(wg *sync.WaitGroup, filepath string, ch chan DigitalSection,
 			if err != nil {
 				if !strings.Contains(err.Error(), "continue HEAD") {
 					log.Printf("Error parsing record: %s", err)
+					skipped++
 				}
 				continue
 			}
@@ -743,10 +1482,21 @@ func ReadDigitalCsv(wg *sync.WaitGroup, filepath string, ch chan DigitalSection,
 
 // ReadStaticAnalogCsv 读取CSV文件, 将其转换成 []C.StaticAnalog 切片
 func ReadStaticAnalogCsv(filepath string) StaticAnalogSection {
-	// 打开文件
-	file, err := os.Open(filepath)
+	// 预编译的数据集不需要解析
+	if IsDatasetFile(filepath) {
+		ds, err := OpenDataset(filepath, DatasetStaticAnalog)
+		if err != nil {
+			panic("can not open dataset: " + filepath + ", " + err.Error())
+		}
+		defer func() { _ = ds.Close() }()
+		// 复制到Go内存后释放映射
+		return ds.StaticAnalogSection()
+	}
+
+	// 打开文件, 压缩文件透明解压
+	file, err := OpenCsvFile(filepath)
 	if err != nil {
-		panic("can not open file: " + filepath)
+		panic("can not open file: " + filepath + ", " + err.Error())
 	}
 	defer func() { _ = file.Close() }()
 
@@ -754,14 +1504,34 @@ func ReadStaticAnalogCsv(filepath string) StaticAnalogSection {
 	reader := csv.NewReader(NewCRFilterReader(bufio.NewReader(file)))
 
 	dataList := make([]C.StaticAnalog, 0)
+	skipped := 0 // 无法解析的行数
+	mapper := NewCsvRecordMapper(DatasetStaticAnalog)
 	for {
 		// 读取一行, 判断是否为EOF
 		record, err := reader.Read()
 		if err != nil {
 			if err.Error() == "EOF" {
+				LogSkippedRows(filepath, skipped)
 				break
 			}
+			// 只跳过格式错误的行, 其他错误(例如压缩文件被截断)每次读取都会返回
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				panic("can not read file: " + filepath + ", " + err.Error())
+			}
 			log.Printf("Error reading record: %s", err)
+			skipped++
+			continue
+		}
+
+		// 按表头映射为固定的列顺序, 表头缺少必需的列时无法读取
+		record, err = mapper.Map(record)
+		if err != nil {
+			if errors.Is(err, ErrColumnHeader) {
+				panic("can not read file: " + filepath + ", " + err.Error())
+			}
+			log.Printf("Error mapping record: %s", err)
+			skipped++
 			continue
 		}
 
@@ -769,6 +1539,7 @@ func ReadStaticAnalogCsv(filepath string) StaticAnalogSection {
 		if err != nil {
 			if !strings.Contains(err.Error(), "continue HEAD") {
 				log.Printf("Error parsing record: %s", err)
+				skipped++
 			}
 			continue
 		}
@@ -781,10 +1552,21 @@ func ReadStaticAnalogCsv(filepath string) StaticAnalogSection {
 
 // ReadStaticDigitalCsv 读取CSV文件, 将其转换成 []C.StaticDigital 切片
 func ReadStaticDigitalCsv(filepath string) StaticDigitalSection {
-	// 打开文件
-	file, err := os.Open(filepath)
+	// 预编译的数据集不需要解析
+	if IsDatasetFile(filepath) {
+		ds, err := OpenDataset(filepath, DatasetStaticDigital)
+		if err != nil {
+			panic("can not open dataset: " + filepath + ", " + err.Error())
+		}
+		defer func() { _ = ds.Close() }()
+		// 复制到Go内存后释放映射
+		return ds.StaticDigitalSection()
+	}
+
+	// 打开文件, 压缩文件透明解压
+	file, err := OpenCsvFile(filepath)
 	if err != nil {
-		panic("can not open file: " + filepath)
+		panic("can not open file: " + filepath + ", " + err.Error())
 	}
 	defer func() { _ = file.Close() }()
 
@@ -792,14 +1574,34 @@ func ReadStaticDigitalCsv(filepath string) StaticDigitalSection {
 	reader := csv.NewReader(NewCRFilterReader(bufio.NewReader(file)))
 
 	dataList := make([]C.StaticDigital, 0)
+	skipped := 0 // 无法解析的行数
+	mapper := NewCsvRecordMapper(DatasetStaticDigital)
 	for {
 		// 读取一行, 判断是否为EOF
 		record, err := reader.Read()
 		if err != nil {
 			if err.Error() == "EOF" {
+				LogSkippedRows(filepath, skipped)
 				break
 			}
+			// 只跳过格式错误的行, 其他错误(例如压缩文件被截断)每次读取都会返回
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				panic("can not read file: " + filepath + ", " + err.Error())
+			}
 			log.Printf("Error reading record: %s", err)
+			skipped++
+			continue
+		}
+
+		// 按表头映射为固定的列顺序, 表头缺少必需的列时无法读取
+		record, err = mapper.Map(record)
+		if err != nil {
+			if errors.Is(err, ErrColumnHeader) {
+				panic("can not read file: " + filepath + ", " + err.Error())
+			}
+			log.Printf("Error mapping record: %s", err)
+			skipped++
 			continue
 		}
 
@@ -807,6 +1609,7 @@ func ReadStaticDigitalCsv(filepath string) StaticDigitalSection {
 		if err != nil {
 			if !strings.Contains(err.Error(), "continue HEAD") {
 				log.Printf("Error parsing record: %s", err)
+				skipped++
 			}
 			continue
 		}
@@ -822,7 +1625,18 @@ func ReadStaticDigitalCsv(filepath string) StaticDigitalSection {
 func FastWriteRealtimeSection(magic int32, unitNumber int64, fastSectionCh chan Section, normalSectionCh chan Section, exitCh chan bool, randomAv bool) {
 	fastClose := false
 	normalClose := false
+	GlobalBound.Begin()
 	for {
+		// 达到 --duration 后不再写入, 读取协程停止读取后关闭缓存队列
+		if GlobalBound.Expired() {
+			DrainSections(fastSectionCh)
+			DrainSections(normalSectionCh)
+			return
+		}
+
+		// 两个缓存队列都为空时, 等待的时间为读取饥饿时间
+		waitStart := time.Now()
+		starved := len(fastSectionCh) == 0 && len(normalSectionCh) == 0
 		select {
 		case <-exitCh:
 			if !fastClose {
@@ -850,30 +1664,44 @@ func FastWriteRealtimeSection(magic int32, unitNumber int64, fastSectionCh chan
 				}
 				continue
 			}
+			GlobalPreload.Recv("快采点", waitStart, starved)
+			aStatus := WriteStatus{}
+			dStatus := WriteStatus{}
 			wt1 := time.Now()
 			if section.analogOk {
-				GlobalPlugin.WriteRtAnalog(magic, unitNumber, section.analog, true, randomAv)
+				aStatus = GlobalPlugin.WriteRtAnalog(magic, unitNumber, section.analog, true, randomAv)
 			}
 			wt2 := time.Now()
 			if section.digitalOk {
-				GlobalPlugin.WriteRtDigital(magic, unitNumber, section.digital, true)
+				dStatus = GlobalPlugin.WriteRtDigital(magic, unitNumber, section.digital, true)
 			}
 			wt3 := time.Now()
 
-			FastAnalogWriteSectionInfoList = append(FastAnalogWriteSectionInfoList, WriteSectionInfo{
-				UnitNumber:   unitNumber,
-				Time:         section.analog.Time,
-				Duration:     wt2.Sub(wt1),
-				SectionCount: 1,
-				PNumCount:    int64(len(section.analog.Data)),
-			})
-			FastDigitalWriteSectionInfoList = append(FastDigitalWriteSectionInfoList, WriteSectionInfo{
-				UnitNumber:   unitNumber,
-				Time:         section.digital.Time,
-				Duration:     wt3.Sub(wt2),
-				SectionCount: 1,
-				PNumCount:    int64(len(section.digital.Data)),
-			})
+			GlobalFastStats.Add(
+				WriteSectionInfo{
+					UnitNumber:      unitNumber,
+					Time:            section.Time(),
+					Loop:            section.loop,
+					Duration:        wt2.Sub(wt1),
+					SectionCount:    1,
+					PNumCount:       int64(len(section.analog.Data)),
+					FailedCount:     aStatus.FailedCount,
+					FailedPNumCount: aStatus.FailedPNumCount,
+					Ack:             aStatus.Ack,
+				},
+				WriteSectionInfo{
+					UnitNumber:      unitNumber,
+					Time:            section.Time(),
+					Loop:            section.loop,
+					Duration:        wt3.Sub(wt2),
+					SectionCount:    1,
+					PNumCount:       int64(len(section.digital.Data)),
+					FailedCount:     dStatus.FailedCount,
+					FailedPNumCount: dStatus.FailedPNumCount,
+					Ack:             dStatus.Ack,
+				},
+			)
+			GlobalFlush.AfterSections(1)
 		case section, ok := <-normalSectionCh:
 			if !ok {
 				normalClose = true
@@ -882,37 +1710,59 @@ func FastWriteRealtimeSection(magic int32, unitNumber int64, fastSectionCh chan
 				}
 				continue
 			}
+			GlobalPreload.Recv("普通点", waitStart, starved)
+			aStatus := WriteStatus{}
+			dStatus := WriteStatus{}
 			wt1 := time.Now()
 			if section.analogOk {
-				GlobalPlugin.WriteRtAnalog(magic, unitNumber, section.analog, false, randomAv)
+				aStatus = GlobalPlugin.WriteRtAnalog(magic, unitNumber, section.analog, false, randomAv)
 			}
 			wt2 := time.Now()
 			if section.digitalOk {
-				GlobalPlugin.WriteRtDigital(magic, unitNumber, section.digital, false)
+				dStatus = GlobalPlugin.WriteRtDigital(magic, unitNumber, section.digital, false)
 			}
 			wt3 := time.Now()
 
-			NormalAnalogWriteSectionInfoList = append(NormalAnalogWriteSectionInfoList, WriteSectionInfo{
-				UnitNumber:   unitNumber,
-				Time:         section.analog.Time,
-				Duration:     wt2.Sub(wt1),
-				SectionCount: 1,
-				PNumCount:    int64(len(section.analog.Data)),
-			})
-			NormalDigitalWriteSectionInfoList = append(NormalDigitalWriteSectionInfoList, WriteSectionInfo{
-				UnitNumber:   unitNumber,
-				Time:         section.digital.Time,
-				Duration:     wt3.Sub(wt2),
-				SectionCount: 1,
-				PNumCount:    int64(len(section.digital.Data)),
-			})
+			GlobalNormalStats.Add(
+				WriteSectionInfo{
+					UnitNumber:      unitNumber,
+					Time:            section.Time(),
+					Loop:            section.loop,
+					Duration:        wt2.Sub(wt1),
+					SectionCount:    1,
+					PNumCount:       int64(len(section.analog.Data)),
+					FailedCount:     aStatus.FailedCount,
+					FailedPNumCount: aStatus.FailedPNumCount,
+					Ack:             aStatus.Ack,
+				},
+				WriteSectionInfo{
+					UnitNumber:      unitNumber,
+					Time:            section.Time(),
+					Loop:            section.loop,
+					Duration:        wt3.Sub(wt2),
+					SectionCount:    1,
+					PNumCount:       int64(len(section.digital.Data)),
+					FailedCount:     dStatus.FailedCount,
+					FailedPNumCount: dStatus.FailedPNumCount,
+					Ack:             dStatus.Ack,
+				},
+			)
+			GlobalFlush.AfterSections(1)
 		}
 	}
 }
 
 // FastWriteHisSection 极速写入历史断面
 func FastWriteHisSection(magic int32, unitNumber int64, sectionCh chan Section, exitCh chan bool, randomAv bool) {
+	GlobalBound.Begin()
 	for {
+		// 达到 --duration 后不再写入, 读取协程停止读取后关闭缓存队列
+		if GlobalBound.Expired() {
+			DrainSections(sectionCh)
+			return
+		}
+		waitStart := time.Now()
+		starved := len(sectionCh) == 0
 		select {
 		case <-exitCh:
 			for {
@@ -925,46 +1775,62 @@ func FastWriteHisSection(magic int32, unitNumber int64, sectionCh chan Section,
 			if !ok {
 				return
 			}
+			GlobalPreload.Recv("普通点", waitStart, starved)
+			aStatus := WriteStatus{}
+			dStatus := WriteStatus{}
 			wt1 := time.Now()
 			if section.analogOk {
-				GlobalPlugin.WriteHisAnalog(magic, unitNumber, section.analog, randomAv)
+				aStatus = GlobalPlugin.WriteHisAnalog(magic, unitNumber, section.analog, randomAv)
 			}
 			wt2 := time.Now()
 			if section.digitalOk {
-				GlobalPlugin.WriteHisDigital(magic, unitNumber, section.digital)
+				dStatus = GlobalPlugin.WriteHisDigital(magic, unitNumber, section.digital)
 			}
 			wt3 := time.Now()
-			NormalAnalogWriteSectionInfoList = append(NormalAnalogWriteSectionInfoList, WriteSectionInfo{
-				UnitNumber:   unitNumber,
-				Time:         section.analog.Time,
-				Duration:     wt2.Sub(wt1),
-				SectionCount: 1,
-				PNumCount:    int64(len(section.analog.Data)),
-			})
-			NormalDigitalWriteSectionInfoList = append(NormalDigitalWriteSectionInfoList, WriteSectionInfo{
-				UnitNumber:   unitNumber,
-				Time:         section.digital.Time,
-				Duration:     wt3.Sub(wt2),
-				SectionCount: 1,
-				PNumCount:    int64(len(section.digital.Data)),
-			})
+			GlobalNormalStats.Add(
+				WriteSectionInfo{
+					UnitNumber:      unitNumber,
+					Time:            section.Time(),
+					Loop:            section.loop,
+					Duration:        wt2.Sub(wt1),
+					SectionCount:    1,
+					PNumCount:       int64(len(section.analog.Data)),
+					FailedCount:     aStatus.FailedCount,
+					FailedPNumCount: aStatus.FailedPNumCount,
+					Ack:             aStatus.Ack,
+				},
+				WriteSectionInfo{
+					UnitNumber:      unitNumber,
+					Time:            section.Time(),
+					Loop:            section.loop,
+					Duration:        wt3.Sub(wt2),
+					SectionCount:    1,
+					PNumCount:       int64(len(section.digital.Data)),
+					FailedCount:     dStatus.FailedCount,
+					FailedPNumCount: dStatus.FailedPNumCount,
+					Ack:             dStatus.Ack,
+				},
+			)
+			GlobalFlush.AfterSections(1)
 		}
 	}
 }
 
 // AsyncPeriodicWriteSection 周期性写入断面(实时/历史通用)
 // unitNumber int64 机组数量
-// overloadProtectionWriteDuration 过载保护持续时间, 单位毫秒
-// overloadProtectionWritePeriodic 过载保护写入周期, 单位毫秒
-// regularWritePeriodic 常规写入周期, 单位毫秒
+// overloadProtectionWriteDuration 过载保护持续时间, 为0时不开启过载保护
+// overloadProtectionWritePeriodic 过载保护写入周期
+// regularWritePeriodic 常规写入周期, 开启快采点缓存时每批断面的写入周期为 regularWritePeriodic*GlobalPeriodic.FastCacheBatch
+// 按绝对的计划时间调度: 第N个断面的计划时间 = 开始时间 + 前N个周期之和, 唤醒延迟不会累积;
+// 落后于计划时间时不睡眠, 立即写入后续断面直到追上计划时间
 // 返回值: 总时间, 写入时间, 睡眠时间
 func AsyncPeriodicWriteSection(
 	magic int32,
 	unitNumber int64,
 	wg *sync.WaitGroup,
-	overloadProtectionWriteDuration int,
-	overloadProtectionWritePeriodic int,
-	regularWritePeriodic int,
+	overloadProtectionWriteDuration time.Duration,
+	overloadProtectionWritePeriodic time.Duration,
+	regularWritePeriodic time.Duration,
 	sectionCh chan Section,
 	isRt bool,
 	isFast bool,
@@ -976,10 +1842,27 @@ func AsyncPeriodicWriteSection(
 		wg.Done()
 	}()
 
-	sum := 0
+	schedule := &PeriodicSchedule{OverloadDuration: overloadProtectionWriteDuration, OverloadPeriodic: overloadProtectionWritePeriodic, Regular: regularWritePeriodic}
+	GlobalBound.Begin()
+	next := time.Now()
+
+	// 开环模式下由发布协程按计划时间发布断面, 写入协程不睡眠, 计划时间取断面的计划发布时间
+	openLoop := GlobalOpenLoop.Enabled
+	stopRelease := make(chan struct{})
+	recv := func() (Section, bool) {
+		return GlobalPreload.RecvSection(SectionName(isFast), sectionCh)
+	}
+	if openLoop {
+		sectionCh = GlobalOpenLoop.Release(SectionName(isFast), sectionCh, schedule, stopRelease)
+		recv = func() (Section, bool) {
+			section, ok := <-sectionCh
+			return section, ok
+		}
+	}
 	for {
 		select {
 		case <-exitCh:
+			close(stopRelease)
 			for {
 				_, ok := <-sectionCh
 				if !ok {
@@ -987,39 +1870,65 @@ func AsyncPeriodicWriteSection(
 				}
 			}
 		default:
+			// 达到 --duration 后不再调度新的断面, 与读取结束相同; 开环模式下由发布协程停止发布
+			if !openLoop && GlobalBound.Expired() {
+				DrainSections(sectionCh)
+				return
+			}
 			if fastCache {
+				scheduled := next
+				if !openLoop {
+					next = next.Add(regularWritePeriodic * time.Duration(GlobalPeriodic.FastCacheBatch))
+				}
 				analogList := make([]AnalogSection, 0)
 				digitalList := make([]DigitalSection, 0)
+				listTime := int64(-1)
+				listLoop := int64(0)
+				batchCount := int64(0) // 合并后的断面数量, 只有一侧存在的断面也计为一个断面
 				isEOF := false
 				for {
-					section, ok := <-sectionCh
+					section, ok := recv()
 					if !ok {
 						isEOF = true
 						break
 					}
+					batchCount++
+					if listTime == -1 {
+						listTime = section.Time()
+						listLoop = section.loop
+						if openLoop {
+							scheduled = section.release
+						}
+					}
+					if openLoop {
+						next = section.deadline
+					}
 					if section.analogOk {
 						analogList = append(analogList, section.analog)
 					}
 					if section.digitalOk {
 						digitalList = append(digitalList, section.digital)
 					}
-					if len(analogList) == 100 || len(digitalList) == 100 {
+					if len(analogList) == GlobalPeriodic.FastCacheBatch || len(digitalList) == GlobalPeriodic.FastCacheBatch {
 						break
 					}
 				}
 
-				duration := time.Duration(0)
-				if len(analogList) != 0 || len(digitalList) != 0 {
+				if batchCount != 0 {
+					aStatus := WriteStatus{}
+					dStatus := WriteStatus{}
 					t1 := time.Now()
 					if len(analogList) != 0 {
-						GlobalPlugin.WriteRtAnalogList(magic, unitNumber, analogList, randomAv)
+						aStatus = GlobalPlugin.WriteRtAnalogList(magic, unitNumber, analogList, randomAv)
 					}
 					t2 := time.Now()
 					if len(digitalList) != 0 {
-						GlobalPlugin.WriteRtDigitalList(magic, unitNumber, digitalList)
+						dStatus = GlobalPlugin.WriteRtDigitalList(magic, unitNumber, digitalList)
 					}
 					t3 := time.Now()
-					duration = t3.Sub(t1)
+					// flush的耗时计入本周期, 错过截止时间按flush结束的时间判断
+					GlobalFlush.AfterSections(batchCount)
+					t4 := time.Now()
 
 					aPCount := 0
 					for _, analog := range analogList {
@@ -1029,20 +1938,36 @@ func AsyncPeriodicWriteSection(
 					for _, digital := range digitalList {
 						dPCount = dPCount + len(digital.Data)
 					}
-					FastAnalogWriteSectionInfoList = append(FastAnalogWriteSectionInfoList, WriteSectionInfo{
-						UnitNumber:   unitNumber,
-						Time:         analogList[0].Time,
-						Duration:     t2.Sub(t1),
-						SectionCount: int64(len(analogList)),
-						PNumCount:    int64(aPCount),
-					})
-					FastDigitalWriteSectionInfoList = append(FastDigitalWriteSectionInfoList, WriteSectionInfo{
-						UnitNumber:   unitNumber,
-						Time:         analogList[0].Time,
-						Duration:     t3.Sub(t2),
-						SectionCount: int64(len(digitalList)),
-						PNumCount:    int64(dPCount),
-					})
+					GlobalFastStats.Add(
+						WriteSectionInfo{
+							UnitNumber:      unitNumber,
+							Time:            listTime,
+							Loop:            listLoop,
+							Duration:        t2.Sub(t1),
+							SectionCount:    batchCount,
+							PNumCount:       int64(aPCount),
+							FailedCount:     aStatus.FailedCount,
+							FailedPNumCount: aStatus.FailedPNumCount,
+							Ack:             aStatus.Ack,
+							Scheduled:       scheduled,
+							Started:         t1,
+							Missed:          t4.After(next),
+						},
+						WriteSectionInfo{
+							UnitNumber:      unitNumber,
+							Time:            listTime,
+							Loop:            listLoop,
+							Duration:        t3.Sub(t2),
+							SectionCount:    batchCount,
+							PNumCount:       int64(dPCount),
+							FailedCount:     dStatus.FailedCount,
+							FailedPNumCount: dStatus.FailedPNumCount,
+							Ack:             dStatus.Ack,
+							Scheduled:       scheduled,
+							Started:         t1,
+							Missed:          t4.After(next),
+						},
+					)
 				}
 
 				// 全部写完, 退出循环
@@ -1050,116 +1975,162 @@ func AsyncPeriodicWriteSection(
 					return
 				}
 
-				// 睡眠
-				if duration < time.Duration(regularWritePeriodic)*time.Millisecond*100 {
-					sleepDuration := time.Duration(regularWritePeriodic)*time.Millisecond*100 - duration
+				// 睡眠到下一批的计划时间
+				if sleepDuration := time.Until(next); sleepDuration > 0 && !openLoop {
 					if isFast {
-						FastSleepDurationList = append(FastSleepDurationList, sleepDuration)
+						GlobalFastStats.AddSleep(sleepDuration)
 					} else {
-						NormalSleepDurationList = append(NormalSleepDurationList, sleepDuration)
+						GlobalNormalStats.AddSleep(sleepDuration)
 					}
 					time.Sleep(sleepDuration)
 				}
 			} else {
-				// 写入数据
-				start := time.Now()
-				section, ok := <-sectionCh
+				// 写入数据, 过载保护期间按过载保护写入周期计划下一个断面
+				scheduled := next
+				if !openLoop {
+					next = next.Add(schedule.Next())
+				}
+				section, ok := recv()
 				if !ok {
 					return
 				}
+				if openLoop {
+					scheduled, next = section.release, section.deadline
+				}
 				if isRt {
+					aStatus := WriteStatus{}
+					dStatus := WriteStatus{}
 					wt1 := time.Now()
 					if section.analogOk {
-						GlobalPlugin.WriteRtAnalog(magic, unitNumber, section.analog, isFast, randomAv)
+						aStatus = GlobalPlugin.WriteRtAnalog(magic, unitNumber, section.analog, isFast, randomAv)
 					}
 					wt2 := time.Now()
 					if section.digitalOk {
-						GlobalPlugin.WriteRtDigital(magic, unitNumber, section.digital, isFast)
+						dStatus = GlobalPlugin.WriteRtDigital(magic, unitNumber, section.digital, isFast)
 					}
 					wt3 := time.Now()
+					// flush的耗时计入本周期, 错过截止时间按flush结束的时间判断
+					GlobalFlush.AfterSections(1)
+					wt4 := time.Now()
 					if isFast {
-						FastAnalogWriteSectionInfoList = append(FastAnalogWriteSectionInfoList, WriteSectionInfo{
-							UnitNumber:   unitNumber,
-							Time:         section.analog.Time,
-							Duration:     wt2.Sub(wt1),
-							SectionCount: 1,
-							PNumCount:    int64(len(section.analog.Data)),
-						})
-						FastDigitalWriteSectionInfoList = append(FastDigitalWriteSectionInfoList, WriteSectionInfo{
-							UnitNumber:   unitNumber,
-							Time:         section.digital.Time,
-							Duration:     wt3.Sub(wt2),
-							SectionCount: 1,
-							PNumCount:    int64(len(section.digital.Data)),
-						})
+						GlobalFastStats.Add(
+							WriteSectionInfo{
+								UnitNumber:      unitNumber,
+								Time:            section.Time(),
+								Loop:            section.loop,
+								Duration:        wt2.Sub(wt1),
+								SectionCount:    1,
+								PNumCount:       int64(len(section.analog.Data)),
+								FailedCount:     aStatus.FailedCount,
+								FailedPNumCount: aStatus.FailedPNumCount,
+								Ack:             aStatus.Ack,
+								Scheduled:       scheduled,
+								Started:         wt1,
+								Missed:          wt4.After(next),
+							},
+							WriteSectionInfo{
+								UnitNumber:      unitNumber,
+								Time:            section.Time(),
+								Loop:            section.loop,
+								Duration:        wt3.Sub(wt2),
+								SectionCount:    1,
+								PNumCount:       int64(len(section.digital.Data)),
+								FailedCount:     dStatus.FailedCount,
+								FailedPNumCount: dStatus.FailedPNumCount,
+								Ack:             dStatus.Ack,
+								Scheduled:       scheduled,
+								Started:         wt1,
+								Missed:          wt4.After(next),
+							},
+						)
 					} else {
-						NormalAnalogWriteSectionInfoList = append(NormalAnalogWriteSectionInfoList, WriteSectionInfo{
-							UnitNumber:   unitNumber,
-							Time:         section.analog.Time,
-							Duration:     wt2.Sub(wt1),
-							SectionCount: 1,
-							PNumCount:    int64(len(section.analog.Data)),
-						})
-						NormalDigitalWriteSectionInfoList = append(NormalDigitalWriteSectionInfoList, WriteSectionInfo{
-							UnitNumber:   unitNumber,
-							Time:         section.digital.Time,
-							Duration:     wt3.Sub(wt2),
-							SectionCount: 1,
-							PNumCount:    int64(len(section.digital.Data)),
-						})
+						GlobalNormalStats.Add(
+							WriteSectionInfo{
+								UnitNumber:      unitNumber,
+								Time:            section.Time(),
+								Loop:            section.loop,
+								Duration:        wt2.Sub(wt1),
+								SectionCount:    1,
+								PNumCount:       int64(len(section.analog.Data)),
+								FailedCount:     aStatus.FailedCount,
+								FailedPNumCount: aStatus.FailedPNumCount,
+								Ack:             aStatus.Ack,
+								Scheduled:       scheduled,
+								Started:         wt1,
+								Missed:          wt4.After(next),
+							},
+							WriteSectionInfo{
+								UnitNumber:      unitNumber,
+								Time:            section.Time(),
+								Loop:            section.loop,
+								Duration:        wt3.Sub(wt2),
+								SectionCount:    1,
+								PNumCount:       int64(len(section.digital.Data)),
+								FailedCount:     dStatus.FailedCount,
+								FailedPNumCount: dStatus.FailedPNumCount,
+								Ack:             dStatus.Ack,
+								Scheduled:       scheduled,
+								Started:         wt1,
+								Missed:          wt4.After(next),
+							},
+						)
 					}
 				} else {
+					aStatus := WriteStatus{}
+					dStatus := WriteStatus{}
 					wt1 := time.Now()
 					if section.analogOk {
-						GlobalPlugin.WriteHisAnalog(magic, unitNumber, section.analog, randomAv)
+						aStatus = GlobalPlugin.WriteHisAnalog(magic, unitNumber, section.analog, randomAv)
 					}
 					wt2 := time.Now()
 					if section.digitalOk {
-						GlobalPlugin.WriteHisDigital(magic, unitNumber, section.digital)
+						dStatus = GlobalPlugin.WriteHisDigital(magic, unitNumber, section.digital)
 					}
 					wt3 := time.Now()
-
-					NormalAnalogWriteSectionInfoList = append(NormalAnalogWriteSectionInfoList, WriteSectionInfo{
-						UnitNumber:   unitNumber,
-						Time:         section.analog.Time,
-						Duration:     wt2.Sub(wt1),
-						SectionCount: 1,
-						PNumCount:    int64(len(section.analog.Data)),
-					})
-					NormalDigitalWriteSectionInfoList = append(NormalDigitalWriteSectionInfoList, WriteSectionInfo{
-						UnitNumber:   unitNumber,
-						Time:         section.digital.Time,
-						Duration:     wt3.Sub(wt2),
-						SectionCount: 1,
-						PNumCount:    int64(len(section.digital.Data)),
-					})
+					// flush的耗时计入本周期, 错过截止时间按flush结束的时间判断
+					GlobalFlush.AfterSections(1)
+					wt4 := time.Now()
+
+					GlobalNormalStats.Add(
+						WriteSectionInfo{
+							UnitNumber:      unitNumber,
+							Time:            section.Time(),
+							Loop:            section.loop,
+							Duration:        wt2.Sub(wt1),
+							SectionCount:    1,
+							PNumCount:       int64(len(section.analog.Data)),
+							FailedCount:     aStatus.FailedCount,
+							FailedPNumCount: aStatus.FailedPNumCount,
+							Ack:             aStatus.Ack,
+							Scheduled:       scheduled,
+							Started:         wt1,
+							Missed:          wt4.After(next),
+						},
+						WriteSectionInfo{
+							UnitNumber:      unitNumber,
+							Time:            section.Time(),
+							Loop:            section.loop,
+							Duration:        wt3.Sub(wt2),
+							SectionCount:    1,
+							PNumCount:       int64(len(section.digital.Data)),
+							FailedCount:     dStatus.FailedCount,
+							FailedPNumCount: dStatus.FailedPNumCount,
+							Ack:             dStatus.Ack,
+							Scheduled:       scheduled,
+							Started:         wt1,
+							Missed:          wt4.After(next),
+						},
+					)
 				}
 
-				duration := time.Now().Sub(start)
-
-				// 睡眠剩余时间
-				if sum < overloadProtectionWriteDuration {
-					sum += overloadProtectionWritePeriodic
-
-					if duration < time.Duration(overloadProtectionWritePeriodic)*time.Millisecond {
-						sleepDuration := time.Duration(overloadProtectionWritePeriodic)*time.Millisecond - duration
-						if isFast {
-							FastSleepDurationList = append(FastSleepDurationList, sleepDuration)
-						} else {
-							NormalSleepDurationList = append(NormalSleepDurationList, sleepDuration)
-						}
-						time.Sleep(sleepDuration)
-					}
-				} else {
-					if duration < time.Duration(regularWritePeriodic)*time.Millisecond {
-						sleepDuration := time.Duration(regularWritePeriodic)*time.Millisecond - duration
-						if isFast {
-							FastSleepDurationList = append(FastSleepDurationList, sleepDuration)
-						} else {
-							NormalSleepDurationList = append(NormalSleepDurationList, sleepDuration)
-						}
-						time.Sleep(sleepDuration)
+				// 睡眠到下一个断面的计划时间
+				if sleepDuration := time.Until(next); sleepDuration > 0 && !openLoop {
+					if isFast {
+						GlobalFastStats.AddSleep(sleepDuration)
+					} else {
+						GlobalNormalStats.AddSleep(sleepDuration)
 					}
+					time.Sleep(sleepDuration)
 				}
 			}
 		}
@@ -1170,27 +2141,55 @@ func AsyncPeriodicWriteSection(
 func StaticWrite(magic int32, unitNumber int64, analogPath string, digitalPath string, typ int64) {
 	t1 := time.Now()
 	analogSection := ReadStaticAnalogCsv(analogPath)
-	GlobalPlugin.WriteStaticAnalog(magic, unitNumber, analogSection, typ)
+	aStatus := GlobalPlugin.WriteStaticAnalog(magic, unitNumber, analogSection, typ)
 	t2 := time.Now()
 	digitalSection := ReadStaticDigitalCsv(digitalPath)
-	GlobalPlugin.WriteStaticDigital(magic, unitNumber, digitalSection, typ)
+	dStatus := GlobalPlugin.WriteStaticDigital(magic, unitNumber, digitalSection, typ)
 	t3 := time.Now()
-	FastAnalogWriteSectionInfoList = append(FastAnalogWriteSectionInfoList, WriteSectionInfo{
-		UnitNumber:   unitNumber,
-		Time:         -1,
-		Duration:     t2.Sub(t1),
-		SectionCount: 1,
-		PNumCount:    int64(len(analogSection.Data)),
-	})
-	FastDigitalWriteSectionInfoList = append(FastDigitalWriteSectionInfoList, WriteSectionInfo{
-		UnitNumber:   unitNumber,
-		Time:         -1,
-		Duration:     t3.Sub(t2),
-		SectionCount: 1,
-		PNumCount:    int64(len(digitalSection.Data)),
+	GlobalFastStats.Add(
+		WriteSectionInfo{
+			UnitNumber:      unitNumber,
+			Time:            -1,
+			Duration:        t2.Sub(t1),
+			SectionCount:    1,
+			PNumCount:       int64(len(analogSection.Data)),
+			FailedCount:     aStatus.FailedCount,
+			FailedPNumCount: aStatus.FailedPNumCount,
+			Ack:             aStatus.Ack,
+		},
+		WriteSectionInfo{
+			UnitNumber:      unitNumber,
+			Time:            -1,
+			Duration:        t3.Sub(t2),
+			SectionCount:    1,
+			PNumCount:       int64(len(digitalSection.Data)),
+			FailedCount:     dStatus.FailedCount,
+			FailedPNumCount: dStatus.FailedPNumCount,
+			Ack:             dStatus.Ack,
+		},
+	)
+}
+
+// AbortCh 写入过程中出现无法继续的错误(例如插件进程崩溃)时关闭, 与中断信号一样触发平滑退出
+var AbortCh = make(chan struct{})
+var abortOnce sync.Once
+
+// Abort 触发平滑退出, 多次调用只生效一次
+func Abort(reason string) {
+	abortOnce.Do(func() {
+		log.Println("中止写入: ", reason)
+		close(AbortCh)
 	})
 }
 
+// WaitExit 等待中断信号或者 Abort
+func WaitExit(sigs chan os.Signal) {
+	select {
+	case <-sigs:
+	case <-AbortCh:
+	}
+}
+
 func FastWriteRtOnlyFast(magic int32, unitNumber int64, fastAnalogCsvPath string, fastDigitalCsvPath string, randomAv bool) {
 	// 平滑退出
 	sigs := make(chan os.Signal, 1)
@@ -1198,22 +2197,22 @@ func FastWriteRtOnlyFast(magic int32, unitNumber int64, fastAnalogCsvPath string
 	done := make(chan bool, 1)
 	rd1 := make(chan bool, 1)
 	go func() {
-		_ = <-sigs
+		WaitExit(sigs)
 		log.Println("捕获中断信号, 进行平滑退出处理")
 		done <- true
 		rd1 <- true
 		log.Println("平滑退出信号发送完成")
 	}()
 
-	fastSectionCh := make(chan Section, CacheSize)
-	normalSectionCh := make(chan Section, CacheSize)
+	fastSectionCh := make(chan Section, GlobalPeriodic.CacheSize)
+	normalSectionCh := make(chan Section, GlobalPeriodic.CacheSize)
 	close(normalSectionCh)
 	wg := new(sync.WaitGroup)
 	wg.Add(1)
 	go ReadCsv(wg, fastAnalogCsvPath, fastDigitalCsvPath, fastSectionCh, rd1)
 
-	// 睡眠2秒, 等待协程加载缓存
-	time.Sleep(2 * time.Second)
+	// 等待读取协程加载缓存: 预加载数据集, 或者缓存足够的断面后开始写入
+	fastSectionCh = GlobalPreload.Prepare("快采点", fastSectionCh, WaitGroupDone(wg))
 
 	FastWriteRealtimeSection(magic, unitNumber, fastSectionCh, normalSectionCh, done, randomAv)
 	wg.Wait()
@@ -1226,21 +2225,21 @@ func FastWriteRtOnlyNormal(magic int32, unitNumber int64, normalAnalogCsvPath st
 	done := make(chan bool, 1)
 	rd1 := make(chan bool, 1)
 	go func() {
-		_ = <-sigs
+		WaitExit(sigs)
 		log.Println("捕获中断信号, 进行平滑退出处理")
 		done <- true
 		rd1 <- true
 		log.Println("平滑退出信号发送完成")
 	}()
 
-	fastSectionCh := make(chan Section, CacheSize)
+	fastSectionCh := make(chan Section, GlobalPeriodic.CacheSize)
 	close(fastSectionCh)
-	normalSectionCh := make(chan Section, CacheSize)
+	normalSectionCh := make(chan Section, GlobalPeriodic.CacheSize)
 	wg := new(sync.WaitGroup)
 	wg.Add(1)
 	go ReadCsv(wg, normalAnalogCsvPath, normalDigitalCsvPath, normalSectionCh, rd1)
-	// 睡眠2秒, 等待协程加载缓存
-	time.Sleep(2 * time.Second)
+	// 等待读取协程加载缓存: 预加载数据集, 或者缓存足够的断面后开始写入
+	normalSectionCh = GlobalPreload.Prepare("普通点", normalSectionCh, WaitGroupDone(wg))
 
 	FastWriteRealtimeSection(magic, unitNumber, fastSectionCh, normalSectionCh, done, randomAv)
 	wg.Wait()
@@ -1269,7 +2268,7 @@ func FastWriteRt(magic int32, unitNumber int64, fastAnalogCsvPath string, fastDi
 	rd1 := make(chan bool, 1)
 	rd2 := make(chan bool, 1)
 	go func() {
-		_ = <-sigs
+		WaitExit(sigs)
 		log.Println("捕获中断信号, 进行平滑退出处理")
 		done <- true
 		rd1 <- true
@@ -1277,17 +2276,21 @@ func FastWriteRt(magic int32, unitNumber int64, fastAnalogCsvPath string, fastDi
 		log.Println("平滑退出信号发送完成")
 	}()
 
-	fastSectionCh := make(chan Section, CacheSize)
-	normalSectionCh := make(chan Section, CacheSize)
-	wg := new(sync.WaitGroup)
-	wg.Add(2)
-	go ReadCsv(wg, fastAnalogCsvPath, fastDigitalCsvPath, fastSectionCh, rd1)
-	go ReadCsv(wg, normalAnalogCsvPath, normalDigitalCsvPath, normalSectionCh, rd2)
-	// 睡眠2秒, 等待协程加载缓存
-	time.Sleep(2 * time.Second)
+	fastSectionCh := make(chan Section, GlobalPeriodic.CacheSize)
+	normalSectionCh := make(chan Section, GlobalPeriodic.CacheSize)
+	wgFast := new(sync.WaitGroup)
+	wgNormal := new(sync.WaitGroup)
+	wgFast.Add(1)
+	wgNormal.Add(1)
+	go ReadCsv(wgFast, fastAnalogCsvPath, fastDigitalCsvPath, fastSectionCh, rd1)
+	go ReadCsv(wgNormal, normalAnalogCsvPath, normalDigitalCsvPath, normalSectionCh, rd2)
+	// 等待读取协程加载缓存: 预加载数据集, 或者缓存足够的断面后开始写入
+	fastSectionCh = GlobalPreload.Prepare("快采点", fastSectionCh, WaitGroupDone(wgFast))
+	normalSectionCh = GlobalPreload.Prepare("普通点", normalSectionCh, WaitGroupDone(wgNormal))
 
 	FastWriteRealtimeSection(magic, unitNumber, fastSectionCh, normalSectionCh, done, randomAv)
-	wg.Wait()
+	wgFast.Wait()
+	wgNormal.Wait()
 }
 
 func PeriodicWriteRtOnlyFast(magic int32, unitNumber int64, overloadProtectionFlag bool, fastAnalogCsvPath string, fastDigitalCsvPath string, fastCache bool, randomAv bool) {
@@ -1297,24 +2300,24 @@ func PeriodicWriteRtOnlyFast(magic int32, unitNumber int64, overloadProtectionFl
 	done1 := make(chan bool, 1)
 	rd1 := make(chan bool, 1)
 	go func() {
-		_ = <-sigs
+		WaitExit(sigs)
 		done1 <- true
 		rd1 <- true
 	}()
 
-	fastSectionCh := make(chan Section, CacheSize)
+	fastSectionCh := make(chan Section, GlobalPeriodic.CacheSize)
 	wgRead := new(sync.WaitGroup)
 	wgRead.Add(1)
 	go ReadCsv(wgRead, fastAnalogCsvPath, fastDigitalCsvPath, fastSectionCh, rd1)
 
-	// 睡眠2秒, 等待协程加载缓存
-	time.Sleep(2000 * time.Millisecond)
+	// 等待读取协程加载缓存: 预加载数据集, 或者缓存足够的断面后开始写入
+	fastSectionCh = GlobalPreload.Prepare("快采点", fastSectionCh, WaitGroupDone(wgRead))
 	wgWrite := new(sync.WaitGroup)
 	wgWrite.Add(1)
 	if overloadProtectionFlag {
-		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, FastRegularWritePeriodic, fastSectionCh, true, true, fastCache, done1, randomAv)
+		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, GlobalPeriodic.FastPeriodic, fastSectionCh, true, true, fastCache, done1, randomAv)
 	} else {
-		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, FastRegularWritePeriodic, fastSectionCh, true, true, fastCache, done1, randomAv)
+		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, GlobalPeriodic.FastPeriodic, fastSectionCh, true, true, fastCache, done1, randomAv)
 	}
 	wgWrite.Wait()
 	wgRead.Wait()
@@ -1328,25 +2331,25 @@ func PeriodicWriteRtOnlyNormal(magic int32, unitNumber int64, overloadProtection
 	done2 := make(chan bool, 1)
 	rd1 := make(chan bool, 1)
 	go func() {
-		_ = <-sigs
+		WaitExit(sigs)
 		done1 <- true
 		done2 <- true
 		rd1 <- true
 	}()
 
-	normalSectionCh := make(chan Section, CacheSize)
+	normalSectionCh := make(chan Section, GlobalPeriodic.CacheSize)
 	wgRead := new(sync.WaitGroup)
 	wgRead.Add(1)
 	go ReadCsv(wgRead, normalAnalogCsvPath, normalDigitalCsvPath, normalSectionCh, rd1)
 
-	// 睡眠2秒, 等待协程加载缓存
-	time.Sleep(2000 * time.Millisecond)
+	// 等待读取协程加载缓存: 预加载数据集, 或者缓存足够的断面后开始写入
+	normalSectionCh = GlobalPreload.Prepare("普通点", normalSectionCh, WaitGroupDone(wgRead))
 	wgWrite := new(sync.WaitGroup)
 	wgWrite.Add(1)
 	if overloadProtectionFlag {
-		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, OverloadProtectionWriteDuration, OverloadProtectionWritePeriodic, NormalRegularWritePeriodic, normalSectionCh, true, false, false, done2, randomAv)
+		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, GlobalPeriodic.OverloadDuration, GlobalPeriodic.OverloadPeriodic, GlobalPeriodic.NormalPeriodic, normalSectionCh, true, false, false, done2, randomAv)
 	} else {
-		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, NormalRegularWritePeriodic, normalSectionCh, true, false, false, done2, randomAv)
+		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, GlobalPeriodic.NormalPeriodic, normalSectionCh, true, false, false, done2, randomAv)
 	}
 	wgWrite.Wait()
 	wgRead.Wait()
@@ -1362,33 +2365,37 @@ func PeriodicWriteRt(magic int32, unitNumber int64, overloadProtectionFlag bool,
 	rd1 := make(chan bool, 1)
 	rd2 := make(chan bool, 1)
 	go func() {
-		_ = <-sigs
+		WaitExit(sigs)
 		done1 <- true
 		done2 <- true
 		rd1 <- true
 		rd2 <- true
 	}()
 
-	fastSectionCh := make(chan Section, CacheSize)
-	normalSectionCh := make(chan Section, CacheSize)
-	wgRead := new(sync.WaitGroup)
-	wgRead.Add(2)
-	go ReadCsv(wgRead, fastAnalogCsvPath, fastDigitalCsvPath, fastSectionCh, rd1)
-	go ReadCsv(wgRead, normalAnalogCsvPath, normalDigitalCsvPath, normalSectionCh, rd2)
-
-	// 睡眠2秒, 等待协程加载缓存
-	time.Sleep(2000 * time.Millisecond)
+	fastSectionCh := make(chan Section, GlobalPeriodic.CacheSize)
+	normalSectionCh := make(chan Section, GlobalPeriodic.CacheSize)
+	wgFast := new(sync.WaitGroup)
+	wgNormal := new(sync.WaitGroup)
+	wgFast.Add(1)
+	wgNormal.Add(1)
+	go ReadCsv(wgFast, fastAnalogCsvPath, fastDigitalCsvPath, fastSectionCh, rd1)
+	go ReadCsv(wgNormal, normalAnalogCsvPath, normalDigitalCsvPath, normalSectionCh, rd2)
+
+	// 等待读取协程加载缓存: 预加载数据集, 或者缓存足够的断面后开始写入
+	fastSectionCh = GlobalPreload.Prepare("快采点", fastSectionCh, WaitGroupDone(wgFast))
+	normalSectionCh = GlobalPreload.Prepare("普通点", normalSectionCh, WaitGroupDone(wgNormal))
 	wgWrite := new(sync.WaitGroup)
 	wgWrite.Add(2)
 	if overloadProtectionFlag {
-		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, FastRegularWritePeriodic, fastSectionCh, true, true, fastCache, done1, randomAv)
-		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, OverloadProtectionWriteDuration, OverloadProtectionWritePeriodic, NormalRegularWritePeriodic, normalSectionCh, true, false, false, done2, randomAv)
+		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, GlobalPeriodic.FastPeriodic, fastSectionCh, true, true, fastCache, done1, randomAv)
+		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, GlobalPeriodic.OverloadDuration, GlobalPeriodic.OverloadPeriodic, GlobalPeriodic.NormalPeriodic, normalSectionCh, true, false, false, done2, randomAv)
 	} else {
-		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, FastRegularWritePeriodic, fastSectionCh, true, true, fastCache, done1, randomAv)
-		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, NormalRegularWritePeriodic, normalSectionCh, true, false, false, done2, randomAv)
+		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, GlobalPeriodic.FastPeriodic, fastSectionCh, true, true, fastCache, done1, randomAv)
+		go AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, GlobalPeriodic.NormalPeriodic, normalSectionCh, true, false, false, done2, randomAv)
 	}
 	wgWrite.Wait()
-	wgRead.Wait()
+	wgFast.Wait()
+	wgNormal.Wait()
 }
 
 // FastWriteHis 极速写历史
@@ -1399,50 +2406,148 @@ func FastWriteHis(magic int32, unitNumber int64, analogCsvPath string, digitalCs
 	done := make(chan bool, 1)
 	rd1 := make(chan bool, 1)
 	go func() {
-		_ = <-sigs
+		WaitExit(sigs)
 		done <- true
 		rd1 <- true
 	}()
 
-	sectionCh := make(chan Section, CacheSize)
+	sectionCh := make(chan Section, GlobalPeriodic.CacheSize)
 	wg := new(sync.WaitGroup)
 	wg.Add(1)
 	go ReadCsv(wg, analogCsvPath, digitalCsvPath, sectionCh, rd1)
 
-	// 睡眠2秒, 等待协程加载缓存
-	time.Sleep(2000 * time.Millisecond)
+	// 等待读取协程加载缓存: 预加载数据集, 或者缓存足够的断面后开始写入
+	sectionCh = GlobalPreload.Prepare("普通点", sectionCh, WaitGroupDone(wg))
 	FastWriteHisSection(magic, unitNumber, sectionCh, done, randomAv)
 	wg.Wait()
 }
 
 // PeriodicWriteHis 周期性写历史
-func PeriodicWriteHis(magic int32, unitNumber int64, analogCsvPath string, digitalCsvPath string, randomAv bool) {
+func PeriodicWriteHis(magic int32, unitNumber int64, overloadProtectionFlag bool, analogCsvPath string, digitalCsvPath string, randomAv bool) {
 	// 平滑退出
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	done := make(chan bool, 1)
 	rd1 := make(chan bool, 1)
 	go func() {
-		_ = <-sigs
+		WaitExit(sigs)
 		done <- true
 		rd1 <- true
 	}()
 
-	normalSectionCh := make(chan Section, CacheSize)
+	normalSectionCh := make(chan Section, GlobalPeriodic.CacheSize)
 	wgRead := new(sync.WaitGroup)
 	wgRead.Add(1)
 	go ReadCsv(wgRead, analogCsvPath, digitalCsvPath, normalSectionCh, rd1)
 
-	// 睡眠2秒, 等待协程加载缓存
-	time.Sleep(2000 * time.Millisecond)
-
+	// 等待读取协程加载缓存: 预加载数据集, 或者缓存足够的断面后开始写入
+	normalSectionCh = GlobalPreload.Prepare("普通点", normalSectionCh, WaitGroupDone(wgRead))
 	wgWrite := new(sync.WaitGroup)
 	wgWrite.Add(1)
-	AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, NormalRegularWritePeriodic, normalSectionCh, false, false, false, done, randomAv)
+	if overloadProtectionFlag {
+		AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, GlobalPeriodic.OverloadDuration, GlobalPeriodic.OverloadPeriodic, GlobalPeriodic.NormalPeriodic, normalSectionCh, false, false, false, done, randomAv)
+	} else {
+		AsyncPeriodicWriteSection(magic, unitNumber, wgWrite, 0, 0, GlobalPeriodic.NormalPeriodic, normalSectionCh, false, false, false, done, randomAv)
+	}
 	wgWrite.Wait()
 	wgRead.Wait()
 }
 
+// ReadBack 通过插件读回数据, 以与输入CSV相同的格式输出
+// typ: 0代表实时快采集点, 1代表实时普通点(读快照), 2代表历史普通点(读[start, end]范围内的历史值)
+func ReadBack(magic int32, unitId int64, typ int64, isDigital bool, pNumList []int32, start int64, end int64, output string) error {
+	out := os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+		out = file
+	}
+	writer := csv.NewWriter(out)
+	defer writer.Flush()
+
+	if isDigital {
+		_ = writer.Write([]string{"TIME", "P_NUM", "DV", "DVR", "Q", "BF", "FQ", "FAI", "MS", "TEW", "CST"})
+	} else {
+		_ = writer.Write([]string{"TIME", "P_NUM", "AV", "AVR", "Q", "BF", "FQ", "FAI", "MS", "TEW", "CST"})
+	}
+
+	count := 0
+	switch typ {
+	case 0, 1:
+		isFast := typ == 0
+		if isDigital {
+			tsList, dataList, err := GlobalPlugin.ReadRtDigital(magic, unitId, pNumList, isFast)
+			if err != nil {
+				return err
+			}
+			for i := range dataList {
+				if tsList[i] == -1 {
+					log.Println("没有读取到值, P_NUM: ", pNumList[i])
+					continue
+				}
+				_ = writer.Write(FormatDigitalRecord(tsList[i], dataList[i]))
+				count++
+			}
+		} else {
+			tsList, dataList, err := GlobalPlugin.ReadRtAnalog(magic, unitId, pNumList, isFast)
+			if err != nil {
+				return err
+			}
+			for i := range dataList {
+				if tsList[i] == -1 {
+					log.Println("没有读取到值, P_NUM: ", pNumList[i])
+					continue
+				}
+				_ = writer.Write(FormatAnalogRecord(tsList[i], dataList[i]))
+				count++
+			}
+		}
+	case 2:
+		for _, pNum := range pNumList {
+			var err error
+			if isDigital {
+				err = GlobalPlugin.ReadHisDigital(magic, unitId, pNum, start, end, func(ts int64, digital C.Digital) {
+					_ = writer.Write(FormatDigitalRecord(ts, digital))
+					count++
+				})
+			} else {
+				err = GlobalPlugin.ReadHisAnalog(magic, unitId, pNum, start, end, func(ts int64, analog C.Analog) {
+					_ = writer.Write(FormatAnalogRecord(ts, analog))
+					count++
+				})
+			}
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("未知type: 0代表实时快采集点, 1代表实时普通点, 2代表历史普通点")
+	}
+	log.Printf("读取完成, PNUM数量: %v, 读取值数量: %v\n", len(pNumList), count)
+	return nil
+}
+
+// AnalogSectionsPNumCount 统计多个断面的PNum数量
+func AnalogSectionsPNumCount(sections []AnalogSection) int {
+	count := 0
+	for _, section := range sections {
+		count += len(section.Data)
+	}
+	return count
+}
+
+// DigitalSectionsPNumCount 统计多个断面的PNum数量
+func DigitalSectionsPNumCount(sections []DigitalSection) int {
+	count := 0
+	for _, section := range sections {
+		count += len(section.Data)
+	}
+	return count
+}
+
 func RandAnalogSection(section AnalogSection) AnalogSection {
 	ss := AnalogSection{
 		Time: section.Time,
@@ -1529,240 +2634,529 @@ func InitStaticDigitalGlobalID(magic int32, unitId int64, isFast bool, isRt bool
 	return ss
 }
 
+// Writer 写数后端, 每次调用只写入一个机组的数据
+// 调用前 WritePlugin 已经完成了随机浮动和GlobalID初始化, 多个机组会并发调用同一个 Writer
+// DylibWriter(通过dlopen加载的插件)是其中一种实现, 也可以用纯Go实现后端、包装器或测试替身
+type Writer interface {
+	Info() PluginInfo
+	Login(param string) int
+	Logout()
+	Flush() error
+	WriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool) error
+	WriteRtDigital(magic int32, unitId int64, section DigitalSection, isFast bool) error
+	WriteRtAnalogList(magic int32, unitId int64, sections []AnalogSection) error
+	WriteRtDigitalList(magic int32, unitId int64, sections []DigitalSection) error
+	WriteHisAnalog(magic int32, unitId int64, section AnalogSection) error
+	WriteHisDigital(magic int32, unitId int64, section DigitalSection) error
+	WriteStaticAnalog(magic int32, unitId int64, section StaticAnalogSection, typ int64) error
+	WriteStaticDigital(magic int32, unitId int64, section StaticDigitalSection, typ int64) error
+}
+
+// AsyncWriter 支持异步写入的后端(能力位async), 数据库确认写入后需要调用 GlobalAcks.Ack(requestId, status)
+// 返回error表示提交失败, 提交失败的请求不能再确认
+type AsyncWriter interface {
+	WriteRtAnalogAsync(magic int32, unitId int64, section AnalogSection, isFast bool, requestId int64) error
+	WriteRtDigitalAsync(magic int32, unitId int64, section DigitalSection, isFast bool, requestId int64) error
+	WriteHisAnalogAsync(magic int32, unitId int64, section AnalogSection, requestId int64) error
+	WriteHisDigitalAsync(magic int32, unitId int64, section DigitalSection, requestId int64) error
+}
+
+// Reader 支持读取数据的后端(能力位read)
+type Reader interface {
+	ReadRtAnalog(magic int32, unitId int64, pNumList []int32, isFast bool) ([]int64, []C.Analog, error)
+	ReadRtDigital(magic int32, unitId int64, pNumList []int32, isFast bool) ([]int64, []C.Digital, error)
+	ReadHisAnalog(magic int32, unitId int64, pNum int32, start int64, end int64, fn func(int64, C.Analog)) error
+	ReadHisDigital(magic int32, unitId int64, pNum int32, start int64, end int64, fn func(int64, C.Digital)) error
+}
+
+// NopWriter 支持写数程序开销测试(harness_bench)的后端
+// NopWriteRtAnalog 与写实时模拟量的调用路径相同(GlobalID初始化, 调用后端), 但不调用插件的写入函数
+type NopWriter interface {
+	NopWriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool) error
+}
+
 // WritePlugin 写入插件
-// 用于加载插件, 内部调用了 plugin/dylib.h 头文件, 这个头文件封装了C的动态库加载函数
+// 把一次写入分发到所有机组, 负责随机浮动、GlobalID初始化和统计写入结果, 实际写入由 Writer 完成
 type WritePlugin struct {
-	handle C.DYLIB_HANDLE
+	writer Writer
+	async  AsyncWriter // 开启异步写入时不为nil
 }
 
-func NewWritePlugin(path string) *WritePlugin {
-	return &WritePlugin{
-		handle: C.load_library(C.CString(path)),
+func NewWritePlugin(writer Writer) *WritePlugin {
+	return &WritePlugin{writer: writer}
+}
+
+// DylibWriter 通过dlopen加载的插件
+// 内部调用了 plugin/dylib.h 头文件, 这个头文件封装了C的动态库加载函数
+type DylibWriter struct {
+	handle *C.DYLIB_HANDLE // 插件句柄和加载时解析的函数表
+	info   PluginInfo
+}
+
+var _ Writer = (*DylibWriter)(nil)
+var _ AsyncWriter = (*DylibWriter)(nil)
+var _ Reader = (*DylibWriter)(nil)
+var _ NopWriter = (*DylibWriter)(nil)
+
+// 插件能力位, 与 plugin/write_plugin.h 中的 PLUGIN_CAP_* 对应
+const (
+	PluginCapRealtime  = uint64(C.PLUGIN_CAP_REALTIME)
+	PluginCapListWrite = uint64(C.PLUGIN_CAP_LIST_WRITE)
+	PluginCapHistory   = uint64(C.PLUGIN_CAP_HISTORY)
+	PluginCapStatic    = uint64(C.PLUGIN_CAP_STATIC)
+	PluginCapRead      = uint64(C.PLUGIN_CAP_READ)
+	PluginCapFlush     = uint64(C.PLUGIN_CAP_FLUSH)
+	PluginCapAsync     = uint64(C.PLUGIN_CAP_ASYNC)
+)
+
+// PluginCapNames 能力位名称, 用于输出插件信息和错误信息
+var PluginCapNames = []struct {
+	Cap  uint64
+	Name string
+}{
+	{PluginCapRealtime, "realtime"},
+	{PluginCapListWrite, "list_write"},
+	{PluginCapHistory, "history"},
+	{PluginCapStatic, "static"},
+	{PluginCapRead, "read"},
+	{PluginCapFlush, "flush"},
+	{PluginCapAsync, "async"},
+}
+
+// PluginSymbols 插件导出函数与能力位的对应关系, 能力位为0表示必须导出的函数
+var PluginSymbols = []struct {
+	Name string
+	Cap  uint64
+}{
+	{"login", 0},
+	{"logout", 0},
+	{"flush", PluginCapFlush},
+	{"write_rt_analog", PluginCapRealtime},
+	{"write_rt_digital", PluginCapRealtime},
+	{"write_rt_analog_list", PluginCapListWrite},
+	{"write_rt_digital_list", PluginCapListWrite},
+	{"write_his_analog", PluginCapHistory},
+	{"write_his_digital", PluginCapHistory},
+	{"write_static_analog", PluginCapStatic},
+	{"write_static_digital", PluginCapStatic},
+	{"read_rt_analog", PluginCapRead},
+	{"read_rt_digital", PluginCapRead},
+	{"read_his_analog", PluginCapRead},
+	{"read_his_digital", PluginCapRead},
+	{"write_rt_analog_async", PluginCapAsync},
+	{"write_rt_digital_async", PluginCapAsync},
+	{"write_his_analog_async", PluginCapAsync},
+	{"write_his_digital_async", PluginCapAsync},
+}
+
+// PluginInfo 插件信息, 未导出plugin_info的插件根据导出的函数推断能力位
+type PluginInfo struct {
+	ABIVersion   int32  // 插件ABI版本
+	Vendor       string // 厂商名称
+	Version      string // 插件版本
+	Capabilities uint64 // 能力位
+	Declared     bool   // 为true表示能力位由插件的plugin_info声明
+}
+
+// CapNames 将能力位转换为可读的名称列表
+func CapNames(caps uint64) string {
+	names := make([]string, 0)
+	for _, c := range PluginCapNames {
+		if caps&c.Cap != 0 {
+			names = append(names, c.Name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
 	}
+	return strings.Join(names, ",")
 }
 
-func (df *WritePlugin) Login(param string) int {
-	if param == "" {
-		return int(C.dy_login(df.handle, nil))
-	} else {
-		cParam := C.CString(param)
-		defer C.free(unsafe.Pointer(cParam))
-		return int(C.dy_login(df.handle, cParam))
+func (info PluginInfo) String() string {
+	vendor := info.Vendor
+	if vendor == "" {
+		vendor = "unknown"
+	}
+	version := info.Version
+	if version == "" {
+		version = "unknown"
+	}
+	return fmt.Sprintf("厂商: %v, 插件版本: %v, ABI版本: %v, 能力: %v", vendor, version, info.ABIVersion, CapNames(info.Capabilities))
+}
+
+// libraryError 获取动态库加载或函数查找失败的原因
+func libraryError() string {
+	msg := C.library_error()
+	if msg == nil {
+		return "unknown error"
+	}
+	return C.GoString(msg)
+}
+
+// NewDylibWriter 加载插件, 一次性解析插件导出的函数, 并且校验插件声明的能力
+func NewDylibWriter(path string) (*DylibWriter, error) {
+	// dlerror 的错误信息是线程局部的, 加载和校验期间固定在同一个线程上
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	loaded := C.load_library(cPath)
+	if loaded.handle == nil {
+		return nil, errors.New(libraryError())
+	}
+
+	// 函数表分配在C内存中, 每次调用插件时直接传递指针, 不需要经过cgo的指针检查
+	handle := (*C.DYLIB_HANDLE)(C.malloc(C.size_t(unsafe.Sizeof(C.DYLIB_HANDLE{}))))
+	*handle = loaded
+	C.resolve_library(handle)
+
+	info, err := LoadPluginInfo(handle)
+	if err != nil {
+		C.close_library(handle)
+		C.free(unsafe.Pointer(handle))
+		return nil, err
+	}
+	return &DylibWriter{
+		handle: handle,
+		info:   info,
+	}, nil
+}
+
+// LoadPluginInfo 读取插件信息, 并且校验插件导出的函数和声明的能力
+func LoadPluginInfo(handle *C.DYLIB_HANDLE) (PluginInfo, error) {
+	cInfo := C.PluginInfo{}
+	rtn := C.dy_plugin_info(handle, &cInfo)
+	info := PluginInfo{
+		ABIVersion:   int32(cInfo.abi_version),
+		Vendor:       C.GoString(&cInfo.vendor[0]),
+		Version:      C.GoString(&cInfo.version[0]),
+		Capabilities: uint64(cInfo.capabilities),
+		Declared:     rtn == 2,
+	}
+	if info.ABIVersion < 1 || info.ABIVersion > C.WRITE_PLUGIN_ABI_VERSION {
+		return info, fmt.Errorf("插件ABI版本不支持: %v, 写数程序支持的ABI版本: 1-%v", info.ABIVersion, C.WRITE_PLUGIN_ABI_VERSION)
+	}
+	handle.abi_version = C.int32_t(info.ABIVersion)
+
+	// 校验导出函数, 未声明能力位的插件根据导出的函数推断能力位
+	missingCaps := uint64(0)
+	for _, sym := range PluginSymbols {
+		cName := C.CString(sym.Name)
+		ptr := C.dy_symbol(handle, cName)
+		C.free(unsafe.Pointer(cName))
+		if ptr != nil {
+			continue
+		}
+		if sym.Cap == 0 {
+			return info, fmt.Errorf("插件未导出必须的函数 %v: %v", sym.Name, libraryError())
+		}
+		if info.Declared && info.Capabilities&sym.Cap != 0 {
+			return info, fmt.Errorf("插件声明了能力 %v, 但未导出函数 %v: %v", CapNames(sym.Cap), sym.Name, libraryError())
+		}
+		missingCaps |= sym.Cap
+	}
+	if !info.Declared {
+		for _, sym := range PluginSymbols {
+			info.Capabilities |= sym.Cap
+		}
+		info.Capabilities &^= missingCaps
 	}
+
+	return info, nil
+}
+
+// Writer 实际写入数据的后端
+func (df *WritePlugin) Writer() Writer {
+	return df.writer
+}
+
+func (df *WritePlugin) Login(param string) int {
+	return df.writer.Login(param)
 }
 
 func (df *WritePlugin) Logout() {
-	C.dy_logout(df.handle)
+	df.writer.Logout()
+}
+
+// Close 没有登入或登入失败时释放插件: 关闭录制文件, 结束独立的插件进程(--isolate), 不调用插件的logout
+func (df *WritePlugin) Close() {
+	writer := df.writer
+	if rw, ok := writer.(*RecordWriter); ok {
+		rw.Close()
+		writer = rw.writer
+	}
+	if hw, ok := writer.(*HostWriter); ok {
+		hw.Close()
+	}
+}
+
+// Flush 刷新插件缓存, 插件不支持flush时直接返回nil
+func (df *WritePlugin) Flush() error {
+	return df.writer.Flush()
+}
+
+// SetAsync 开启/关闭异步写入, 开启前需要通过Require校验插件支持async
+func (df *WritePlugin) SetAsync(async bool) {
+	df.async = nil
+	if async {
+		df.async, _ = df.writer.(AsyncWriter)
+	}
+}
+
+// Async 是否开启了异步写入
+func (df *WritePlugin) Async() bool {
+	return df.async != nil
+}
+
+// newWriteStatus 开启异步写入时, 为本次写入(包含所有机组)创建AckGroup
+func (df *WritePlugin) newWriteStatus(asyncName string) *WriteStatus {
+	status := new(WriteStatus)
+	if df.async != nil {
+		status.Ack = NewAckGroup(asyncName)
+	}
+	return status
+}
+
+// Info 插件信息
+func (df *WritePlugin) Info() PluginInfo {
+	return df.writer.Info()
+}
+
+// Require 校验插件是否支持命令需要的全部能力
+func (df *WritePlugin) Require(caps uint64) error {
+	if missing := caps &^ df.Info().Capabilities; missing != 0 {
+		return fmt.Errorf("插件不支持: %v", CapNames(missing))
+	}
+	return nil
 }
 
-func (df *WritePlugin) WriteRtAnalog(magic int32, unitNumber int64, section AnalogSection, isFast bool, randomAv bool) {
+func (df *WritePlugin) WriteRtAnalog(magic int32, unitNumber int64, section AnalogSection, isFast bool, randomAv bool) WriteStatus {
+	section.Time = GlobalTimeBase.Shift(section.Time)
+	defer GlobalFlush.Writing()()
+	status := df.newWriteStatus("write_rt_analog_async")
 	if unitNumber == 1 {
-		df.SyncWriteRtAnalog(magic, 0, section, isFast, randomAv)
+		status.Record(df.SyncWriteRtAnalog(magic, 0, section, isFast, randomAv, status.Ack), len(section.Data))
 	} else {
 		wg := new(sync.WaitGroup)
 		wg.Add(int(unitNumber))
 		for i := int64(0); i < unitNumber; i++ {
-			go df.AsyncWriteRtAnalog(wg, magic, i, section, isFast, randomAv)
+			go df.AsyncWriteRtAnalog(wg, status, magic, i, section, isFast, randomAv)
 		}
 		wg.Wait()
 	}
+	status.Ack.Seal()
+	return *status
 }
 
-func (df *WritePlugin) WriteRtDigital(magic int32, unitNumber int64, section DigitalSection, isFast bool) {
+func (df *WritePlugin) WriteRtDigital(magic int32, unitNumber int64, section DigitalSection, isFast bool) WriteStatus {
+	section.Time = GlobalTimeBase.Shift(section.Time)
+	defer GlobalFlush.Writing()()
+	status := df.newWriteStatus("write_rt_digital_async")
 	if unitNumber == 1 {
-		df.SyncWriteRtDigital(magic, 0, section, isFast)
+		status.Record(df.SyncWriteRtDigital(magic, 0, section, isFast, status.Ack), len(section.Data))
 	} else {
 		wg := new(sync.WaitGroup)
 		wg.Add(int(unitNumber))
 		for i := int64(0); i < unitNumber; i++ {
-			go df.AsyncWriteRtDigital(wg, magic, i, section, isFast)
+			go df.AsyncWriteRtDigital(wg, status, magic, i, section, isFast)
 		}
 		wg.Wait()
 	}
+	status.Ack.Seal()
+	return *status
 }
 
-func (df *WritePlugin) WriteRtAnalogList(magic int32, unitNumber int64, sections []AnalogSection, randomAv bool) {
+func (df *WritePlugin) WriteRtAnalogList(magic int32, unitNumber int64, sections []AnalogSection, randomAv bool) WriteStatus {
+	shifted := make([]AnalogSection, len(sections))
+	for i, section := range sections {
+		shifted[i] = AnalogSection{Time: GlobalTimeBase.Shift(section.Time), Data: section.Data}
+	}
+	sections = shifted
+	defer GlobalFlush.Writing()()
+	status := new(WriteStatus)
 	if unitNumber == 1 {
-		df.SyncWriteRtAnalogList(magic, 0, sections, randomAv)
+		status.Record(df.SyncWriteRtAnalogList(magic, 0, sections, randomAv), AnalogSectionsPNumCount(sections))
 	} else {
 		wg := new(sync.WaitGroup)
 		wg.Add(int(unitNumber))
 		for i := int64(0); i < unitNumber; i++ {
-			go df.AsyncWriteRtAnalogList(wg, magic, i, sections, randomAv)
+			go df.AsyncWriteRtAnalogList(wg, status, magic, i, sections, randomAv)
 		}
 		wg.Wait()
 	}
+	return *status
 }
 
-func (df *WritePlugin) WriteRtDigitalList(magic int32, unitNumber int64, sections []DigitalSection) {
+func (df *WritePlugin) WriteRtDigitalList(magic int32, unitNumber int64, sections []DigitalSection) WriteStatus {
+	shifted := make([]DigitalSection, len(sections))
+	for i, section := range sections {
+		shifted[i] = DigitalSection{Time: GlobalTimeBase.Shift(section.Time), Data: section.Data}
+	}
+	sections = shifted
+	defer GlobalFlush.Writing()()
+	status := new(WriteStatus)
 	if unitNumber == 1 {
-		df.SyncWriteRtDigitalList(magic, 0, sections)
+		status.Record(df.SyncWriteRtDigitalList(magic, 0, sections), DigitalSectionsPNumCount(sections))
 	} else {
 		wg := new(sync.WaitGroup)
 		wg.Add(int(unitNumber))
 		for i := int64(0); i < unitNumber; i++ {
-			go df.AsyncWriteRtDigitalList(wg, magic, i, sections)
+			go df.AsyncWriteRtDigitalList(wg, status, magic, i, sections)
 		}
 		wg.Wait()
 	}
+	return *status
 }
 
-func (df *WritePlugin) WriteHisAnalog(magic int32, unitNumber int64, section AnalogSection, randomAv bool) {
+func (df *WritePlugin) WriteHisAnalog(magic int32, unitNumber int64, section AnalogSection, randomAv bool) WriteStatus {
+	section.Time = GlobalTimeBase.Shift(section.Time)
+	defer GlobalFlush.Writing()()
+	status := df.newWriteStatus("write_his_analog_async")
 	if unitNumber == 1 {
-		df.SyncWriteHisAnalog(magic, 0, section, randomAv)
+		status.Record(df.SyncWriteHisAnalog(magic, 0, section, randomAv, status.Ack), len(section.Data))
 	} else {
 		wg := new(sync.WaitGroup)
 		wg.Add(int(unitNumber))
 		for i := int64(0); i < unitNumber; i++ {
-			go df.AsyncWriteHisAnalog(wg, magic, i, section, randomAv)
+			go df.AsyncWriteHisAnalog(wg, status, magic, i, section, randomAv)
 		}
 		wg.Wait()
 	}
+	status.Ack.Seal()
+	return *status
 }
 
-func (df *WritePlugin) WriteHisDigital(magic int32, unitNumber int64, section DigitalSection) {
+func (df *WritePlugin) WriteHisDigital(magic int32, unitNumber int64, section DigitalSection) WriteStatus {
+	section.Time = GlobalTimeBase.Shift(section.Time)
+	defer GlobalFlush.Writing()()
+	status := df.newWriteStatus("write_his_digital_async")
 	if unitNumber == 1 {
-		df.SyncWriteHisDigital(magic, 0, section)
+		status.Record(df.SyncWriteHisDigital(magic, 0, section, status.Ack), len(section.Data))
 	} else {
 		wg := new(sync.WaitGroup)
 		wg.Add(int(unitNumber))
 		for i := int64(0); i < unitNumber; i++ {
-			go df.AsyncWriteHisDigital(wg, magic, i, section)
+			go df.AsyncWriteHisDigital(wg, status, magic, i, section)
 		}
 		wg.Wait()
 	}
+	status.Ack.Seal()
+	return *status
 }
 
-func (df *WritePlugin) WriteStaticAnalog(magic int32, unitNumber int64, section StaticAnalogSection, typ int64) {
+func (df *WritePlugin) WriteStaticAnalog(magic int32, unitNumber int64, section StaticAnalogSection, typ int64) WriteStatus {
+	defer GlobalFlush.Writing()()
+	status := new(WriteStatus)
 	if unitNumber == 1 {
-		df.SyncWriteStaticAnalog(magic, 0, section, typ)
+		status.Record(df.SyncWriteStaticAnalog(magic, 0, section, typ), len(section.Data))
 	} else {
 		wg := new(sync.WaitGroup)
 		wg.Add(int(unitNumber))
 		for i := int64(0); i < unitNumber; i++ {
-			go df.AsyncWriteStaticAnalog(wg, magic, i, section, typ)
+			go df.AsyncWriteStaticAnalog(wg, status, magic, i, section, typ)
 		}
 		wg.Wait()
 	}
+	return *status
 }
 
-func (df *WritePlugin) WriteStaticDigital(magic int32, unitNumber int64, section StaticDigitalSection, typ int64) {
+func (df *WritePlugin) WriteStaticDigital(magic int32, unitNumber int64, section StaticDigitalSection, typ int64) WriteStatus {
+	defer GlobalFlush.Writing()()
+	status := new(WriteStatus)
 	if unitNumber == 1 {
-		df.SyncWriteStaticDigital(magic, 0, section, typ)
+		status.Record(df.SyncWriteStaticDigital(magic, 0, section, typ), len(section.Data))
 	} else {
 		wg := new(sync.WaitGroup)
 		wg.Add(int(unitNumber))
 		for i := int64(0); i < unitNumber; i++ {
-			go df.AsyncWriteStaticDigital(wg, magic, i, section, typ)
+			go df.AsyncWriteStaticDigital(wg, status, magic, i, section, typ)
 		}
 		wg.Wait()
 	}
+	return *status
 }
 
-func (df *WritePlugin) SyncWriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool, randomAv bool) {
+func (df *WritePlugin) SyncWriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool, randomAv bool, ack *AckGroup) error {
 	if randomAv {
 		section = RandAnalogSection(section)
 	}
 	section = InitAnalogGlobalID(magic, unitId, isFast, true, section)
-	C.dy_write_rt_analog(df.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Analog)(&section.Data[0]), C.int64_t(len(section.Data)), C.bool(isFast))
-}
-
-func (df *WritePlugin) SyncWriteRtDigital(magic int32, unitId int64, section DigitalSection, isFast bool) {
-	section = InitDigitalGlobalID(magic, unitId, isFast, true, section)
-	C.dy_write_rt_digital(df.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Digital)(&section.Data[0]), C.int64_t(len(section.Data)), C.bool(isFast))
-}
-
-func (df *WritePlugin) SyncWriteRtAnalogList(magic int32, unitId int64, sections []AnalogSection, randomAv bool) {
-	if randomAv {
-		for i := 0; i < len(sections); i++ {
-			sections[i] = RandAnalogSection(sections[i])
-		}
-	}
-	for i := 0; i < len(sections); i++ {
-		sections[i] = InitAnalogGlobalID(magic, unitId, true, true, sections[i])
-	}
-
-	// 初始化 C 数组
-	timeList := make([]C.int64_t, 0)
-	analogArrayList := make([]*C.Analog, 0)
-	countList := make([]C.int64_t, 0)
-
-	for i := range sections {
-		timeList = append(timeList, C.int64_t(sections[i].Time))
-
-		// 分配 C 内存并将 Go 数据复制到 C 内存中
-		analogData := C.malloc(C.size_t(len(sections[i].Data)) * C.size_t(unsafe.Sizeof(C.Analog{})))
-		if analogData == nil {
-			panic("C.malloc failed")
-		}
-		for j := range sections[i].Data {
-			(*[1 << 30]C.Analog)(analogData)[j] = C.Analog(sections[i].Data[j])
+	if ack != nil {
+		requestId := GlobalAcks.Submit(ack, len(section.Data))
+		err := df.async.WriteRtAnalogAsync(magic, unitId, section, isFast, requestId)
+		if err != nil {
+			GlobalAcks.Cancel(requestId)
 		}
-		analogArrayList = append(analogArrayList, (*C.Analog)(analogData))
-		countList = append(countList, C.int64_t(len(sections[i].Data)))
+		return err
 	}
+	return df.writer.WriteRtAnalog(magic, unitId, section, isFast)
+}
 
-	// 调用 C 函数，传递结构体指针数组
-	C.dy_write_rt_analog_list(df.handle, C.int32_t(magic), C.int64_t(unitId), &timeList[0], &analogArrayList[0], &countList[0], C.int64_t(len(sections)))
-
-	// 释放 C 分配的内存
-	for i := range analogArrayList {
-		if analogArrayList[i] != nil {
-			C.free(unsafe.Pointer(analogArrayList[i]))
+func (df *WritePlugin) SyncWriteRtDigital(magic int32, unitId int64, section DigitalSection, isFast bool, ack *AckGroup) error {
+	section = InitDigitalGlobalID(magic, unitId, isFast, true, section)
+	if ack != nil {
+		requestId := GlobalAcks.Submit(ack, len(section.Data))
+		err := df.async.WriteRtDigitalAsync(magic, unitId, section, isFast, requestId)
+		if err != nil {
+			GlobalAcks.Cancel(requestId)
 		}
+		return err
 	}
+	return df.writer.WriteRtDigital(magic, unitId, section, isFast)
 }
 
-func (df *WritePlugin) SyncWriteRtDigitalList(magic int32, unitId int64, sections []DigitalSection) {
+// SyncWriteRtAnalogList 多个机组并发写入同一批断面, 每个机组使用自己的切片, 不修改调用方的切片
+func (df *WritePlugin) SyncWriteRtAnalogList(magic int32, unitId int64, sections []AnalogSection, randomAv bool) error {
+	list := make([]AnalogSection, len(sections))
 	for i := 0; i < len(sections); i++ {
-		sections[i] = InitDigitalGlobalID(magic, unitId, true, true, sections[i])
-	}
-
-	// 初始化 C 数组
-	timeList := make([]C.int64_t, 0)
-	digitalArrayList := make([]*C.Digital, 0)
-	countList := make([]C.int64_t, 0)
-
-	for i := range sections {
-		timeList = append(timeList, C.int64_t(sections[i].Time))
-
-		// 分配 C 内存并将 Go 数据复制到 C 内存中
-		digitalData := C.malloc(C.size_t(len(sections[i].Data)) * C.size_t(unsafe.Sizeof(C.Digital{})))
-		if digitalData == nil {
-			panic("C.malloc failed")
+		section := sections[i]
+		if randomAv {
+			section = RandAnalogSection(section)
 		}
-		for j := range sections[i].Data {
-			(*[1 << 30]C.Digital)(digitalData)[j] = C.Digital(sections[i].Data[j])
-		}
-		digitalArrayList = append(digitalArrayList, (*C.Digital)(digitalData))
-		countList = append(countList, C.int64_t(len(sections[i].Data)))
+		list[i] = InitAnalogGlobalID(magic, unitId, true, true, section)
 	}
+	return df.writer.WriteRtAnalogList(magic, unitId, list)
+}
 
-	// 调用 C 函数，传递结构体指针数组
-	C.dy_write_rt_digital_list(df.handle, C.int32_t(magic), C.int64_t(unitId), &timeList[0], &digitalArrayList[0], &countList[0], C.int64_t(len(sections)))
-
-	// 释放 C 分配的内存
-	for i := range digitalArrayList {
-		if digitalArrayList[i] != nil {
-			C.free(unsafe.Pointer(digitalArrayList[i]))
-		}
+func (df *WritePlugin) SyncWriteRtDigitalList(magic int32, unitId int64, sections []DigitalSection) error {
+	list := make([]DigitalSection, len(sections))
+	for i := 0; i < len(sections); i++ {
+		list[i] = InitDigitalGlobalID(magic, unitId, true, true, sections[i])
 	}
+	return df.writer.WriteRtDigitalList(magic, unitId, list)
 }
 
-func (df *WritePlugin) SyncWriteHisAnalog(magic int32, unitId int64, section AnalogSection, randomAv bool) {
+func (df *WritePlugin) SyncWriteHisAnalog(magic int32, unitId int64, section AnalogSection, randomAv bool, ack *AckGroup) error {
 	if randomAv {
 		section = RandAnalogSection(section)
 	}
 	section = InitAnalogGlobalID(magic, unitId, false, false, section)
-	C.dy_write_his_analog(df.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Analog)(&section.Data[0]), C.int64_t(len(section.Data)))
+	if ack != nil {
+		requestId := GlobalAcks.Submit(ack, len(section.Data))
+		err := df.async.WriteHisAnalogAsync(magic, unitId, section, requestId)
+		if err != nil {
+			GlobalAcks.Cancel(requestId)
+		}
+		return err
+	}
+	return df.writer.WriteHisAnalog(magic, unitId, section)
 }
 
-func (df *WritePlugin) SyncWriteHisDigital(magic int32, unitId int64, section DigitalSection) {
+func (df *WritePlugin) SyncWriteHisDigital(magic int32, unitId int64, section DigitalSection, ack *AckGroup) error {
 	section = InitDigitalGlobalID(magic, unitId, false, false, section)
-	C.dy_write_his_digital(df.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Digital)(&section.Data[0]), C.int64_t(len(section.Data)))
+	if ack != nil {
+		requestId := GlobalAcks.Submit(ack, len(section.Data))
+		err := df.async.WriteHisDigitalAsync(magic, unitId, section, requestId)
+		if err != nil {
+			GlobalAcks.Cancel(requestId)
+		}
+		return err
+	}
+	return df.writer.WriteHisDigital(magic, unitId, section)
 }
 
-func (df *WritePlugin) SyncWriteStaticAnalog(magic int32, unitId int64, section StaticAnalogSection, typ int64) {
+func (df *WritePlugin) SyncWriteStaticAnalog(magic int32, unitId int64, section StaticAnalogSection, typ int64) error {
 	if typ == 0 {
 		section = InitStaticAnalogGlobalID(magic, unitId, true, true, section)
 	} else if typ == 1 {
@@ -1772,10 +3166,10 @@ func (df *WritePlugin) SyncWriteStaticAnalog(magic int32, unitId int64, section
 	} else {
 		panic("未知type: 0代表实时快采集点, 1代表实时普通点, 2代表历史普通点")
 	}
-	C.dy_write_static_analog(df.handle, C.int32_t(magic), C.int64_t(unitId), (*C.StaticAnalog)(&section.Data[0]), C.int64_t(len(section.Data)), C.int64_t(typ))
+	return df.writer.WriteStaticAnalog(magic, unitId, section, typ)
 }
 
-func (df *WritePlugin) SyncWriteStaticDigital(magic int32, unitId int64, section StaticDigitalSection, typ int64) {
+func (df *WritePlugin) SyncWriteStaticDigital(magic int32, unitId int64, section StaticDigitalSection, typ int64) error {
 	if typ == 0 {
 		section = InitStaticDigitalGlobalID(magic, unitId, true, true, section)
 	} else if typ == 1 {
@@ -1785,67 +3179,486 @@ func (df *WritePlugin) SyncWriteStaticDigital(magic int32, unitId int64, section
 	} else {
 		panic("未知type: 0代表实时快采集点, 1代表实时普通点, 2代表历史普通点")
 	}
-	C.dy_write_static_digital(df.handle, C.int32_t(magic), C.int64_t(unitId), (*C.StaticDigital)(&section.Data[0]), C.int64_t(len(section.Data)), C.int64_t(typ))
+	return df.writer.WriteStaticDigital(magic, unitId, section, typ)
+}
+
+// Reader 后端不支持读取数据时返回错误
+func (df *WritePlugin) Reader() (Reader, error) {
+	reader, ok := df.writer.(Reader)
+	if !ok {
+		return nil, fmt.Errorf("插件不支持: %v", CapNames(PluginCapRead))
+	}
+	return reader, nil
+}
+
+// ReadRtAnalog 读实时模拟量快照, 返回值按pNumList的顺序排列, 没有值的点时间戳为-1
+func (df *WritePlugin) ReadRtAnalog(magic int32, unitId int64, pNumList []int32, isFast bool) ([]int64, []C.Analog, error) {
+	reader, err := df.Reader()
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader.ReadRtAnalog(magic, unitId, pNumList, isFast)
+}
+
+// ReadRtDigital 读实时数字量快照, 返回值按pNumList的顺序排列, 没有值的点时间戳为-1
+func (df *WritePlugin) ReadRtDigital(magic int32, unitId int64, pNumList []int32, isFast bool) ([]int64, []C.Digital, error) {
+	reader, err := df.Reader()
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader.ReadRtDigital(magic, unitId, pNumList, isFast)
+}
+
+// ReadHisAnalog 读历史模拟量, 每读取到一个值调用一次fn
+func (df *WritePlugin) ReadHisAnalog(magic int32, unitId int64, pNum int32, start int64, end int64, fn func(int64, C.Analog)) error {
+	reader, err := df.Reader()
+	if err != nil {
+		return err
+	}
+	return reader.ReadHisAnalog(magic, unitId, pNum, start, end, fn)
+}
+
+// ReadHisDigital 读历史数字量, 每读取到一个值调用一次fn
+func (df *WritePlugin) ReadHisDigital(magic int32, unitId int64, pNum int32, start int64, end int64, fn func(int64, C.Digital)) error {
+	reader, err := df.Reader()
+	if err != nil {
+		return err
+	}
+	return reader.ReadHisDigital(magic, unitId, pNum, start, end, fn)
 }
 
-func (df *WritePlugin) AsyncWriteRtAnalog(wg *sync.WaitGroup, magic int32, unitId int64, section AnalogSection, isFast bool, randomAv bool) {
+func (df *WritePlugin) AsyncWriteRtAnalog(wg *sync.WaitGroup, status *WriteStatus, magic int32, unitId int64, section AnalogSection, isFast bool, randomAv bool) {
 	defer wg.Done()
-	df.SyncWriteRtAnalog(magic, unitId, section, isFast, randomAv)
+	status.Record(df.SyncWriteRtAnalog(magic, unitId, section, isFast, randomAv, status.Ack), len(section.Data))
 }
 
-func (df *WritePlugin) AsyncWriteRtDigital(wg *sync.WaitGroup, magic int32, unitId int64, section DigitalSection, isFast bool) {
+func (df *WritePlugin) AsyncWriteRtDigital(wg *sync.WaitGroup, status *WriteStatus, magic int32, unitId int64, section DigitalSection, isFast bool) {
 	defer wg.Done()
-	df.SyncWriteRtDigital(magic, unitId, section, isFast)
+	status.Record(df.SyncWriteRtDigital(magic, unitId, section, isFast, status.Ack), len(section.Data))
 }
 
-func (df *WritePlugin) AsyncWriteRtAnalogList(wg *sync.WaitGroup, magic int32, unitId int64, sections []AnalogSection, randomAv bool) {
+func (df *WritePlugin) AsyncWriteRtAnalogList(wg *sync.WaitGroup, status *WriteStatus, magic int32, unitId int64, sections []AnalogSection, randomAv bool) {
 	defer wg.Done()
-	df.SyncWriteRtAnalogList(magic, unitId, sections, randomAv)
+	status.Record(df.SyncWriteRtAnalogList(magic, unitId, sections, randomAv), AnalogSectionsPNumCount(sections))
 }
 
-func (df *WritePlugin) AsyncWriteRtDigitalList(wg *sync.WaitGroup, magic int32, unitId int64, sections []DigitalSection) {
+func (df *WritePlugin) AsyncWriteRtDigitalList(wg *sync.WaitGroup, status *WriteStatus, magic int32, unitId int64, sections []DigitalSection) {
 	defer wg.Done()
-	df.SyncWriteRtDigitalList(magic, unitId, sections)
+	status.Record(df.SyncWriteRtDigitalList(magic, unitId, sections), DigitalSectionsPNumCount(sections))
 }
 
-func (df *WritePlugin) AsyncWriteHisAnalog(wg *sync.WaitGroup, magic int32, unitId int64, section AnalogSection, randomAv bool) {
+func (df *WritePlugin) AsyncWriteHisAnalog(wg *sync.WaitGroup, status *WriteStatus, magic int32, unitId int64, section AnalogSection, randomAv bool) {
 	defer wg.Done()
-	df.SyncWriteHisAnalog(magic, unitId, section, randomAv)
+	status.Record(df.SyncWriteHisAnalog(magic, unitId, section, randomAv, status.Ack), len(section.Data))
 }
 
-func (df *WritePlugin) AsyncWriteHisDigital(wg *sync.WaitGroup, magic int32, unitId int64, section DigitalSection) {
+func (df *WritePlugin) AsyncWriteHisDigital(wg *sync.WaitGroup, status *WriteStatus, magic int32, unitId int64, section DigitalSection) {
 	defer wg.Done()
-	df.SyncWriteHisDigital(magic, unitId, section)
+	status.Record(df.SyncWriteHisDigital(magic, unitId, section, status.Ack), len(section.Data))
 }
 
-func (df *WritePlugin) AsyncWriteStaticAnalog(wg *sync.WaitGroup, magic int32, unitId int64, section StaticAnalogSection, typ int64) {
+func (df *WritePlugin) AsyncWriteStaticAnalog(wg *sync.WaitGroup, status *WriteStatus, magic int32, unitId int64, section StaticAnalogSection, typ int64) {
 	defer wg.Done()
-	df.SyncWriteStaticAnalog(magic, unitId, section, typ)
+	status.Record(df.SyncWriteStaticAnalog(magic, unitId, section, typ), len(section.Data))
 }
 
-func (df *WritePlugin) AsyncWriteStaticDigital(wg *sync.WaitGroup, magic int32, unitId int64, section StaticDigitalSection, typ int64) {
+func (df *WritePlugin) AsyncWriteStaticDigital(wg *sync.WaitGroup, status *WriteStatus, magic int32, unitId int64, section StaticDigitalSection, typ int64) {
 	defer wg.Done()
-	df.SyncWriteStaticDigital(magic, unitId, section, typ)
+	status.Record(df.SyncWriteStaticDigital(magic, unitId, section, typ), len(section.Data))
 }
 
-var GlobalPlugin *WritePlugin = nil
+func (dw *DylibWriter) Info() PluginInfo {
+	return dw.info
+}
 
-func InitGlobalPlugin(path string) {
-	GlobalPlugin = NewWritePlugin(path)
+func (dw *DylibWriter) Login(param string) int {
+	if param == "" {
+		return int(C.dy_login(dw.handle, nil))
+	} else {
+		cParam := C.CString(param)
+		defer C.free(unsafe.Pointer(cParam))
+		return int(C.dy_login(dw.handle, cParam))
+	}
 }
 
-// CrFilterReader 是一个自定义的 io.Reader，用于去除数据流中的 \r 字符
-type CrFilterReader struct {
-	reader *bufio.Reader
+func (dw *DylibWriter) Logout() {
+	C.dy_logout(dw.handle)
 }
 
-// NewCRFilterReader 返回一个包装了 bufio.Reader 的 crFilterReader
-func NewCRFilterReader(r *bufio.Reader) *CrFilterReader {
-	return &CrFilterReader{reader: r}
+// Flush 刷新插件缓存, 插件未导出flush时直接返回nil
+func (dw *DylibWriter) Flush() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	rtn := C.dy_flush(dw.handle)
+	if rtn == 0 {
+		return nil
+	}
+	buf := make([]byte, 256)
+	if C.dy_last_error(dw.handle, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf))) == 0 {
+		return fmt.Errorf("flush failed, status: %v", int(rtn))
+	}
+	return fmt.Errorf("flush failed, status: %v, error: %v", int(rtn), C.GoString((*C.char)(unsafe.Pointer(&buf[0]))))
 }
 
-// Read 实现了 io.Reader 接口，替换数据流中的 '\r' 为 '\n'
-// 备注: 因解析CSV文件时, 发现文件格式不标准, 有的CSV文件是以 "\r\r" 作为分隔符的, 所以统一替换成 '\n'
+// CheckStatus 将插件写入函数的返回值转换为error, 返回值非0时通过last_error获取错误信息
+// 多个机组的写入并发调用插件, 插件按线程保存last_error, 调用方需要通过runtime.LockOSThread在调用插件函数的同一个线程上调用CheckStatus
+func (dw *DylibWriter) CheckStatus(name string, unitId int64, time int64, rtn C.int) error {
+	if rtn == 0 {
+		return nil
+	}
+	buf := make([]byte, 256)
+	if C.dy_last_error(dw.handle, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf))) == 0 {
+		return fmt.Errorf("%v failed, unit_id: %v, time: %v, status: %v", name, unitId, time, int(rtn))
+	}
+	return fmt.Errorf("%v failed, unit_id: %v, time: %v, status: %v, error: %v", name, unitId, time, int(rtn), C.GoString((*C.char)(unsafe.Pointer(&buf[0]))))
+}
+
+func (dw *DylibWriter) WriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	rtn := C.dy_write_rt_analog(dw.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Analog)(&section.Data[0]), C.int64_t(len(section.Data)), C.bool(isFast))
+	return dw.CheckStatus("write_rt_analog", unitId, section.Time, rtn)
+}
+
+func (dw *DylibWriter) WriteRtDigital(magic int32, unitId int64, section DigitalSection, isFast bool) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	rtn := C.dy_write_rt_digital(dw.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Digital)(&section.Data[0]), C.int64_t(len(section.Data)), C.bool(isFast))
+	return dw.CheckStatus("write_rt_digital", unitId, section.Time, rtn)
+}
+
+func (dw *DylibWriter) WriteRtAnalogList(magic int32, unitId int64, sections []AnalogSection) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	// 初始化 C 数组
+	timeList := make([]C.int64_t, 0)
+	analogArrayList := make([]*C.Analog, 0)
+	countList := make([]C.int64_t, 0)
+
+	for i := range sections {
+		timeList = append(timeList, C.int64_t(sections[i].Time))
+
+		// 分配 C 内存并将 Go 数据复制到 C 内存中
+		analogData := C.malloc(C.size_t(len(sections[i].Data)) * C.size_t(unsafe.Sizeof(C.Analog{})))
+		if analogData == nil {
+			panic("C.malloc failed")
+		}
+		for j := range sections[i].Data {
+			(*[1 << 30]C.Analog)(analogData)[j] = C.Analog(sections[i].Data[j])
+		}
+		analogArrayList = append(analogArrayList, (*C.Analog)(analogData))
+		countList = append(countList, C.int64_t(len(sections[i].Data)))
+	}
+
+	// 调用 C 函数，传递结构体指针数组
+	rtn := C.dy_write_rt_analog_list(dw.handle, C.int32_t(magic), C.int64_t(unitId), &timeList[0], &analogArrayList[0], &countList[0], C.int64_t(len(sections)))
+
+	// 释放 C 分配的内存
+	for i := range analogArrayList {
+		if analogArrayList[i] != nil {
+			C.free(unsafe.Pointer(analogArrayList[i]))
+		}
+	}
+
+	return dw.CheckStatus("write_rt_analog_list", unitId, sections[0].Time, rtn)
+}
+
+func (dw *DylibWriter) WriteRtDigitalList(magic int32, unitId int64, sections []DigitalSection) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	// 初始化 C 数组
+	timeList := make([]C.int64_t, 0)
+	digitalArrayList := make([]*C.Digital, 0)
+	countList := make([]C.int64_t, 0)
+
+	for i := range sections {
+		timeList = append(timeList, C.int64_t(sections[i].Time))
+
+		// 分配 C 内存并将 Go 数据复制到 C 内存中
+		digitalData := C.malloc(C.size_t(len(sections[i].Data)) * C.size_t(unsafe.Sizeof(C.Digital{})))
+		if digitalData == nil {
+			panic("C.malloc failed")
+		}
+		for j := range sections[i].Data {
+			(*[1 << 30]C.Digital)(digitalData)[j] = C.Digital(sections[i].Data[j])
+		}
+		digitalArrayList = append(digitalArrayList, (*C.Digital)(digitalData))
+		countList = append(countList, C.int64_t(len(sections[i].Data)))
+	}
+
+	// 调用 C 函数，传递结构体指针数组
+	rtn := C.dy_write_rt_digital_list(dw.handle, C.int32_t(magic), C.int64_t(unitId), &timeList[0], &digitalArrayList[0], &countList[0], C.int64_t(len(sections)))
+
+	// 释放 C 分配的内存
+	for i := range digitalArrayList {
+		if digitalArrayList[i] != nil {
+			C.free(unsafe.Pointer(digitalArrayList[i]))
+		}
+	}
+
+	return dw.CheckStatus("write_rt_digital_list", unitId, sections[0].Time, rtn)
+}
+
+func (dw *DylibWriter) WriteHisAnalog(magic int32, unitId int64, section AnalogSection) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	rtn := C.dy_write_his_analog(dw.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Analog)(&section.Data[0]), C.int64_t(len(section.Data)))
+	return dw.CheckStatus("write_his_analog", unitId, section.Time, rtn)
+}
+
+func (dw *DylibWriter) WriteHisDigital(magic int32, unitId int64, section DigitalSection) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	rtn := C.dy_write_his_digital(dw.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Digital)(&section.Data[0]), C.int64_t(len(section.Data)))
+	return dw.CheckStatus("write_his_digital", unitId, section.Time, rtn)
+}
+
+func (dw *DylibWriter) WriteStaticAnalog(magic int32, unitId int64, section StaticAnalogSection, typ int64) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	rtn := C.dy_write_static_analog(dw.handle, C.int32_t(magic), C.int64_t(unitId), (*C.StaticAnalog)(&section.Data[0]), C.int64_t(len(section.Data)), C.int64_t(typ))
+	return dw.CheckStatus("write_static_analog", unitId, -1, rtn)
+}
+
+func (dw *DylibWriter) WriteStaticDigital(magic int32, unitId int64, section StaticDigitalSection, typ int64) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	rtn := C.dy_write_static_digital(dw.handle, C.int32_t(magic), C.int64_t(unitId), (*C.StaticDigital)(&section.Data[0]), C.int64_t(len(section.Data)), C.int64_t(typ))
+	return dw.CheckStatus("write_static_digital", unitId, -1, rtn)
+}
+
+func (dw *DylibWriter) WriteRtAnalogAsync(magic int32, unitId int64, section AnalogSection, isFast bool, requestId int64) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	rtn := C.dy_write_rt_analog_async(dw.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Analog)(&section.Data[0]), C.int64_t(len(section.Data)), C.bool(isFast), C.int64_t(requestId), 0)
+	return dw.CheckStatus("write_rt_analog_async", unitId, section.Time, rtn)
+}
+
+func (dw *DylibWriter) WriteRtDigitalAsync(magic int32, unitId int64, section DigitalSection, isFast bool, requestId int64) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	rtn := C.dy_write_rt_digital_async(dw.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Digital)(&section.Data[0]), C.int64_t(len(section.Data)), C.bool(isFast), C.int64_t(requestId), 0)
+	return dw.CheckStatus("write_rt_digital_async", unitId, section.Time, rtn)
+}
+
+func (dw *DylibWriter) WriteHisAnalogAsync(magic int32, unitId int64, section AnalogSection, requestId int64) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	rtn := C.dy_write_his_analog_async(dw.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Analog)(&section.Data[0]), C.int64_t(len(section.Data)), C.int64_t(requestId), 0)
+	return dw.CheckStatus("write_his_analog_async", unitId, section.Time, rtn)
+}
+
+func (dw *DylibWriter) WriteHisDigitalAsync(magic int32, unitId int64, section DigitalSection, requestId int64) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	rtn := C.dy_write_his_digital_async(dw.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Digital)(&section.Data[0]), C.int64_t(len(section.Data)), C.int64_t(requestId), 0)
+	return dw.CheckStatus("write_his_digital_async", unitId, section.Time, rtn)
+}
+
+// ReadRtAnalog 读实时模拟量快照, 返回值按pNumList的顺序排列, 没有值的点时间戳为-1
+func (dw *DylibWriter) ReadRtAnalog(magic int32, unitId int64, pNumList []int32, isFast bool) ([]int64, []C.Analog, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if len(pNumList) == 0 {
+		return nil, nil, nil
+	}
+	pNumArray := make([]C.int32_t, len(pNumList))
+	timeList := make([]C.int64_t, len(pNumList))
+	for i, pNum := range pNumList {
+		pNumArray[i] = C.int32_t(pNum)
+		timeList[i] = -1
+	}
+	dataList := make([]C.Analog, len(pNumList))
+	rtn := C.dy_read_rt_analog(dw.handle, C.int32_t(magic), C.int64_t(unitId), &pNumArray[0], C.int64_t(len(pNumArray)), C.bool(isFast), &timeList[0], &dataList[0])
+	if err := dw.CheckStatus("read_rt_analog", unitId, -1, rtn); err != nil {
+		return nil, nil, err
+	}
+	tsList := make([]int64, len(timeList))
+	for i, ts := range timeList {
+		tsList[i] = int64(ts)
+	}
+	return tsList, dataList, nil
+}
+
+// ReadRtDigital 读实时数字量快照, 返回值按pNumList的顺序排列, 没有值的点时间戳为-1
+func (dw *DylibWriter) ReadRtDigital(magic int32, unitId int64, pNumList []int32, isFast bool) ([]int64, []C.Digital, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if len(pNumList) == 0 {
+		return nil, nil, nil
+	}
+	pNumArray := make([]C.int32_t, len(pNumList))
+	timeList := make([]C.int64_t, len(pNumList))
+	for i, pNum := range pNumList {
+		pNumArray[i] = C.int32_t(pNum)
+		timeList[i] = -1
+	}
+	dataList := make([]C.Digital, len(pNumList))
+	rtn := C.dy_read_rt_digital(dw.handle, C.int32_t(magic), C.int64_t(unitId), &pNumArray[0], C.int64_t(len(pNumArray)), C.bool(isFast), &timeList[0], &dataList[0])
+	if err := dw.CheckStatus("read_rt_digital", unitId, -1, rtn); err != nil {
+		return nil, nil, err
+	}
+	tsList := make([]int64, len(timeList))
+	for i, ts := range timeList {
+		tsList[i] = int64(ts)
+	}
+	return tsList, dataList, nil
+}
+
+// ReadHisAnalog 读历史模拟量, 插件每读取到一个值调用一次fn
+func (dw *DylibWriter) ReadHisAnalog(magic int32, unitId int64, pNum int32, start int64, end int64, fn func(int64, C.Analog)) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	ctx := cgo.NewHandle(fn)
+	defer ctx.Delete()
+	rtn := C.dy_read_his_analog(dw.handle, C.int32_t(magic), C.int64_t(unitId), C.int32_t(pNum), C.int64_t(start), C.int64_t(end), C.uintptr_t(ctx))
+	return dw.CheckStatus("read_his_analog", unitId, start, rtn)
+}
+
+// ReadHisDigital 读历史数字量, 插件每读取到一个值调用一次fn
+func (dw *DylibWriter) ReadHisDigital(magic int32, unitId int64, pNum int32, start int64, end int64, fn func(int64, C.Digital)) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	ctx := cgo.NewHandle(fn)
+	defer ctx.Delete()
+	rtn := C.dy_read_his_digital(dw.handle, C.int32_t(magic), C.int64_t(unitId), C.int32_t(pNum), C.int64_t(start), C.int64_t(end), C.uintptr_t(ctx))
+	return dw.CheckStatus("read_his_digital", unitId, start, rtn)
+}
+
+// NopWriteRtAnalog 与 WritePlugin.SyncWriteRtAnalog 的调用路径相同(GlobalID初始化, cgo调用, 函数表分发), 但不调用插件
+// 用于测量写数程序调用插件的额外开销
+func (dw *DylibWriter) NopWriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	section = InitAnalogGlobalID(magic, unitId, isFast, true, section)
+	rtn := C.dy_nop_write_rt_analog(dw.handle, C.int32_t(magic), C.int64_t(unitId), C.int64_t(section.Time), (*C.Analog)(&section.Data[0]), C.int64_t(len(section.Data)), C.bool(isFast))
+	return dw.CheckStatus("nop_write_rt_analog", unitId, section.Time, rtn)
+}
+
+// NopCall 只进行cgo调用和函数表分发, 不做任何数据处理
+func (dw *DylibWriter) NopCall(section AnalogSection) {
+	C.dy_nop_write_rt_analog(dw.handle, 0, 0, C.int64_t(section.Time), (*C.Analog)(&section.Data[0]), C.int64_t(len(section.Data)), false)
+}
+
+// LookupCall 按函数名查找一次写入函数, 旧版本每次调用插件都会执行一次查找
+func (dw *DylibWriter) LookupCall() {
+	C.dy_lookup_write_rt_analog(dw.handle)
+}
+
+// BenchCalls 调用count次fn, 输出平均耗时, 最长耗时, P99耗时, 中位数耗时
+// 平均耗时由总耗时计算, 不包含单次计时本身的开销
+func BenchCalls(name string, count int, fn func()) {
+	durationList := make([]float64, count)
+	for i := 0; i < count; i++ {
+		t := time.Now()
+		fn()
+		durationList[i] = float64(time.Since(t))
+	}
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		fn()
+	}
+	dAvg := time.Since(start) / time.Duration(count)
+
+	sort.Float64s(durationList)
+	dMax := time.Duration(stat.Quantile(1.00, stat.Empirical, durationList, nil))
+	dP99 := time.Duration(stat.Quantile(0.99, stat.Empirical, durationList, nil))
+	dP50 := time.Duration(stat.Quantile(0.50, stat.Empirical, durationList, nil))
+	log.Printf("%v - 平均耗时: %v, 最长耗时: %v, P99耗时: %v, 中位数耗时: %v\n", name, dAvg, dMax, dP99, dP50)
+}
+
+// HarnessBench 测量写数程序每次调用插件的额外开销, 不会调用插件的写入函数
+func HarnessBench(magic int32, unitNumber int64, pNumCount int, count int) {
+	section := AnalogSection{Time: 0, Data: make([]C.Analog, pNumCount)}
+	for i := range section.Data {
+		section.Data[i].p_num = C.int32_t(i)
+	}
+
+	nop, ok := GlobalPlugin.Writer().(NopWriter)
+	if !ok {
+		log.Println("插件后端不支持写数程序开销测试")
+		return
+	}
+
+	log.Printf("MAGIC: %v, 写数程序开销测试 - 机组数量: %v, 断面PNUM数量: %v, 调用次数: %v\n", magic, unitNumber, pNumCount, count)
+	// 函数查找和cgo调用只有动态库插件才有
+	if dylib, ok := nop.(*DylibWriter); ok {
+		BenchCalls("函数查找(dlsym, 已改为加载时完成)", count, func() {
+			dylib.LookupCall()
+		})
+		BenchCalls("cgo调用+函数表分发", count, func() {
+			dylib.NopCall(section)
+		})
+	}
+	BenchCalls("GlobalID初始化", count, func() {
+		InitAnalogGlobalID(magic, 0, true, true, section)
+	})
+	BenchCalls("完整调用路径(含机组并发, 不含插件)", count, func() {
+		if unitNumber == 1 {
+			_ = nop.NopWriteRtAnalog(magic, 0, section, true)
+			return
+		}
+		wg := new(sync.WaitGroup)
+		wg.Add(int(unitNumber))
+		for i := int64(0); i < unitNumber; i++ {
+			go func(unitId int64) {
+				defer wg.Done()
+				_ = nop.NopWriteRtAnalog(magic, unitId, section, true)
+			}(i)
+		}
+		wg.Wait()
+	})
+}
+
+var GlobalPlugin *WritePlugin = nil
+
+// InitGlobalPlugin 加载插件, 并且校验插件是否支持命令需要的能力
+// isolate 为true时在独立的插件进程中加载插件, 见 HostWriter; 路径以 builtin: 开头时使用内置插件, 见 BuiltinWriter
+func InitGlobalPlugin(path string, isolate bool, caps uint64) error {
+	var writer Writer
+	if IsBuiltinPlugin(path) {
+		if isolate {
+			return errors.New("内置插件不支持--isolate")
+		}
+		builtin, err := NewBuiltinWriter(path)
+		if err != nil {
+			return err
+		}
+		writer = builtin
+	} else if isolate {
+		host, err := NewHostWriter(path)
+		if err != nil {
+			return err
+		}
+		writer = host
+	} else {
+		dylib, err := NewDylibWriter(path)
+		if err != nil {
+			return err
+		}
+		writer = dylib
+	}
+	plugin := NewWritePlugin(writer)
+	log.Println("插件信息: ", plugin.Info())
+	if err := plugin.Require(caps); err != nil {
+		return err
+	}
+	GlobalPlugin = plugin
+	return nil
+}
+
+// CrFilterReader 是一个自定义的 io.Reader，用于去除数据流中的 \r 字符
+type CrFilterReader struct {
+	reader *bufio.Reader
+}
+
+// NewCRFilterReader 返回一个包装了 bufio.Reader 的 crFilterReader
+func NewCRFilterReader(r *bufio.Reader) *CrFilterReader {
+	return &CrFilterReader{reader: r}
+}
+
+// Read 实现了 io.Reader 接口，替换数据流中的 '\r' 为 '\n'
+// 备注: 因解析CSV文件时, 发现文件格式不标准, 有的CSV文件是以 "\r\r" 作为分隔符的, 所以统一替换成 '\n'
 func (r *CrFilterReader) Read(p []byte) (int, error) {
 	n, err := r.reader.Read(p)
 	if err != nil {
@@ -1880,6 +3693,8 @@ var versionCmd = &cobra.Command{
 var staticWrite = &cobra.Command{
 	Use:   "static_write",
 	Short: "Write STATIC_ANALOG.csv, STATIC_DIGITAL.csv",
+	Long: "Write STATIC_ANALOG.csv, STATIC_DIGITAL.csv\n\n" +
+		"静态数据没有断面时间, 整个文件作为一次写入, 不支持有界写入(--duration, --max_sections, --start_time, --end_time)、--time_base 和循环回放",
 	Run: func(cmd *cobra.Command, args []string) {
 		pluginPath, _ := cmd.Flags().GetString("plugin")
 		staticAnalogCsvPath, _ := cmd.Flags().GetString("static_analog")
@@ -1887,26 +3702,58 @@ var staticWrite = &cobra.Command{
 		unitNumber, _ := cmd.Flags().GetInt64("unit_number")
 		typ, _ := cmd.Flags().GetInt64("type")
 		param, _ := cmd.Flags().GetString("param")
+		isolate, _ := cmd.Flags().GetBool("isolate")
+		recordPath, _ := cmd.Flags().GetString("record")
+		strict, _ := cmd.Flags().GetBool("strict")
+		columnMapPath, _ := cmd.Flags().GetString("column_map")
 		magic, _ := cmd.Flags().GetInt32("magic")
 
+		// 加载列名映射文件
+		if err := LoadColumnMapping(columnMapPath); err != nil {
+			log.Println("加载列名映射文件失败: ", err)
+			return
+		}
+
+		// 写入前校验输入文件, 有问题时不写入
+		if strict && !ValidateInputs(ValidateInput{staticAnalogCsvPath, DatasetStaticAnalog}, ValidateInput{staticDigitalCsvPath, DatasetStaticDigital}) {
+			log.Println("输入文件校验失败, --strict 模式下不写入")
+			os.Exit(1)
+		}
+
 		// 加载动态库
-		InitGlobalPlugin(pluginPath)
+		if err := InitGlobalPlugin(pluginPath, isolate, PluginCapStatic); err != nil {
+			log.Println("加载插件失败: ", err)
+			os.Exit(1)
+		}
+		if err := RecordGlobalPlugin(recordPath); err != nil {
+			log.Println("创建录制文件失败: ", err)
+			GlobalPlugin.Close()
+			os.Exit(1)
+		}
 
-		// 登入
+		// 登入, 登入失败时关闭录制文件和插件进程后退出
 		if rtn := GlobalPlugin.Login(param); rtn != 0 {
 			log.Println("登陆失败: ", rtn)
-			return
+			GlobalPlugin.Close()
+			os.Exit(1)
 		}
 		start := time.Now()
 
 		// 输出统计值
 		defer func() {
+			// 写入阶段结束, 刷新插件缓存
+			GlobalFlush.Flush()
+			flushDuration := GlobalFlush.Duration()
+			WaitAcks()
+
 			logoutStart := time.Now()
 			GlobalPlugin.Logout()
 			logoutDuration := time.Since(logoutStart)
 
 			log.Println("logout time: ", logoutDuration)
-			StaticSummary(magic, "静态写入", start, time.Now(), FastAnalogWriteSectionInfoList, FastDigitalWriteSectionInfoList, logoutDuration)
+			GlobalFlush.Print()
+			GlobalDecompress.Print()
+			StaticSummary(magic, "静态写入", start, time.Now(), GlobalFastStats, flushDuration, logoutDuration)
 		}()
 
 		// 静态写入
@@ -1914,202 +3761,451 @@ var staticWrite = &cobra.Command{
 	},
 }
 
+var rtFastWriteOpts = &WriteOptions{}
+
 var rtFastWrite = &cobra.Command{
 	Use:   "rt_fast_write",
 	Short: "Fast Write REALTIME_FAST_ANALOG.csv, REALTIME_FAST_DIGITAL.csv, REALTIME_NORMAL_ANALOG.csv, REALTIME_NORMAL_DIGITAL.csv",
 	Run: func(cmd *cobra.Command, args []string) {
-		pluginPath, _ := cmd.Flags().GetString("plugin")
-		fastAnalogCsvPath, _ := cmd.Flags().GetString("rt_fast_analog")
-		fastDigitalCsvPath, _ := cmd.Flags().GetString("rt_fast_digital")
-		normalAnalogCsvPath, _ := cmd.Flags().GetString("rt_normal_analog")
-		normalDigitalCsvPath, _ := cmd.Flags().GetString("rt_normal_digital")
-		unitNumber, _ := cmd.Flags().GetInt64("unit_number")
-		randomAv, _ := cmd.Flags().GetBool("random_av")
-		param, _ := cmd.Flags().GetString("param")
-		mode, _ := cmd.Flags().GetInt64("mode")
-		magic, _ := cmd.Flags().GetInt32("magic")
+		o := rtFastWriteOpts
 		parallelWriting, _ := cmd.Flags().GetBool("parallel_writing")
 
-		// 加载动态库
-		InitGlobalPlugin(pluginPath)
-
-		// 登入
-		if rtn := GlobalPlugin.Login(param); rtn != 0 {
-			log.Println("登陆失败: ", rtn)
-			return
-		}
-		start := time.Now()
-		defer func() {
-			logoutStart := time.Now()
-			GlobalPlugin.Logout()
-			logoutDuration := time.Since(logoutStart)
-			log.Println("logout time: ", logoutDuration)
-			if mode == 0 {
+		RunWrite(o, PluginCapRealtime, func() {
+			// 极速写入实时值
+			switch o.Mode {
+			case 0:
+				// 写快采 + 普通
 				if parallelWriting {
-					ParallelRtFastWriteSummary(magic, "极速写入实时值(快采点,普通点并行)", start, time.Now(), FastAnalogWriteSectionInfoList, FastDigitalWriteSectionInfoList, NormalAnalogWriteSectionInfoList, NormalDigitalWriteSectionInfoList, logoutDuration)
+					ParallelFastWriteRt(o.Magic, o.UnitNumber, o.FastAnalog, o.FastDigital, o.NormalAnalog, o.NormalDigital, o.RandomAv)
 				} else {
-					RtFastWriteSummary(magic, "极速写入实时值(快采点,普通点串行)", start, time.Now(), FastAnalogWriteSectionInfoList, FastDigitalWriteSectionInfoList, NormalAnalogWriteSectionInfoList, NormalDigitalWriteSectionInfoList, logoutDuration)
+					FastWriteRt(o.Magic, o.UnitNumber, o.FastAnalog, o.FastDigital, o.NormalAnalog, o.NormalDigital, o.RandomAv)
 				}
-			} else if mode == 1 {
-				RtFastWriteSummary(magic, "极速写入实时值(只写快采点)", start, time.Now(), FastAnalogWriteSectionInfoList, FastDigitalWriteSectionInfoList, NormalAnalogWriteSectionInfoList, NormalDigitalWriteSectionInfoList, logoutDuration)
-			} else if mode == 2 {
-				RtFastWriteSummary(magic, "极速写入实时值(只写普通点)", start, time.Now(), FastAnalogWriteSectionInfoList, FastDigitalWriteSectionInfoList, NormalAnalogWriteSectionInfoList, NormalDigitalWriteSectionInfoList, logoutDuration)
-			} else {
-				panic("mode must be 0 or 1 or 2")
+			case 1:
+				// 只写快采
+				FastWriteRtOnlyFast(o.Magic, o.UnitNumber, o.FastAnalog, o.FastDigital, o.RandomAv)
+			case 2:
+				// 只写普通
+				FastWriteRtOnlyNormal(o.Magic, o.UnitNumber, o.NormalAnalog, o.NormalDigital, o.RandomAv)
 			}
-		}()
-
-		// 极速写入实时值
-		if mode == 0 {
-			// 写快采 + 普通
-			if parallelWriting {
-				ParallelFastWriteRt(magic, unitNumber, fastAnalogCsvPath, fastDigitalCsvPath, normalAnalogCsvPath, normalDigitalCsvPath, randomAv)
-			} else {
-				FastWriteRt(magic, unitNumber, fastAnalogCsvPath, fastDigitalCsvPath, normalAnalogCsvPath, normalDigitalCsvPath, randomAv)
+		}, func(start time.Time, flushDuration time.Duration, logoutDuration time.Duration) {
+			switch {
+			case o.Mode == 0 && parallelWriting:
+				ParallelRtFastWriteSummary(o.Magic, "极速写入实时值(快采点,普通点并行)", start, time.Now(), GlobalFastStats, GlobalNormalStats, flushDuration, logoutDuration)
+			case o.Mode == 0:
+				RtFastWriteSummary(o.Magic, "极速写入实时值(快采点,普通点串行)", start, time.Now(), GlobalFastStats, GlobalNormalStats, flushDuration, logoutDuration)
+			case o.Mode == 1:
+				RtFastWriteSummary(o.Magic, "极速写入实时值(只写快采点)", start, time.Now(), GlobalFastStats, GlobalNormalStats, flushDuration, logoutDuration)
+			case o.Mode == 2:
+				RtFastWriteSummary(o.Magic, "极速写入实时值(只写普通点)", start, time.Now(), GlobalFastStats, GlobalNormalStats, flushDuration, logoutDuration)
 			}
-		} else if mode == 1 {
-			// 只写快采
-			FastWriteRtOnlyFast(magic, unitNumber, fastAnalogCsvPath, fastDigitalCsvPath, randomAv)
-		} else if mode == 2 {
-			// 只写普通
-			FastWriteRtOnlyNormal(magic, unitNumber, normalAnalogCsvPath, normalDigitalCsvPath, randomAv)
-		} else {
-			panic("mode must be 0 or 1 or 2")
-		}
+		})
 	},
 }
 
+var hisFastWriteOpts = &WriteOptions{}
+
 var hisFastWrite = &cobra.Command{
 	Use:   "his_fast_write",
 	Short: "Fast Write HISTORY_NORMAL_ANALOG.csv, HISTORY_NORMAL_DIGITAL.csv",
+	Run: func(cmd *cobra.Command, args []string) {
+		o := hisFastWriteOpts
+
+		RunWrite(o, PluginCapHistory, func() {
+			// 极速写入历史
+			FastWriteHis(o.Magic, o.UnitNumber, o.NormalAnalog, o.NormalDigital, o.RandomAv)
+		}, func(start time.Time, flushDuration time.Duration, logoutDuration time.Duration) {
+			HisFastWriteSummary(o.Magic, "极速写入历史值", start, time.Now(), GlobalNormalStats, flushDuration, logoutDuration)
+		})
+	},
+}
+
+var hisPeriodicWriteOpts = &WriteOptions{}
+var hisPeriodicOpts = &PeriodicOptions{}
+
+var hisPeriodicWrite = &cobra.Command{
+	Use:   "his_periodic_write",
+	Short: "Periodic Write HISTORY_NORMAL_ANALOG.csv, HISTORY_NORMAL_DIGITAL.csv",
+	Run: func(cmd *cobra.Command, args []string) {
+		o, po := hisPeriodicWriteOpts, hisPeriodicOpts
+		if !po.Setup(cmd, o, false) {
+			os.Exit(1)
+		}
+
+		RunWrite(o, PluginCapHistory, func() {
+			// 周期性写入
+			PeriodicWriteHis(o.Magic, o.UnitNumber, po.OverloadProtection, o.NormalAnalog, o.NormalDigital, o.RandomAv)
+		}, func(start time.Time, flushDuration time.Duration, logoutDuration time.Duration) {
+			PeriodicWriteHisSummary(o.Magic, "周期性写入历史值", start, time.Now(), GlobalNormalStats, flushDuration, logoutDuration)
+		})
+	},
+}
+
+var rtPeriodicWriteOpts = &WriteOptions{}
+var rtPeriodicOpts = &PeriodicOptions{}
+
+var rtPeriodicWrite = &cobra.Command{
+	Use:   "rt_periodic_write",
+	Short: "Periodic Write REALTIME_FAST_ANALOG.csv, REALTIME_FAST_DIGITAL.csv, REALTIME_NORMAL_ANALOG.csv, REALTIME_NORMAL_DIGITAL.csv",
+	Run: func(cmd *cobra.Command, args []string) {
+		o, po := rtPeriodicWriteOpts, rtPeriodicOpts
+		if !po.Setup(cmd, o, true) {
+			os.Exit(1)
+		}
+
+		// 快采点缓存需要插件支持批量写入
+		requiredCaps := PluginCapRealtime
+		if po.FastCache && o.Mode != 2 {
+			requiredCaps |= PluginCapListWrite
+		}
+
+		RunWrite(o, requiredCaps, func() {
+			// 周期性写入
+			switch o.Mode {
+			case 0:
+				PeriodicWriteRt(o.Magic, o.UnitNumber, po.OverloadProtection, o.FastAnalog, o.FastDigital, o.NormalAnalog, o.NormalDigital, po.FastCache, o.RandomAv)
+			case 1:
+				PeriodicWriteRtOnlyFast(o.Magic, o.UnitNumber, po.OverloadProtection, o.FastAnalog, o.FastDigital, po.FastCache, o.RandomAv)
+			case 2:
+				PeriodicWriteRtOnlyNormal(o.Magic, o.UnitNumber, po.OverloadProtection, o.NormalAnalog, o.NormalDigital, po.FastCache, o.RandomAv)
+			}
+		}, func(start time.Time, flushDuration time.Duration, logoutDuration time.Duration) {
+			overload, fastCache := "关闭", "关闭"
+			if po.OverloadProtection {
+				overload = "开启"
+			}
+			if po.FastCache {
+				fastCache = "开启"
+			}
+			name := fmt.Sprintf("周期性写入实时值(%v载保护, %v快采点缓存)", overload, fastCache)
+			PeriodicWriteRtSummary(o.Magic, name, start, time.Now(), GlobalFastStats, GlobalNormalStats, flushDuration, logoutDuration)
+		})
+	},
+}
+
+var readBack = &cobra.Command{
+	Use:   "read",
+	Short: "Read data back through the plugin and print it in the same CSV format as the input",
 	Run: func(cmd *cobra.Command, args []string) {
 		pluginPath, _ := cmd.Flags().GetString("plugin")
-		analogCsvPath, _ := cmd.Flags().GetString("his_normal_analog")
-		digitalCsvPath, _ := cmd.Flags().GetString("his_normal_digital")
-		unitNumber, _ := cmd.Flags().GetInt64("unit_number")
-		randomAv, _ := cmd.Flags().GetBool("random_av")
 		param, _ := cmd.Flags().GetString("param")
 		magic, _ := cmd.Flags().GetInt32("magic")
+		unitId, _ := cmd.Flags().GetInt64("unit_id")
+		typ, _ := cmd.Flags().GetInt64("type")
+		isDigital, _ := cmd.Flags().GetBool("digital")
+		pNum, _ := cmd.Flags().GetString("pnum")
+		start, _ := cmd.Flags().GetInt64("start")
+		end, _ := cmd.Flags().GetInt64("end")
+		output, _ := cmd.Flags().GetString("output")
+
+		pNumList, err := ParsePNumList(pNum)
+		if err != nil || len(pNumList) == 0 {
+			log.Println("pnum 格式错误: ", pNum)
+			return
+		}
 
 		// 加载动态库
-		InitGlobalPlugin(pluginPath)
+		if err := InitGlobalPlugin(pluginPath, false, PluginCapRead); err != nil {
+			log.Println("加载插件失败: ", err)
+			os.Exit(1)
+		}
 
 		// 登入
 		if rtn := GlobalPlugin.Login(param); rtn != 0 {
 			log.Println("登陆失败: ", rtn)
 			return
 		}
-		start := time.Now()
-		defer func() {
-			logoutStart := time.Now()
-			GlobalPlugin.Logout()
-			logoutDuration := time.Since(logoutStart)
-			log.Println("logout time: ", logoutDuration)
-			HisFastWriteSummary(magic, "极速写入历史值", start, time.Now(), NormalAnalogWriteSectionInfoList, NormalDigitalWriteSectionInfoList, logoutDuration)
-		}()
+		defer GlobalPlugin.Logout()
 
-		// 极速写入历史
-		FastWriteHis(magic, unitNumber, analogCsvPath, digitalCsvPath, randomAv)
+		if err := ReadBack(magic, unitId, typ, isDigital, pNumList, start, end, output); err != nil {
+			log.Println("读取失败: ", err)
+		}
 	},
 }
 
-var hisPeriodicWrite = &cobra.Command{
-	Use:   "his_periodic_write",
-	Short: "Periodic Write HISTORY_NORMAL_ANALOG.csv, HISTORY_NORMAL_DIGITAL.csv",
+var harnessBench = &cobra.Command{
+	Use:   "harness_bench",
+	Short: "Measure the per-call overhead of the writer itself, without calling plugin writes",
 	Run: func(cmd *cobra.Command, args []string) {
 		pluginPath, _ := cmd.Flags().GetString("plugin")
-		analogCsvPath, _ := cmd.Flags().GetString("his_normal_analog")
-		digitalCsvPath, _ := cmd.Flags().GetString("his_normal_digital")
-		randomAv, _ := cmd.Flags().GetBool("random_av")
+		isolate, _ := cmd.Flags().GetBool("isolate")
 		unitNumber, _ := cmd.Flags().GetInt64("unit_number")
-		param, _ := cmd.Flags().GetString("param")
+		pNumCount, _ := cmd.Flags().GetInt("pnum_count")
+		count, _ := cmd.Flags().GetInt("count")
 		magic, _ := cmd.Flags().GetInt32("magic")
 
+		// 加载插件, 只解析函数表, 不登陆数据库
+		if err := InitGlobalPlugin(pluginPath, isolate, PluginCapRealtime); err != nil {
+			log.Println("加载插件失败: ", err)
+			os.Exit(1)
+		}
+		if isolate {
+			defer GlobalPlugin.Writer().(*HostWriter).Close()
+		}
+		if pNumCount <= 0 || count <= 0 || unitNumber <= 0 {
+			log.Println("pnum_count, count, unit_number 必须大于0")
+			return
+		}
+
+		HarnessBench(magic, unitNumber, pNumCount, count)
+	},
+}
+
+var prepare = &cobra.Command{
+	Use:   "prepare",
+	Short: "Convert a CSV file to a memory-mappable binary dataset accepted by all write commands",
+	Run: func(cmd *cobra.Command, args []string) {
+		input, _ := cmd.Flags().GetString("input")
+		output, _ := cmd.Flags().GetString("output")
+		typ, _ := cmd.Flags().GetString("type")
+		columnMapPath, _ := cmd.Flags().GetString("column_map")
+
+		// 加载列名映射文件
+		if err := LoadColumnMapping(columnMapPath); err != nil {
+			log.Println("加载列名映射文件失败: ", err)
+			return
+		}
+
+		kind := uint32(0)
+		var err error
+		if typ == "" {
+			kind, err = DetectCsvKind(input)
+		} else {
+			kind, err = DatasetKindByName(typ)
+		}
+		if err != nil {
+			log.Println("数据集类型错误: ", err)
+			return
+		}
+		if err := PrepareDataset(input, output, kind); err != nil {
+			log.Println("prepare失败: ", err)
+		}
+	},
+}
+
+var validate = &cobra.Command{
+	Use:   "validate",
+	Short: "Check CSV/Parquet/Arrow/dataset input files line by line and report file:line for each issue",
+	Run: func(cmd *cobra.Command, args []string) {
+		input, _ := cmd.Flags().GetString("input")
+		typ, _ := cmd.Flags().GetString("type")
+		maxIssues, _ := cmd.Flags().GetInt64("max_issues")
+		columnMapPath, _ := cmd.Flags().GetString("column_map")
+
+		// 加载列名映射文件
+		if err := LoadColumnMapping(columnMapPath); err != nil {
+			log.Println("加载列名映射文件失败: ", err)
+			os.Exit(1)
+		}
+
+		failed := false
+		for _, path := range strings.Split(input, ",") {
+			if path = strings.TrimSpace(path); path == "" {
+				continue
+			}
+			kind := uint32(0)
+			var err error
+			if typ == "" {
+				kind, err = DetectValidateKind(path)
+			} else {
+				kind, err = DatasetKindByName(typ)
+			}
+			if err != nil {
+				log.Printf("%v: 数据集类型错误: %v\n", path, err)
+				failed = true
+				continue
+			}
+			vr, err := ValidateFile(path, kind, maxIssues)
+			if err != nil {
+				log.Printf("%v: 校验失败: %v\n", path, err)
+				failed = true
+				continue
+			}
+			vr.Print()
+			failed = failed || vr.Issues != 0
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+var generate = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate reproducible realtime, history and static datasets with configurable size, value model and quality flags",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := &GenerateConfig{}
+		cfg.OutputDir, _ = cmd.Flags().GetString("output_dir")
+		cfg.Prefix, _ = cmd.Flags().GetString("prefix")
+		sets, _ := cmd.Flags().GetString("sets")
+		cfg.Format, _ = cmd.Flags().GetString("format")
+		cfg.Static, _ = cmd.Flags().GetBool("static")
+		cfg.AnalogCount, _ = cmd.Flags().GetInt("analog_count")
+		cfg.DigitalCount, _ = cmd.Flags().GetInt("digital_count")
+		startTime, _ := cmd.Flags().GetString("start_time")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		duration, _ := cmd.Flags().GetDuration("duration")
+		cfg.Interval = interval.Milliseconds()
+		cfg.Duration = duration.Milliseconds()
+		cfg.Model, _ = cmd.Flags().GetString("model")
+		cfg.Base, _ = cmd.Flags().GetFloat64("base")
+		cfg.Amplitude, _ = cmd.Flags().GetFloat64("amplitude")
+		period, _ := cmd.Flags().GetDuration("period")
+		cfg.Period = period.Milliseconds()
+		cfg.WalkStep, _ = cmd.Flags().GetFloat64("walk_step")
+		cfg.QProb, _ = cmd.Flags().GetFloat64("q_prob")
+		cfg.BfProb, _ = cmd.Flags().GetFloat64("bf_prob")
+		cfg.FqProb, _ = cmd.Flags().GetFloat64("fq_prob")
+		cfg.MsProb, _ = cmd.Flags().GetFloat64("ms_prob")
+		cfg.FaiProb, _ = cmd.Flags().GetFloat64("fai_prob")
+		cfg.DvToggleProb, _ = cmd.Flags().GetFloat64("dv_toggle_prob")
+		cfg.Seed, _ = cmd.Flags().GetInt64("seed")
+
+		for _, set := range strings.Split(sets, ",") {
+			if set = strings.TrimSpace(set); set != "" {
+				cfg.Sets = append(cfg.Sets, set)
+			}
+		}
+		var err error
+		if cfg.StartTime, err = ParseSectionTime("start_time", startTime); err != nil {
+			log.Println("generate失败: ", err)
+			return
+		}
+		if err := GenerateDataset(cfg); err != nil {
+			log.Println("generate失败: ", err)
+		}
+	},
+}
+
+var capacity = &cobra.Command{
+	Use:   "capacity",
+	Short: "Ramp units, points per section or section rate step by step to find the maximum sustainable point rate",
+	Run: func(cmd *cobra.Command, args []string) {
+		pluginPath, _ := cmd.Flags().GetString("plugin")
+		param, _ := cmd.Flags().GetString("param")
+		isolate, _ := cmd.Flags().GetBool("isolate")
+		columnMapPath, _ := cmd.Flags().GetString("column_map")
+		cfg := &CapacityConfig{}
+		cfg.Type, _ = cmd.Flags().GetInt64("type")
+		cfg.AnalogPath, _ = cmd.Flags().GetString("analog")
+		cfg.DigitalPath, _ = cmd.Flags().GetString("digital")
+		cfg.Magic, _ = cmd.Flags().GetInt32("magic")
+		cfg.RandomAv, _ = cmd.Flags().GetBool("random_av")
+		cfg.Ramp, _ = cmd.Flags().GetString("ramp")
+		cfg.UnitNumber, _ = cmd.Flags().GetInt64("unit_number")
+		cfg.Points, _ = cmd.Flags().GetInt("points")
+		cfg.Rate, _ = cmd.Flags().GetFloat64("rate")
+		cfg.Step, _ = cmd.Flags().GetFloat64("step")
+		cfg.Steps, _ = cmd.Flags().GetInt("steps")
+		cfg.Hold, _ = cmd.Flags().GetDuration("hold")
+		cfg.MaxMissRatio, _ = cmd.Flags().GetFloat64("max_miss_ratio")
+		cfg.MaxBacklog, _ = cmd.Flags().GetInt("max_backlog")
+		cfg.MaxErrorRatio, _ = cmd.Flags().GetFloat64("max_error_ratio")
+
+		if err := cfg.Validate(); err != nil {
+			log.Println("饱和搜索参数错误: ", err)
+			return
+		}
+
+		// 加载列名映射文件
+		if err := LoadColumnMapping(columnMapPath); err != nil {
+			log.Println("加载列名映射文件失败: ", err)
+			return
+		}
+
 		// 加载动态库
-		InitGlobalPlugin(pluginPath)
+		requiredCaps := PluginCapRealtime
+		if cfg.Type == 2 {
+			requiredCaps = PluginCapHistory
+		}
+		if err := InitGlobalPlugin(pluginPath, isolate, requiredCaps); err != nil {
+			log.Println("加载插件失败: ", err)
+			os.Exit(1)
+		}
 
 		// 登入
 		if rtn := GlobalPlugin.Login(param); rtn != 0 {
 			log.Println("登陆失败: ", rtn)
 			return
 		}
-		start := time.Now()
 		defer func() {
-			logoutStart := time.Now()
 			GlobalPlugin.Logout()
-			logoutDuration := time.Since(logoutStart)
-			log.Println("logout time: ", logoutDuration)
-			PeriodicWriteHisSummary(magic, "周期性写入历史值", start, time.Now(), NormalAnalogWriteSectionInfoList, NormalDigitalWriteSectionInfoList, NormalSleepDurationList, logoutDuration)
+			GlobalWriteErrors.Print()
 		}()
 
-		// 周期性写入
-		PeriodicWriteHis(magic, unitNumber, analogCsvPath, digitalCsvPath, randomAv)
+		RunCapacity(cfg)
 	},
 }
 
-var rtPeriodicWrite = &cobra.Command{
-	Use:   "rt_periodic_write",
-	Short: "Periodic Write REALTIME_FAST_ANALOG.csv, REALTIME_FAST_DIGITAL.csv, REALTIME_NORMAL_ANALOG.csv, REALTIME_NORMAL_DIGITAL.csv",
+var replay = &cobra.Command{
+	Use:   "replay",
+	Short: "Replay the plugin calls captured by --record against a plugin",
 	Run: func(cmd *cobra.Command, args []string) {
 		pluginPath, _ := cmd.Flags().GetString("plugin")
-		overloadProtection, _ := cmd.Flags().GetBool("overload_protection")
-		fastAnalogCsvPath, _ := cmd.Flags().GetString("rt_fast_analog")
-		fastDigitalCsvPath, _ := cmd.Flags().GetString("rt_fast_digital")
-		normalAnalogCsvPath, _ := cmd.Flags().GetString("rt_normal_analog")
-		normalDigitalCsvPath, _ := cmd.Flags().GetString("rt_normal_digital")
-		unitNumber, _ := cmd.Flags().GetInt64("unit_number")
-		fastCache, _ := cmd.Flags().GetBool("fast_cache")
-		randomAv, _ := cmd.Flags().GetBool("random_av")
+		recordPath, _ := cmd.Flags().GetString("record")
 		param, _ := cmd.Flags().GetString("param")
-		mode, _ := cmd.Flags().GetInt64("mode")
-		magic, _ := cmd.Flags().GetInt32("magic")
+		isolate, _ := cmd.Flags().GetBool("isolate")
+		speed, _ := cmd.Flags().GetFloat64("speed")
+
+		if speed < 0 {
+			log.Println("speed不能小于0: ", speed)
+			return
+		}
+		if param == "" {
+			recordedParam, err := RecordedLoginParam(recordPath)
+			if err != nil {
+				log.Println("读取录制文件失败: ", err)
+				return
+			}
+			param = recordedParam
+		}
 
 		// 加载动态库
-		InitGlobalPlugin(pluginPath)
+		if err := InitGlobalPlugin(pluginPath, isolate, 0); err != nil {
+			log.Println("加载插件失败: ", err)
+			os.Exit(1)
+		}
 
 		// 登入
 		if rtn := GlobalPlugin.Login(param); rtn != 0 {
 			log.Println("登陆失败: ", rtn)
 			return
 		}
+
+		// 平滑退出
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			WaitExit(sigs)
+			Abort("捕获中断信号")
+		}()
+
+		collector := &ReplayCollector{}
 		start := time.Now()
-		defer func() {
-			logoutStart := time.Now()
-			GlobalPlugin.Logout()
-			logoutDuration := time.Since(logoutStart)
-			log.Println("logout time: ", logoutDuration)
+		err := Replay(GlobalPlugin.Writer(), recordPath, speed, collector)
+		end := time.Now()
+		if err != nil {
+			log.Println("回放失败: ", err)
+		}
 
-			name := ""
-			if overloadProtection == true && fastCache == true {
-				name = "周期性写入实时值(开启载保护, 开启快采点缓存)"
-			} else if overloadProtection == true && fastCache == false {
-				name = "周期性写入实时值(开启载保护, 关闭快采点缓存)"
-			} else if overloadProtection == false && fastCache == false {
-				name = "周期性写入实时值(关闭载保护, 关闭快采点缓存)"
-			} else if overloadProtection == false && fastCache == true {
-				name = "周期性写入实时值(关闭载保护, 开启快采点缓存)"
-			}
+		logoutStart := time.Now()
+		GlobalPlugin.Logout()
+		log.Println("logout time: ", time.Since(logoutStart))
+		log.Printf("回放 - 录制文件: %v, 开始时间: %v, 结束时间: %v, 总耗时: %v\n", recordPath, start.Format(time.RFC3339), end.Format(time.RFC3339), end.Sub(start))
+		collector.Print()
+	},
+}
 
-			if mode == 0 {
-				PeriodicWriteRtSummary(magic, name, start, time.Now(), FastAnalogWriteSectionInfoList, FastDigitalWriteSectionInfoList, FastSleepDurationList, NormalAnalogWriteSectionInfoList, NormalDigitalWriteSectionInfoList, NormalSleepDurationList, logoutDuration)
-			} else if mode == 1 {
-				PeriodicWriteRtSummary(magic, name, start, time.Now(), FastAnalogWriteSectionInfoList, FastDigitalWriteSectionInfoList, FastSleepDurationList, NormalAnalogWriteSectionInfoList, NormalDigitalWriteSectionInfoList, NormalSleepDurationList, logoutDuration)
-			} else if mode == 2 {
-				PeriodicWriteRtSummary(magic, name, start, time.Now(), FastAnalogWriteSectionInfoList, FastDigitalWriteSectionInfoList, FastSleepDurationList, NormalAnalogWriteSectionInfoList, NormalDigitalWriteSectionInfoList, NormalSleepDurationList, logoutDuration)
-			} else {
-				panic("mode must be 0 or 1 or 2")
-			}
-		}()
+var pluginHost = &cobra.Command{
+	Use:    "plugin_host",
+	Short:  "Plugin host process, started by write commands with --isolate",
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		pluginPath, _ := cmd.Flags().GetString("plugin")
+		socketPath, _ := cmd.Flags().GetString("socket")
 
-		// 周期性写入
-		if mode == 0 {
-			PeriodicWriteRt(magic, unitNumber, overloadProtection, fastAnalogCsvPath, fastDigitalCsvPath, normalAnalogCsvPath, normalDigitalCsvPath, fastCache, randomAv)
-		} else if mode == 1 {
-			PeriodicWriteRtOnlyFast(magic, unitNumber, overloadProtection, fastAnalogCsvPath, fastDigitalCsvPath, fastCache, randomAv)
-		} else if mode == 2 {
-			PeriodicWriteRtOnlyNormal(magic, unitNumber, overloadProtection, normalAnalogCsvPath, normalDigitalCsvPath, fastCache, randomAv)
-		} else {
-			panic("mode must be 0 or 1 or 2")
+		if err := RunPluginHost(pluginPath, socketPath); err != nil {
+			log.Println("插件进程启动失败: ", err)
+			os.Exit(2)
 		}
 	},
 }
@@ -2126,52 +4222,114 @@ func init() {
 	staticWrite.Flags().Int64P("unit_number", "", 1, "unit number")
 	staticWrite.Flags().Int64P("type", "", 0, "0代表实时快采集点, 1代表实时普通点, 2代表历史普通点")
 	staticWrite.Flags().StringP("param", "", "", "custom param")
+	staticWrite.Flags().BoolP("isolate", "", false, "为true时在独立的插件进程中加载插件, 插件崩溃时写数程序仍然输出统计结果")
+	staticWrite.Flags().StringP("record", "", "", "录制文件路径, 不为空时把每次插件调用写入录制文件, 可以通过replay命令回放")
+	staticWrite.Flags().BoolP("strict", "", false, "为true时写入前校验输入文件(与validate命令相同), 有问题时不写入并返回非0的退出码")
+	staticWrite.Flags().StringP("column_map", "", "", "列名映射文件路径, 每行 逻辑列名=文件中的列名 或 default.逻辑列名=默认值, 为空时按标准列名读取")
 	staticWrite.Flags().Int32P("magic", "", 0, "魔数, 默认为0")
 
 	rootCmd.AddCommand(rtFastWrite)
-	rtFastWrite.Flags().StringP("plugin", "", "", "plugin path")
-	rtFastWrite.Flags().StringP("rt_fast_analog", "", "", "realtime fast analog csv path")
-	rtFastWrite.Flags().StringP("rt_fast_digital", "", "", "realtime fast digital csv path")
-	rtFastWrite.Flags().StringP("rt_normal_analog", "", "", "realtime normal analog csv path")
-	rtFastWrite.Flags().StringP("rt_normal_digital", "", "", "realtime normal digital csv path")
-	rtFastWrite.Flags().Int64P("unit_number", "", 1, "unit number")
-	rtFastWrite.Flags().StringP("param", "", "", "custom param")
-	rtFastWrite.Flags().BoolP("random_av", "", false, "为true表示给av值加一个[0,30]的随机数浮动")
-	rtFastWrite.Flags().Int32P("magic", "", 0, "魔数, 默认为0")
-	rtFastWrite.Flags().Int64("mode", 0, "写入模式: 0表示写快采点+普通点, 1表示只写快采点, 2表示只写普通点")
+	rtFastWriteOpts.Register(rtFastWrite, true)
 	rtFastWrite.Flags().BoolP("parallel_writing", "", false, "为true时, 快采点和普通点会分别由两个协程进行并行写入")
 
 	rootCmd.AddCommand(rtPeriodicWrite)
-	rtPeriodicWrite.Flags().StringP("plugin", "", "", "plugin path")
-	rtPeriodicWrite.Flags().BoolP("overload_protection", "", false, "overload protection flag")
-	rtPeriodicWrite.Flags().StringP("rt_fast_analog", "", "", "realtime fast analog csv path")
-	rtPeriodicWrite.Flags().StringP("rt_fast_digital", "", "", "realtime fast digital csv path")
-	rtPeriodicWrite.Flags().StringP("rt_normal_analog", "", "", "realtime normal analog csv path")
-	rtPeriodicWrite.Flags().StringP("rt_normal_digital", "", "", "realtime normal digital csv path")
-	rtPeriodicWrite.Flags().Int64P("unit_number", "", 1, "unit number")
-	rtPeriodicWrite.Flags().BoolP("fast_cache", "", false, "fast cache")
-	rtPeriodicWrite.Flags().BoolP("random_av", "", false, "为true表示给av值加一个[0,30]的随机数浮动")
-	rtPeriodicWrite.Flags().StringP("param", "", "", "custom param")
-	rtPeriodicWrite.Flags().Int32P("magic", "", 0, "魔数, 默认为0")
-	rtPeriodicWrite.Flags().Int64("mode", 0, "写入模式: 0表示写快采点+普通点, 1表示只写快采点, 2表示只写普通点")
+	rtPeriodicWriteOpts.Register(rtPeriodicWrite, true)
+	rtPeriodicOpts.Register(rtPeriodicWrite, true)
 
 	rootCmd.AddCommand(hisFastWrite)
-	hisFastWrite.Flags().StringP("plugin", "", "", "plugin path")
-	hisFastWrite.Flags().StringP("his_normal_analog", "", "", "history normal analog csv path")
-	hisFastWrite.Flags().StringP("his_normal_digital", "", "", "history normal digital csv path")
-	hisFastWrite.Flags().Int64P("unit_number", "", 1, "unit number")
-	hisFastWrite.Flags().BoolP("random_av", "", false, "为true表示给av值加一个[0,30]的随机数浮动")
-	hisFastWrite.Flags().Int32P("magic", "", 0, "魔数, 默认为0")
-	hisFastWrite.Flags().StringP("param", "", "", "custom param")
+	hisFastWriteOpts.Register(hisFastWrite, false)
 
 	rootCmd.AddCommand(hisPeriodicWrite)
-	hisPeriodicWrite.Flags().StringP("plugin", "", "", "plugin path")
-	hisPeriodicWrite.Flags().StringP("his_normal_analog", "", "", "history normal analog csv path")
-	hisPeriodicWrite.Flags().StringP("his_normal_digital", "", "", "history normal digital csv path")
-	hisPeriodicWrite.Flags().Int64P("unit_number", "", 1, "unit number")
-	hisPeriodicWrite.Flags().BoolP("random_av", "", false, "为true表示给av值加一个[0,30]的随机数浮动")
-	hisPeriodicWrite.Flags().Int32P("magic", "", 0, "魔数, 默认为0")
-	hisPeriodicWrite.Flags().StringP("param", "", "", "custom param")
+	hisPeriodicWriteOpts.Register(hisPeriodicWrite, false)
+	hisPeriodicOpts.Register(hisPeriodicWrite, false)
+
+	rootCmd.AddCommand(readBack)
+	readBack.Flags().StringP("plugin", "", "", "plugin path")
+	readBack.Flags().StringP("param", "", "", "custom param")
+	readBack.Flags().Int32P("magic", "", 0, "魔数, 默认为0")
+	readBack.Flags().Int64P("unit_id", "", 0, "机组ID")
+	readBack.Flags().Int64P("type", "", 0, "0代表实时快采集点, 1代表实时普通点, 2代表历史普通点")
+	readBack.Flags().BoolP("digital", "", false, "为true时读数字量, 为false时读模拟量")
+	readBack.Flags().StringP("pnum", "", "", "P_NUM列表, 例如: 1,2,5-10")
+	readBack.Flags().Int64P("start", "", 0, "历史值开始时间(包含), 只在type为2时有效")
+	readBack.Flags().Int64P("end", "", 0, "历史值结束时间(包含), 只在type为2时有效")
+	readBack.Flags().StringP("output", "", "", "输出CSV文件路径, 为空时输出到标准输出")
+
+	rootCmd.AddCommand(harnessBench)
+	harnessBench.Flags().StringP("plugin", "", "", "plugin path")
+	harnessBench.Flags().BoolP("isolate", "", false, "为true时在独立的插件进程中加载插件, 完整调用路径包含进程间通信的开销")
+	harnessBench.Flags().Int64P("unit_number", "", 1, "unit number")
+	harnessBench.Flags().IntP("pnum_count", "", 1000, "每个断面的PNUM数量")
+	harnessBench.Flags().IntP("count", "", 100000, "调用次数")
+	harnessBench.Flags().Int32P("magic", "", 0, "魔数, 默认为0")
+
+	rootCmd.AddCommand(prepare)
+	prepare.Flags().StringP("input", "", "", "输入CSV文件路径(支持.gz/.zst/.xz, 以及Parquet/Arrow IPC文件)")
+	prepare.Flags().StringP("output", "", "", "输出数据集文件路径")
+	prepare.Flags().StringP("type", "", "", "数据集类型: analog, digital, static_analog, static_digital, 为空时根据CSV表头判断")
+	prepare.Flags().StringP("column_map", "", "", "列名映射文件路径, 每行 逻辑列名=文件中的列名 或 default.逻辑列名=默认值, 为空时按标准列名读取")
+
+	rootCmd.AddCommand(validate)
+	validate.Flags().StringP("input", "", "", "输入文件路径, 多个文件用逗号分隔(支持CSV、压缩的CSV、Parquet/Arrow IPC文件和预编译数据集)")
+	validate.Flags().StringP("type", "", "", "数据集类型: analog, digital, static_analog, static_digital, 为空时根据表头判断")
+	validate.Flags().Int64P("max_issues", "", 100, "每个文件最多输出的问题数量, 为0时全部输出")
+	validate.Flags().StringP("column_map", "", "", "列名映射文件路径, 每行 逻辑列名=文件中的列名 或 default.逻辑列名=默认值, 为空时按标准列名读取")
+
+	rootCmd.AddCommand(generate)
+	generate.Flags().StringP("output_dir", "", ".", "输出目录")
+	generate.Flags().StringP("prefix", "", "", "文件名前缀, 例如 1721454092945_")
+	generate.Flags().StringP("sets", "", "rt_fast,rt_normal,his", "生成的数据集: rt_fast(实时快采集点), rt_normal(实时普通点), his(历史普通点), 逗号分隔")
+	generate.Flags().StringP("format", "", "csv", "输出格式: csv, dataset(预编译数据集)")
+	generate.Flags().BoolP("static", "", true, "为true时同时生成静态模拟量和静态数字量")
+	generate.Flags().IntP("analog_count", "", 100, "每个断面的模拟量PNUM数量")
+	generate.Flags().IntP("digital_count", "", 100, "每个断面的数字量PNUM数量")
+	generate.Flags().StringP("start_time", "", "0", "第一个断面的时间: 毫秒时间戳或 RFC3339 格式的时间, 与写入命令的 --start_time 相同")
+	generate.Flags().DurationP("interval", "", time.Second, "断面间隔(例如1s, 精确到毫秒)")
+	generate.Flags().DurationP("duration", "", time.Minute, "持续时间(例如10m, 精确到毫秒), 断面数量为duration/interval")
+	generate.Flags().StringP("model", "", ValueModelRandomWalk, "模拟量的值模型: constant, random_walk, sine, step")
+	generate.Flags().Float64P("base", "", 300, "模拟量的基准值")
+	generate.Flags().Float64P("amplitude", "", 3, "模拟量的幅度, 每个点的基准值在[base, base+amplitude)之间随机")
+	generate.Flags().DurationP("period", "", time.Minute, "sine和step的周期(例如1m, 精确到毫秒)")
+	generate.Flags().Float64P("walk_step", "", 0.1, "random_walk每个断面的步长标准差")
+	generate.Flags().Float64P("q_prob", "", 0.5, "Q为true的概率")
+	generate.Flags().Float64P("bf_prob", "", 0.5, "BF为true的概率")
+	generate.Flags().Float64P("fq_prob", "", 0.5, "FQ为true的概率")
+	generate.Flags().Float64P("ms_prob", "", 0.5, "MS为true的概率")
+	generate.Flags().Float64P("fai_prob", "", 0.5, "数字量FAI为true的概率")
+	generate.Flags().Float64P("dv_toggle_prob", "", 0.1, "数字量DV每个断面翻转的概率")
+	generate.Flags().Int64P("seed", "", 1, "随机数种子, 参数和种子相同时生成的文件完全相同")
+
+	rootCmd.AddCommand(capacity)
+	capacity.Flags().StringP("plugin", "", "", "plugin path")
+	capacity.Flags().StringP("param", "", "", "custom param")
+	capacity.Flags().BoolP("isolate", "", false, "为true时在独立的插件进程中加载插件, 插件崩溃时写数程序仍然输出统计结果")
+	capacity.Flags().Int32P("magic", "", 0, "魔数, 默认为0")
+	capacity.Flags().Int64P("type", "", 1, "0代表实时快采集点, 1代表实时普通点, 2代表历史普通点")
+	capacity.Flags().StringP("analog", "", "", "模拟量文件路径(CSV、数据集、Parquet / Arrow IPC)")
+	capacity.Flags().StringP("digital", "", "", "数字量文件路径(CSV、数据集、Parquet / Arrow IPC)")
+	capacity.Flags().StringP("column_map", "", "", "列名映射文件路径, 每行 逻辑列名=文件中的列名 或 default.逻辑列名=默认值, 为空时按标准列名读取")
+	capacity.Flags().BoolP("random_av", "", false, "为true表示给av值加一个[0,30]的随机数浮动")
+	capacity.Flags().StringP("ramp", "", CapacityRampUnit, "每一步增加的参数: unit(机组数量), points(每个断面的PNUM数量), rate(每秒写入的断面数量)")
+	capacity.Flags().Int64P("unit_number", "", 1, "第一步的机组数量")
+	capacity.Flags().IntP("points", "", 0, "第一步每个断面的模拟量和数字量各自最多写入的PNUM数量, 为0时写入文件中的全部PNUM")
+	capacity.Flags().Float64P("rate", "", 2.5, "第一步每秒写入的断面数量, 默认与普通点的400ms周期相同")
+	capacity.Flags().Float64P("step", "", 1, "每一步增加的机组数量、PNUM数量或断面速率")
+	capacity.Flags().IntP("steps", "", 10, "最多的步骤数量")
+	capacity.Flags().DurationP("hold", "", 30*time.Second, "每一步的持续时间")
+	capacity.Flags().Float64P("max_miss_ratio", "", 0.01, "错过截止时间(写入完成时已经超过下一个断面的计划发布时间)的断面比例超过该值时认为饱和")
+	capacity.Flags().IntP("max_backlog", "", 10, "每一步结束时积压的断面数量超过该值时认为饱和")
+	capacity.Flags().Float64P("max_error_ratio", "", 0, "写入失败的调用比例超过该值时认为饱和")
+
+	rootCmd.AddCommand(replay)
+	replay.Flags().StringP("plugin", "", "", "plugin path")
+	replay.Flags().StringP("record", "", "", "录制文件路径")
+	replay.Flags().StringP("param", "", "", "custom param, 为空时使用录制时login的参数")
+	replay.Flags().BoolP("isolate", "", false, "为true时在独立的插件进程中加载插件, 插件崩溃时写数程序仍然输出统计结果")
+	replay.Flags().Float64P("speed", "", 1, "回放速度, 1表示按录制时的时间间隔回放, 大于1时按比例压缩时间间隔, 0表示不等待")
+
+	rootCmd.AddCommand(pluginHost)
+	pluginHost.Flags().StringP("plugin", "", "", "plugin path")
+	pluginHost.Flags().StringP("socket", "", "", "unix socket path")
 }
 
 func Execute() {
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCall 测试插件收到的一次调用
+type fakeCall struct {
+	Op     string
+	UnitId int64
+	Fast   bool
+	Times  []int64
+	Raw    []byte
+}
+
+// fakeWriter 记录每次写入调用的测试插件, failUnit 机组的写入返回错误, 其他调用与 builtin:null 相同
+// onCall 不为nil时在每次写入调用记录后调用, 参数为已记录的调用次数
+type fakeWriter struct {
+	*BuiltinWriter
+	failUnit int64
+	onCall   func(n int)
+	mu       sync.Mutex
+	calls    []fakeCall
+}
+
+func newFakeWriter(failUnit int64) *fakeWriter {
+	bw, _ := NewBuiltinWriter(BuiltinPluginPrefix + "null")
+	return &fakeWriter{BuiltinWriter: bw, failUnit: failUnit}
+}
+
+func (fw *fakeWriter) call(op string, unitId int64, isFast bool, times []int64, raw []byte) error {
+	fw.mu.Lock()
+	fw.calls = append(fw.calls, fakeCall{Op: op, UnitId: unitId, Fast: isFast, Times: times, Raw: append([]byte(nil), raw...)})
+	n := len(fw.calls)
+	fw.mu.Unlock()
+	if fw.onCall != nil {
+		fw.onCall(n)
+	}
+	if unitId == fw.failUnit {
+		return fmt.Errorf("unit %v failed", unitId)
+	}
+	return nil
+}
+
+// Calls 按机组排序的调用, 多个机组并发写入时调用顺序不确定
+func (fw *fakeWriter) Calls() []fakeCall {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	calls := append([]fakeCall(nil), fw.calls...)
+	sort.SliceStable(calls, func(i, j int) bool { return calls[i].UnitId < calls[j].UnitId })
+	return calls
+}
+
+func (fw *fakeWriter) WriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool) error {
+	return fw.call("write_rt_analog", unitId, isFast, []int64{section.Time}, rawBytes(section.Data))
+}
+
+func (fw *fakeWriter) WriteRtDigital(magic int32, unitId int64, section DigitalSection, isFast bool) error {
+	return fw.call("write_rt_digital", unitId, isFast, []int64{section.Time}, rawBytes(section.Data))
+}
+
+func (fw *fakeWriter) WriteRtAnalogList(magic int32, unitId int64, sections []AnalogSection) error {
+	times, raw := make([]int64, 0), make([]byte, 0)
+	for _, section := range sections {
+		times = append(times, section.Time)
+		raw = append(raw, rawBytes(section.Data)...)
+	}
+	return fw.call("write_rt_analog_list", unitId, true, times, raw)
+}
+
+func (fw *fakeWriter) WriteRtDigitalList(magic int32, unitId int64, sections []DigitalSection) error {
+	times, raw := make([]int64, 0), make([]byte, 0)
+	for _, section := range sections {
+		times = append(times, section.Time)
+		raw = append(raw, rawBytes(section.Data)...)
+	}
+	return fw.call("write_rt_digital_list", unitId, true, times, raw)
+}
+
+func (fw *fakeWriter) WriteHisAnalog(magic int32, unitId int64, section AnalogSection) error {
+	return fw.call("write_his_analog", unitId, false, []int64{section.Time}, rawBytes(section.Data))
+}
+
+func (fw *fakeWriter) WriteHisDigital(magic int32, unitId int64, section DigitalSection) error {
+	return fw.call("write_his_digital", unitId, false, []int64{section.Time}, rawBytes(section.Data))
+}
+
+// analogRow 模拟量CSV行, 值由 pNum 决定
+func analogRow(ts int64, pNum int) []string {
+	return []string{strconv.FormatInt(ts, 10), strconv.Itoa(pNum), strconv.Itoa(pNum) + ".5", "1.25", "true", "false", "false", "0", "false", "A", "0"}
+}
+
+// digitalRow 数字量CSV行, 值由 pNum 决定
+func digitalRow(ts int64, pNum int) []string {
+	return []string{strconv.FormatInt(ts, 10), strconv.Itoa(pNum), strconv.Itoa(pNum % 2), "0", "true", "false", "false", "0", "false", "A", "0"}
+}
+
+func testAnalogSection(t *testing.T, ts int64, pNums ...int) AnalogSection {
+	t.Helper()
+	section := AnalogSection{Time: ts}
+	for _, pNum := range pNums {
+		_, analog, err := ParseAnalogRecord(analogRow(ts, pNum))
+		if err != nil {
+			t.Fatal(err)
+		}
+		section.Data = append(section.Data, analog)
+	}
+	return section
+}
+
+func testDigitalSection(t *testing.T, ts int64, pNums ...int) DigitalSection {
+	t.Helper()
+	section := DigitalSection{Time: ts}
+	for _, pNum := range pNums {
+		_, digital, err := ParseDigitalRecord(digitalRow(ts, pNum))
+		if err != nil {
+			t.Fatal(err)
+		}
+		section.Data = append(section.Data, digital)
+	}
+	return section
+}
+
+// writeCsv 在临时目录中写入CSV文件, 第一行为表头
+func writeCsv(t *testing.T, name string, header []string, rows ...[]string) string {
+	t.Helper()
+	lines := []string{strings.Join(header, ",")}
+	for _, row := range rows {
+		lines = append(lines, strings.Join(row, ","))
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWritePluginDispatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		unitNumber     int64
+		failUnit       int64
+		write          func(t *testing.T, plugin *WritePlugin, unitNumber int64) WriteStatus
+		op             string
+		wantFailed     int64
+		wantFailedPNum int64
+	}{
+		{
+			name: "rt analog, 1 unit", unitNumber: 1, failUnit: -1, op: "write_rt_analog",
+			write: func(t *testing.T, plugin *WritePlugin, unitNumber int64) WriteStatus {
+				return plugin.WriteRtAnalog(0, unitNumber, testAnalogSection(t, 1000, 1, 2, 3), true, false)
+			},
+		},
+		{
+			name: "rt analog, 3 units, unit 1 fails", unitNumber: 3, failUnit: 1, op: "write_rt_analog",
+			wantFailed: 1, wantFailedPNum: 3,
+			write: func(t *testing.T, plugin *WritePlugin, unitNumber int64) WriteStatus {
+				return plugin.WriteRtAnalog(0, unitNumber, testAnalogSection(t, 1000, 1, 2, 3), true, false)
+			},
+		},
+		{
+			name: "rt digital, 1 unit fails", unitNumber: 1, failUnit: 0, op: "write_rt_digital",
+			wantFailed: 1, wantFailedPNum: 2,
+			write: func(t *testing.T, plugin *WritePlugin, unitNumber int64) WriteStatus {
+				return plugin.WriteRtDigital(0, unitNumber, testDigitalSection(t, 1000, 1, 2), false)
+			},
+		},
+		{
+			name: "rt analog list, 2 units, unit 0 fails", unitNumber: 2, failUnit: 0, op: "write_rt_analog_list",
+			wantFailed: 1, wantFailedPNum: 3,
+			write: func(t *testing.T, plugin *WritePlugin, unitNumber int64) WriteStatus {
+				sections := []AnalogSection{testAnalogSection(t, 1000, 1, 2), testAnalogSection(t, 1001, 1)}
+				return plugin.WriteRtAnalogList(0, unitNumber, sections, false)
+			},
+		},
+		{
+			name: "his analog, 4 units", unitNumber: 4, failUnit: -1, op: "write_his_analog",
+			write: func(t *testing.T, plugin *WritePlugin, unitNumber int64) WriteStatus {
+				return plugin.WriteHisAnalog(0, unitNumber, testAnalogSection(t, 1000, 7), false)
+			},
+		},
+		{
+			name: "his digital, 2 units, unit 1 fails", unitNumber: 2, failUnit: 1, op: "write_his_digital",
+			wantFailed: 1, wantFailedPNum: 4,
+			write: func(t *testing.T, plugin *WritePlugin, unitNumber int64) WriteStatus {
+				return plugin.WriteHisDigital(0, unitNumber, testDigitalSection(t, 1000, 1, 2, 3, 4))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			GlobalWriteErrors = &WriteErrorCollector{}
+			fw := newFakeWriter(tt.failUnit)
+			status := tt.write(t, NewWritePlugin(fw), tt.unitNumber)
+
+			calls := fw.Calls()
+			if int64(len(calls)) != tt.unitNumber {
+				t.Fatalf("calls = %v, want %v", len(calls), tt.unitNumber)
+			}
+			for i, call := range calls {
+				if call.Op != tt.op || call.UnitId != int64(i) {
+					t.Errorf("call %v = %v(unit %v), want %v(unit %v)", i, call.Op, call.UnitId, tt.op, i)
+				}
+			}
+			if status.FailedCount != tt.wantFailed || status.FailedPNumCount != tt.wantFailedPNum {
+				t.Errorf("status = %v/%v, want %v/%v", status.FailedCount, status.FailedPNumCount, tt.wantFailed, tt.wantFailedPNum)
+			}
+			if status.Ack != nil {
+				t.Errorf("sync write has ack group")
+			}
+			if GlobalWriteErrors.count != tt.wantFailed {
+				t.Errorf("write errors = %v, want %v", GlobalWriteErrors.count, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestWritePluginGlobalID(t *testing.T) {
+	fw := newFakeWriter(-1)
+	plugin := NewWritePlugin(fw)
+	section := testAnalogSection(t, 1000, 1, 2)
+	sections := []AnalogSection{section, testAnalogSection(t, 1001, 1)}
+	plugin.WriteRtAnalog(5, 2, section, true, false)
+	plugin.WriteRtAnalogList(5, 2, sections, false)
+
+	// 每个机组的GlobalID不同, 调用方的断面不被修改
+	calls := fw.Calls()
+	for i := 0; i < 2; i++ {
+		if calls[i].Op != calls[i+2].Op || string(calls[i].Raw) == string(calls[i+2].Raw) {
+			t.Errorf("%v: units 0 and 1 have the same global id", calls[i].Op)
+		}
+	}
+	want := testAnalogSection(t, 1000, 1, 2)
+	if string(rawBytes(section.Data)) != string(rawBytes(want.Data)) || string(rawBytes(sections[0].Data)) != string(rawBytes(want.Data)) {
+		t.Errorf("caller's section was modified")
+	}
+}
+
+func TestReadCsvPass(t *testing.T) {
+	analogPath := writeCsv(t, "a.csv", AnalogColumns,
+		analogRow(1000, 1), analogRow(1000, 2), analogRow(2000, 1), analogRow(3000, 1))
+	digitalPath := writeCsv(t, "d.csv", DigitalColumns,
+		digitalRow(1000, 1), digitalRow(3000, 1), digitalRow(3000, 2), digitalRow(4000, 1))
+
+	type section struct {
+		Time            int64
+		Analog, Digital int
+	}
+	tests := []struct {
+		name        string
+		shift       int64
+		limit       int64
+		start, end  int64
+		strict      bool
+		want        []section
+		first, last int64
+	}{
+		{
+			name: "merge", want: []section{{1000, 2, 1}, {2000, 1, 0}, {3000, 1, 2}, {4000, 0, 1}},
+			first: 1000, last: 4000,
+		},
+		{
+			name: "shift", shift: 10, want: []section{{1010, 2, 1}, {2010, 1, 0}, {3010, 1, 2}, {4010, 0, 1}},
+			first: 1000, last: 4000,
+		},
+		{
+			name: "limit", limit: 2, want: []section{{1000, 2, 1}, {2000, 1, 0}},
+			first: 1000, last: 2000,
+		},
+		{
+			name: "window", start: 2000, end: 3000, want: []section{{2000, 1, 0}, {3000, 1, 2}},
+			first: 2000, last: 3000,
+		},
+		{
+			name: "strict align stops at first gap", strict: true, want: []section{{1000, 2, 1}},
+			first: 1000, last: 1000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			GlobalBound = &BoundCollector{Start: math.MinInt64, End: math.MaxInt64, expired: make(chan struct{})}
+			if tt.end != 0 {
+				GlobalBound.Start, GlobalBound.End = tt.start, tt.end
+			}
+			GlobalAlign = &AlignCollector{Strict: tt.strict}
+
+			ch := make(chan Section, 16)
+			count, first, last := readCsvPass(analogPath, digitalPath, ch, make(chan struct{}), 1, tt.shift, tt.limit)
+			close(ch)
+			got := make([]section, 0)
+			for s := range ch {
+				if s.loop != 1 {
+					t.Errorf("loop = %v, want 1", s.loop)
+				}
+				if s.analogOk && s.digitalOk && s.analog.Time != s.digital.Time {
+					t.Errorf("analog time %v != digital time %v", s.analog.Time, s.digital.Time)
+				}
+				got = append(got, section{s.Time(), len(s.analog.Data), len(s.digital.Data)})
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("sections = %v, want %v", got, tt.want)
+			}
+			if count != int64(len(tt.want)) || first != tt.first || last != tt.last {
+				t.Errorf("count, first, last = %v, %v, %v, want %v, %v, %v", count, first, last, len(tt.want), tt.first, tt.last)
+			}
+		})
+	}
+	GlobalBound = &BoundCollector{Start: math.MinInt64, End: math.MaxInt64, expired: make(chan struct{})}
+	GlobalAlign = &AlignCollector{}
+}
+
+// useTestPlugin 使用 fw 作为 GlobalPlugin, 重置写入统计和有界写入, 测试结束后恢复
+func useTestPlugin(t *testing.T, fw *fakeWriter) {
+	t.Helper()
+	plugin, fastStats, normalStats, bound, periodic := GlobalPlugin, GlobalFastStats, GlobalNormalStats, GlobalBound, *GlobalPeriodic
+	GlobalPlugin = NewWritePlugin(fw)
+	GlobalFastStats, GlobalNormalStats = &WriteStats{}, &WriteStats{}
+	GlobalBound = &BoundCollector{Start: math.MinInt64, End: math.MaxInt64, expired: make(chan struct{})}
+	GlobalWriteErrors = &WriteErrorCollector{}
+	t.Cleanup(func() {
+		GlobalPlugin, GlobalFastStats, GlobalNormalStats, GlobalBound = plugin, fastStats, normalStats, bound
+		*GlobalPeriodic = periodic
+	})
+}
+
+// testSectionCsv 写入 n 个断面的模拟量和数字量CSV文件, 断面时间从 start 开始每次加 step
+func testSectionCsv(t *testing.T, prefix string, n int, start int64, step int64) (string, string) {
+	t.Helper()
+	analogRows, digitalRows := make([][]string, 0), make([][]string, 0)
+	for i := 0; i < n; i++ {
+		ts := start + int64(i)*step
+		analogRows = append(analogRows, analogRow(ts, 1), analogRow(ts, 2))
+		digitalRows = append(digitalRows, digitalRow(ts, 1))
+	}
+	return writeCsv(t, prefix+"_analog.csv", AnalogColumns, analogRows...), writeCsv(t, prefix+"_digital.csv", DigitalColumns, digitalRows...)
+}
+
+// readTestCsv 启动读取协程, 返回缓存队列和读取协程的平滑退出信号
+func readTestCsv(t *testing.T, wg *sync.WaitGroup, analogPath string, digitalPath string) (chan Section, chan bool) {
+	t.Helper()
+	ch := make(chan Section, GlobalPeriodic.CacheSize)
+	exitCh := make(chan bool, 1)
+	wg.Add(1)
+	go ReadCsv(wg, analogPath, digitalPath, ch, exitCh)
+	return ch, exitCh
+}
+
+// callList 调用的名称和断面时间, 用于比较调用顺序
+func callList(calls []fakeCall, isFast bool) []string {
+	list := make([]string, 0)
+	for _, call := range calls {
+		if call.Fast == isFast {
+			list = append(list, fmt.Sprintf("%v%v", call.Op, call.Times))
+		}
+	}
+	return list
+}
+
+func TestAsyncPeriodicWriteSection(t *testing.T) {
+	tests := []struct {
+		name      string
+		isRt      bool
+		isFast    bool
+		fastCache bool
+		batch     int
+		want      []string
+		writes    int64
+	}{
+		{
+			name: "rt normal", isRt: true,
+			want: []string{
+				"write_rt_analog[1000]", "write_rt_digital[1000]", "write_rt_analog[1010]", "write_rt_digital[1010]",
+				"write_rt_analog[1020]", "write_rt_digital[1020]", "write_rt_analog[1030]", "write_rt_digital[1030]",
+				"write_rt_analog[1040]", "write_rt_digital[1040]",
+			},
+			writes: 5,
+		},
+		{
+			name: "rt fast", isRt: true, isFast: true,
+			want: []string{
+				"write_rt_analog[1000]", "write_rt_digital[1000]", "write_rt_analog[1010]", "write_rt_digital[1010]",
+				"write_rt_analog[1020]", "write_rt_digital[1020]", "write_rt_analog[1030]", "write_rt_digital[1030]",
+				"write_rt_analog[1040]", "write_rt_digital[1040]",
+			},
+			writes: 5,
+		},
+		{
+			name: "his",
+			want: []string{
+				"write_his_analog[1000]", "write_his_digital[1000]", "write_his_analog[1010]", "write_his_digital[1010]",
+				"write_his_analog[1020]", "write_his_digital[1020]", "write_his_analog[1030]", "write_his_digital[1030]",
+				"write_his_analog[1040]", "write_his_digital[1040]",
+			},
+			writes: 5,
+		},
+		{
+			name: "rt fast cache, batch 2", isRt: true, isFast: true, fastCache: true, batch: 2,
+			want: []string{
+				"write_rt_analog_list[1000 1010]", "write_rt_digital_list[1000 1010]",
+				"write_rt_analog_list[1020 1030]", "write_rt_digital_list[1020 1030]",
+				"write_rt_analog_list[1040]", "write_rt_digital_list[1040]",
+			},
+			writes: 3,
+		},
+		{
+			name: "rt fast cache, batch 5", isRt: true, isFast: true, fastCache: true, batch: 5,
+			want: []string{
+				"write_rt_analog_list[1000 1010 1020 1030 1040]", "write_rt_digital_list[1000 1010 1020 1030 1040]",
+			},
+			writes: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw := newFakeWriter(-1)
+			useTestPlugin(t, fw)
+			GlobalPeriodic.CacheSize = 2
+			if tt.batch != 0 {
+				GlobalPeriodic.FastCacheBatch = tt.batch
+			}
+			analogPath, digitalPath := testSectionCsv(t, "s", 5, 1000, 10)
+			wgRead, wgWrite := new(sync.WaitGroup), new(sync.WaitGroup)
+			ch, _ := readTestCsv(t, wgRead, analogPath, digitalPath)
+			wgWrite.Add(1)
+			AsyncPeriodicWriteSection(0, 1, wgWrite, 0, 0, time.Millisecond, ch, tt.isRt, tt.isFast, tt.fastCache, make(chan bool, 1), false)
+			wgWrite.Wait()
+			wgRead.Wait()
+
+			if got := callList(fw.Calls(), tt.isFast); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("calls = %v, want %v", got, tt.want)
+			}
+			stats, other := GlobalNormalStats, GlobalFastStats
+			if tt.isFast {
+				stats, other = GlobalFastStats, GlobalNormalStats
+			}
+			_, loops := stats.Loops()
+			if len(loops) != 1 || loops[0].SectionCount != 5 || loops[0].Writes.Count != tt.writes || loops[0].PNumCount != 15 {
+				t.Errorf("stats = %+v, want 5 sections, %v writes, 15 pnums", loops, tt.writes)
+			}
+			if other.Written() {
+				t.Errorf("sections were counted in the wrong stats")
+			}
+		})
+	}
+}
+
+func TestAsyncPeriodicWriteSectionExit(t *testing.T) {
+	fw := newFakeWriter(-1)
+	useTestPlugin(t, fw)
+	GlobalPeriodic.CacheSize = 2
+	analogPath, digitalPath := testSectionCsv(t, "s", 50, 1000, 10)
+	wgRead, wgWrite := new(sync.WaitGroup), new(sync.WaitGroup)
+	ch, rd := readTestCsv(t, wgRead, analogPath, digitalPath)
+
+	// 第一个断面写完后发送平滑退出信号, 写入协程不再写入, 丢弃缓存队列中的断面直到读取协程关闭队列
+	exitCh := make(chan bool, 1)
+	fw.onCall = func(n int) {
+		if n == 2 {
+			exitCh <- true
+			rd <- true
+		}
+	}
+	wgWrite.Add(1)
+	AsyncPeriodicWriteSection(0, 1, wgWrite, 0, 0, time.Millisecond, ch, true, false, false, exitCh, false)
+	wgWrite.Wait()
+	wgRead.Wait()
+
+	if got := callList(fw.Calls(), false); fmt.Sprint(got) != fmt.Sprint([]string{"write_rt_analog[1000]", "write_rt_digital[1000]"}) {
+		t.Errorf("calls = %v, want only the first section", got)
+	}
+	if _, ok := <-ch; ok {
+		t.Errorf("section channel was not drained")
+	}
+}
+
+func TestFastWriteRealtimeSection(t *testing.T) {
+	fw := newFakeWriter(-1)
+	useTestPlugin(t, fw)
+	GlobalPeriodic.CacheSize = 2
+	fastAnalog, fastDigital := testSectionCsv(t, "fast", 4, 1000, 10)
+	normalAnalog, normalDigital := testSectionCsv(t, "normal", 3, 5000, 100)
+	wg := new(sync.WaitGroup)
+	fastCh, _ := readTestCsv(t, wg, fastAnalog, fastDigital)
+	normalCh, _ := readTestCsv(t, wg, normalAnalog, normalDigital)
+	FastWriteRealtimeSection(0, 1, fastCh, normalCh, make(chan bool, 1), false)
+	wg.Wait()
+
+	// 快采点和普通点交替写入, 各自的断面按时间顺序写入
+	calls := fw.Calls()
+	wantFast := []string{
+		"write_rt_analog[1000]", "write_rt_digital[1000]", "write_rt_analog[1010]", "write_rt_digital[1010]",
+		"write_rt_analog[1020]", "write_rt_digital[1020]", "write_rt_analog[1030]", "write_rt_digital[1030]",
+	}
+	wantNormal := []string{
+		"write_rt_analog[5000]", "write_rt_digital[5000]", "write_rt_analog[5100]", "write_rt_digital[5100]",
+		"write_rt_analog[5200]", "write_rt_digital[5200]",
+	}
+	if got := callList(calls, true); fmt.Sprint(got) != fmt.Sprint(wantFast) {
+		t.Errorf("fast calls = %v, want %v", got, wantFast)
+	}
+	if got := callList(calls, false); fmt.Sprint(got) != fmt.Sprint(wantNormal) {
+		t.Errorf("normal calls = %v, want %v", got, wantNormal)
+	}
+	for _, tt := range []struct {
+		name     string
+		stats    *WriteStats
+		sections int64
+	}{{"fast", GlobalFastStats, 4}, {"normal", GlobalNormalStats, 3}} {
+		_, loops := tt.stats.Loops()
+		if len(loops) != 1 || loops[0].SectionCount != tt.sections || loops[0].Writes.Count != tt.sections {
+			t.Errorf("%v stats = %+v, want %v sections", tt.name, loops, tt.sections)
+		}
+	}
+}
+
+func TestFastWriteRealtimeSectionExit(t *testing.T) {
+	fw := newFakeWriter(-1)
+	useTestPlugin(t, fw)
+	GlobalPeriodic.CacheSize = 2
+	fastAnalog, fastDigital := testSectionCsv(t, "fast", 50, 1000, 10)
+	normalAnalog, normalDigital := testSectionCsv(t, "normal", 50, 5000, 100)
+	wg := new(sync.WaitGroup)
+	fastCh, rd1 := readTestCsv(t, wg, fastAnalog, fastDigital)
+	normalCh, rd2 := readTestCsv(t, wg, normalAnalog, normalDigital)
+
+	// 写入第一个断面后发送平滑退出信号, 两个缓存队列都被丢弃到读取协程关闭
+	exitCh := make(chan bool, 1)
+	fw.onCall = func(n int) {
+		if n == 2 {
+			exitCh <- true
+			rd1 <- true
+			rd2 <- true
+		}
+	}
+	FastWriteRealtimeSection(0, 1, fastCh, normalCh, exitCh, false)
+	wg.Wait()
+
+	if n := len(fw.Calls()); n >= 200 || n%2 != 0 {
+		t.Errorf("calls = %v, want the write to stop early after whole sections", n)
+	}
+	for _, ch := range []chan Section{fastCh, normalCh} {
+		if _, ok := <-ch; ok {
+			t.Errorf("section channel was not drained")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// 开环写入(--open_loop)
+// 周期性写入默认是闭环的: 数据库变慢时写入协程等待写入完成后才写下一个断面, 统计的耗时看不到积压.
+// 开环模式下按固定的到达速率发布断面, 与写入是否完成无关, 模拟真实的数据采集前置机:
+// * 发布协程按计划时间(与周期性写入相同, 包括过载保护)把断面放入无界的发布队列, 写入协程从队列中取断面写入, 不睡眠
+// * 延迟从计划发布时间开始计算(写入完成时间 - 计划发布时间), 排队的时间计入延迟, 避免协调遗漏(coordinated omission)
+// * 每次发布时记录队列中等待写入的更早的断面数量(积压, 不含本次发布的断面)
+
+// PeriodicSchedule 周期性写入的计划周期, 过载保护期间使用过载保护写入周期
+type PeriodicSchedule struct {
+	OverloadDuration time.Duration // 过载保护持续时间, 为0时不开启过载保护
+	OverloadPeriodic time.Duration // 过载保护写入周期
+	Regular          time.Duration // 常规写入周期
+
+	sum time.Duration
+}
+
+// Next 当前断面到下一个断面的周期
+func (ps *PeriodicSchedule) Next() time.Duration {
+	if ps.sum < ps.OverloadDuration {
+		ps.sum += ps.OverloadPeriodic
+		return ps.OverloadPeriodic
+	}
+	return ps.Regular
+}
+
+// BacklogStats 发布队列的积压统计
+type BacklogStats struct {
+	Released int64 // 发布的断面数量
+	Max      int   // 最大积压断面数量
+	Sum      int64 // 每次发布时积压断面数量之和
+	Last     int   // 最后一次发布时的积压断面数量
+}
+
+// OpenLoopCollector 开环写入的配置和积压统计
+type OpenLoopCollector struct {
+	Enabled bool // 为true时按计划时间发布断面, 与写入是否完成无关
+
+	mu      sync.Mutex
+	backlog map[string]*BacklogStats
+}
+
+var GlobalOpenLoop = &OpenLoopCollector{}
+
+// Release 启动发布协程, 按 schedule 的计划时间从 in 读取断面并发布, 返回发布队列
+// stop 关闭或写入时长(--duration)到期后不再发布, 读取并丢弃剩余的断面, 用于平滑退出
+func (oc *OpenLoopCollector) Release(name string, in chan Section, schedule *PeriodicSchedule, stop chan struct{}) chan Section {
+	released := make(chan Section, GlobalPeriodic.CacheSize)
+	out := make(chan Section)
+
+	// 按计划时间发布, 读取跟不上时实际发布晚于计划时间, 延迟仍然从计划时间开始计算
+	go func() {
+		defer close(released)
+		next := time.Now()
+		for {
+			if d := time.Until(next); d > 0 {
+				timer := time.NewTimer(d)
+				select {
+				case <-timer.C:
+				case <-stop:
+					timer.Stop()
+				case <-GlobalBound.Done():
+					timer.Stop()
+				}
+			}
+			select {
+			case <-stop:
+				DrainSections(in)
+				return
+			default:
+			}
+			if GlobalBound.Expired() {
+				DrainSections(in)
+				return
+			}
+			section, ok := GlobalPreload.RecvSection(name, in)
+			if !ok {
+				return
+			}
+			section.release = next
+			next = next.Add(schedule.Next())
+			section.deadline = next
+			released <- section
+		}
+	}()
+
+	// 无界队列, 发布不会因为写入变慢而阻塞
+	go func() {
+		queue := make([]Section, 0)
+		for released != nil || len(queue) != 0 {
+			var sendCh chan Section
+			var head Section
+			if len(queue) != 0 {
+				sendCh = out
+				head = queue[0]
+			}
+			select {
+			case section, ok := <-released:
+				if !ok {
+					released = nil
+					continue
+				}
+				// 积压为本次发布时队列中还没有交给写入协程的更早的断面, 不含本次发布的断面, 写入跟得上时为0
+				queue = append(queue, section)
+				oc.record(name, len(queue)-1)
+			case sendCh <- head:
+				queue[0] = Section{}
+				queue = queue[1:]
+			}
+		}
+		close(out)
+	}()
+	return out
+}
+
+func (oc *OpenLoopCollector) record(name string, backlog int) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	if oc.backlog == nil {
+		oc.backlog = make(map[string]*BacklogStats)
+	}
+	stats, ok := oc.backlog[name]
+	if !ok {
+		stats = &BacklogStats{}
+		oc.backlog[name] = stats
+	}
+	stats.Released++
+	stats.Sum += int64(backlog)
+	stats.Last = backlog
+	if backlog > stats.Max {
+		stats.Max = backlog
+	}
+}
+
+// Backlog 积压统计, 没有发布过断面时返回false
+func (oc *OpenLoopCollector) Backlog(name string) (BacklogStats, bool) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	stats, ok := oc.backlog[name]
+	if !ok {
+		return BacklogStats{}, false
+	}
+	return *stats, true
+}
+
+// PrintOpenLoopSummary 输出开环延迟(写入完成时间 - 计划发布时间)和积压统计, 不是开环写入时不输出
+func PrintOpenLoopSummary(prefix string, name string, stats *WriteStats) {
+	if !GlobalOpenLoop.Enabled {
+		return
+	}
+	// 写入完成时间 = 实际开始写入时间 + 模拟量耗时 + 数字量耗时, 写入时累加到 WriteStats
+	stats.mu.Lock()
+	h := stats.openLoop
+	stats.mu.Unlock()
+	if h.Count != 0 {
+		log.Printf("%v开环延迟(写入完成时间 - 计划发布时间) - 写入次数: %v, 平均延迟: %v, 最长延迟: %v, \n\t\tP999延迟: %v, P99延迟: %v, P95延迟: %v, 中位数延迟: %v\n",
+			prefix, h.Count, h.Avg(), h.Max, h.Quantile(0.999), h.Quantile(0.99), h.Quantile(0.95), h.Quantile(0.50),
+		)
+	}
+	if backlog, ok := GlobalOpenLoop.Backlog(name); ok {
+		log.Printf("%v开环积压 - 发布断面数量: %v, 最大积压断面数量: %v, 平均积压断面数量: %.2f, 最后一次发布时的积压断面数量: %v\n",
+			prefix, backlog.Released, backlog.Max, float64(backlog.Sum)/float64(backlog.Released), backlog.Last,
+		)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPeriodicScheduleNext(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name     string
+		schedule PeriodicSchedule
+		want     []time.Duration
+	}{
+		{
+			name:     "no overload protection",
+			schedule: PeriodicSchedule{Regular: 10 * ms},
+			want:     []time.Duration{10 * ms, 10 * ms, 10 * ms},
+		},
+		{
+			name:     "overload window is a multiple of the overload periodic",
+			schedule: PeriodicSchedule{OverloadDuration: 9 * ms, OverloadPeriodic: 3 * ms, Regular: 10 * ms},
+			want:     []time.Duration{3 * ms, 3 * ms, 3 * ms, 10 * ms, 10 * ms},
+		},
+		{
+			name:     "last overload periodic crosses the window",
+			schedule: PeriodicSchedule{OverloadDuration: 10 * ms, OverloadPeriodic: 3 * ms, Regular: 20 * ms},
+			want:     []time.Duration{3 * ms, 3 * ms, 3 * ms, 3 * ms, 20 * ms, 20 * ms},
+		},
+		{
+			name:     "overload periodic equals the window",
+			schedule: PeriodicSchedule{OverloadDuration: 5 * ms, OverloadPeriodic: 5 * ms, Regular: 20 * ms},
+			want:     []time.Duration{5 * ms, 20 * ms},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := tt.schedule
+			got := make([]time.Duration, 0)
+			for range tt.want {
+				got = append(got, schedule.Next())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteStatsLateness(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	ms := time.Millisecond
+	type write struct {
+		scheduled, started time.Duration // 相对 start 的计划时间和实际开始写入时间, 计划时间为负数时不是周期性写入
+		duration           time.Duration
+		missed             bool
+	}
+	tests := []struct {
+		name       string
+		writes     []write
+		wantOk     bool
+		wantMissed int
+		wantMax    time.Duration
+		wantLast   time.Duration
+		wantOpen   time.Duration // 最大开环延迟
+	}{
+		{
+			name:   "not periodic",
+			writes: []write{{scheduled: -1, started: 0, duration: ms}},
+		},
+		{
+			name:   "on time",
+			writes: []write{{0, 0, ms, false}, {10 * ms, 10 * ms, ms, false}, {20 * ms, 21 * ms, ms, false}},
+			wantOk: true, wantMax: ms, wantLast: ms, wantOpen: 2 * ms,
+		},
+		{
+			name: "late write and catch-up",
+			writes: []write{
+				{0, 0, 25 * ms, true},
+				{10 * ms, 25 * ms, ms, true},
+				{20 * ms, 26 * ms, ms, false},
+				{30 * ms, 30 * ms, ms, false},
+			},
+			wantOk: true, wantMissed: 2, wantMax: 15 * ms, wantLast: 0, wantOpen: 25 * ms,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &WriteStats{}
+			for i, w := range tt.writes {
+				info := WriteSectionInfo{UnitNumber: 1, Time: int64(i), SectionCount: 1, Duration: w.duration, Started: start.Add(w.started), Missed: w.missed}
+				if w.scheduled >= 0 {
+					info.Scheduled = start.Add(w.scheduled)
+				}
+				stats.Add(info, WriteSectionInfo{UnitNumber: 1, Time: int64(i), SectionCount: 1, Started: info.Started})
+			}
+			ok, count, missed, _, dMax, _, _, _, last := LatenessSummary(stats)
+			if ok != tt.wantOk {
+				t.Fatalf("periodic = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if count != len(tt.writes) || missed != tt.wantMissed || dMax != tt.wantMax || last != tt.wantLast {
+				t.Errorf("count, missed, max, last = %v, %v, %v, %v, want %v, %v, %v, %v",
+					count, missed, dMax, last, len(tt.writes), tt.wantMissed, tt.wantMax, tt.wantLast)
+			}
+			if stats.openLoop.Max != tt.wantOpen {
+				t.Errorf("open loop max = %v, want %v", stats.openLoop.Max, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestAsyncPeriodicWriteSectionCatchUp(t *testing.T) {
+	fw := newFakeWriter(-1)
+	useTestPlugin(t, fw)
+	GlobalPeriodic.CacheSize = 8
+	analogPath, digitalPath := testSectionCsv(t, "s", 6, 1000, 10)
+	wgRead, wgWrite := new(sync.WaitGroup), new(sync.WaitGroup)
+	ch, _ := readTestCsv(t, wgRead, analogPath, digitalPath)
+
+	// 第一个断面的写入比两个周期还长, 之后的断面不睡眠直到追上计划时间, 计划时间不因为晚写入而顺延
+	periodic := 20 * time.Millisecond
+	fw.onCall = func(n int) {
+		if n == 1 {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	start := time.Now()
+	wgWrite.Add(1)
+	AsyncPeriodicWriteSection(0, 1, wgWrite, 0, 0, periodic, ch, true, false, false, make(chan bool, 1), false)
+	elapsed := time.Since(start)
+	wgRead.Wait()
+
+	ok, count, missed, _, dMax, _, _, _, last := LatenessSummary(GlobalNormalStats)
+	if !ok || count != 6 {
+		t.Fatalf("periodic = %v, writes = %v, want 6 periodic writes", ok, count)
+	}
+	// 第一个断面在50ms时写完, 错过20ms的截止时间; 第二个断面计划在20ms, 截止时间为40ms, 也错过
+	if missed != 2 {
+		t.Errorf("missed = %v, want 2", missed)
+	}
+	if dMax < 25*time.Millisecond || last > periodic/2 {
+		t.Errorf("max lateness = %v, last lateness = %v, want the second section about 30ms late and the last on time", dMax, last)
+	}
+	// 按绝对时间调度, 最后一个断面计划在100ms, 睡眠到120ms结束; 顺延调度需要 50ms + 6*20ms
+	if elapsed < 6*periodic || elapsed >= 50*time.Millisecond+6*periodic {
+		t.Errorf("elapsed = %v, want between %v and %v", elapsed, 6*periodic, 50*time.Millisecond+6*periodic)
+	}
+	// 追赶期间不睡眠, 只在后4个断面之后睡眠(约10ms+3*20ms)
+	if sleep := GlobalNormalStats.Sleep(); sleep >= 5*periodic {
+		t.Errorf("sleep = %v, want less than %v", sleep, 5*periodic)
+	}
+}
+
+func TestOpenLoopRelease(t *testing.T) {
+	useTestPlugin(t, newFakeWriter(-1))
+	periodic := 2 * time.Millisecond
+	in := make(chan Section, 8)
+	for i := int64(0); i < 5; i++ {
+		in <- Section{analog: testAnalogSection(t, 1000+i, 1), analogOk: true}
+	}
+	close(in)
+	oc := &OpenLoopCollector{Enabled: true}
+	out := oc.Release("普通点", in, &PeriodicSchedule{Regular: periodic}, make(chan struct{}))
+
+	// 写入协程停顿期间按计划时间继续发布, 积压为发布时队列中更早的断面数量
+	time.Sleep(50 * time.Millisecond)
+	sections := make([]Section, 0)
+	for section := range out {
+		sections = append(sections, section)
+	}
+	if len(sections) != 5 {
+		t.Fatalf("released %v sections, want 5", len(sections))
+	}
+	for i, section := range sections {
+		if section.analog.Time != 1000+int64(i) {
+			t.Errorf("section %v time = %v, want %v", i, section.analog.Time, 1000+i)
+		}
+		// 计划发布时间按绝对时间计算, 与实际发布的时间无关
+		if release := section.release.Sub(sections[0].release); release != time.Duration(i)*periodic {
+			t.Errorf("section %v release = +%v, want +%v", i, release, time.Duration(i)*periodic)
+		}
+		if section.deadline.Sub(section.release) != periodic {
+			t.Errorf("section %v deadline = release+%v, want release+%v", i, section.deadline.Sub(section.release), periodic)
+		}
+	}
+	backlog, ok := oc.Backlog("普通点")
+	if want := (BacklogStats{Released: 5, Max: 4, Sum: 10, Last: 4}); !ok || backlog != want {
+		t.Errorf("backlog = %+v, want %+v", backlog, want)
+	}
+	if _, ok := oc.Backlog("快采点"); ok {
+		t.Errorf("backlog recorded for a name that was never released")
+	}
+}
+
+func TestOpenLoopReleaseStop(t *testing.T) {
+	useTestPlugin(t, newFakeWriter(-1))
+	in := make(chan Section)
+	sent := make(chan int)
+	section := Section{analog: testAnalogSection(t, 1000, 1), analogOk: true}
+	go func() {
+		n := 0
+		for ; n < 100; n++ {
+			in <- section
+		}
+		close(in)
+		sent <- n
+	}()
+	stop := make(chan struct{})
+	oc := &OpenLoopCollector{Enabled: true}
+	out := oc.Release("普通点", in, &PeriodicSchedule{Regular: 5 * time.Millisecond}, stop)
+
+	// 关闭 stop 后不再发布, 剩余的断面被丢弃直到读取协程关闭队列, 已发布的断面仍然交给写入协程
+	received := 0
+	for range out {
+		received++
+		if received == 2 {
+			close(stop)
+		}
+	}
+	if n := <-sent; n != 100 {
+		t.Errorf("producer sent %v sections, want 100", n)
+	}
+	backlog, _ := oc.Backlog("普通点")
+	if received >= 100 || int64(received) != backlog.Released {
+		t.Errorf("received %v sections, released %v, want the same number and fewer than 100", received, backlog.Released)
+	}
+}
+
+func TestAsyncPeriodicWriteSectionOpenLoop(t *testing.T) {
+	fw := newFakeWriter(-1)
+	useTestPlugin(t, fw)
+	openLoop := GlobalOpenLoop
+	GlobalOpenLoop = &OpenLoopCollector{Enabled: true}
+	t.Cleanup(func() { GlobalOpenLoop = openLoop })
+	analogPath, digitalPath := testSectionCsv(t, "s", 4, 1000, 10)
+	wgRead, wgWrite := new(sync.WaitGroup), new(sync.WaitGroup)
+	ch, _ := readTestCsv(t, wgRead, analogPath, digitalPath)
+
+	// 第一个断面的写入停顿60ms, 后面的断面每10ms发布一次, 在队列中等待的时间计入延迟
+	periodic := 10 * time.Millisecond
+	fw.onCall = func(n int) {
+		if n == 1 {
+			time.Sleep(60 * time.Millisecond)
+		}
+	}
+	wgWrite.Add(1)
+	AsyncPeriodicWriteSection(0, 1, wgWrite, 0, 0, periodic, ch, true, false, false, make(chan bool, 1), false)
+	wgRead.Wait()
+
+	if got := callList(fw.Calls(), false); len(got) != 8 {
+		t.Fatalf("calls = %v, want 4 sections", got)
+	}
+	// 第二个断面计划在10ms发布, 60ms后才开始写入; 第一个断面的开环延迟包含停顿的60ms
+	ok, count, _, _, dMax, _, _, _, _ := LatenessSummary(GlobalNormalStats)
+	if !ok || count != 4 || dMax < 40*time.Millisecond {
+		t.Errorf("periodic = %v, writes = %v, max lateness = %v, want 4 writes at least 40ms late", ok, count, dMax)
+	}
+	if GlobalNormalStats.openLoop.Max < 60*time.Millisecond {
+		t.Errorf("open loop max = %v, want at least 60ms", GlobalNormalStats.openLoop.Max)
+	}
+	if sleep := GlobalNormalStats.Sleep(); sleep != 0 {
+		t.Errorf("open loop writer slept %v", sleep)
+	}
+	backlog, _ := GlobalOpenLoop.Backlog("普通点")
+	if want := (BacklogStats{Released: 4, Max: 2, Sum: 3, Last: 2}); backlog != want {
+		t.Errorf("backlog = %+v, want %+v", backlog, want)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// 周期性写入的节奏(rt_periodic_write, his_periodic_write)
+// 写入周期、过载保护窗口、缓存队列长度和快采点批量写入的断面数量不再是编译期常量:
+// * 通过命令行参数或 --config 指定的配置文件设置, 命令行参数优先, 默认值为原来的常量
+// * 配置文件每行为 参数名=值, 参数名与命令行参数相同(不带--), #开头的行为注释, 其他命令的参数被跳过
+// * 写入前检查参数之间是否矛盾, 统计结果的开头输出本次写入使用的节奏
+
+// PeriodicConfig 周期性写入的节奏
+type PeriodicConfig struct {
+	FastPeriodic     time.Duration // 快采点写入周期
+	NormalPeriodic   time.Duration // 普通点写入周期(历史值也使用该周期)
+	Overload         bool          // 是否开启过载保护
+	OverloadDuration time.Duration // 过载保护持续时间
+	OverloadPeriodic time.Duration // 过载保护写入周期
+	CacheSize        int           // 缓存队列长度
+	FastCacheBatch   int           // 开启快采点缓存时每次批量写入的断面数量
+}
+
+var GlobalPeriodic = &PeriodicConfig{
+	FastPeriodic:     FastRegularWritePeriodic * time.Millisecond,
+	NormalPeriodic:   NormalRegularWritePeriodic * time.Millisecond,
+	OverloadDuration: OverloadProtectionWriteDuration * time.Millisecond,
+	OverloadPeriodic: OverloadProtectionWritePeriodic * time.Millisecond,
+	CacheSize:        CacheSize,
+	FastCacheBatch:   FastCacheBatchSize,
+}
+
+// Validate 检查写入节奏的参数, isRt 为false时不检查快采点的参数
+func (pc *PeriodicConfig) Validate(isRt bool) error {
+	if pc.NormalPeriodic <= 0 {
+		return fmt.Errorf("--normal_periodic 必须大于0: %v", pc.NormalPeriodic)
+	}
+	if pc.CacheSize <= 0 {
+		return fmt.Errorf("--cache_size 必须大于0: %v", pc.CacheSize)
+	}
+	if isRt {
+		if pc.FastPeriodic <= 0 {
+			return fmt.Errorf("--fast_periodic 必须大于0: %v", pc.FastPeriodic)
+		}
+		if pc.FastPeriodic > pc.NormalPeriodic {
+			return fmt.Errorf("快采点写入周期 --fast_periodic(%v) 不能大于普通点写入周期 --normal_periodic(%v)", pc.FastPeriodic, pc.NormalPeriodic)
+		}
+		if pc.FastCacheBatch <= 0 {
+			return fmt.Errorf("--fast_cache_batch 必须大于0: %v", pc.FastCacheBatch)
+		}
+	}
+	if !pc.Overload {
+		return nil
+	}
+	if pc.OverloadDuration <= 0 {
+		return fmt.Errorf("开启过载保护时 --overload_duration 必须大于0: %v", pc.OverloadDuration)
+	}
+	if pc.OverloadPeriodic <= 0 {
+		return fmt.Errorf("开启过载保护时 --overload_periodic 必须大于0: %v", pc.OverloadPeriodic)
+	}
+	if pc.OverloadPeriodic > pc.OverloadDuration {
+		return fmt.Errorf("过载保护写入周期 --overload_periodic(%v) 不能大于过载保护持续时间 --overload_duration(%v)", pc.OverloadPeriodic, pc.OverloadDuration)
+	}
+	if pc.OverloadPeriodic >= pc.NormalPeriodic {
+		return fmt.Errorf("过载保护写入周期 --overload_periodic(%v) 应小于普通点写入周期 --normal_periodic(%v), 否则过载保护不起作用", pc.OverloadPeriodic, pc.NormalPeriodic)
+	}
+	return nil
+}
+
+// Print 在统计结果的开头输出写入节奏, isRt 为false时只输出历史值使用的参数
+func (pc *PeriodicConfig) Print(isRt bool) {
+	overload := "关闭"
+	if pc.Overload {
+		overload = fmt.Sprintf("开启(前%v每%v写入一次)", pc.OverloadDuration, pc.OverloadPeriodic)
+	}
+	if isRt {
+		log.Printf("写入节奏 - 快采点周期: %v, 普通点周期: %v, 过载保护: %v, 缓存队列长度: %v, 快采点批量写入断面数量: %v\n",
+			pc.FastPeriodic, pc.NormalPeriodic, overload, pc.CacheSize, pc.FastCacheBatch)
+	} else {
+		log.Printf("写入节奏 - 写入周期: %v, 过载保护: %v, 缓存队列长度: %v\n", pc.NormalPeriodic, overload, pc.CacheSize)
+	}
+}
+
+// LoadConfigFile 读取配置文件, 把其中的值设置到命令行没有指定的参数上
+func LoadConfigFile(cmd *cobra.Command, path string) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	// 先读完整个文件再设置, 命令行指定的参数不被配置文件覆盖
+	type configValue struct {
+		line       int
+		key, value string
+	}
+	values := make([]configValue, 0)
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return fmt.Errorf("%v:%v: 格式错误, 应为 参数名=值", path, line)
+		}
+		key, value = strings.TrimPrefix(strings.TrimSpace(key), "--"), strings.TrimSpace(value)
+		if key == "config" {
+			return fmt.Errorf("%v:%v: 配置文件中不能指定 config", path, line)
+		}
+		if cmd.Flags().Lookup(key) == nil {
+			// 同一个配置文件可以给多个命令使用, 其他命令的参数跳过
+			if !knownFlag(cmd.Root(), key) {
+				return fmt.Errorf("%v:%v: 未知的参数 %v", path, line, key)
+			}
+			log.Printf("%v:%v: %v 不支持参数 %v, 已跳过\n", path, line, cmd.Name(), key)
+			continue
+		}
+		values = append(values, configValue{line, key, value})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	changed := make(map[string]bool)
+	for _, v := range values {
+		changed[v.key] = cmd.Flags().Changed(v.key)
+	}
+	for _, v := range values {
+		if changed[v.key] {
+			continue
+		}
+		if err := cmd.Flags().Set(v.key, v.value); err != nil {
+			return fmt.Errorf("%v:%v: %v=%v: %v", path, v.line, v.key, v.value, err)
+		}
+	}
+	return nil
+}
+
+// knownFlag 是否有命令支持该参数
+func knownFlag(cmd *cobra.Command, name string) bool {
+	if cmd.Flags().Lookup(name) != nil {
+		return true
+	}
+	for _, sub := range cmd.Commands() {
+		if knownFlag(sub, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestPeriodicConfigValidate(t *testing.T) {
+	ms := time.Millisecond
+	valid := PeriodicConfig{
+		FastPeriodic: 10 * ms, NormalPeriodic: 100 * ms, Overload: true,
+		OverloadDuration: 500 * ms, OverloadPeriodic: 50 * ms, CacheSize: 10, FastCacheBatch: 5,
+	}
+	tests := []struct {
+		name    string
+		change  func(pc *PeriodicConfig)
+		isRt    bool
+		wantErr string
+	}{
+		{name: "valid rt", change: func(pc *PeriodicConfig) {}, isRt: true},
+		{name: "valid his", change: func(pc *PeriodicConfig) {}},
+		{name: "fast equals normal", change: func(pc *PeriodicConfig) { pc.FastPeriodic = pc.NormalPeriodic }, isRt: true},
+		{name: "fast greater than normal", change: func(pc *PeriodicConfig) { pc.FastPeriodic = 200 * ms }, isRt: true, wantErr: "--fast_periodic"},
+		{name: "his ignores fast periodic", change: func(pc *PeriodicConfig) { pc.FastPeriodic = 200 * ms }},
+		{name: "zero fast periodic", change: func(pc *PeriodicConfig) { pc.FastPeriodic = 0 }, isRt: true, wantErr: "--fast_periodic"},
+		{name: "zero fast cache batch", change: func(pc *PeriodicConfig) { pc.FastCacheBatch = 0 }, isRt: true, wantErr: "--fast_cache_batch"},
+		{name: "his ignores fast cache batch", change: func(pc *PeriodicConfig) { pc.FastCacheBatch = 0 }},
+		{name: "zero normal periodic", change: func(pc *PeriodicConfig) { pc.NormalPeriodic = 0 }, wantErr: "--normal_periodic"},
+		{name: "zero cache size", change: func(pc *PeriodicConfig) { pc.CacheSize = 0 }, isRt: true, wantErr: "--cache_size"},
+		{name: "negative cache size", change: func(pc *PeriodicConfig) { pc.CacheSize = -1 }, wantErr: "--cache_size"},
+		{name: "overload periodic equals duration", change: func(pc *PeriodicConfig) { pc.OverloadPeriodic, pc.OverloadDuration = 50*ms, 50*ms }, isRt: true},
+		{name: "overload periodic greater than duration", change: func(pc *PeriodicConfig) { pc.OverloadDuration = 40 * ms }, isRt: true, wantErr: "--overload_duration"},
+		{name: "overload periodic equals normal", change: func(pc *PeriodicConfig) { pc.OverloadPeriodic = pc.NormalPeriodic }, wantErr: "--overload_periodic"},
+		{name: "overload periodic greater than normal", change: func(pc *PeriodicConfig) { pc.OverloadPeriodic = 200 * ms }, isRt: true, wantErr: "--overload_periodic"},
+		{name: "zero overload duration", change: func(pc *PeriodicConfig) { pc.OverloadDuration = 0 }, wantErr: "--overload_duration"},
+		{name: "zero overload periodic", change: func(pc *PeriodicConfig) { pc.OverloadPeriodic = 0 }, wantErr: "--overload_periodic"},
+		{
+			name:   "overload window is not checked without overload protection",
+			change: func(pc *PeriodicConfig) { pc.Overload, pc.OverloadDuration, pc.OverloadPeriodic = false, 0, 200*ms },
+			isRt:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := valid
+			tt.change(&pc)
+			err := pc.Validate(tt.isRt)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate = %v, want error about %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testPeriodicCommands 与 rt_periodic_write, his_periodic_write 相同注册参数的命令
+func testPeriodicCommands() (*cobra.Command, *cobra.Command, *PeriodicOptions, *PeriodicOptions) {
+	root := &cobra.Command{Use: "Rtdb"}
+	rt := &cobra.Command{Use: "rt_periodic_write"}
+	his := &cobra.Command{Use: "his_periodic_write"}
+	rtOpts, hisOpts := &PeriodicOptions{}, &PeriodicOptions{}
+	(&WriteOptions{}).Register(rt, true)
+	rtOpts.Register(rt, true)
+	(&WriteOptions{}).Register(his, false)
+	hisOpts.Register(his, false)
+	root.AddCommand(rt, his)
+	return rt, his, rtOpts, hisOpts
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name    string
+		his     bool
+		args    []string
+		config  string
+		want    func(o *PeriodicOptions) bool
+		wantErr string
+	}{
+		{
+			name:   "file values",
+			config: "# 注释\n\nnormal_periodic=50ms\n--cache_size = 20\noverload_protection=true\n",
+			want: func(o *PeriodicOptions) bool {
+				return o.NormalPeriodic == 50*ms && o.CacheSize == 20 && o.OverloadProtection
+			},
+		},
+		{
+			name:   "command line wins",
+			args:   []string{"--normal_periodic=20ms"},
+			config: "normal_periodic=50ms\ncache_size=20\n",
+			want: func(o *PeriodicOptions) bool {
+				return o.NormalPeriodic == 20*ms && o.CacheSize == 20
+			},
+		},
+		{
+			name:   "command line default value wins",
+			args:   []string{"--cache_size=10"},
+			config: "cache_size=20\n",
+			want:   func(o *PeriodicOptions) bool { return o.CacheSize == 10 },
+		},
+		{
+			name:   "keys of other commands are skipped",
+			his:    true,
+			config: "fast_periodic=5ms\nfast_cache_batch=2\nrt_fast_analog=a.csv\nnormal_periodic=50ms\n",
+			want:   func(o *PeriodicOptions) bool { return o.NormalPeriodic == 50*ms },
+		},
+		{
+			name:    "unknown key",
+			config:  "normal_periodic=50ms\nnormal_period=50ms\n",
+			wantErr: ":2: 未知的参数 normal_period",
+		},
+		{
+			name:    "missing value separator",
+			config:  "normal_periodic 50ms\n",
+			wantErr: ":1: 格式错误",
+		},
+		{
+			name:    "config in config file",
+			config:  "config=other.conf\n",
+			wantErr: ":1: 配置文件中不能指定 config",
+		},
+		{
+			name:    "invalid value",
+			config:  "# 注释\ncache_size=many\n",
+			wantErr: ":2: cache_size=many",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt, his, rtOpts, hisOpts := testPeriodicCommands()
+			cmd, opts := rt, rtOpts
+			if tt.his {
+				cmd, opts = his, hisOpts
+			}
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "periodic.conf")
+			if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := LoadConfigFile(cmd, path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadConfigFile = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfigFile = %v", err)
+			}
+			if !tt.want(opts) {
+				t.Errorf("options = %+v", *opts)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileMissing(t *testing.T) {
+	rt, _, _, _ := testPeriodicCommands()
+	if err := LoadConfigFile(rt, ""); err != nil {
+		t.Errorf("LoadConfigFile without --config = %v, want nil", err)
+	}
+	if err := LoadConfigFile(rt, filepath.Join(t.TempDir(), "missing.conf")); err == nil {
+		t.Errorf("LoadConfigFile with a missing file succeeded")
+	}
+}
@@ -0,0 +1,679 @@
+package main
+
+// #include "write_plugin.h"
+import "C"
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// 插件进程隔离
+// 写数程序启动一个 plugin_host 子进程, 由子进程dlopen插件, 写数程序通过Unix域套接字把断面发送给子进程
+// 插件崩溃(段错误、log.Fatal等)只会导致子进程退出, 写数程序检测到后输出崩溃时正在写入的断面, 然后平滑退出并输出统计结果
+//
+// 帧格式: 4字节小端长度 + 内容
+// 请求内容: 1字节操作码 + 参数, 响应内容: int32返回值 + 错误信息 + 返回数据
+// Analog/Digital 等数组直接按C结构体的内存布局传输, 父子进程是同一个程序, 结构体布局一致
+
+// 操作码
+const (
+	hostOpInfo byte = iota + 1
+	hostOpLogin
+	hostOpLogout
+	hostOpFlush
+	hostOpWriteRtAnalog
+	hostOpWriteRtDigital
+	hostOpWriteRtAnalogList
+	hostOpWriteRtDigitalList
+	hostOpWriteHisAnalog
+	hostOpWriteHisDigital
+	hostOpWriteStaticAnalog
+	hostOpWriteStaticDigital
+	hostOpNopWriteRtAnalog
+)
+
+// HostMaxFrameSize 单帧最大长度
+const HostMaxFrameSize = 1 << 30
+
+// HostStartTimeout 等待插件进程监听套接字的超时时间
+const HostStartTimeout = 10 * time.Second
+
+// HostExitTimeout 连接断开后等待插件进程退出的时间, 超时则认为只是连接出错
+const HostExitTimeout = 1 * time.Second
+
+// HostCloseTimeout 正常关闭时等待插件进程退出的时间, 超时则强制结束插件进程
+const HostCloseTimeout = 5 * time.Second
+
+// HostCaps 插件进程能够转发的能力, 异步写入和读取需要回调, 不支持跨进程
+const HostCaps = PluginCapRealtime | PluginCapListWrite | PluginCapHistory | PluginCapStatic | PluginCapFlush
+
+// ErrHostCrashed 插件进程已经崩溃
+var ErrHostCrashed = errors.New("插件进程已崩溃")
+
+// ErrFrameTooLarge 帧长度超过 HostMaxFrameSize
+var ErrFrameTooLarge = errors.New("帧长度超出限制")
+
+// rawBytes 将C结构体数组按内存布局转换为字节数组(不复制)
+func rawBytes[T any](data []T) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	var zero T
+	return unsafe.Slice((*byte)(unsafe.Pointer(&data[0])), len(data)*int(unsafe.Sizeof(zero)))
+}
+
+// fromRawBytes 将字节数组复制为C结构体数组
+func fromRawBytes[T any](buf []byte) ([]T, error) {
+	var zero T
+	size := int(unsafe.Sizeof(zero))
+	if len(buf)%size != 0 {
+		return nil, fmt.Errorf("数组长度错误: %v, 结构体大小: %v", len(buf), size)
+	}
+	data := make([]T, len(buf)/size)
+	copy(rawBytes(data), buf)
+	return data, nil
+}
+
+// HostEncoder 帧内容编码
+type HostEncoder struct {
+	buf []byte
+}
+
+func (e *HostEncoder) Byte(v byte) *HostEncoder {
+	e.buf = append(e.buf, v)
+	return e
+}
+
+func (e *HostEncoder) Int32(v int32) *HostEncoder {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(v))
+	return e
+}
+
+func (e *HostEncoder) Int64(v int64) *HostEncoder {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(v))
+	return e
+}
+
+func (e *HostEncoder) Bytes(v []byte) *HostEncoder {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(len(v)))
+	e.buf = append(e.buf, v...)
+	return e
+}
+
+func (e *HostEncoder) String(v string) *HostEncoder {
+	return e.Bytes([]byte(v))
+}
+
+// HostDecoder 帧内容解码, 出错后后续读取都返回零值, 最后通过 Err 检查
+type HostDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *HostDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := d.buf[:n]
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *HostDecoder) Byte() byte {
+	if v := d.next(1); v != nil {
+		return v[0]
+	}
+	return 0
+}
+
+func (d *HostDecoder) Int32() int32 {
+	if v := d.next(4); v != nil {
+		return int32(binary.LittleEndian.Uint32(v))
+	}
+	return 0
+}
+
+func (d *HostDecoder) Int64() int64 {
+	if v := d.next(8); v != nil {
+		return int64(binary.LittleEndian.Uint64(v))
+	}
+	return 0
+}
+
+func (d *HostDecoder) Bytes() []byte {
+	if v := d.next(4); v != nil {
+		return d.next(int(binary.LittleEndian.Uint32(v)))
+	}
+	return nil
+}
+
+func (d *HostDecoder) String() string {
+	return string(d.Bytes())
+}
+
+func (d *HostDecoder) Err() error {
+	return d.err
+}
+
+// WriteFrame 写入一帧
+func WriteFrame(w io.Writer, payload []byte) error {
+	buf := make([]byte, 4, 4+len(payload))
+	binary.LittleEndian.PutUint32(buf, uint32(len(payload)))
+	_, err := w.Write(append(buf, payload...))
+	return err
+}
+
+// ReadFrame 读取一帧
+func ReadFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(header)
+	if n > HostMaxFrameSize {
+		return nil, fmt.Errorf("%w: %v", ErrFrameTooLarge, n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// errorString 将error转换为响应中的错误信息, nil为空字符串
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// RunPluginHost 插件进程入口, 加载插件并在Unix域套接字上处理写数程序的请求
+// 标准输入关闭(写数程序退出)时插件进程随之退出
+func RunPluginHost(pluginPath string, socketPath string) error {
+	log.SetPrefix("[plugin_host] ")
+	// 中断信号由写数程序处理, 插件进程在写数程序logout之后退出
+	signal.Ignore(syscall.SIGINT, syscall.SIGTERM)
+	writer, err := NewDylibWriter(pluginPath)
+	if err != nil {
+		return err
+	}
+
+	_ = os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	go func() {
+		// 写数程序在logout之后关闭标准输入, 直接退出, 套接字文件由写数程序删除
+		_, _ = io.Copy(io.Discard, os.Stdin)
+		os.Exit(0)
+	}()
+
+	mu := new(sync.RWMutex)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go ServeHostConn(writer, mu, conn)
+	}
+}
+
+// ServeHostConn 按顺序处理一个连接上的请求, 每个连接同一时刻只有一个请求
+// 不同连接的请求通过 mu 串行调用插件: 写入与进程内加载插件时一样由各个机组并发调用(持有读锁), login/logout/flush等其他调用独占插件
+// 请求内容格式错误时返回错误响应, 帧已经完整读取, 连接继续使用; 帧长度超出限制时返回错误响应后关闭连接
+func ServeHostConn(writer *DylibWriter, mu *sync.RWMutex, conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		req, err := ReadFrame(r)
+		if err != nil {
+			if errors.Is(err, ErrFrameTooLarge) {
+				log.Println("处理请求失败: ", err)
+				_ = WriteFrame(conn, hostErrorResponse(err))
+			}
+			return
+		}
+		var resp []byte
+		if len(req) != 0 && isHostWriteOp(req[0]) {
+			mu.RLock()
+			resp, err = HandleHostRequest(writer, req)
+			mu.RUnlock()
+		} else {
+			mu.Lock()
+			resp, err = HandleHostRequest(writer, req)
+			mu.Unlock()
+		}
+		if err != nil {
+			log.Println("处理请求失败: ", err)
+			resp = hostErrorResponse(err)
+		}
+		if err := WriteFrame(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// isHostWriteOp 是否为写入请求, 写入请求可以由多个机组并发调用插件
+func isHostWriteOp(op byte) bool {
+	return op >= hostOpWriteRtAnalog && op <= hostOpNopWriteRtAnalog
+}
+
+// hostErrorResponse 请求无法处理时的响应, 返回值为-1
+func hostErrorResponse(err error) []byte {
+	return (&HostEncoder{}).Int32(-1).String(errorString(err)).buf
+}
+
+// HandleHostRequest 解析请求并调用插件, 返回响应内容
+func HandleHostRequest(writer *DylibWriter, req []byte) ([]byte, error) {
+	d := &HostDecoder{buf: req}
+	op := d.Byte()
+	rtn := int32(0)
+	var callErr error
+	extra := &HostEncoder{}
+
+	switch op {
+	case hostOpInfo:
+		info := writer.Info()
+		declared := byte(0)
+		if info.Declared {
+			declared = 1
+		}
+		extra.Int32(info.ABIVersion).String(info.Vendor).String(info.Version).Int64(int64(info.Capabilities)).Byte(declared)
+	case hostOpLogin:
+		param := d.String()
+		if d.Err() == nil {
+			rtn = int32(writer.Login(param))
+		}
+	case hostOpLogout:
+		writer.Logout()
+	case hostOpFlush:
+		callErr = writer.Flush()
+	case hostOpWriteRtAnalog, hostOpWriteRtDigital, hostOpWriteHisAnalog, hostOpWriteHisDigital, hostOpNopWriteRtAnalog:
+		magic, unitId, t, isFast := d.Int32(), d.Int64(), d.Int64(), d.Byte() == 1
+		raw := d.Bytes()
+		if d.Err() != nil {
+			break
+		}
+		switch op {
+		case hostOpWriteRtAnalog, hostOpWriteHisAnalog, hostOpNopWriteRtAnalog:
+			data, err := fromRawBytes[C.Analog](raw)
+			if err != nil {
+				return nil, err
+			}
+			switch op {
+			case hostOpWriteRtAnalog:
+				callErr = writer.WriteRtAnalog(magic, unitId, AnalogSection{Time: t, Data: data}, isFast)
+			case hostOpWriteHisAnalog:
+				callErr = writer.WriteHisAnalog(magic, unitId, AnalogSection{Time: t, Data: data})
+			default:
+				// 写数程序已经完成了GlobalID初始化, 插件进程只进行cgo调用和函数表分发
+				writer.NopCall(AnalogSection{Time: t, Data: data})
+			}
+		default:
+			data, err := fromRawBytes[C.Digital](raw)
+			if err != nil {
+				return nil, err
+			}
+			if op == hostOpWriteRtDigital {
+				callErr = writer.WriteRtDigital(magic, unitId, DigitalSection{Time: t, Data: data}, isFast)
+			} else {
+				callErr = writer.WriteHisDigital(magic, unitId, DigitalSection{Time: t, Data: data})
+			}
+		}
+	case hostOpWriteRtAnalogList, hostOpWriteRtDigitalList:
+		magic, unitId, count := d.Int32(), d.Int64(), d.Int64()
+		analogSections := make([]AnalogSection, 0)
+		digitalSections := make([]DigitalSection, 0)
+		for i := int64(0); i < count && d.Err() == nil; i++ {
+			t, raw := d.Int64(), d.Bytes()
+			if op == hostOpWriteRtAnalogList {
+				data, err := fromRawBytes[C.Analog](raw)
+				if err != nil {
+					return nil, err
+				}
+				analogSections = append(analogSections, AnalogSection{Time: t, Data: data})
+			} else {
+				data, err := fromRawBytes[C.Digital](raw)
+				if err != nil {
+					return nil, err
+				}
+				digitalSections = append(digitalSections, DigitalSection{Time: t, Data: data})
+			}
+		}
+		if d.Err() != nil {
+			break
+		}
+		if op == hostOpWriteRtAnalogList {
+			callErr = writer.WriteRtAnalogList(magic, unitId, analogSections)
+		} else {
+			callErr = writer.WriteRtDigitalList(magic, unitId, digitalSections)
+		}
+	case hostOpWriteStaticAnalog, hostOpWriteStaticDigital:
+		magic, unitId, typ := d.Int32(), d.Int64(), d.Int64()
+		raw := d.Bytes()
+		if d.Err() != nil {
+			break
+		}
+		if op == hostOpWriteStaticAnalog {
+			data, err := fromRawBytes[C.StaticAnalog](raw)
+			if err != nil {
+				return nil, err
+			}
+			callErr = writer.WriteStaticAnalog(magic, unitId, StaticAnalogSection{Data: data}, typ)
+		} else {
+			data, err := fromRawBytes[C.StaticDigital](raw)
+			if err != nil {
+				return nil, err
+			}
+			callErr = writer.WriteStaticDigital(magic, unitId, StaticDigitalSection{Data: data}, typ)
+		}
+	default:
+		return nil, fmt.Errorf("未知的操作码: %v", op)
+	}
+	if d.Err() != nil {
+		return nil, fmt.Errorf("请求格式错误, 操作码: %v, error: %v", op, d.Err())
+	}
+
+	resp := &HostEncoder{}
+	resp.Int32(rtn).String(errorString(callErr))
+	resp.buf = append(resp.buf, extra.buf...)
+	return resp.buf, nil
+}
+
+// HostWriter 在独立的插件进程(plugin_host)中加载插件, 通过Unix域套接字转发写入请求
+// 插件进程崩溃后, 正在进行的调用会输出崩溃时写入的断面, 之后的调用直接返回 ErrHostCrashed
+type HostWriter struct {
+	socketPath string
+	cmd        *exec.Cmd
+	stdin      io.WriteCloser
+	exited     chan struct{} // 插件进程退出后关闭
+	conns      chan net.Conn // 空闲连接, 每个并发调用占用一个连接
+	started    atomic.Bool   // 为true表示插件进程已经完成启动
+	closing    atomic.Bool   // 为true表示正常退出插件进程
+	crashed    atomic.Bool   // 为true表示插件进程已崩溃
+	state      *os.ProcessState
+	info       PluginInfo
+}
+
+var _ Writer = (*HostWriter)(nil)
+var _ NopWriter = (*HostWriter)(nil)
+
+// NewHostWriter 启动插件进程并等待插件加载完成
+func NewHostWriter(path string) (*HostWriter, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	hw := &HostWriter{
+		socketPath: filepath.Join(os.TempDir(), fmt.Sprintf("rtdb_writer_%v.sock", os.Getpid())),
+		exited:     make(chan struct{}),
+		conns:      make(chan net.Conn, 1024),
+	}
+	hw.cmd = exec.Command(exe, "plugin_host", "--plugin", path, "--socket", hw.socketPath)
+	hw.cmd.Stdout = os.Stdout
+	hw.cmd.Stderr = os.Stderr
+	if hw.stdin, err = hw.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if err := hw.cmd.Start(); err != nil {
+		return nil, err
+	}
+	go hw.wait()
+
+	// 等待插件进程加载插件并监听套接字
+	deadline := time.Now().Add(HostStartTimeout)
+	for {
+		conn, err := net.Dial("unix", hw.socketPath)
+		if err == nil {
+			hw.conns <- conn
+			break
+		}
+		select {
+		case <-hw.exited:
+			return nil, fmt.Errorf("插件进程启动失败: %v", hw.state)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			hw.Close()
+			return nil, fmt.Errorf("等待插件进程启动超时: %v", err)
+		}
+	}
+
+	_, resp, err := hw.call((&HostEncoder{}).Byte(hostOpInfo), "plugin_info", -1, -1)
+	if err != nil {
+		hw.Close()
+		return nil, err
+	}
+	hw.info = PluginInfo{
+		ABIVersion:   resp.Int32(),
+		Vendor:       resp.String(),
+		Version:      resp.String(),
+		Capabilities: uint64(resp.Int64()),
+		Declared:     resp.Byte() == 1,
+	}
+	if err := resp.Err(); err != nil {
+		hw.Close()
+		return nil, fmt.Errorf("插件信息格式错误: %v", err)
+	}
+	if dropped := hw.info.Capabilities &^ HostCaps; dropped != 0 {
+		log.Println("插件进程隔离模式不支持的能力: ", CapNames(dropped))
+		hw.info.Capabilities &= HostCaps
+	}
+	hw.started.Store(true)
+	return hw, nil
+}
+
+// wait 等待插件进程退出, 启动完成后非正常退出时输出崩溃信息并触发平滑退出
+func (hw *HostWriter) wait() {
+	_ = hw.cmd.Wait()
+	hw.state = hw.cmd.ProcessState
+	close(hw.exited)
+	_ = os.Remove(hw.socketPath)
+	if hw.closing.Load() || !hw.started.Load() {
+		return
+	}
+	hw.crashed.Store(true)
+	log.Println("插件进程崩溃: ", hw.state)
+	Abort("插件进程崩溃")
+}
+
+// conn 获取一个空闲连接, 没有空闲连接时新建连接
+func (hw *HostWriter) conn() (net.Conn, error) {
+	select {
+	case conn := <-hw.conns:
+		return conn, nil
+	default:
+		return net.Dial("unix", hw.socketPath)
+	}
+}
+
+// release 归还连接, 空闲连接过多时直接关闭
+func (hw *HostWriter) release(conn net.Conn) {
+	select {
+	case hw.conns <- conn:
+	default:
+		_ = conn.Close()
+	}
+}
+
+// call 发送请求并等待响应, name/unitId/sectionTime 用于输出崩溃时正在写入的断面
+// 返回插件函数的返回值和剩余的响应数据
+func (hw *HostWriter) call(req *HostEncoder, name string, unitId int64, sectionTime int64) (int32, *HostDecoder, error) {
+	if hw.crashed.Load() {
+		return -1, nil, fmt.Errorf("%v failed, unit_id: %v, time: %v, %w", name, unitId, sectionTime, ErrHostCrashed)
+	}
+	conn, err := hw.conn()
+	if err == nil {
+		err = WriteFrame(conn, req.buf)
+	}
+	var payload []byte
+	if err == nil {
+		payload, err = ReadFrame(conn)
+	}
+	if err != nil {
+		if conn != nil {
+			_ = conn.Close()
+		}
+		return -1, nil, hw.connError(err, name, unitId, sectionTime)
+	}
+	hw.release(conn)
+
+	resp := &HostDecoder{buf: payload}
+	rtn, msg := resp.Int32(), resp.String()
+	if err := resp.Err(); err != nil {
+		return -1, nil, fmt.Errorf("%v 响应格式错误: %v", name, err)
+	}
+	if msg != "" {
+		return rtn, resp, errors.New(msg)
+	}
+	return rtn, resp, nil
+}
+
+// connError 连接出错时判断插件进程是否已经退出, 退出则输出崩溃时正在调用的函数和断面
+func (hw *HostWriter) connError(err error, name string, unitId int64, sectionTime int64) error {
+	select {
+	case <-hw.exited:
+	case <-time.After(HostExitTimeout):
+		return fmt.Errorf("%v 调用插件进程失败, unit_id: %v, time: %v, error: %v", name, unitId, sectionTime, err)
+	}
+	if hw.closing.Load() {
+		return fmt.Errorf("%v 调用插件进程失败, 插件进程已退出: %v", name, hw.state)
+	}
+	hw.crashed.Store(true)
+	log.Printf("插件进程崩溃时正在调用: %v, unit_id: %v, 断面时间: %v\n", name, unitId, sectionTime)
+	return fmt.Errorf("%v failed, unit_id: %v, time: %v, %v: %v", name, unitId, sectionTime, ErrHostCrashed, hw.state)
+}
+
+// Close 正常关闭插件进程
+func (hw *HostWriter) Close() {
+	hw.closing.Store(true)
+	for {
+		select {
+		case conn := <-hw.conns:
+			_ = conn.Close()
+			continue
+		default:
+		}
+		break
+	}
+	_ = hw.stdin.Close()
+	select {
+	case <-hw.exited:
+	case <-time.After(HostCloseTimeout):
+		log.Printf("等待插件进程退出超时(%v), 强制结束插件进程\n", HostCloseTimeout)
+		_ = hw.cmd.Process.Kill()
+		<-hw.exited
+	}
+}
+
+func (hw *HostWriter) Info() PluginInfo {
+	return hw.info
+}
+
+func (hw *HostWriter) Login(param string) int {
+	rtn, _, err := hw.call((&HostEncoder{}).Byte(hostOpLogin).String(param), "login", -1, -1)
+	if err != nil {
+		log.Println("登陆失败: ", err)
+		return -1
+	}
+	return int(rtn)
+}
+
+// Logout 插件进程崩溃时跳过logout, 之后关闭插件进程
+func (hw *HostWriter) Logout() {
+	if _, _, err := hw.call((&HostEncoder{}).Byte(hostOpLogout), "logout", -1, -1); err != nil {
+		log.Println("logout失败: ", err)
+	}
+	hw.Close()
+}
+
+func (hw *HostWriter) Flush() error {
+	_, _, err := hw.call((&HostEncoder{}).Byte(hostOpFlush), "flush", -1, -1)
+	return err
+}
+
+// NopWriteRtAnalog 在写数程序中完成GlobalID初始化, 把断面发送给插件进程, 插件进程不调用插件的写入函数
+func (hw *HostWriter) NopWriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool) error {
+	section = InitAnalogGlobalID(magic, unitId, isFast, true, section)
+	_, _, err := hw.call(encodeSection(hostOpNopWriteRtAnalog, magic, unitId, section.Time, isFast, rawBytes(section.Data)), "nop_write_rt_analog", unitId, section.Time)
+	return err
+}
+
+// encodeSection 编码单个断面的写入请求
+func encodeSection(op byte, magic int32, unitId int64, t int64, isFast bool, raw []byte) *HostEncoder {
+	fast := byte(0)
+	if isFast {
+		fast = 1
+	}
+	return (&HostEncoder{}).Byte(op).Int32(magic).Int64(unitId).Int64(t).Byte(fast).Bytes(raw)
+}
+
+func (hw *HostWriter) WriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool) error {
+	_, _, err := hw.call(encodeSection(hostOpWriteRtAnalog, magic, unitId, section.Time, isFast, rawBytes(section.Data)), "write_rt_analog", unitId, section.Time)
+	return err
+}
+
+func (hw *HostWriter) WriteRtDigital(magic int32, unitId int64, section DigitalSection, isFast bool) error {
+	_, _, err := hw.call(encodeSection(hostOpWriteRtDigital, magic, unitId, section.Time, isFast, rawBytes(section.Data)), "write_rt_digital", unitId, section.Time)
+	return err
+}
+
+func (hw *HostWriter) WriteRtAnalogList(magic int32, unitId int64, sections []AnalogSection) error {
+	req := (&HostEncoder{}).Byte(hostOpWriteRtAnalogList).Int32(magic).Int64(unitId).Int64(int64(len(sections)))
+	for i := range sections {
+		req.Int64(sections[i].Time).Bytes(rawBytes(sections[i].Data))
+	}
+	_, _, err := hw.call(req, "write_rt_analog_list", unitId, sections[0].Time)
+	return err
+}
+
+func (hw *HostWriter) WriteRtDigitalList(magic int32, unitId int64, sections []DigitalSection) error {
+	req := (&HostEncoder{}).Byte(hostOpWriteRtDigitalList).Int32(magic).Int64(unitId).Int64(int64(len(sections)))
+	for i := range sections {
+		req.Int64(sections[i].Time).Bytes(rawBytes(sections[i].Data))
+	}
+	_, _, err := hw.call(req, "write_rt_digital_list", unitId, sections[0].Time)
+	return err
+}
+
+func (hw *HostWriter) WriteHisAnalog(magic int32, unitId int64, section AnalogSection) error {
+	_, _, err := hw.call(encodeSection(hostOpWriteHisAnalog, magic, unitId, section.Time, false, rawBytes(section.Data)), "write_his_analog", unitId, section.Time)
+	return err
+}
+
+func (hw *HostWriter) WriteHisDigital(magic int32, unitId int64, section DigitalSection) error {
+	_, _, err := hw.call(encodeSection(hostOpWriteHisDigital, magic, unitId, section.Time, false, rawBytes(section.Data)), "write_his_digital", unitId, section.Time)
+	return err
+}
+
+func (hw *HostWriter) WriteStaticAnalog(magic int32, unitId int64, section StaticAnalogSection, typ int64) error {
+	req := (&HostEncoder{}).Byte(hostOpWriteStaticAnalog).Int32(magic).Int64(unitId).Int64(typ).Bytes(rawBytes(section.Data))
+	_, _, err := hw.call(req, "write_static_analog", unitId, -1)
+	return err
+}
+
+func (hw *HostWriter) WriteStaticDigital(magic int32, unitId int64, section StaticDigitalSection, typ int64) error {
+	req := (&HostEncoder{}).Byte(hostOpWriteStaticDigital).Int32(magic).Int64(unitId).Int64(typ).Bytes(rawBytes(section.Data))
+	_, _, err := hw.call(req, "write_static_digital", unitId, -1)
+	return err
+}
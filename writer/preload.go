@@ -0,0 +1,171 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// 读取缓存的预加载与就绪屏障
+// 写入开始前不再固定睡眠2秒等待读取协程加载缓存:
+// * 流式读取(默认): 缓存队列中的断面数量达到 Ready(或读取结束)后立即开始写入
+// * 预加载(--preload): 写入开始前把整个数据集(或前 Window 个断面)读入内存, 写入过程中不会等待读取
+// 写入过程中缓存队列为空、写入协程等待读取协程的时间统计为读取饥饿时间
+
+// PreloadCollector 预加载配置, 以及就绪等待时间和读取饥饿时间的统计
+type PreloadCollector struct {
+	Enabled bool  // 为true时写入开始前预加载断面
+	Window  int64 // 预加载的断面数量, 为0时预加载整个数据集
+	Ready   int   // 流式读取时缓存多少个断面后开始写入, 为0或超过缓存队列长度时以队列长度为准
+
+	mu        sync.Mutex
+	waits     map[string]time.Duration // 写入开始前的等待时间(预加载或就绪屏障)
+	loaded    map[string]int64         // 写入开始前已缓存的断面数量
+	sections  map[string]int64         // 写入协程读取的断面数量
+	starved   map[string]int64         // 队列为空需要等待的次数
+	starveDur map[string]time.Duration // 读取饥饿时间
+}
+
+var GlobalPreload = &PreloadCollector{}
+
+// PreloadNames 统计结果的输出顺序
+var PreloadNames = []string{"快采点", "普通点"}
+
+// SectionName 断面类型的名称, 历史断面统计为普通点
+func SectionName(isFast bool) string {
+	if isFast {
+		return "快采点"
+	}
+	return "普通点"
+}
+
+// WaitGroupDone 返回一个在 wg 结束时关闭的通道
+func WaitGroupDone(wg *sync.WaitGroup) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// Prepare 写入开始前准备缓存队列, 预加载模式返回预加载后的队列, 否则等待就绪屏障后返回原队列
+// readDone 在所有读取协程结束时关闭
+func (pc *PreloadCollector) Prepare(name string, ch chan Section, readDone chan struct{}) chan Section {
+	if pc.Enabled {
+		return pc.preload(name, ch)
+	}
+	pc.waitReady(name, ch, readDone)
+	return ch
+}
+
+// preload 读取断面直到读取结束或达到 Window, 剩余的断面继续流式读取
+func (pc *PreloadCollector) preload(name string, ch chan Section) chan Section {
+	t := time.Now()
+	sections := make([]Section, 0)
+	closed := false
+	for pc.Window <= 0 || int64(len(sections)) < pc.Window {
+		section, ok := <-ch
+		if !ok {
+			closed = true
+			break
+		}
+		sections = append(sections, section)
+	}
+
+	out := make(chan Section, len(sections)+GlobalPeriodic.CacheSize)
+	pNumCount := 0
+	for _, section := range sections {
+		pNumCount += len(section.analog.Data) + len(section.digital.Data)
+		out <- section
+	}
+	if closed {
+		close(out)
+	} else {
+		go func() {
+			for section := range ch {
+				out <- section
+			}
+			close(out)
+		}()
+	}
+	pc.ready(name, t, int64(len(sections)))
+	log.Printf("预加载 - %v: 断面数量: %v, PNUM数量: %v, 读取结束: %v, 耗时: %v\n", name, len(sections), pNumCount, closed, time.Since(t))
+	return out
+}
+
+// waitReady 就绪屏障, 缓存队列中的断面数量达到 Ready 后返回, 读取结束或中止写入时也会返回
+func (pc *PreloadCollector) waitReady(name string, ch chan Section, readDone chan struct{}) {
+	t := time.Now()
+	ready := pc.Ready
+	if ready <= 0 || ready > cap(ch) {
+		ready = cap(ch)
+	}
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for len(ch) < ready {
+		select {
+		case <-readDone:
+			ready = 0
+		case <-AbortCh:
+			ready = 0
+		case <-ticker.C:
+		}
+	}
+	pc.ready(name, t, int64(len(ch)))
+}
+
+func (pc *PreloadCollector) ready(name string, start time.Time, loaded int64) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.waits == nil {
+		pc.waits = make(map[string]time.Duration)
+		pc.loaded = make(map[string]int64)
+	}
+	pc.waits[name] += time.Since(start)
+	pc.loaded[name] += loaded
+}
+
+// Recv 写入协程读取一个断面时调用, waitStart 为开始等待的时间, starved 表示开始等待时缓存队列为空
+func (pc *PreloadCollector) Recv(name string, waitStart time.Time, starved bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.sections == nil {
+		pc.sections = make(map[string]int64)
+		pc.starved = make(map[string]int64)
+		pc.starveDur = make(map[string]time.Duration)
+	}
+	pc.sections[name]++
+	if starved {
+		pc.starved[name]++
+		pc.starveDur[name] += time.Since(waitStart)
+	}
+}
+
+// RecvSection 从缓存队列读取一个断面并统计读取饥饿时间
+func (pc *PreloadCollector) RecvSection(name string, ch chan Section) (Section, bool) {
+	t := time.Now()
+	starved := len(ch) == 0
+	section, ok := <-ch
+	if ok {
+		pc.Recv(name, t, starved)
+	}
+	return section, ok
+}
+
+// Print 输出就绪等待时间和读取饥饿时间
+func (pc *PreloadCollector) Print() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	mode := "流式读取"
+	if pc.Enabled {
+		mode = "预加载"
+	}
+	for _, name := range PreloadNames {
+		if _, ok := pc.waits[name]; !ok {
+			continue
+		}
+		log.Printf("%v - %v: 写入前等待时间: %v, 写入前缓存断面数量: %v\n", mode, name, pc.waits[name], pc.loaded[name])
+		log.Printf("读取饥饿 - %v: 读取断面数量: %v, 等待读取的次数: %v, 读取饥饿时间: %v\n", name, pc.sections[name], pc.starved[name], pc.starveDur[name])
+	}
+}
@@ -0,0 +1,707 @@
+package main
+
+// #include "write_plugin.h"
+import "C"
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// 录制与回放
+// 写入命令通过 --record 把每次插件调用写入录制文件, replay 命令把录制文件中的调用按原来的顺序发送给另一个插件
+// 录制的数据是插件实际收到的数据(已经完成随机浮动和GlobalID初始化), 回放时直接调用 Writer, 不再经过 WritePlugin
+//
+// 文件格式:
+// 文件头: 8字节魔数 RecordFileMagic + uint32版本 + Analog/Digital/StaticAnalog/StaticDigital 的结构体大小(各uint32)
+// 记录:   uint32内容长度 + uint32内容的CRC32校验值 + 内容
+// 内容:   操作码(同步写入与插件进程相同, 异步写入见 recordOpWriteRtAnalogAsync) + 调用开始时间(相对录制开始, 纳秒) + 调用耗时
+//         + magic + unit_id + is_fast + type + 是否失败 + login参数 + 断面数量 + 每个断面的(时间 + 原始数组)
+
+// RecordFileMagic 录制文件魔数
+const RecordFileMagic = "RTDBREC\x00"
+
+// RecordFileVersion 录制文件版本
+// * 1: 异步写入按对应的同步写入记录
+// * 2: 异步写入使用单独的操作码, 记录的是提交时间、提交耗时和提交结果
+const RecordFileVersion = 2
+
+// 异步写入的操作码, 只在录制文件中使用, 不与插件进程的操作码重复
+const (
+	recordOpWriteRtAnalogAsync byte = iota + 0x80
+	recordOpWriteRtDigitalAsync
+	recordOpWriteHisAnalogAsync
+	recordOpWriteHisDigitalAsync
+)
+
+// RecordOpNames 录制文件中的操作码名称
+var RecordOpNames = map[byte]string{
+	hostOpLogin:              "login",
+	hostOpLogout:             "logout",
+	hostOpFlush:              "flush",
+	hostOpWriteRtAnalog:      "write_rt_analog",
+	hostOpWriteRtDigital:     "write_rt_digital",
+	hostOpWriteRtAnalogList:  "write_rt_analog_list",
+	hostOpWriteRtDigitalList: "write_rt_digital_list",
+	hostOpWriteHisAnalog:     "write_his_analog",
+	hostOpWriteHisDigital:    "write_his_digital",
+	hostOpWriteStaticAnalog:  "write_static_analog",
+	hostOpWriteStaticDigital: "write_static_digital",
+
+	recordOpWriteRtAnalogAsync:   "write_rt_analog_async",
+	recordOpWriteRtDigitalAsync:  "write_rt_digital_async",
+	recordOpWriteHisAnalogAsync:  "write_his_analog_async",
+	recordOpWriteHisDigitalAsync: "write_his_digital_async",
+}
+
+// RecordOpCaps 回放时每个操作码需要的插件能力
+var RecordOpCaps = map[byte]uint64{
+	hostOpWriteRtAnalog:      PluginCapRealtime,
+	hostOpWriteRtDigital:     PluginCapRealtime,
+	hostOpWriteRtAnalogList:  PluginCapListWrite,
+	hostOpWriteRtDigitalList: PluginCapListWrite,
+	hostOpWriteHisAnalog:     PluginCapHistory,
+	hostOpWriteHisDigital:    PluginCapHistory,
+	hostOpWriteStaticAnalog:  PluginCapStatic,
+	hostOpWriteStaticDigital: PluginCapStatic,
+
+	recordOpWriteRtAnalogAsync:   PluginCapRealtime | PluginCapAsync,
+	recordOpWriteRtDigitalAsync:  PluginCapRealtime | PluginCapAsync,
+	recordOpWriteHisAnalogAsync:  PluginCapHistory | PluginCapAsync,
+	recordOpWriteHisDigitalAsync: PluginCapHistory | PluginCapAsync,
+}
+
+// recordStructSizes 文件头中的结构体大小, 回放时校验与当前程序一致
+func recordStructSizes() []uint32 {
+	return []uint32{
+		uint32(unsafe.Sizeof(C.Analog{})),
+		uint32(unsafe.Sizeof(C.Digital{})),
+		uint32(unsafe.Sizeof(C.StaticAnalog{})),
+		uint32(unsafe.Sizeof(C.StaticDigital{})),
+	}
+}
+
+// RecordEntry 录制文件中的一条记录
+type RecordEntry struct {
+	Op       byte
+	Offset   time.Duration // 调用开始时间, 相对录制开始
+	Duration time.Duration // 录制时的调用耗时
+	Magic    int32
+	UnitId   int64
+	IsFast   bool
+	Type     int64
+	Failed   bool // 录制时调用是否失败
+	Param    string
+	Times    []int64
+	Raw      [][]byte
+}
+
+// Name 操作码名称
+func (e RecordEntry) Name() string {
+	if name, ok := RecordOpNames[e.Op]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%v)", e.Op)
+}
+
+// RecordWriter 录制包装器, 把每次调用转发给被包装的 Writer, 并把调用写入录制文件
+type RecordWriter struct {
+	writer Writer
+	path   string
+	start  time.Time
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	count  int64
+	err    error // 第一次写录制文件失败的错误, 之后不再录制
+}
+
+var _ Writer = (*RecordWriter)(nil)
+var _ AsyncWriter = (*RecordWriter)(nil)
+
+// NewRecordWriter 创建录制文件并写入文件头
+func NewRecordWriter(writer Writer, path string) (*RecordWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	rw := &RecordWriter{
+		writer: writer,
+		path:   path,
+		start:  time.Now(),
+		file:   file,
+		w:      bufio.NewWriterSize(file, 1<<20),
+	}
+	header := []byte(RecordFileMagic)
+	header = binary.LittleEndian.AppendUint32(header, RecordFileVersion)
+	for _, size := range recordStructSizes() {
+		header = binary.LittleEndian.AppendUint32(header, size)
+	}
+	if _, err := rw.w.Write(header); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return rw, nil
+}
+
+// RecordGlobalPlugin 为全局插件开启录制, path为空时不录制
+func RecordGlobalPlugin(path string) error {
+	if path == "" {
+		return nil
+	}
+	recorder, err := NewRecordWriter(GlobalPlugin.Writer(), path)
+	if err != nil {
+		return err
+	}
+	GlobalPlugin = NewWritePlugin(recorder)
+	log.Println("录制插件调用: ", path)
+	return nil
+}
+
+// record 写入一条记录, sections 编码断面数量和断面内容
+func (rw *RecordWriter) record(op byte, start time.Time, magic int32, unitId int64, isFast bool, typ int64, param string, callErr error, sections func(e *HostEncoder)) {
+	duration := time.Since(start)
+	fast := byte(0)
+	if isFast {
+		fast = 1
+	}
+	failed := int32(0)
+	if callErr != nil {
+		failed = 1
+	}
+	e := &HostEncoder{}
+	e.Byte(op).Int64(int64(start.Sub(rw.start))).Int64(int64(duration)).Int32(magic).Int64(unitId).Byte(fast).Int64(typ).Int32(failed).String(param)
+	if sections == nil {
+		e.Int64(0)
+	} else {
+		sections(e)
+	}
+
+	frame := make([]byte, 8, 8+len(e.buf))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(e.buf)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(e.buf))
+	frame = append(frame, e.buf...)
+
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.err != nil || rw.file == nil {
+		return
+	}
+	if _, err := rw.w.Write(frame); err != nil {
+		rw.err = err
+		log.Println("写入录制文件失败, 停止录制: ", err)
+		return
+	}
+	rw.count++
+}
+
+// analogSections 编码模拟量断面
+func analogSections(sections ...AnalogSection) func(e *HostEncoder) {
+	return func(e *HostEncoder) {
+		e.Int64(int64(len(sections)))
+		for i := range sections {
+			e.Int64(sections[i].Time).Bytes(rawBytes(sections[i].Data))
+		}
+	}
+}
+
+// digitalSections 编码数字量断面
+func digitalSections(sections ...DigitalSection) func(e *HostEncoder) {
+	return func(e *HostEncoder) {
+		e.Int64(int64(len(sections)))
+		for i := range sections {
+			e.Int64(sections[i].Time).Bytes(rawBytes(sections[i].Data))
+		}
+	}
+}
+
+// Close 写入缓存并关闭录制文件
+func (rw *RecordWriter) Close() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.file == nil {
+		return
+	}
+	if err := rw.w.Flush(); err != nil && rw.err == nil {
+		rw.err = err
+	}
+	if err := rw.file.Close(); err != nil && rw.err == nil {
+		rw.err = err
+	}
+	rw.file = nil
+	if rw.err != nil {
+		log.Printf("录制文件不完整: %v, 记录数量: %v, error: %v\n", rw.path, rw.count, rw.err)
+		return
+	}
+	log.Printf("录制完成: %v, 记录数量: %v\n", rw.path, rw.count)
+}
+
+func (rw *RecordWriter) Info() PluginInfo {
+	return rw.writer.Info()
+}
+
+func (rw *RecordWriter) Login(param string) int {
+	start := time.Now()
+	rtn := rw.writer.Login(param)
+	var err error
+	if rtn != 0 {
+		err = fmt.Errorf("login failed: %v", rtn)
+	}
+	rw.record(hostOpLogin, start, 0, -1, false, 0, param, err, nil)
+	return rtn
+}
+
+// Logout 录制logout之后关闭录制文件
+func (rw *RecordWriter) Logout() {
+	start := time.Now()
+	rw.writer.Logout()
+	rw.record(hostOpLogout, start, 0, -1, false, 0, "", nil, nil)
+	rw.Close()
+}
+
+func (rw *RecordWriter) Flush() error {
+	start := time.Now()
+	err := rw.writer.Flush()
+	rw.record(hostOpFlush, start, 0, -1, false, 0, "", err, nil)
+	return err
+}
+
+func (rw *RecordWriter) WriteRtAnalog(magic int32, unitId int64, section AnalogSection, isFast bool) error {
+	start := time.Now()
+	err := rw.writer.WriteRtAnalog(magic, unitId, section, isFast)
+	rw.record(hostOpWriteRtAnalog, start, magic, unitId, isFast, 0, "", err, analogSections(section))
+	return err
+}
+
+func (rw *RecordWriter) WriteRtDigital(magic int32, unitId int64, section DigitalSection, isFast bool) error {
+	start := time.Now()
+	err := rw.writer.WriteRtDigital(magic, unitId, section, isFast)
+	rw.record(hostOpWriteRtDigital, start, magic, unitId, isFast, 0, "", err, digitalSections(section))
+	return err
+}
+
+func (rw *RecordWriter) WriteRtAnalogList(magic int32, unitId int64, sections []AnalogSection) error {
+	start := time.Now()
+	err := rw.writer.WriteRtAnalogList(magic, unitId, sections)
+	rw.record(hostOpWriteRtAnalogList, start, magic, unitId, true, 0, "", err, analogSections(sections...))
+	return err
+}
+
+func (rw *RecordWriter) WriteRtDigitalList(magic int32, unitId int64, sections []DigitalSection) error {
+	start := time.Now()
+	err := rw.writer.WriteRtDigitalList(magic, unitId, sections)
+	rw.record(hostOpWriteRtDigitalList, start, magic, unitId, true, 0, "", err, digitalSections(sections...))
+	return err
+}
+
+func (rw *RecordWriter) WriteHisAnalog(magic int32, unitId int64, section AnalogSection) error {
+	start := time.Now()
+	err := rw.writer.WriteHisAnalog(magic, unitId, section)
+	rw.record(hostOpWriteHisAnalog, start, magic, unitId, false, 0, "", err, analogSections(section))
+	return err
+}
+
+func (rw *RecordWriter) WriteHisDigital(magic int32, unitId int64, section DigitalSection) error {
+	start := time.Now()
+	err := rw.writer.WriteHisDigital(magic, unitId, section)
+	rw.record(hostOpWriteHisDigital, start, magic, unitId, false, 0, "", err, digitalSections(section))
+	return err
+}
+
+func (rw *RecordWriter) WriteStaticAnalog(magic int32, unitId int64, section StaticAnalogSection, typ int64) error {
+	start := time.Now()
+	err := rw.writer.WriteStaticAnalog(magic, unitId, section, typ)
+	rw.record(hostOpWriteStaticAnalog, start, magic, unitId, false, typ, "", err, func(e *HostEncoder) {
+		e.Int64(1).Int64(-1).Bytes(rawBytes(section.Data))
+	})
+	return err
+}
+
+func (rw *RecordWriter) WriteStaticDigital(magic int32, unitId int64, section StaticDigitalSection, typ int64) error {
+	start := time.Now()
+	err := rw.writer.WriteStaticDigital(magic, unitId, section, typ)
+	rw.record(hostOpWriteStaticDigital, start, magic, unitId, false, typ, "", err, func(e *HostEncoder) {
+		e.Int64(1).Int64(-1).Bytes(rawBytes(section.Data))
+	})
+	return err
+}
+
+// asyncWriter 被包装的 Writer 的异步写入接口, 开启异步写入前已经校验过能力位
+func (rw *RecordWriter) asyncWriter() (AsyncWriter, error) {
+	async, ok := rw.writer.(AsyncWriter)
+	if !ok {
+		return nil, errors.New("插件不支持: async")
+	}
+	return async, nil
+}
+
+// 异步写入记录的是提交时间、提交耗时和提交结果
+
+func (rw *RecordWriter) WriteRtAnalogAsync(magic int32, unitId int64, section AnalogSection, isFast bool, requestId int64) error {
+	async, err := rw.asyncWriter()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = async.WriteRtAnalogAsync(magic, unitId, section, isFast, requestId)
+	rw.record(recordOpWriteRtAnalogAsync, start, magic, unitId, isFast, 0, "", err, analogSections(section))
+	return err
+}
+
+func (rw *RecordWriter) WriteRtDigitalAsync(magic int32, unitId int64, section DigitalSection, isFast bool, requestId int64) error {
+	async, err := rw.asyncWriter()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = async.WriteRtDigitalAsync(magic, unitId, section, isFast, requestId)
+	rw.record(recordOpWriteRtDigitalAsync, start, magic, unitId, isFast, 0, "", err, digitalSections(section))
+	return err
+}
+
+func (rw *RecordWriter) WriteHisAnalogAsync(magic int32, unitId int64, section AnalogSection, requestId int64) error {
+	async, err := rw.asyncWriter()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = async.WriteHisAnalogAsync(magic, unitId, section, requestId)
+	rw.record(recordOpWriteHisAnalogAsync, start, magic, unitId, false, 0, "", err, analogSections(section))
+	return err
+}
+
+func (rw *RecordWriter) WriteHisDigitalAsync(magic int32, unitId int64, section DigitalSection, requestId int64) error {
+	async, err := rw.asyncWriter()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = async.WriteHisDigitalAsync(magic, unitId, section, requestId)
+	rw.record(recordOpWriteHisDigitalAsync, start, magic, unitId, false, 0, "", err, digitalSections(section))
+	return err
+}
+
+// ReadRecordFile 按顺序读取录制文件中的记录, 校验失败时返回错误
+// 文件末尾不完整的记录(例如录制时写数程序崩溃)只输出警告
+func ReadRecordFile(path string, fn func(index int64, entry RecordEntry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReaderSize(file, 1<<20)
+
+	sizes := recordStructSizes()
+	header := make([]byte, len(RecordFileMagic)+4+4*len(sizes))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("读取录制文件头失败: %v", err)
+	}
+	if string(header[:len(RecordFileMagic)]) != RecordFileMagic {
+		return errors.New("不是录制文件")
+	}
+	d := &HostDecoder{buf: header[len(RecordFileMagic):]}
+	if version := d.Int32(); version < 1 || version > RecordFileVersion {
+		return fmt.Errorf("录制文件版本不支持: %v", version)
+	}
+	for i, size := range sizes {
+		if recorded := uint32(d.Int32()); recorded != size {
+			return fmt.Errorf("录制文件的结构体大小与写数程序不一致, 下标: %v, 录制文件: %v, 写数程序: %v", i, recorded, size)
+		}
+	}
+
+	frameHeader := make([]byte, 8)
+	for index := int64(0); ; index++ {
+		if _, err := io.ReadFull(r, frameHeader); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			log.Printf("录制文件末尾不完整, 第%v条记录之后的内容被忽略\n", index)
+			return nil
+		}
+		n := binary.LittleEndian.Uint32(frameHeader[0:4])
+		checksum := binary.LittleEndian.Uint32(frameHeader[4:8])
+		if n > HostMaxFrameSize {
+			return fmt.Errorf("第%v条记录长度错误: %v", index+1, n)
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			log.Printf("录制文件末尾不完整, 第%v条记录之后的内容被忽略\n", index)
+			return nil
+		}
+		if crc32.ChecksumIEEE(body) != checksum {
+			return fmt.Errorf("第%v条记录校验失败", index+1)
+		}
+
+		d := &HostDecoder{buf: body}
+		entry := RecordEntry{
+			Op:       d.Byte(),
+			Offset:   time.Duration(d.Int64()),
+			Duration: time.Duration(d.Int64()),
+			Magic:    d.Int32(),
+			UnitId:   d.Int64(),
+			IsFast:   d.Byte() == 1,
+			Type:     d.Int64(),
+			Failed:   d.Int32() != 0,
+			Param:    d.String(),
+		}
+		count := d.Int64()
+		for i := int64(0); i < count && d.Err() == nil; i++ {
+			entry.Times = append(entry.Times, d.Int64())
+			entry.Raw = append(entry.Raw, d.Bytes())
+		}
+		if err := d.Err(); err != nil {
+			return fmt.Errorf("第%v条记录格式错误: %v", index+1, err)
+		}
+		if err := fn(index, entry); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplayEntry 调用插件回放一条记录
+// 异步写入按录制时一样提交, 提交的请求登记到 GlobalAcks, 确认结果计入写入错误
+func ReplayEntry(writer Writer, entry RecordEntry) error {
+	if cap, ok := RecordOpCaps[entry.Op]; ok && writer.Info().Capabilities&cap != cap {
+		return fmt.Errorf("插件不支持: %v", CapNames(cap&^writer.Info().Capabilities))
+	}
+	if entry.Op == hostOpFlush {
+		return writer.Flush()
+	}
+	if len(entry.Raw) == 0 {
+		return fmt.Errorf("%v 记录中没有断面, unit_id: %v", entry.Name(), entry.UnitId)
+	}
+	switch entry.Op {
+	case hostOpWriteRtAnalog, hostOpWriteHisAnalog, hostOpWriteRtAnalogList, recordOpWriteRtAnalogAsync, recordOpWriteHisAnalogAsync:
+		sections := make([]AnalogSection, 0, len(entry.Raw))
+		for i := range entry.Raw {
+			data, err := fromRawBytes[C.Analog](entry.Raw[i])
+			if err != nil {
+				return err
+			}
+			sections = append(sections, AnalogSection{Time: entry.Times[i], Data: data})
+		}
+		switch entry.Op {
+		case hostOpWriteRtAnalog:
+			return writer.WriteRtAnalog(entry.Magic, entry.UnitId, sections[0], entry.IsFast)
+		case hostOpWriteHisAnalog:
+			return writer.WriteHisAnalog(entry.Magic, entry.UnitId, sections[0])
+		case recordOpWriteRtAnalogAsync:
+			return replayAsync(writer, entry, len(sections[0].Data), func(async AsyncWriter, requestId int64) error {
+				return async.WriteRtAnalogAsync(entry.Magic, entry.UnitId, sections[0], entry.IsFast, requestId)
+			})
+		case recordOpWriteHisAnalogAsync:
+			return replayAsync(writer, entry, len(sections[0].Data), func(async AsyncWriter, requestId int64) error {
+				return async.WriteHisAnalogAsync(entry.Magic, entry.UnitId, sections[0], requestId)
+			})
+		default:
+			return writer.WriteRtAnalogList(entry.Magic, entry.UnitId, sections)
+		}
+	case hostOpWriteRtDigital, hostOpWriteHisDigital, hostOpWriteRtDigitalList, recordOpWriteRtDigitalAsync, recordOpWriteHisDigitalAsync:
+		sections := make([]DigitalSection, 0, len(entry.Raw))
+		for i := range entry.Raw {
+			data, err := fromRawBytes[C.Digital](entry.Raw[i])
+			if err != nil {
+				return err
+			}
+			sections = append(sections, DigitalSection{Time: entry.Times[i], Data: data})
+		}
+		switch entry.Op {
+		case hostOpWriteRtDigital:
+			return writer.WriteRtDigital(entry.Magic, entry.UnitId, sections[0], entry.IsFast)
+		case hostOpWriteHisDigital:
+			return writer.WriteHisDigital(entry.Magic, entry.UnitId, sections[0])
+		case recordOpWriteRtDigitalAsync:
+			return replayAsync(writer, entry, len(sections[0].Data), func(async AsyncWriter, requestId int64) error {
+				return async.WriteRtDigitalAsync(entry.Magic, entry.UnitId, sections[0], entry.IsFast, requestId)
+			})
+		case recordOpWriteHisDigitalAsync:
+			return replayAsync(writer, entry, len(sections[0].Data), func(async AsyncWriter, requestId int64) error {
+				return async.WriteHisDigitalAsync(entry.Magic, entry.UnitId, sections[0], requestId)
+			})
+		default:
+			return writer.WriteRtDigitalList(entry.Magic, entry.UnitId, sections)
+		}
+	case hostOpWriteStaticAnalog:
+		data, err := fromRawBytes[C.StaticAnalog](entry.Raw[0])
+		if err != nil {
+			return err
+		}
+		return writer.WriteStaticAnalog(entry.Magic, entry.UnitId, StaticAnalogSection{Data: data}, entry.Type)
+	case hostOpWriteStaticDigital:
+		data, err := fromRawBytes[C.StaticDigital](entry.Raw[0])
+		if err != nil {
+			return err
+		}
+		return writer.WriteStaticDigital(entry.Magic, entry.UnitId, StaticDigitalSection{Data: data}, entry.Type)
+	default:
+		return fmt.Errorf("未知的操作码: %v", entry.Op)
+	}
+}
+
+// replayAsync 提交一次异步写入, 提交失败时取消登记的请求
+func replayAsync(writer Writer, entry RecordEntry, pNumCount int, submit func(async AsyncWriter, requestId int64) error) error {
+	async, ok := writer.(AsyncWriter)
+	if !ok {
+		return errors.New("插件不支持: async")
+	}
+	group := NewAckGroup(entry.Name())
+	defer group.Seal()
+	requestId := GlobalAcks.Submit(group, pNumCount)
+	err := submit(async, requestId)
+	if err != nil {
+		GlobalAcks.Cancel(requestId)
+	}
+	return err
+}
+
+// ReplayStat 回放统计, 按函数分别统计
+type ReplayStat struct {
+	Name           string
+	Count          int
+	FailedCount    int
+	RecordedFailed int
+	Durations      DurationHistogram // 回放的耗时
+	Recorded       DurationHistogram // 录制时的耗时
+}
+
+// ReplayCollector 收集回放结果
+type ReplayCollector struct {
+	mu    sync.Mutex
+	stats map[string]*ReplayStat
+}
+
+func (rc *ReplayCollector) Add(entry RecordEntry, duration time.Duration, err error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.stats == nil {
+		rc.stats = make(map[string]*ReplayStat)
+	}
+	s, ok := rc.stats[entry.Name()]
+	if !ok {
+		s = &ReplayStat{Name: entry.Name()}
+		rc.stats[entry.Name()] = s
+	}
+	s.Count++
+	if err != nil {
+		s.FailedCount++
+		GlobalWriteErrors.Add(err)
+	}
+	if entry.Failed {
+		s.RecordedFailed++
+	}
+	s.Durations.Add(duration)
+	s.Recorded.Add(entry.Duration)
+}
+
+// Print 输出回放结果, 与录制时的结果对比
+func (rc *ReplayCollector) Print() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	names := make([]string, 0, len(rc.stats))
+	for name := range rc.stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := rc.stats[name]
+		log.Printf("%v - 调用次数: %v, 失败次数: %v(录制时: %v), 平均耗时: %v(录制时: %v), P99耗时: %v(录制时: %v)\n",
+			s.Name, s.Count, s.FailedCount, s.RecordedFailed, s.Durations.Avg(), s.Recorded.Avg(),
+			s.Durations.Quantile(0.99), s.Recorded.Quantile(0.99))
+	}
+	GlobalWriteErrors.Print()
+}
+
+// Replay 按录制的顺序回放调用
+// speed 为1时按录制时的时间间隔回放, 大于1时按比例压缩时间间隔, 为0时不等待
+// 同一个机组的调用按顺序执行, 不同机组的调用并发执行, 与录制时一致; 每个机组的协程各自等待到调用的开始时间, 一个机组变慢不会推迟其他机组的调用
+// 回放结束后等待异步写入的请求被确认
+func Replay(writer Writer, path string, speed float64, collector *ReplayCollector) error {
+	wg := new(sync.WaitGroup)
+	units := make(map[int64]chan RecordEntry)
+	async := false
+	defer func() {
+		for _, ch := range units {
+			close(ch)
+		}
+		wg.Wait()
+		if async && !GlobalAcks.Wait(AckWaitTimeout) {
+			log.Printf("等待异步写入确认超时(%v), 未确认请求数量: %v\n", AckWaitTimeout, GlobalAcks.Pending())
+		}
+	}()
+
+	start := time.Now()
+	return ReadRecordFile(path, func(index int64, entry RecordEntry) error {
+		select {
+		case <-AbortCh:
+			return errors.New("回放被中止")
+		default:
+		}
+		// login和logout由回放命令处理
+		if entry.Op == hostOpLogin || entry.Op == hostOpLogout {
+			return nil
+		}
+		// 异步写入的操作码都不小于 recordOpWriteRtAnalogAsync
+		if entry.Op >= recordOpWriteRtAnalogAsync {
+			async = true
+		}
+
+		ch, ok := units[entry.UnitId]
+		if !ok {
+			ch = make(chan RecordEntry, CacheSize)
+			units[entry.UnitId] = ch
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for entry := range ch {
+					if speed > 0 {
+						if wait := time.Duration(float64(entry.Offset)/speed) - time.Since(start); wait > 0 {
+							select {
+							case <-time.After(wait):
+							case <-AbortCh:
+							}
+						}
+					}
+					// 中止后丢弃还没有回放的调用
+					select {
+					case <-AbortCh:
+						continue
+					default:
+					}
+					t := time.Now()
+					err := ReplayEntry(writer, entry)
+					collector.Add(entry, time.Since(t), err)
+				}
+			}()
+		}
+		ch <- entry
+		return nil
+	})
+}
+
+// errRecordFound 查找记录时提前结束读取
+var errRecordFound = errors.New("found")
+
+// RecordedLoginParam 录制时login的参数
+func RecordedLoginParam(path string) (string, error) {
+	param := ""
+	err := ReadRecordFile(path, func(index int64, entry RecordEntry) error {
+		if entry.Op == hostOpLogin {
+			param = entry.Param
+			return errRecordFound
+		}
+		return nil
+	})
+	if err != nil && err != errRecordFound {
+		return "", err
+	}
+	return param, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordReplayRoundTrip(t *testing.T) {
+	GlobalWriteErrors = &WriteErrorCollector{}
+	path := filepath.Join(t.TempDir(), "calls.rec")
+	recorded := newFakeWriter(1)
+	rw, err := NewRecordWriter(recorded, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin := NewWritePlugin(rw)
+	plugin.Login("host=127.0.0.1")
+	plugin.WriteRtAnalog(3, 2, testAnalogSection(t, 1000, 1, 2, 3), true, false)
+	plugin.WriteRtDigital(3, 1, testDigitalSection(t, 1000, 1), false)
+	plugin.WriteRtAnalogList(3, 1, []AnalogSection{testAnalogSection(t, 1001, 1), testAnalogSection(t, 1002, 2)}, false)
+	plugin.WriteHisAnalog(3, 1, testAnalogSection(t, 2000, 4), false)
+	plugin.WriteHisDigital(3, 1, testDigitalSection(t, 2000, 5, 6))
+	_ = plugin.Flush()
+	plugin.Logout()
+
+	param, err := RecordedLoginParam(path)
+	if err != nil || param != "host=127.0.0.1" {
+		t.Errorf("login param = %q, %v", param, err)
+	}
+
+	// 回放到另一个插件, 每次调用的参数和断面内容与录制时相同
+	replayed := newFakeWriter(-1)
+	names := make([]string, 0)
+	failed := make(map[int64]bool)
+	err = ReadRecordFile(path, func(index int64, entry RecordEntry) error {
+		names = append(names, entry.Name())
+		if entry.Op == hostOpLogin || entry.Op == hostOpLogout {
+			return nil
+		}
+		failed[entry.UnitId] = failed[entry.UnitId] || entry.Failed
+		if entry.Magic != 3 && entry.Op != hostOpFlush {
+			t.Errorf("%v: magic = %v, want 3", entry.Name(), entry.Magic)
+		}
+		return ReplayEntry(replayed, entry)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantNames := []string{"login", "write_rt_analog", "write_rt_analog", "write_rt_digital", "write_rt_analog_list",
+		"write_his_analog", "write_his_digital", "flush", "logout"}
+	if len(names) != len(wantNames) {
+		t.Fatalf("entries = %v, want %v", names, wantNames)
+	}
+	for i := range names {
+		if names[i] != wantNames[i] {
+			t.Errorf("entry %v = %v, want %v", i, names[i], wantNames[i])
+		}
+	}
+	if !failed[1] || failed[0] {
+		t.Errorf("recorded failures = %v, want only unit 1", failed)
+	}
+
+	want, got := recorded.Calls(), replayed.Calls()
+	if len(got) != len(want) {
+		t.Fatalf("replayed %v calls, want %v", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Op != want[i].Op || got[i].UnitId != want[i].UnitId || fmt.Sprint(got[i].Times) != fmt.Sprint(want[i].Times) || string(got[i].Raw) != string(want[i].Raw) {
+			t.Errorf("call %v: replayed %v(unit %v, %v), recorded %v(unit %v, %v)",
+				i, got[i].Op, got[i].UnitId, got[i].Times, want[i].Op, want[i].UnitId, want[i].Times)
+		}
+	}
+}
+
+func TestReadRecordFileDamaged(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "calls.rec")
+	rw, err := NewRecordWriter(newFakeWriter(-1), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rw.WriteRtAnalog(0, 0, testAnalogSection(t, 1000, 1), true)
+	_ = rw.WriteRtAnalog(0, 0, testAnalogSection(t, 2000, 1), true)
+	rw.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	tests := []struct {
+		name        string
+		content     []byte
+		wantErr     bool
+		wantEntries int
+	}{
+		{name: "complete", content: data, wantEntries: 2},
+		{name: "incomplete tail is ignored", content: data[:len(data)-3], wantEntries: 1},
+		{name: "checksum mismatch", content: corrupted, wantErr: true, wantEntries: 1},
+		{name: "empty", content: nil, wantErr: true},
+		{name: "not a record file", content: []byte("TIME,P_NUM,AV,AVR,Q,BF,FQ,FAI,MS,TEW,CST\n"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			entries := 0
+			err := ReadRecordFile(path, func(int64, RecordEntry) error {
+				entries++
+				return nil
+			})
+			if (err != nil) != tt.wantErr || entries != tt.wantEntries {
+				t.Errorf("entries = %v, err = %v, want %v entries, error: %v", entries, err, tt.wantEntries, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplayCollector(t *testing.T) {
+	GlobalWriteErrors = &WriteErrorCollector{}
+	rc := &ReplayCollector{}
+	for i := 1; i <= 100; i++ {
+		entry := RecordEntry{Op: hostOpWriteRtAnalog, Duration: time.Duration(i) * time.Millisecond, Failed: i == 1}
+		var err error
+		if i%10 == 0 {
+			err = errors.New("failed")
+		}
+		rc.Add(entry, time.Duration(i)*time.Microsecond, err)
+	}
+	s := rc.stats["write_rt_analog"]
+	if s == nil || s.Count != 100 || s.FailedCount != 10 || s.RecordedFailed != 1 {
+		t.Fatalf("stat = %+v, want 100 calls, 10 failed, 1 failed when recorded", s)
+	}
+	// 回放和录制时的耗时都用直方图统计, 不保存每次调用的耗时
+	if s.Durations.Count != 100 || s.Durations.Max != 100*time.Microsecond || s.Durations.Avg() != 50500*time.Nanosecond {
+		t.Errorf("replayed count, max, avg = %v, %v, %v", s.Durations.Count, s.Durations.Max, s.Durations.Avg())
+	}
+	if p99 := s.Recorded.Quantile(0.99); p99 < 97*time.Millisecond || p99 > 101*time.Millisecond {
+		t.Errorf("recorded p99 = %v, want about 99ms", p99)
+	}
+}
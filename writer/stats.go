@@ -0,0 +1,288 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 写入统计
+// 长时间写入(--loop_until, 开环写入)时断面数量没有上限, 不保留每个断面的记录, 写入时立即累加:
+// * 耗时按对数分桶计入直方图, 分位数由直方图估计, 相对误差不超过 1/(2*HistogramSubBuckets), 最大值和最小值是精确的
+// * 模拟量和数字量是同一个断面(开启快采点缓存时为同一批断面), 一次写入合并为一条记录
+// * 按轮(Loop)分别累加, 用于循环回放的按轮统计
+// * 异步写入在断面的所有请求被确认后再计入确认耗时和确认失败
+
+// HistogramSubBuckets 直方图每个2的幂区间内的桶数量
+const HistogramSubBuckets = 64
+
+// DurationHistogram 耗时直方图, 只保存非空的桶
+type DurationHistogram struct {
+	Count   int64
+	Sum     time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	buckets map[int]int64
+}
+
+// histogramBucket 小于 HistogramSubBuckets 纳秒时每纳秒一个桶, 之后每个2的幂区间 HistogramSubBuckets 个桶, 负数计入第一个桶
+func histogramBucket(d time.Duration) int {
+	if d < HistogramSubBuckets {
+		if d < 0 {
+			return 0
+		}
+		return int(d)
+	}
+	shift := bits.Len64(uint64(d)) - bits.Len64(HistogramSubBuckets)
+	return (shift+1)*HistogramSubBuckets + int(d>>shift) - HistogramSubBuckets
+}
+
+// histogramValue 桶的代表值, 取桶的中点
+func histogramValue(bucket int) time.Duration {
+	if bucket < HistogramSubBuckets {
+		return time.Duration(bucket)
+	}
+	shift := bucket/HistogramSubBuckets - 1
+	lower := time.Duration(bucket%HistogramSubBuckets+HistogramSubBuckets) << shift
+	return lower + time.Duration(1)<<shift/2
+}
+
+func (h *DurationHistogram) Add(d time.Duration) {
+	if h.buckets == nil {
+		h.buckets = make(map[int]int64)
+	}
+	if h.Count == 0 || d < h.Min {
+		h.Min = d
+	}
+	if h.Count == 0 || d > h.Max {
+		h.Max = d
+	}
+	h.Count++
+	h.Sum += d
+	h.buckets[histogramBucket(d)]++
+}
+
+// Avg 平均值, 没有记录时返回0
+func (h *DurationHistogram) Avg() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile 分位数, 与 stat.Quantile(q, stat.Empirical, ...) 相同取第 ceil(q*Count) 个值所在的桶, 结果限制在 [Min, Max] 之间
+func (h *DurationHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return h.Min
+	}
+	if q >= 1 {
+		return h.Max
+	}
+	rank := int64(math.Ceil(q * float64(h.Count)))
+	keys := make([]int, 0, len(h.buckets))
+	for k := range h.buckets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	cum := int64(0)
+	for _, k := range keys {
+		cum += h.buckets[k]
+		if cum >= rank {
+			v := histogramValue(k)
+			if v < h.Min {
+				v = h.Min
+			}
+			if v > h.Max {
+				v = h.Max
+			}
+			return v
+		}
+	}
+	return h.Max
+}
+
+// LoopStats 一轮(或所有轮合计)的写入统计
+type LoopStats struct {
+	Writes          DurationHistogram // 每次写入(模拟量+数字量)的耗时
+	SectionCount    int64             // 断面数量
+	PNumCount       int64             // PNum数量
+	UnitPNumCount   int64             // PNum数量(按机组累计), 用于计算有效写入速率
+	FailedSections  int64             // 失败断面数量, 模拟量或数字量任意一个写入失败则认为断面写入失败
+	FailedCount     int64             // 失败调用次数
+	FailedPNumCount int64             // 失败PNum数量(按机组累计)
+	FirstTime       int64             // 第一次写入的断面时间
+	LastTime        int64             // 最后一次写入的断面时间
+}
+
+// Summary 返回值与 Summary 相同: 总耗时, 断面数量, 平均耗时, 最长耗时, 最短耗时, P99耗时, P95耗时, 中位数耗时, PNum数量
+func (ls *LoopStats) Summary() (time.Duration, int, time.Duration, time.Duration, time.Duration, time.Duration, time.Duration, time.Duration, int) {
+	h := &ls.Writes
+	dAvg := time.Duration(0)
+	if ls.SectionCount != 0 {
+		dAvg = h.Sum / time.Duration(ls.SectionCount)
+	}
+	return h.Sum, int(ls.SectionCount), dAvg, h.Max, h.Min, h.Quantile(0.99), h.Quantile(0.95), h.Quantile(0.50), int(ls.PNumCount)
+}
+
+// fail 记录写入失败, sectionFailed 为true时把断面计为失败断面
+func (ls *LoopStats) fail(sectionCount int64, count int64, pNum int64, sectionFailed bool) {
+	ls.FailedCount += count
+	ls.FailedPNumCount += pNum
+	if sectionFailed {
+		ls.FailedSections += sectionCount
+	}
+}
+
+// WriteStats 一类断面(快采点或普通点)的写入统计, 可以被写入协程和异步确认并发调用
+type WriteStats struct {
+	mu           sync.Mutex
+	unitNumber   int64
+	total        LoopStats
+	loops        map[int64]*LoopStats
+	sleep        time.Duration     // 周期性写入的睡眠耗时
+	lateness     DurationHistogram // 周期性写入的调度延迟(实际开始写入时间 - 计划时间)
+	missed       int64             // 错过截止时间的次数
+	lastLateness time.Duration     // 最后一次写入的调度延迟
+	openLoop     DurationHistogram // 开环延迟(写入完成时间 - 计划发布时间)
+	acks         DurationHistogram // 异步写入提交到确认的耗时
+	async        bool
+	unacked      int64 // 还有请求未确认的断面数量
+}
+
+var GlobalFastStats = &WriteStats{}
+var GlobalNormalStats = &WriteStats{}
+
+// Add 记录一次写入, analog/digital 为同一个断面(或同一批断面)的模拟量和数字量
+func (ws *WriteStats) Add(analog WriteSectionInfo, digital WriteSectionInfo) {
+	failedCount := analog.FailedCount + digital.FailedCount
+	failedPNum := analog.FailedPNumCount + digital.FailedPNumCount
+
+	ws.mu.Lock()
+	if ws.loops == nil {
+		ws.loops = make(map[int64]*LoopStats)
+	}
+	loop, ok := ws.loops[analog.Loop]
+	if !ok {
+		loop = &LoopStats{}
+		ws.loops[analog.Loop] = loop
+	}
+	ws.unitNumber = analog.UnitNumber
+	// 断面时间与提交给插件的时间相同, 包含 --time_base 的偏移
+	sectionTime := GlobalTimeBase.Shift(analog.Time)
+	for _, ls := range []*LoopStats{&ws.total, loop} {
+		if ls.Writes.Count == 0 {
+			ls.FirstTime = sectionTime
+		}
+		ls.LastTime = sectionTime
+		ls.Writes.Add(analog.Duration + digital.Duration)
+		ls.SectionCount += analog.SectionCount
+		ls.PNumCount += analog.PNumCount + digital.PNumCount
+		ls.UnitPNumCount += analog.PNumCount*analog.UnitNumber + digital.PNumCount*digital.UnitNumber
+		ls.fail(analog.SectionCount, failedCount, failedPNum, failedCount != 0)
+	}
+	// 模拟量和数字量的计划时间和实际开始写入时间相同, 写入完成时间 = 实际开始写入时间 + 模拟量耗时 + 数字量耗时
+	if !analog.Scheduled.IsZero() {
+		lateness := analog.Started.Sub(analog.Scheduled)
+		ws.lateness.Add(lateness)
+		ws.lastLateness = lateness
+		if analog.Missed {
+			ws.missed++
+		}
+		ws.openLoop.Add(analog.Started.Add(analog.Duration + digital.Duration).Sub(analog.Scheduled))
+	}
+	groups := make([]*AckGroup, 0, 2)
+	for _, g := range []*AckGroup{analog.Ack, digital.Ack} {
+		if g != nil {
+			groups = append(groups, g)
+		}
+	}
+	if len(groups) != 0 {
+		ws.async = true
+		ws.unacked++
+	}
+	ws.mu.Unlock()
+
+	// 确认回调可能立即执行, 需要在释放锁之后注册
+	pending := int64(len(groups))
+	for _, g := range groups {
+		g.OnDone(func() {
+			if atomic.AddInt64(&pending, -1) == 0 {
+				ws.acked(loop, groups, analog.SectionCount, failedCount == 0)
+			}
+		})
+	}
+}
+
+// acked 一个断面的异步写入请求全部被确认, 从最先提交到最后确认计入确认耗时, 确认失败计入失败统计
+// syncOk 为true时同步提交没有失败, 断面还没有计为失败
+func (ws *WriteStats) acked(loop *LoopStats, groups []*AckGroup, sectionCount int64, syncOk bool) {
+	submit := groups[0].Submit
+	acked := time.Time{}
+	count, pNum := int64(0), int64(0)
+	for _, g := range groups {
+		latency, _ := g.Latency()
+		if g.Submit.Before(submit) {
+			submit = g.Submit
+		}
+		if g.Submit.Add(latency).After(acked) {
+			acked = g.Submit.Add(latency)
+		}
+		c, p := g.Failed()
+		count += c
+		pNum += p
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.unacked--
+	ws.acks.Add(acked.Sub(submit))
+	if count == 0 {
+		return
+	}
+	for _, ls := range []*LoopStats{&ws.total, loop} {
+		ls.fail(sectionCount, count, pNum, syncOk)
+	}
+}
+
+// AddSleep 记录周期性写入的睡眠耗时
+func (ws *WriteStats) AddSleep(d time.Duration) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.sleep += d
+}
+
+// Written 是否写入过断面
+func (ws *WriteStats) Written() bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.total.Writes.Count != 0
+}
+
+// Sleep 周期性写入的睡眠耗时
+func (ws *WriteStats) Sleep() time.Duration {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.sleep
+}
+
+// Loops 按轮数排序的每一轮的统计(副本)
+func (ws *WriteStats) Loops() ([]int64, []LoopStats) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	loops := make([]int64, 0, len(ws.loops))
+	for loop := range ws.loops {
+		loops = append(loops, loop)
+	}
+	sort.Slice(loops, func(i, j int) bool { return loops[i] < loops[j] })
+	stats := make([]LoopStats, len(loops))
+	for i, loop := range loops {
+		stats[i] = *ws.loops[loop]
+	}
+	return loops, stats
+}
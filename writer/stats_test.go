@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDurationHistogram(t *testing.T) {
+	tests := []struct {
+		name   string
+		values func() []time.Duration
+	}{
+		{"single", func() []time.Duration { return []time.Duration{42 * time.Microsecond} }},
+		{"small values are exact", func() []time.Duration {
+			values := make([]time.Duration, 0)
+			for i := 0; i < HistogramSubBuckets; i++ {
+				values = append(values, time.Duration(i))
+			}
+			return values
+		}},
+		{"linear", func() []time.Duration {
+			values := make([]time.Duration, 0)
+			for i := 1; i <= 10000; i++ {
+				values = append(values, time.Duration(i)*time.Microsecond)
+			}
+			return values
+		}},
+		{"long tail", func() []time.Duration {
+			values := make([]time.Duration, 0)
+			for i := 0; i < 1000; i++ {
+				values = append(values, time.Duration(100+i%7)*time.Microsecond)
+			}
+			return append(values, 3*time.Second, 5*time.Millisecond)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := tt.values()
+			h := &DurationHistogram{}
+			sum := time.Duration(0)
+			for _, v := range values {
+				h.Add(v)
+				sum += v
+			}
+			sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+			if h.Count != int64(len(values)) || h.Sum != sum || h.Min != values[0] || h.Max != values[len(values)-1] {
+				t.Errorf("count, sum, min, max = %v, %v, %v, %v", h.Count, h.Sum, h.Min, h.Max)
+			}
+			if h.Avg() != sum/time.Duration(len(values)) {
+				t.Errorf("avg = %v, want %v", h.Avg(), sum/time.Duration(len(values)))
+			}
+			// 分位数与排序后的第 ceil(q*n) 个值比较, 相对误差不超过 1/(2*HistogramSubBuckets)
+			for _, q := range []float64{0, 0.5, 0.95, 0.99, 1} {
+				rank := int(math.Ceil(q * float64(len(values))))
+				if rank < 1 {
+					rank = 1
+				}
+				want := values[rank-1]
+				got := h.Quantile(q)
+				if diff := math.Abs(float64(got - want)); diff > float64(want)/(2*HistogramSubBuckets) {
+					t.Errorf("Quantile(%v) = %v, want %v", q, got, want)
+				}
+			}
+		})
+	}
+
+	empty := &DurationHistogram{}
+	if empty.Quantile(0.99) != 0 || empty.Avg() != 0 {
+		t.Errorf("empty histogram: quantile = %v, avg = %v", empty.Quantile(0.99), empty.Avg())
+	}
+}
+
+func TestWriteStatsLoops(t *testing.T) {
+	ws := &WriteStats{}
+	adds := []struct {
+		loop, time   int64
+		duration     time.Duration
+		failed, pNum int64
+	}{
+		{0, 1000, 2 * time.Millisecond, 0, 10},
+		{0, 2000, 4 * time.Millisecond, 1, 10},
+		{1, 3000, 6 * time.Millisecond, 0, 10},
+	}
+	for _, a := range adds {
+		ws.Add(WriteSectionInfo{UnitNumber: 2, Time: a.time, Duration: a.duration / 2, SectionCount: 1, PNumCount: a.pNum, FailedCount: a.failed, FailedPNumCount: a.failed * a.pNum, Loop: a.loop},
+			WriteSectionInfo{UnitNumber: 2, Time: a.time, Duration: a.duration / 2, PNumCount: a.pNum, Loop: a.loop})
+	}
+	if !ws.Written() {
+		t.Fatal("Written = false")
+	}
+	all, count, avg, max, min, _, _, _, pNum := ws.total.Summary()
+	if all != 12*time.Millisecond || count != 3 || avg != 4*time.Millisecond || max != 6*time.Millisecond || min != 2*time.Millisecond || pNum != 60 {
+		t.Errorf("total summary = %v, %v, %v, %v, %v, %v", all, count, avg, max, min, pNum)
+	}
+	if ws.total.UnitPNumCount != 120 || ws.total.FailedSections != 1 || ws.total.FailedCount != 1 || ws.total.FailedPNumCount != 10 {
+		t.Errorf("total = %+v", ws.total)
+	}
+
+	loops, stats := ws.Loops()
+	if len(loops) != 2 || loops[0] != 0 || loops[1] != 1 {
+		t.Fatalf("loops = %v", loops)
+	}
+	if stats[0].SectionCount != 2 || stats[0].FirstTime != 1000 || stats[0].LastTime != 2000 || stats[0].FailedSections != 1 {
+		t.Errorf("loop 0 = %+v", stats[0])
+	}
+	if stats[1].SectionCount != 1 || stats[1].FirstTime != 3000 || stats[1].FailedSections != 0 {
+		t.Errorf("loop 1 = %+v", stats[1])
+	}
+}
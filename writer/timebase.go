@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// 断面时间基准(--time_base)
+// 输入文件中的TIME列直接作为断面时间写入, 数据通常落在1970年附近或者录制时的时间, 无法测试数据库的最新值、数据保留等与时间相关的行为:
+// * --time_base=now 把断面时间平移到第一次写入时的时间, 登入、预加载和缓存队列填充的耗时不会让断面时间落后于当前时间
+// * --time_base=2024-07-20T08:00:00+08:00 把断面时间平移到指定的时间(RFC3339)
+// * 所有输入文件(快采点、普通点、历史)使用同一个偏移, 最早的断面(指定了 --start_time 时为窗口的开始时间)对齐到基准时间, 断面之间的相对间隔不变
+// * 读取时只加循环回放的偏移, 基准时间的偏移在提交给插件时(WritePlugin)加上
+// 断面时间的单位为毫秒
+
+// TimeBase 断面时间基准
+type TimeBase struct {
+	Now    bool      // 基准时间为第一次写入时的时间
+	Base   time.Time // 基准时间
+	First  int64     // 所有输入文件中最早的断面时间
+	Offset int64     // 加到每个断面时间上的偏移, 为0时不平移
+
+	once sync.Once
+}
+
+var GlobalTimeBase = &TimeBase{}
+
+// ParseTimeBase 解析 --time_base, now 表示当前时间
+func ParseTimeBase(value string) (time.Time, error) {
+	if value == "now" {
+		return time.Now(), nil
+	}
+	base, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--time_base 应为 now 或 RFC3339 格式的时间(例如 2024-07-20T08:00:00+08:00): %v", err)
+	}
+	return base, nil
+}
+
+// Resolve 根据 --time_base 和输入文件中最早的断面时间计算偏移, value 为空时不平移
+func (tb *TimeBase) Resolve(value string, inputs ...ValidateInput) error {
+	if value == "" {
+		return nil
+	}
+	now := value == "now"
+	base, err := ParseTimeBase(value)
+	if err != nil {
+		return err
+	}
+	found := false
+	first := int64(0)
+	for _, input := range inputs {
+		if input.Path == "" {
+			continue
+		}
+		t, ok, err := FirstSectionTime(input.Path, input.Kind)
+		if err != nil {
+			return fmt.Errorf("%v: %v", input.Path, err)
+		}
+		if ok && (!found || t < first) {
+			found = true
+			first = t
+		}
+	}
+	if !found {
+		return errors.New("输入文件中没有断面")
+	}
+	// 指定了 --start_time 时窗口的开始时间对齐到基准时间
+	if GlobalBound.Start > first {
+		first = GlobalBound.Start
+	}
+	tb.Now = now
+	tb.First = first
+	if now {
+		log.Printf("断面时间基准 - 基准时间: 第一次写入时的时间, 最早的断面时间: %v\n", first)
+		return nil
+	}
+	tb.anchor(base)
+	return nil
+}
+
+// anchor 确定基准时间和偏移
+func (tb *TimeBase) anchor(base time.Time) {
+	tb.Base = base
+	tb.Offset = base.UnixMilli() - tb.First
+	log.Printf("断面时间基准 - 基准时间: %v, 最早的断面时间: %v, 偏移: %v\n", base.Format(time.RFC3339Nano), tb.First, tb.Offset)
+}
+
+// Shift 断面提交给插件时的时间, --time_base=now 时第一次调用确定基准时间
+func (tb *TimeBase) Shift(t int64) int64 {
+	tb.once.Do(func() {
+		if tb.Now {
+			tb.anchor(time.Now())
+		}
+	})
+	return t + tb.Offset
+}
+
+// FirstSectionTime 读取文件中第一个断面的时间, 文件中没有断面时返回false
+func FirstSectionTime(path string, kind uint32) (int64, bool, error) {
+	// 预编译数据集读取索引
+	if IsDatasetFile(path) {
+		ds, err := OpenDataset(path, kind)
+		if err != nil {
+			return 0, false, err
+		}
+		defer func() { _ = ds.Close() }()
+		if len(ds.Index) == 0 {
+			return 0, false, nil
+		}
+		return ds.Index[0].Time, true, nil
+	}
+
+	// Parquet / Arrow IPC 文件读取第一个非空批次的TIME列
+	if format := DetectColumnar(path); format != ColumnarNone {
+		src, err := OpenColumnar(path, format, kind)
+		if err != nil {
+			return 0, false, err
+		}
+		defer func() { _ = src.Close() }()
+		for {
+			batch, err := src.Next()
+			if err == io.EOF {
+				return 0, false, nil
+			}
+			if err != nil {
+				return 0, false, err
+			}
+			if batch.Rows != 0 {
+				t, err := batch.Columns[0].Int(0)
+				return t, err == nil, err
+			}
+		}
+	}
+
+	// CSV文件按写入命令相同的方式解析, 跳过表头和无法解析的行
+	file, err := OpenCsvFile(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() { _ = file.Close() }()
+	reader := csv.NewReader(NewCRFilterReader(bufio.NewReader(file)))
+	reader.FieldsPerRecord = -1
+	mapper := NewCsvRecordMapper(kind)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return 0, false, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			continue
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		if record, err = mapper.Map(record); err != nil {
+			if errors.Is(err, ErrColumnHeader) {
+				return 0, false, err
+			}
+			continue
+		}
+		var t int64
+		if kind == DatasetAnalog {
+			t, _, err = ParseAnalogRecord(record)
+		} else {
+			t, _, err = ParseDigitalRecord(record)
+		}
+		if err == nil {
+			return t, true, nil
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeBaseResolve(t *testing.T) {
+	csvPath := writeCsv(t, "a.csv", AnalogColumns, analogRow(5000, 1), analogRow(6000, 1))
+	digitalPath := writeCsv(t, "d.csv", DigitalColumns, digitalRow(3000, 1), digitalRow(7000, 1))
+	emptyPath := writeCsv(t, "e.csv", AnalogColumns)
+	inputs := []ValidateInput{{csvPath, DatasetAnalog}, {"", DatasetDigital}, {digitalPath, DatasetDigital}}
+
+	tests := []struct {
+		name       string
+		value      string
+		inputs     []ValidateInput
+		wantErr    bool
+		wantOffset int64
+	}{
+		{name: "not set", value: "", inputs: inputs},
+		{name: "fixed base uses earliest section", value: "2024-07-20T08:00:00+08:00", inputs: inputs, wantOffset: 1721433600000 - 3000},
+		{name: "bad base", value: "yesterday", inputs: inputs, wantErr: true},
+		{name: "no sections", value: "now", inputs: []ValidateInput{{emptyPath, DatasetAnalog}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &TimeBase{}
+			err := tb.Resolve(tt.value, tt.inputs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve = %v, want error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && tb.Shift(3000)-3000 != tt.wantOffset {
+				t.Errorf("offset = %v, want %v", tb.Shift(3000)-3000, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestTimeBaseNowAnchorsAtFirstShift(t *testing.T) {
+	csvPath := writeCsv(t, "a.csv", AnalogColumns, analogRow(5000, 1), analogRow(6000, 1))
+	tb := &TimeBase{}
+	if err := tb.Resolve("now", ValidateInput{csvPath, DatasetAnalog}); err != nil {
+		t.Fatal(err)
+	}
+	// 准备阶段的耗时不计入偏移, 第一个断面对齐到第一次写入的时间
+	time.Sleep(20 * time.Millisecond)
+	before := time.Now().UnixMilli()
+	first := tb.Shift(5000)
+	after := time.Now().UnixMilli()
+	if first < before || first > after {
+		t.Errorf("first section = %v, want between %v and %v", first, before, after)
+	}
+	if second := tb.Shift(6000); second != first+1000 {
+		t.Errorf("second section = %v, want %v", second, first+1000)
+	}
+}
+
+func TestWritePluginTimeBase(t *testing.T) {
+	GlobalTimeBase = &TimeBase{Offset: 500}
+	defer func() { GlobalTimeBase = &TimeBase{} }()
+	fw := newFakeWriter(-1)
+	plugin := NewWritePlugin(fw)
+	sections := []AnalogSection{testAnalogSection(t, 1000, 1), testAnalogSection(t, 1001, 1)}
+	plugin.WriteHisAnalog(0, 1, sections[0], false)
+	plugin.WriteRtAnalogList(0, 1, sections, false)
+
+	calls := fw.Calls()
+	if calls[0].Times[0] != 1500 || calls[1].Times[0] != 1500 || calls[1].Times[1] != 1501 {
+		t.Errorf("times = %v, %v, want shifted by 500", calls[0].Times, calls[1].Times)
+	}
+	if sections[0].Time != 1000 {
+		t.Errorf("caller's section time was modified: %v", sections[0].Time)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+// #include "write_plugin.h"
+import "C"
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 数据集校验(validate命令和写入命令的--strict)
+// 写入命令读取CSV时会跳过无法解析的行(列数不对的行被当作尾行), 被跳过的行不会计入统计, 文件被截断时写入的数据量会悄悄变少
+// validate 逐行检查输入文件, 输出每个问题的 文件:行号, 有问题时返回非0的退出码
+// Parquet / Arrow IPC 文件和预编译数据集没有行号, 输出的是数据行的序号(#N)
+
+// MaxPNum GlobalID 中 P_NUM 占21位, 超过的部分会被截断
+const MaxPNum = 0x1FFFFF
+
+// ValidateReport 一个文件的校验结果
+type ValidateReport struct {
+	Path      string
+	Kind      uint32
+	MaxIssues int64 // 最多输出的问题数量, 为0时全部输出
+	Rows      int64
+	Sections  int64
+	Issues    int64
+}
+
+// Issue 记录一个问题, pos 为行号或者数据行的序号
+func (vr *ValidateReport) Issue(pos interface{}, format string, args ...interface{}) {
+	vr.Issues++
+	if vr.MaxIssues == 0 || vr.Issues <= vr.MaxIssues {
+		log.Printf("%v:%v: %v\n", vr.Path, pos, fmt.Sprintf(format, args...))
+	}
+}
+
+func (vr *ValidateReport) Print() {
+	if vr.MaxIssues != 0 && vr.Issues > vr.MaxIssues {
+		log.Printf("%v: 还有 %v 个问题没有输出\n", vr.Path, vr.Issues-vr.MaxIssues)
+	}
+	log.Printf("校验完成 - 文件: %v, 类型: %v, 数据行数: %v, 断面数量: %v, 问题数量: %v\n",
+		vr.Path, DatasetKinds[vr.Kind].Name, vr.Rows, vr.Sections, vr.Issues)
+}
+
+// sectionChecker 检查时间戳单调递增、断面内P_NUM不重复、P_NUM不超过21位
+// 静态数据的时间固定为-1, 整个文件是一个断面
+type sectionChecker struct {
+	report  *ValidateReport
+	started bool
+	time    int64
+	pNums   map[int64]interface{} // 当前断面的P_NUM和第一次出现的位置
+}
+
+func (sc *sectionChecker) Check(pos interface{}, ts int64, pNum int64) {
+	vr := sc.report
+	vr.Rows++
+	if !sc.started || ts != sc.time {
+		if sc.started && ts < sc.time {
+			vr.Issue(pos, "时间戳不是单调递增: %v 出现在 %v 之后", ts, sc.time)
+		}
+		sc.started = true
+		sc.time = ts
+		sc.pNums = make(map[int64]interface{})
+		vr.Sections++
+	}
+	if pNum < 0 || pNum > MaxPNum {
+		vr.Issue(pos, "P_NUM超出范围: %v, GlobalID中P_NUM占21位, 范围为[0, %v]", pNum, MaxPNum)
+	}
+	if first, ok := sc.pNums[pNum]; ok {
+		vr.Issue(pos, "断面 %v 中P_NUM重复: %v, 第一次出现在 %v:%v", ts, pNum, vr.Path, first)
+	} else {
+		sc.pNums[pNum] = pos
+	}
+}
+
+// checkUint16 检查写入 uint16_t 字段的整数列, 超出范围时会被截断
+func checkUint16(vr *ValidateReport, pos interface{}, name string, value string) {
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err == nil && (v < 0 || v > 65535) {
+		vr.Issue(pos, "%v超出uint16范围: %v", name, v)
+	}
+}
+
+// checkCharArray 检查写入定长 char 数组的字符串列, 需要给结尾的'\0'留出一个字节
+func checkCharArray(vr *ValidateReport, pos interface{}, name string, value string, size int) {
+	if len(value) > size {
+		vr.Issue(pos, "%v长度为 %v 字节, 超过C结构体中的 char[%v], 会被截断", name, len(value), size)
+	} else if len(value) == size {
+		vr.Issue(pos, "%v长度为 %v 字节, 填满了C结构体中的 char[%v], 没有结尾的'\\0'", name, len(value), size)
+	}
+}
+
+// trimParseError ParseAnalogRecord 等函数返回的错误以换行结尾
+func trimParseError(err error) string {
+	return strings.TrimSpace(err.Error())
+}
+
+// DetectValidateKind 判断文件的数据类型, 数据集读取文件头, 其余文件与prepare相同
+func DetectValidateKind(path string) (uint32, error) {
+	if !IsDatasetFile(path) {
+		return DetectCsvKind(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+	header := make([]byte, len(DatasetMagic)+8)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return 0, err
+	}
+	d := &HostDecoder{buf: header[len(DatasetMagic):]}
+	_ = d.Int32()
+	kind := uint32(d.Int32())
+	if _, ok := DatasetKinds[kind]; !ok {
+		return 0, fmt.Errorf("未知的数据集类型: %v", kind)
+	}
+	return kind, nil
+}
+
+// ValidateFile 校验一个文件, 返回校验结果; 文件无法打开时返回错误
+func ValidateFile(path string, kind uint32, maxIssues int64) (*ValidateReport, error) {
+	vr := &ValidateReport{Path: path, Kind: kind, MaxIssues: maxIssues}
+	var err error
+	if IsDatasetFile(path) {
+		err = validateDataset(vr)
+	} else if format := DetectColumnar(path); format != ColumnarNone {
+		err = validateColumnar(vr, format)
+	} else {
+		err = validateCsv(vr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if vr.Rows == 0 {
+		vr.Issue(0, "没有数据行")
+	}
+	return vr, nil
+}
+
+// validateCsv 逐行校验CSV文件, 解析方式与写入命令相同
+func validateCsv(vr *ValidateReport) error {
+	file, err := OpenCsvFile(vr.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := csv.NewReader(NewCRFilterReader(bufio.NewReader(file)))
+	reader.FieldsPerRecord = -1
+
+	columns := KindColumns(vr.Kind)
+	mapper := NewCsvRecordMapper(vr.Kind)
+	checker := &sectionChecker{report: vr}
+	first := true
+	width := len(columns) // 每行的列数, 有表头时与表头相同
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			vr.Issue(parseErr.Line, "CSV格式错误: %v", parseErr.Err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+
+		// 表头按列名映射, 写入命令会跳过表头
+		if mapper.IsHeader(record) {
+			if !first {
+				vr.Issue(line, "重复的表头")
+			} else if _, err := mapper.Map(record); err != nil {
+				vr.Issue(line, "%v, 写入命令无法读取这个文件", err)
+				return nil
+			}
+			width = len(record)
+			first = false
+			continue
+		}
+		first = false
+
+		if len(record) != width {
+			vr.Issue(line, "列数错误: %v, 应为 %v, 写入命令会跳过这一行", len(record), width)
+			continue
+		}
+		if record, err = mapper.Map(record); err != nil {
+			vr.Issue(line, "%v, 写入命令会跳过这一行", err)
+			continue
+		}
+
+		switch vr.Kind {
+		case DatasetAnalog, DatasetDigital:
+			if len(record[9]) != 1 {
+				vr.Issue(line, "TEW长度必须为1: %q", record[9])
+				continue
+			}
+			var ts int64
+			if vr.Kind == DatasetAnalog {
+				ts, _, err = ParseAnalogRecord(record)
+			} else {
+				ts, _, err = ParseDigitalRecord(record)
+			}
+			if err != nil {
+				vr.Issue(line, "解析失败: %v", trimParseError(err))
+				continue
+			}
+			checkUint16(vr, line, "CST", record[10])
+			pNum, _ := strconv.ParseInt(record[1], 10, 64)
+			checker.Check(line, ts, pNum)
+		case DatasetStaticAnalog:
+			if _, err := ParseStaticAnalogRecord(record); err != nil {
+				vr.Issue(line, "解析失败: %v", trimParseError(err))
+				continue
+			}
+			checkUint16(vr, line, "TAGT", record[1])
+			checkUint16(vr, line, "FACK", record[2])
+			checkCharArray(vr, line, "CHN", record[11], 32)
+			checkCharArray(vr, line, "PN", record[12], 32)
+			checkCharArray(vr, line, "DESC", record[13], 128)
+			checkCharArray(vr, line, "UNIT", record[14], 32)
+			pNum, _ := strconv.ParseInt(record[0], 10, 64)
+			checker.Check(line, -1, pNum)
+		case DatasetStaticDigital:
+			if _, err := ParseStaticDigitalRecord(record); err != nil {
+				vr.Issue(line, "解析失败: %v", trimParseError(err))
+				continue
+			}
+			checkUint16(vr, line, "FACK", record[1])
+			checkCharArray(vr, line, "CHN", record[2], 32)
+			checkCharArray(vr, line, "PN", record[3], 32)
+			checkCharArray(vr, line, "DESC", record[4], 128)
+			checkCharArray(vr, line, "UNIT", record[5], 32)
+			pNum, _ := strconv.ParseInt(record[0], 10, 64)
+			checker.Check(line, -1, pNum)
+		}
+	}
+}
+
+// validateColumnar 校验 Parquet / Arrow IPC 文件, 位置为数据行的序号
+func validateColumnar(vr *ValidateReport, format string) error {
+	if vr.Kind != DatasetAnalog && vr.Kind != DatasetDigital {
+		return fmt.Errorf("%v 文件只支持模拟量和数字量", format)
+	}
+	src, err := OpenColumnar(vr.Path, format, vr.Kind)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	checker := &sectionChecker{report: vr}
+	row := int64(0)
+	for {
+		batch, err := src.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for i := 0; i < batch.Rows; i++ {
+			row++
+			pos := "#" + strconv.FormatInt(row, 10)
+			var ts int64
+			if vr.Kind == DatasetAnalog {
+				ts, _, err = ParseAnalogRow(batch, i)
+			} else {
+				ts, _, err = ParseDigitalRow(batch, i)
+			}
+			if err != nil {
+				vr.Issue(pos, "解析失败: %v", err)
+				continue
+			}
+			if cst, err := batch.Columns[10].Int(i); err == nil && (cst < 0 || cst > 65535) {
+				vr.Issue(pos, "CST超出uint16范围: %v", cst)
+			}
+			pNum, _ := batch.Columns[1].Int(i)
+			checker.Check(pos, ts, pNum)
+		}
+	}
+}
+
+// validateDataset 校验预编译数据集, 结构体中的字段已经是C类型, 只检查时间戳和P_NUM
+func validateDataset(vr *ValidateReport) error {
+	ds, err := OpenDataset(vr.Path, vr.Kind)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = ds.Close() }()
+	checker := &sectionChecker{report: vr}
+	row := int64(0)
+	check := func(ts int64, pNum int64) {
+		row++
+		checker.Check("#"+strconv.FormatInt(row, 10), ts, pNum)
+	}
+	switch vr.Kind {
+	case DatasetAnalog:
+		for i := range ds.Index {
+			section := ds.AnalogSection(i)
+			for _, analog := range section.Data {
+				check(section.Time, int64(analog.p_num))
+			}
+		}
+	case DatasetDigital:
+		for i := range ds.Index {
+			section := ds.DigitalSection(i)
+			for _, digital := range section.Data {
+				check(section.Time, int64(digital.p_num))
+			}
+		}
+	case DatasetStaticAnalog:
+		for _, staticAnalog := range ds.StaticAnalogSection().Data {
+			check(-1, int64(staticAnalog.p_num))
+		}
+	case DatasetStaticDigital:
+		for _, staticDigital := range ds.StaticDigitalSection().Data {
+			check(-1, int64(staticDigital.p_num))
+		}
+	}
+	return nil
+}
+
+// ValidateInput 写入命令的一个输入文件
+type ValidateInput struct {
+	Path string
+	Kind uint32
+}
+
+// ValidateInputs 校验写入命令的输入文件(--strict), 路径为空的文件跳过, 所有文件都没有问题时返回true
+func ValidateInputs(inputs ...ValidateInput) bool {
+	ok := true
+	for _, input := range inputs {
+		if input.Path == "" {
+			continue
+		}
+		vr, err := ValidateFile(input.Path, input.Kind, 100)
+		if err != nil {
+			log.Printf("%v: 校验失败: %v\n", input.Path, err)
+			ok = false
+			continue
+		}
+		vr.Print()
+		ok = ok && vr.Issues == 0
+	}
+	return ok
+}
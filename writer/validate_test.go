@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// staticAnalogRow 静态模拟量CSV行
+func staticAnalogRow(pNum int, chn string, desc string) []string {
+	return []string{strconv.Itoa(pNum), "1", "0", "false", "false", "false", "false", "false", "false", "false", "false", chn, "pn", desc, "m", "100", "0"}
+}
+
+// staticDigitalRow 静态数字量CSV行
+func staticDigitalRow(pNum int, desc string, unit string) []string {
+	return []string{strconv.Itoa(pNum), "0", "chn", "pn", desc, unit}
+}
+
+// withRow 复制一行并替换其中一列
+func withRow(row []string, index int, value string) []string {
+	row = append([]string{}, row...)
+	row[index] = value
+	return row
+}
+
+// captureLog 运行 f 期间的日志输出
+func captureLog(t *testing.T, f func()) string {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+	f()
+	return buf.String()
+}
+
+// issueLine 日志中以 path:line: 开头的问题, 没有时返回空字符串
+func issueLine(output string, path string, line int) string {
+	prefix := fmt.Sprintf("%v:%v: ", path, line)
+	for _, s := range strings.Split(output, "\n") {
+		if i := strings.Index(s, prefix); i >= 0 {
+			return s[i+len(prefix):]
+		}
+	}
+	return ""
+}
+
+func TestValidateFile(t *testing.T) {
+	// 每个用例的前两行数据正确, 第三行数据(文件的第4行)最多有一个问题
+	tests := []struct {
+		name string
+		kind uint32
+		good [][]string
+		bad  []string
+		want string // 第4行的问题, 为空时没有问题
+	}{
+		{
+			name: "analog column count",
+			kind: DatasetAnalog,
+			bad:  analogRow(2000, 1)[:10],
+			want: "列数错误: 10, 应为 11",
+		},
+		{
+			name: "analog value",
+			kind: DatasetAnalog,
+			bad:  withRow(analogRow(2000, 1), 2, "abc"),
+			want: "解析失败: parse av error abc",
+		},
+		{
+			name: "digital value",
+			kind: DatasetDigital,
+			bad:  withRow(digitalRow(2000, 1), 2, "x"),
+			want: "解析失败",
+		},
+		{
+			name: "time goes backwards",
+			kind: DatasetAnalog,
+			bad:  analogRow(999, 3),
+			want: "时间戳不是单调递增: 999 出现在 1000 之后",
+		},
+		{
+			name: "duplicate P_NUM",
+			kind: DatasetAnalog,
+			bad:  analogRow(1000, 1),
+			want: "断面 1000 中P_NUM重复: 1, 第一次出现在 ",
+		},
+		{
+			name: "same P_NUM in the next section",
+			kind: DatasetAnalog,
+			bad:  analogRow(2000, 1),
+		},
+		{
+			name: "largest P_NUM",
+			kind: DatasetDigital,
+			bad:  digitalRow(1000, MaxPNum),
+		},
+		{
+			name: "P_NUM over 21 bits",
+			kind: DatasetDigital,
+			bad:  digitalRow(1000, MaxPNum+1),
+			want: "P_NUM超出范围: 2097152",
+		},
+		{
+			name: "negative P_NUM",
+			kind: DatasetAnalog,
+			bad:  analogRow(1000, -1),
+			want: "P_NUM超出范围: -1",
+		},
+		{
+			name: "empty TEW",
+			kind: DatasetAnalog,
+			bad:  withRow(analogRow(2000, 1), 9, ""),
+			want: "TEW长度必须为1",
+		},
+		{
+			name: "long TEW",
+			kind: DatasetDigital,
+			bad:  withRow(digitalRow(2000, 1), 9, "AB"),
+			want: `TEW长度必须为1: "AB"`,
+		},
+		{
+			name: "CST over uint16",
+			kind: DatasetAnalog,
+			bad:  withRow(analogRow(2000, 1), 10, "65536"),
+			want: "CST超出uint16范围: 65536",
+		},
+		{
+			name: "static analog CHN leaves room for NUL",
+			kind: DatasetStaticAnalog,
+			good: [][]string{staticAnalogRow(1, "a", "d"), staticAnalogRow(2, "b", "d")},
+			bad:  staticAnalogRow(3, strings.Repeat("c", 31), "d"),
+		},
+		{
+			name: "static analog CHN fills char[32]",
+			kind: DatasetStaticAnalog,
+			good: [][]string{staticAnalogRow(1, "a", "d"), staticAnalogRow(2, "b", "d")},
+			bad:  staticAnalogRow(3, strings.Repeat("c", 32), "d"),
+			want: `CHN长度为 32 字节, 填满了C结构体中的 char[32], 没有结尾的'\0'`,
+		},
+		{
+			name: "static analog CHN over char[32]",
+			kind: DatasetStaticAnalog,
+			good: [][]string{staticAnalogRow(1, "a", "d"), staticAnalogRow(2, "b", "d")},
+			bad:  staticAnalogRow(3, strings.Repeat("c", 33), "d"),
+			want: "CHN长度为 33 字节, 超过C结构体中的 char[32], 会被截断",
+		},
+		{
+			name: "static analog DESC leaves room for NUL",
+			kind: DatasetStaticAnalog,
+			good: [][]string{staticAnalogRow(1, "a", "d"), staticAnalogRow(2, "b", "d")},
+			bad:  staticAnalogRow(3, "c", strings.Repeat("d", 127)),
+		},
+		{
+			name: "static analog DESC fills char[128]",
+			kind: DatasetStaticAnalog,
+			good: [][]string{staticAnalogRow(1, "a", "d"), staticAnalogRow(2, "b", "d")},
+			bad:  staticAnalogRow(3, "c", strings.Repeat("d", 128)),
+			want: `DESC长度为 128 字节, 填满了C结构体中的 char[128], 没有结尾的'\0'`,
+		},
+		{
+			name: "static digital DESC over char[128]",
+			kind: DatasetStaticDigital,
+			good: [][]string{staticDigitalRow(1, "d", "u"), staticDigitalRow(2, "d", "u")},
+			bad:  staticDigitalRow(3, strings.Repeat("d", 129), "u"),
+			want: "DESC长度为 129 字节, 超过C结构体中的 char[128], 会被截断",
+		},
+		{
+			name: "static digital UNIT fills char[32]",
+			kind: DatasetStaticDigital,
+			good: [][]string{staticDigitalRow(1, "d", "u"), staticDigitalRow(2, "d", "u")},
+			bad:  staticDigitalRow(3, "d", strings.Repeat("u", 32)),
+			want: "UNIT长度为 32 字节, 填满了C结构体中的 char[32]",
+		},
+		{
+			name: "static duplicate P_NUM",
+			kind: DatasetStaticDigital,
+			good: [][]string{staticDigitalRow(1, "d", "u"), staticDigitalRow(2, "d", "u")},
+			bad:  staticDigitalRow(2, "d", "u"),
+			want: "P_NUM重复: 2",
+		},
+		{
+			name: "static analog TAGT over uint16",
+			kind: DatasetStaticAnalog,
+			good: [][]string{staticAnalogRow(1, "a", "d"), staticAnalogRow(2, "b", "d")},
+			bad:  withRow(staticAnalogRow(3, "c", "d"), 1, "70000"),
+			want: "TAGT超出uint16范围: 70000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			good := tt.good
+			if good == nil && tt.kind == DatasetAnalog {
+				good = [][]string{analogRow(1000, 1), analogRow(1000, 2)}
+			} else if good == nil {
+				good = [][]string{digitalRow(1000, 1), digitalRow(1000, 2)}
+			}
+			path := writeCsv(t, "v.csv", KindColumns(tt.kind), append(good, tt.bad)...)
+
+			var vr *ValidateReport
+			var err error
+			output := captureLog(t, func() { vr, err = ValidateFile(path, tt.kind, 0) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vr.Rows < 2 {
+				t.Errorf("rows = %v, want at least the 2 good rows", vr.Rows)
+			}
+			if tt.want == "" {
+				if vr.Issues != 0 {
+					t.Errorf("issues = %v, want 0:\n%v", vr.Issues, output)
+				}
+				return
+			}
+			if vr.Issues != 1 {
+				t.Errorf("issues = %v, want 1:\n%v", vr.Issues, output)
+			}
+			// 问题以 文件:行号 开头, 表头是第1行
+			if issue := issueLine(output, path, 4); !strings.Contains(issue, tt.want) {
+				t.Errorf("issue at %v:4 = %q, want %q\n%v", path, issue, tt.want, output)
+			}
+		})
+	}
+}
+
+func TestValidateFileDuplicatePosition(t *testing.T) {
+	path := writeCsv(t, "v.csv", AnalogColumns, analogRow(1000, 1), analogRow(1000, 2), analogRow(1000, 1))
+	output := captureLog(t, func() {
+		if _, err := ValidateFile(path, DatasetAnalog, 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// 重复的P_NUM同时给出第一次出现的位置
+	if issue := issueLine(output, path, 4); !strings.HasSuffix(issue, path+":2") {
+		t.Errorf("issue = %q, want the first position %v:2", issue, path)
+	}
+}
+
+func TestValidateFileHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []string
+		rows   [][]string
+		line   int
+		want   string
+	}{
+		{
+			name:   "missing required column",
+			header: []string{"TIME", "P_NUM", "AVR"},
+			rows:   [][]string{{"1000", "1", "1"}},
+			line:   1,
+			want:   "写入命令无法读取这个文件",
+		},
+		{
+			name:   "no data rows",
+			header: AnalogColumns,
+			line:   0,
+			want:   "没有数据行",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeCsv(t, "v.csv", tt.header, tt.rows...)
+			var vr *ValidateReport
+			var err error
+			output := captureLog(t, func() { vr, err = ValidateFile(path, DatasetAnalog, 0) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vr.Issues == 0 {
+				t.Errorf("no issues, want %q", tt.want)
+			}
+			if issue := issueLine(output, path, tt.line); !strings.Contains(issue, tt.want) {
+				t.Errorf("issue at %v:%v = %q, want %q\n%v", path, tt.line, issue, tt.want, output)
+			}
+		})
+	}
+}
+
+func TestValidateFileMaxIssues(t *testing.T) {
+	rows := make([][]string, 0)
+	for i := 0; i < 5; i++ {
+		rows = append(rows, withRow(analogRow(1000, i), 9, ""))
+	}
+	path := writeCsv(t, "v.csv", AnalogColumns, rows...)
+	var vr *ValidateReport
+	output := captureLog(t, func() {
+		var err error
+		if vr, err = ValidateFile(path, DatasetAnalog, 2); err != nil {
+			t.Fatal(err)
+		}
+		vr.Print()
+	})
+	// 超过 MaxIssues 的问题只计数, 不输出
+	if vr.Issues != 6 || issueLine(output, path, 3) == "" || issueLine(output, path, 4) != "" {
+		t.Errorf("issues = %v, want 6 with only lines 2 and 3 printed:\n%v", vr.Issues, output)
+	}
+	if !strings.Contains(output, "还有 4 个问题没有输出") {
+		t.Errorf("output does not report the hidden issues:\n%v", output)
+	}
+}
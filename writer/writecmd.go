@@ -0,0 +1,257 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// 写入命令的公共参数和流程
+// rt_fast_write, rt_periodic_write, his_fast_write, his_periodic_write 的插件、输入校验、有界写入、时间基准、预加载等参数相同:
+// * WriteOptions 注册并保存公共参数, PeriodicOptions 注册并保存两个周期性写入命令的参数
+// * RunWrite 完成写入前的准备(列名映射、校验、加载插件、登入)和写入后的收尾(flush、等待确认、登出、统计)
+// * 各命令只负责自己特有的参数、写入方式和统计结果
+
+// WriteOptions 写入命令的公共参数
+type WriteOptions struct {
+	// 输入文件, 实时值命令为快采点和普通点, 历史值命令只有普通点
+	FastAnalog    string
+	FastDigital   string
+	NormalAnalog  string
+	NormalDigital string
+	Mode          int64 // 实时值的写入模式: 0表示写快采点+普通点, 1表示只写快采点, 2表示只写普通点
+
+	Plugin        string
+	Param         string
+	Isolate       bool
+	Record        string
+	Strict        bool
+	ColumnMap     string
+	Magic         int32
+	UnitNumber    int64
+	RandomAv      bool
+	FlushEvery    int64
+	Async         bool
+	AlignStrict   bool
+	Preload       bool
+	PreloadWindow int64
+	ReadySections int
+	TimeBase      string
+	Duration      time.Duration
+	MaxSections   int64
+	StartTime     string
+	EndTime       string
+}
+
+// Register 注册公共参数, isRt 为true时注册实时值的输入文件和写入模式, 否则注册历史值的输入文件
+func (o *WriteOptions) Register(cmd *cobra.Command, isRt bool) {
+	flags := cmd.Flags()
+	if isRt {
+		flags.StringVarP(&o.FastAnalog, "rt_fast_analog", "", "", "realtime fast analog csv path")
+		flags.StringVarP(&o.FastDigital, "rt_fast_digital", "", "", "realtime fast digital csv path")
+		flags.StringVarP(&o.NormalAnalog, "rt_normal_analog", "", "", "realtime normal analog csv path")
+		flags.StringVarP(&o.NormalDigital, "rt_normal_digital", "", "", "realtime normal digital csv path")
+		flags.Int64Var(&o.Mode, "mode", 0, "写入模式: 0表示写快采点+普通点, 1表示只写快采点, 2表示只写普通点")
+	} else {
+		flags.StringVarP(&o.NormalAnalog, "his_normal_analog", "", "", "history normal analog csv path")
+		flags.StringVarP(&o.NormalDigital, "his_normal_digital", "", "", "history normal digital csv path")
+	}
+	flags.StringVarP(&o.Plugin, "plugin", "", "", "plugin path")
+	flags.StringVarP(&o.Param, "param", "", "", "custom param")
+	flags.BoolVarP(&o.Isolate, "isolate", "", false, "为true时在独立的插件进程中加载插件, 插件崩溃时写数程序仍然输出统计结果")
+	flags.StringVarP(&o.Record, "record", "", "", "录制文件路径, 不为空时把每次插件调用写入录制文件, 可以通过replay命令回放")
+	flags.BoolVarP(&o.Strict, "strict", "", false, "为true时写入前校验输入文件(与validate命令相同), 有问题时不写入并返回非0的退出码")
+	flags.StringVarP(&o.ColumnMap, "column_map", "", "", "列名映射文件路径, 每行 逻辑列名=文件中的列名 或 default.逻辑列名=默认值, 为空时按标准列名读取")
+	flags.Int32VarP(&o.Magic, "magic", "", 0, "魔数, 默认为0")
+	flags.Int64VarP(&o.UnitNumber, "unit_number", "", 1, "unit number")
+	flags.BoolVarP(&o.RandomAv, "random_av", "", false, "为true表示给av值加一个[0,30]的随机数浮动")
+	flags.Int64VarP(&o.FlushEvery, "flush_every", "", 0, "每写入N个断面调用一次插件的flush, 为0时只在写入结束时调用")
+	flags.BoolVarP(&o.Async, "async", "", false, "为true时通过插件的异步写入函数写入, 额外统计提交到数据库确认的耗时")
+	flags.BoolVarP(&o.AlignStrict, "align_strict", "", false, "为true时模拟量和数字量出现第一个时间戳不对齐的断面就中止写入, 为false时只统计不对齐的断面")
+	flags.BoolVarP(&o.Preload, "preload", "", false, "为true时写入开始前把整个数据集(或前preload_window个断面)读入内存, 写入过程中不等待读取")
+	flags.Int64VarP(&o.PreloadWindow, "preload_window", "", 0, "预加载的断面数量, 为0时预加载整个数据集, 剩余的断面在写入过程中继续读取")
+	flags.IntVarP(&o.ReadySections, "ready_sections", "", 0, "不预加载时, 缓存队列中的断面数量达到N(或读取结束)后开始写入, 为0时与缓存队列长度相同, 最大为缓存队列长度")
+	flags.StringVarP(&o.TimeBase, "time_base", "", "", "断面时间基准: now 或 RFC3339 格式的时间, 最早的断面平移到该时间, 断面之间的相对间隔不变, 为空时直接使用输入文件中的时间")
+	flags.DurationVarP(&o.Duration, "duration", "", 0, "写入时长(例如10m), 从开始写入时计时, 到期后不再写入新的断面, 与读取结束相同输出统计结果, 为0时不限制")
+	flags.Int64VarP(&o.MaxSections, "max_sections", "", 0, "最多写入的断面数量(快采点、普通点分别计数, 循环回放时累计各轮), 为0时不限制")
+	flags.StringVarP(&o.StartTime, "start_time", "", "", "只写入断面时间不早于该时间的断面: 毫秒时间戳或 RFC3339 格式的时间, 与输入文件中的TIME比较, 为空时不限制")
+	flags.StringVarP(&o.EndTime, "end_time", "", "", "只写入断面时间不晚于该时间的断面: 毫秒时间戳或 RFC3339 格式的时间, 与输入文件中的TIME比较, 为空时不限制")
+}
+
+// Inputs 本次写入的输入文件, 实时值按写入模式只取写入的部分, 用于 --strict 校验和 --time_base
+func (o *WriteOptions) Inputs() []ValidateInput {
+	fast := []ValidateInput{{o.FastAnalog, DatasetAnalog}, {o.FastDigital, DatasetDigital}}
+	normal := []ValidateInput{{o.NormalAnalog, DatasetAnalog}, {o.NormalDigital, DatasetDigital}}
+	switch o.Mode {
+	case 1:
+		return fast
+	case 2:
+		return normal
+	default:
+		return append(fast, normal...)
+	}
+}
+
+// PeriodicOptions 周期性写入命令的公共参数
+type PeriodicOptions struct {
+	Config             string
+	OverloadProtection bool
+	Loop               int64
+	LoopUntil          time.Duration
+	NormalPeriodic     time.Duration
+	OverloadDuration   time.Duration
+	OverloadPeriodic   time.Duration
+	CacheSize          int
+	OpenLoop           bool
+
+	// 只有实时值有快采点
+	FastCache      bool
+	FastPeriodic   time.Duration
+	FastCacheBatch int
+}
+
+// Register 注册周期性写入的参数, isRt 为false时历史值只有一个写入周期, 不注册快采点的参数
+func (o *PeriodicOptions) Register(cmd *cobra.Command, isRt bool) {
+	flags := cmd.Flags()
+	flags.StringVarP(&o.Config, "config", "", "", "配置文件路径, 每行 参数名=值, 参数名与命令行参数相同, 命令行指定的参数优先")
+	flags.BoolVarP(&o.OverloadProtection, "overload_protection", "", false, "overload protection flag")
+	flags.Int64VarP(&o.Loop, "loop", "", 1, "循环回放的轮数, 每一轮的断面时间加上数据集的时长, 为0时不限制轮数(需要指定loop_until)")
+	flags.DurationVarP(&o.LoopUntil, "loop_until", "", 0, "循环回放的时长(例如24h), 超过后不再开始新的一轮, 为0时不限制")
+	if isRt {
+		flags.BoolVarP(&o.FastCache, "fast_cache", "", false, "fast cache")
+		flags.DurationVarP(&o.FastPeriodic, "fast_periodic", "", FastRegularWritePeriodic*time.Millisecond, "快采点写入周期, 开启快采点缓存时每批断面的写入周期为 fast_periodic*fast_cache_batch")
+		flags.IntVarP(&o.FastCacheBatch, "fast_cache_batch", "", FastCacheBatchSize, "开启快采点缓存时每次批量写入的断面数量")
+		flags.DurationVarP(&o.NormalPeriodic, "normal_periodic", "", NormalRegularWritePeriodic*time.Millisecond, "普通点写入周期, 不能小于快采点写入周期")
+		flags.DurationVarP(&o.OverloadDuration, "overload_duration", "", OverloadProtectionWriteDuration*time.Millisecond, "开启过载保护时, 普通点按过载保护写入周期写入的时长")
+		flags.DurationVarP(&o.OverloadPeriodic, "overload_periodic", "", OverloadProtectionWritePeriodic*time.Millisecond, "过载保护写入周期, 应小于普通点写入周期且不大于过载保护时长")
+	} else {
+		flags.DurationVarP(&o.NormalPeriodic, "normal_periodic", "", NormalRegularWritePeriodic*time.Millisecond, "历史值写入周期")
+		flags.DurationVarP(&o.OverloadDuration, "overload_duration", "", OverloadProtectionWriteDuration*time.Millisecond, "开启过载保护时, 按过载保护写入周期写入的时长")
+		flags.DurationVarP(&o.OverloadPeriodic, "overload_periodic", "", OverloadProtectionWritePeriodic*time.Millisecond, "过载保护写入周期, 应小于写入周期且不大于过载保护时长")
+	}
+	flags.IntVarP(&o.CacheSize, "cache_size", "", CacheSize, "缓存队列长度(断面数量)")
+	flags.BoolVarP(&o.OpenLoop, "open_loop", "", false, "为true时按计划时间发布断面, 与写入是否完成无关, 延迟从计划发布时间开始计算并统计积压的断面数量")
+}
+
+// Setup 读取配置文件, 设置循环回放和写入节奏, 返回false时参数有误, 已经输出错误信息
+func (o *PeriodicOptions) Setup(cmd *cobra.Command, wo *WriteOptions, isRt bool) bool {
+	// 读取配置文件, 命令行参数优先
+	if err := LoadConfigFile(cmd, o.Config); err != nil {
+		log.Println("加载配置文件失败: ", err)
+		return false
+	}
+
+	// 循环回放参数, 预加载整个数据集时无法循环
+	GlobalLoop.Count = o.Loop
+	GlobalLoop.Until = o.LoopUntil
+	if err := GlobalLoop.Validate(); err != nil {
+		log.Println("循环回放参数错误: ", err)
+		return false
+	}
+	if GlobalLoop.Enabled() && wo.Preload && wo.PreloadWindow <= 0 {
+		log.Println("循环回放参数错误: 循环回放时预加载需要通过 --preload_window 指定预加载的断面数量")
+		return false
+	}
+
+	// 写入节奏, 历史值使用普通点写入周期
+	if isRt {
+		GlobalPeriodic.FastPeriodic = o.FastPeriodic
+		GlobalPeriodic.FastCacheBatch = o.FastCacheBatch
+	}
+	GlobalPeriodic.NormalPeriodic = o.NormalPeriodic
+	GlobalPeriodic.Overload = o.OverloadProtection
+	GlobalPeriodic.OverloadDuration = o.OverloadDuration
+	GlobalPeriodic.OverloadPeriodic = o.OverloadPeriodic
+	GlobalPeriodic.CacheSize = o.CacheSize
+	if err := GlobalPeriodic.Validate(isRt); err != nil {
+		log.Println("写入节奏参数错误: ", err)
+		return false
+	}
+	GlobalOpenLoop.Enabled = o.OpenLoop
+	return true
+}
+
+// RunWrite 写入命令的公共流程
+// 写入前: 加载列名映射, 校验输入文件(--strict), 设置有界写入和时间基准, 加载插件(异步写入时追加 PluginCapAsync), 开始录制, 登入
+// 写入前的任何一步失败都不写入, 以退出码1结束
+// 写入后: 刷新插件缓存, 等待异步确认, 登出, 输出各项统计, 最后由 summary 输出命令自己的统计结果
+func RunWrite(o *WriteOptions, caps uint64, write func(), summary func(start time.Time, flushDuration time.Duration, logoutDuration time.Duration)) {
+	if o.Mode < 0 || o.Mode > 2 {
+		log.Println("写入模式错误: --mode 只能是0、1或2: ", o.Mode)
+		os.Exit(1)
+	}
+
+	// 加载列名映射文件
+	if err := LoadColumnMapping(o.ColumnMap); err != nil {
+		log.Println("加载列名映射文件失败: ", err)
+		os.Exit(1)
+	}
+
+	// 写入前校验输入文件, 有问题时不写入
+	if o.Strict && !ValidateInputs(o.Inputs()...) {
+		log.Println("输入文件校验失败, --strict 模式下不写入")
+		os.Exit(1)
+	}
+
+	// 有界写入: 写入时长、最多断面数量、断面时间窗口
+	if err := GlobalBound.Set(o.Duration, o.MaxSections, o.StartTime, o.EndTime); err != nil {
+		log.Println("有界写入参数错误: ", err)
+		os.Exit(1)
+	}
+
+	// 断面时间平移到 --time_base, 所有输入文件使用同一个偏移
+	if err := GlobalTimeBase.Resolve(o.TimeBase, o.Inputs()...); err != nil {
+		log.Println("断面时间基准错误: ", err)
+		os.Exit(1)
+	}
+
+	// 加载动态库, 异步写入需要插件支持async
+	if o.Async {
+		caps |= PluginCapAsync
+	}
+	if err := InitGlobalPlugin(o.Plugin, o.Isolate, caps); err != nil {
+		log.Println("加载插件失败: ", err)
+		os.Exit(1)
+	}
+	if err := RecordGlobalPlugin(o.Record); err != nil {
+		log.Println("创建录制文件失败: ", err)
+		GlobalPlugin.Close()
+		os.Exit(1)
+	}
+
+	GlobalFlush.Every = o.FlushEvery
+	GlobalAlign.Strict = o.AlignStrict
+	GlobalPreload.Enabled = o.Preload
+	GlobalPreload.Window = o.PreloadWindow
+	GlobalPreload.Ready = o.ReadySections
+	GlobalPlugin.SetAsync(o.Async)
+
+	// 登入, 登入失败时关闭录制文件和插件进程后退出
+	if rtn := GlobalPlugin.Login(o.Param); rtn != 0 {
+		log.Println("登陆失败: ", rtn)
+		GlobalPlugin.Close()
+		os.Exit(1)
+	}
+	start := time.Now()
+	defer func() {
+		// 写入阶段结束, 刷新插件缓存
+		GlobalFlush.Flush()
+		flushDuration := GlobalFlush.Duration()
+		WaitAcks()
+
+		logoutStart := time.Now()
+		GlobalPlugin.Logout()
+		logoutDuration := time.Since(logoutStart)
+		log.Println("logout time: ", logoutDuration)
+		GlobalFlush.Print()
+		GlobalDecompress.Print()
+		GlobalAlign.Print()
+		GlobalPreload.Print()
+		GlobalBound.Print()
+		summary(start, flushDuration, logoutDuration)
+	}()
+
+	write()
+}